@@ -2,11 +2,18 @@ package golang_yaml_advanced
 
 import (
 	"bufio"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"unicode/utf8"
 )
 
 // Schema represents a validation schema for YAML nodes
@@ -17,8 +24,8 @@ type Schema struct {
 	Required             []string           `json:"required,omitempty"`
 	Enum                 []interface{}      `json:"enum,omitempty"`
 	Pattern              string             `json:"pattern,omitempty"`
-	MinLength            *int               `json:"minLength,omitempty"`
-	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"` // in characters, not bytes
+	MaxLength            *int               `json:"maxLength,omitempty"` // in characters, not bytes
 	Minimum              *float64           `json:"minimum,omitempty"`
 	Maximum              *float64           `json:"maximum,omitempty"`
 	MinItems             *int               `json:"minItems,omitempty"`
@@ -32,6 +39,15 @@ type Schema struct {
 	AnyOf                []*Schema          `json:"anyOf,omitempty"`
 	AllOf                []*Schema          `json:"allOf,omitempty"`
 	Not                  *Schema            `json:"not,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Definitions          map[string]*Schema `json:"definitions,omitempty"`
+	If                   *Schema            `json:"if,omitempty"`
+	Then                 *Schema            `json:"then,omitempty"`
+	Else                 *Schema            `json:"else,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Examples             []interface{}      `json:"examples,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	ContentMediaType     string             `json:"contentMediaType,omitempty"`
 }
 
 // ValidationError represents a schema validation error
@@ -40,21 +56,63 @@ type ValidationError struct {
 	Message    string
 	SchemaPath string
 	Value      interface{}
+
+	advisory bool // reported by a format or content check, a warning for ValidateWithSeverity
 }
 
 func (e ValidationError) Error() string {
 	return fmt.Sprintf("Validation error at %s: %s (value: %v)", e.Path, e.Message, e.Value)
 }
 
-// Validate checks if a node conforms to the schema
+// Validate checks if a node conforms to the schema. Internal references such as
+// $ref: '#/definitions/Foo' are resolved against the Definitions of s, and a
+// reference that leads back to itself for the same node is reported as circular.
 func (s *Schema) Validate(node *Node, path string) []ValidationError {
+	return s.validate(node, path, &schemaContext{root: s, active: make(map[schemaRefVisit]bool)})
+}
+
+// ValidationIssue is a validation error ranked by severity
+type ValidationIssue struct {
+	ValidationError
+	Severity Severity
+}
+
+func (i ValidationIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Severity, i.ValidationError.Error())
+}
+
+// ValidateWithSeverity validates node like Validate and ranks every failure, so a
+// schema can be adopted gradually. Format and content encoding or media type checks
+// are recommendations reported as warnings; violations of type, required properties
+// and all other constraints are errors.
+func (s *Schema) ValidateWithSeverity(node *Node, path string) []ValidationIssue {
+	errs := s.Validate(node, path)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	issues := make([]ValidationIssue, len(errs))
+	for i, err := range errs {
+		issues[i] = ValidationIssue{ValidationError: err, Severity: SeverityError}
+		if err.advisory {
+			issues[i].Severity = SeverityWarning
+		}
+	}
+	return issues
+}
+
+func (s *Schema) validate(node *Node, path string, ctx *schemaContext) []ValidationError {
 	var errors []ValidationError
 
+	if s.Ref != "" {
+		errors = append(errors, s.validateRef(node, path, ctx)...)
+	}
+
 	if node == nil {
 		if s.Type != "" && s.Type != "null" {
 			errors = append(errors, ValidationError{
 				Path:    path,
-				Message: fmt.Sprintf("expected type %s but got null", s.Type),
+				Message: s.describe(fmt.Sprintf("expected type %s but got null", s.Type)),
 				Value:   nil,
 			})
 		}
@@ -67,7 +125,7 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 		if !matchesType(nodeType, s.Type) {
 			errors = append(errors, ValidationError{
 				Path:    path,
-				Message: fmt.Sprintf("expected type %s but got %s", s.Type, nodeType),
+				Message: s.describe(fmt.Sprintf("expected type %s but got %s", s.Type, nodeType)),
 				Value:   node.Value,
 			})
 			return errors // Type mismatch, no point in further validation
@@ -79,7 +137,7 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 		if !isInEnum(node, s.Enum) {
 			errors = append(errors, ValidationError{
 				Path:    path,
-				Message: fmt.Sprintf("value must be one of enum values %v", s.Enum),
+				Message: s.describe(fmt.Sprintf("value must be one of enum values %v", s.Enum)),
 				Value:   node.Value,
 			})
 		}
@@ -88,28 +146,29 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 	// String validations
 	if node.Kind == ScalarNode && s.Type == "string" {
 		str := fmt.Sprintf("%v", node.Value)
+		length := utf8.RuneCountInString(str)
 
-		if s.MinLength != nil && len(str) < *s.MinLength {
+		if s.MinLength != nil && length < *s.MinLength {
 			errors = append(errors, ValidationError{
 				Path:    path,
-				Message: fmt.Sprintf("string length %d is less than minimum %d", len(str), *s.MinLength),
+				Message: s.describe(fmt.Sprintf("string length %d is less than minimum %d", length, *s.MinLength)),
 				Value:   node.Value,
 			})
 		}
 
-		if s.MaxLength != nil && len(str) > *s.MaxLength {
+		if s.MaxLength != nil && length > *s.MaxLength {
 			errors = append(errors, ValidationError{
 				Path:    path,
-				Message: fmt.Sprintf("string length %d exceeds maximum %d", len(str), *s.MaxLength),
+				Message: s.describe(fmt.Sprintf("string length %d exceeds maximum %d", length, *s.MaxLength)),
 				Value:   node.Value,
 			})
 		}
 
 		if s.Pattern != "" {
-			if matched, _ := regexp.MatchString(s.Pattern, str); !matched {
+			if re := cachedRegexp(s.Pattern); re == nil || !re.MatchString(str) {
 				errors = append(errors, ValidationError{
 					Path:    path,
-					Message: fmt.Sprintf("string does not match pattern %s", s.Pattern),
+					Message: s.describe(fmt.Sprintf("string does not match pattern %s", s.Pattern)),
 					Value:   node.Value,
 				})
 			}
@@ -118,9 +177,21 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 		if s.Format != "" {
 			if !validateFormat(str, s.Format) {
 				errors = append(errors, ValidationError{
-					Path:    path,
-					Message: fmt.Sprintf("string does not match format %s", s.Format),
-					Value:   node.Value,
+					Path:     path,
+					Message:  s.describe(fmt.Sprintf("string does not match format %s", s.Format)),
+					Value:    node.Value,
+					advisory: true,
+				})
+			}
+		}
+
+		if s.ContentEncoding != "" || s.ContentMediaType != "" {
+			if msg := validateContent(str, s.ContentEncoding, s.ContentMediaType); msg != "" {
+				errors = append(errors, ValidationError{
+					Path:     path,
+					Message:  s.describe(msg),
+					Value:    node.Value,
+					advisory: true,
 				})
 			}
 		}
@@ -132,7 +203,7 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 			if s.Minimum != nil && num < *s.Minimum {
 				errors = append(errors, ValidationError{
 					Path:    path,
-					Message: fmt.Sprintf("value %f is less than minimum %f", num, *s.Minimum),
+					Message: s.describe(fmt.Sprintf("value %f is less than minimum %f", num, *s.Minimum)),
 					Value:   node.Value,
 				})
 			}
@@ -140,7 +211,7 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 			if s.Maximum != nil && num > *s.Maximum {
 				errors = append(errors, ValidationError{
 					Path:    path,
-					Message: fmt.Sprintf("value %f exceeds maximum %f", num, *s.Maximum),
+					Message: s.describe(fmt.Sprintf("value %f exceeds maximum %f", num, *s.Maximum)),
 					Value:   node.Value,
 				})
 			}
@@ -161,7 +232,7 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 			if !existingKeys[required] {
 				errors = append(errors, ValidationError{
 					Path:    path,
-					Message: fmt.Sprintf("required property '%s' is missing", required),
+					Message: s.describe(fmt.Sprintf("required property '%s' is missing", required)),
 					Value:   nil,
 				})
 			}
@@ -174,11 +245,11 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 
 			if keyNode.Kind == ScalarNode {
 				key := fmt.Sprintf("%v", keyNode.Value)
-				childPath := fmt.Sprintf("%s.%s", path, key)
+				childPath := path + pathKey(key)
 
 				if propSchema, ok := s.Properties[key]; ok {
 					// Validate against specific property schema
-					propErrors := propSchema.Validate(valueNode, childPath)
+					propErrors := propSchema.validate(valueNode, childPath, ctx)
 					errors = append(errors, propErrors...)
 				} else if s.AdditionalProperties != nil {
 					// Handle additional properties
@@ -192,7 +263,7 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 							})
 						}
 					case *Schema:
-						propErrors := ap.Validate(valueNode, childPath)
+						propErrors := ap.validate(valueNode, childPath, ctx)
 						errors = append(errors, propErrors...)
 					}
 				}
@@ -207,7 +278,7 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 		if s.MinItems != nil && arrayLen < *s.MinItems {
 			errors = append(errors, ValidationError{
 				Path:    path,
-				Message: fmt.Sprintf("array length %d is less than minimum %d", arrayLen, *s.MinItems),
+				Message: s.describe(fmt.Sprintf("array length %d is less than minimum %d", arrayLen, *s.MinItems)),
 				Value:   arrayLen,
 			})
 		}
@@ -215,7 +286,7 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 		if s.MaxItems != nil && arrayLen > *s.MaxItems {
 			errors = append(errors, ValidationError{
 				Path:    path,
-				Message: fmt.Sprintf("array has too many items: %d (maximum %d)", arrayLen, *s.MaxItems),
+				Message: s.describe(fmt.Sprintf("array has too many items: %d (maximum %d)", arrayLen, *s.MaxItems)),
 				Value:   arrayLen,
 			})
 		}
@@ -239,7 +310,7 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 		if s.Items != nil {
 			for i, child := range node.Children {
 				childPath := fmt.Sprintf("%s[%d]", path, i)
-				itemErrors := s.Items.Validate(child, childPath)
+				itemErrors := s.Items.validate(child, childPath, ctx)
 				errors = append(errors, itemErrors...)
 			}
 		}
@@ -249,14 +320,14 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 	if len(s.OneOf) > 0 {
 		validCount := 0
 		for _, schema := range s.OneOf {
-			if len(schema.Validate(node, path)) == 0 {
+			if len(schema.validate(node, path, ctx)) == 0 {
 				validCount++
 			}
 		}
 		if validCount != 1 {
 			errors = append(errors, ValidationError{
 				Path:    path,
-				Message: fmt.Sprintf("value must match exactly one schema (matched %d)", validCount),
+				Message: s.describe(fmt.Sprintf("value must match exactly one schema (matched %d)", validCount)),
 				Value:   node.Value,
 			})
 		}
@@ -265,14 +336,14 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 	if len(s.AnyOf) > 0 {
 		validCount := 0
 		for _, schema := range s.AnyOf {
-			if len(schema.Validate(node, path)) == 0 {
+			if len(schema.validate(node, path, ctx)) == 0 {
 				validCount++
 			}
 		}
 		if validCount == 0 {
 			errors = append(errors, ValidationError{
 				Path:    path,
-				Message: "value must match at least one schema",
+				Message: s.describe("value must match at least one schema"),
 				Value:   node.Value,
 			})
 		}
@@ -280,24 +351,172 @@ func (s *Schema) Validate(node *Node, path string) []ValidationError {
 
 	if len(s.AllOf) > 0 {
 		for _, schema := range s.AllOf {
-			subErrors := schema.Validate(node, path)
+			subErrors := schema.validate(node, path, ctx)
 			errors = append(errors, subErrors...)
 		}
 	}
 
 	if s.Not != nil {
-		if len(s.Not.Validate(node, path)) == 0 {
+		if len(s.Not.validate(node, path, ctx)) == 0 {
 			errors = append(errors, ValidationError{
 				Path:    path,
-				Message: "value must not match the schema",
+				Message: s.describe("value must not match the schema"),
 				Value:   node.Value,
 			})
 		}
 	}
 
+	// Conditional validation: If only selects the branch and never reports errors itself
+	if s.If != nil {
+		branch := s.Else
+		if len(s.If.validate(node, path, ctx)) == 0 {
+			branch = s.Then
+		}
+		if branch != nil {
+			errors = append(errors, branch.validate(node, path, ctx)...)
+		}
+	}
+
 	return errors
 }
 
+// describe adds the schema's title and first example to a validation message
+func (s *Schema) describe(message string) string {
+	if s.Title != "" {
+		message = s.Title + ": " + message
+	}
+	if len(s.Examples) > 0 {
+		message = fmt.Sprintf("%s, e.g. %v", message, s.Examples[0])
+	}
+	return message
+}
+
+// schemaContext carries the root schema used to resolve references during validation
+type schemaContext struct {
+	root   *Schema
+	active map[schemaRefVisit]bool
+}
+
+// schemaRefVisit identifies a reference being validated against a node
+type schemaRefVisit struct {
+	ref  string
+	node *Node
+}
+
+// validateRef validates node against the schema s.Ref points to
+func (s *Schema) validateRef(node *Node, path string, ctx *schemaContext) []ValidationError {
+	var value interface{}
+	if node != nil {
+		value = node.Value
+	}
+
+	target, err := ctx.resolve(s.Ref)
+	if err != nil {
+		return []ValidationError{{Path: path, Message: err.Error(), SchemaPath: s.Ref, Value: value}}
+	}
+
+	visit := schemaRefVisit{ref: s.Ref, node: node}
+	if ctx.active[visit] {
+		return []ValidationError{{
+			Path:       path,
+			Message:    fmt.Sprintf("circular $ref %s", s.Ref),
+			SchemaPath: s.Ref,
+			Value:      value,
+		}}
+	}
+	ctx.active[visit] = true
+	defer delete(ctx.active, visit)
+
+	return target.validate(node, path, ctx)
+}
+
+// resolve looks up an internal reference: # for the root schema or
+// #/definitions/Name for one of its definitions
+func (ctx *schemaContext) resolve(ref string) (*Schema, error) {
+	if ref == "#" {
+		return ctx.root, nil
+	}
+	name := strings.TrimPrefix(ref, "#/definitions/")
+	if name == ref || name == "" {
+		return nil, fmt.Errorf("unsupported $ref %s", ref)
+	}
+	// Unescape JSON pointer tokens
+	name = strings.NewReplacer("~1", "/", "~0", "~").Replace(name)
+	definition, ok := ctx.root.Definitions[name]
+	if !ok || definition == nil {
+		return nil, fmt.Errorf("undefined $ref %s", ref)
+	}
+	return definition, nil
+}
+
+// Annotate documents node from the schema: every mapping key that has a property
+// schema with a Description and no head comment of its own gets the description as
+// its head comment. Nested mappings and sequence items are annotated from their
+// property and items schemas, following internal $ref references. Existing comments
+// are left unchanged.
+func (s *Schema) Annotate(node *Node) {
+	s.annotate(documentContent(node), &schemaContext{root: s})
+}
+
+func (s *Schema) annotate(node *Node, ctx *schemaContext) {
+	if node == nil {
+		return
+	}
+	s, _ = ctx.follow(s)
+	if s == nil {
+		return
+	}
+
+	switch node.Kind {
+	case MappingNode:
+		for i := 0; i < len(node.Children)-1; i += 2 {
+			key := node.Children[i]
+			if key.Kind != ScalarNode {
+				continue
+			}
+			property, description := ctx.follow(s.Properties[fmt.Sprintf("%v", key.Value)])
+			if property == nil {
+				continue
+			}
+			if len(key.HeadComment) == 0 && description != "" {
+				for _, line := range strings.Split(strings.TrimSpace(description), "\n") {
+					key.HeadComment = append(key.HeadComment, strings.TrimSpace("# "+strings.TrimSpace(line)))
+				}
+			}
+			property.annotate(node.Children[i+1], ctx)
+		}
+	case SequenceNode:
+		if s.Items != nil {
+			for _, item := range node.Children {
+				s.Items.annotate(item, ctx)
+			}
+		}
+	}
+}
+
+// follow resolves the internal $ref chain starting at s and returns the schema it ends
+// at, along with the first description found on the way. Unresolvable and circular
+// references end the chain.
+func (ctx *schemaContext) follow(s *Schema) (*Schema, string) {
+	var description string
+	seen := make(map[*Schema]bool)
+	for s != nil {
+		if description == "" {
+			description = s.Description
+		}
+		if s.Ref == "" || seen[s] {
+			break
+		}
+		seen[s] = true
+		target, err := ctx.resolve(s.Ref)
+		if err != nil {
+			break
+		}
+		s = target
+	}
+	return s, description
+}
+
 // Helper functions for schema validation
 func getNodeType(node *Node) string {
 	switch node.Kind {
@@ -374,18 +593,19 @@ func nodeToString(node *Node) string {
 	return fmt.Sprintf("%v", node.Value)
 }
 
+// nodeToInterface converts node to plain Go values. Scalars with an explicit core tag
+// keep the type it names, so !!str "007" stays the string "007" and !!int 0x1F is 31.
 func nodeToInterface(node *Node) interface{} {
 	if node == nil {
 		return nil
 	}
 	switch node.Kind {
 	case ScalarNode:
-		return node.Value
+		return taggedScalarValue(node)
 	case MappingNode:
 		result := make(map[string]interface{})
 		for i := 0; i < len(node.Children)-1; i += 2 {
-			key := fmt.Sprintf("%v", node.Children[i].Value)
-			result[key] = nodeToInterface(node.Children[i+1])
+			result[mapKeyString(node.Children[i])] = nodeToInterface(node.Children[i+1])
 		}
 		return result
 	case SequenceNode:
@@ -399,31 +619,149 @@ func nodeToInterface(node *Node) interface{} {
 	}
 }
 
+// taggedScalarValue returns the value of a scalar converted to the type of its core
+// tag: string for !!str, int64 for !!int, float64 for !!float, bool for !!bool and nil
+// for !!null. Values that cannot be converted, and scalars with other tags, are
+// returned unchanged.
+func taggedScalarValue(node *Node) interface{} {
+	value := node.Value
+	switch node.Tag {
+	case "!!str":
+		if _, ok := value.(string); ok {
+			return value
+		}
+		if node.hasCurrentRawValue() {
+			return node.RawValue
+		}
+		if value == nil {
+			return ""
+		}
+		return fmt.Sprintf("%v", value)
+	case "!!int":
+		switch v := value.(type) {
+		case int:
+			return int64(v)
+		case float64:
+			if v == math.Trunc(v) {
+				return int64(v)
+			}
+		case string:
+			// Base 0 accepts the 0x, 0o and 0b prefixes and _ separators
+			if i, err := strconv.ParseInt(strings.TrimSpace(v), 0, 64); err == nil {
+				return i
+			}
+		}
+	case "!!float":
+		// The source text keeps spellings such as .inf that are not decoded
+		if node.hasCurrentRawValue() {
+			if f, ok := parseYAMLFloat(node.RawValue); ok {
+				return f
+			}
+		}
+		switch v := value.(type) {
+		case int:
+			return float64(v)
+		case int64:
+			return float64(v)
+		case string:
+			if f, ok := parseYAMLFloat(v); ok {
+				return f
+			}
+		}
+	case "!!bool":
+		if v, ok := value.(string); ok {
+			if b, ok := yaml11Bool(v); ok {
+				return b
+			}
+		}
+	case "!!null":
+		return nil
+	}
+	return value
+}
+
+// parseYAMLFloat parses a float including the YAML spellings of infinity and NaN
+func parseYAMLFloat(s string) (float64, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case ".inf", "+.inf":
+		return math.Inf(1), true
+	case "-.inf":
+		return math.Inf(-1), true
+	case ".nan":
+		return math.NaN(), true
+	}
+	f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), "_", ""), 64)
+	return f, err == nil
+}
+
+// Compiled regular expressions for the built-in string formats
+var (
+	emailRegex    = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+$`)
+	urlRegex      = regexp.MustCompile(`^(https?|ftp)://[^\s/$.?#].[^\s]*$`)
+	ipv4Regex     = regexp.MustCompile(`^((25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.){3}(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)$`)
+	ipv6Regex     = regexp.MustCompile(`^(([0-9a-fA-F]{1,4}:){7,7}[0-9a-fA-F]{1,4}|([0-9a-fA-F]{1,4}:){1,7}:|([0-9a-fA-F]{1,4}:){1,6}:[0-9a-fA-F]{1,4}|([0-9a-fA-F]{1,4}:){1,5}(:[0-9a-fA-F]{1,4}){1,2}|([0-9a-fA-F]{1,4}:){1,4}(:[0-9a-fA-F]{1,4}){1,3}|([0-9a-fA-F]{1,4}:){1,3}(:[0-9a-fA-F]{1,4}){1,4}|([0-9a-fA-F]{1,4}:){1,2}(:[0-9a-fA-F]{1,4}){1,5}|[0-9a-fA-F]{1,4}:((:[0-9a-fA-F]{1,4}){1,6})|:((:[0-9a-fA-F]{1,4}){1,7}|:))$`)
+	uuidRegex     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	dateRegex     = regexp.MustCompile(`^\d{4}-(0[1-9]|1[0-2])-(0[1-9]|[12][0-9]|3[01])$`)
+	dateTimeRegex = regexp.MustCompile(`^\d{4}-(0[1-9]|1[0-2])-(0[1-9]|[12][0-9]|3[01])T([01][0-9]|2[0-3]):[0-5][0-9]:[0-5][0-9](\.\d+)?(Z|[+-]\d{2}:\d{2})$`)
+	timeRegex     = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]:[0-5][0-9]$`)
+)
+
+// patternCache holds compiled Schema patterns keyed by their source, with a nil
+// entry for patterns that failed to compile
+var patternCache sync.Map
+
+// cachedRegexp returns the compiled form of pattern, or nil if it is invalid
+func cachedRegexp(pattern string) *regexp.Regexp {
+	if cached, ok := patternCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		re = nil
+	}
+	patternCache.Store(pattern, re)
+	return re
+}
+
+// customFormats holds validators registered with RegisterFormat
+var (
+	customFormatsMu sync.RWMutex
+	customFormats   = make(map[string]func(string) bool)
+)
+
+// RegisterFormat registers a validator for a named string format used by Schema.Format.
+// A registered format takes precedence over a built-in format of the same name.
+func RegisterFormat(name string, validate func(string) bool) {
+	customFormatsMu.Lock()
+	defer customFormatsMu.Unlock()
+	if validate == nil {
+		delete(customFormats, name)
+		return
+	}
+	customFormats[name] = validate
+}
+
 func validateFormat(value, format string) bool {
+	customFormatsMu.RLock()
+	validate, ok := customFormats[format]
+	customFormatsMu.RUnlock()
+	if ok {
+		return validate(value)
+	}
+
 	switch format {
 	case "email":
-		emailRegex := `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+$`
-		matched, _ := regexp.MatchString(emailRegex, value)
-		return matched
+		return emailRegex.MatchString(value)
 	case "uri", "url":
-		urlRegex := `^(https?|ftp)://[^\s/$.?#].[^\s]*$`
-		matched, _ := regexp.MatchString(urlRegex, value)
-		return matched
+		return urlRegex.MatchString(value)
 	case "ipv4":
-		ipv4Regex := `^((25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.){3}(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)$`
-		matched, _ := regexp.MatchString(ipv4Regex, value)
-		return matched
+		return ipv4Regex.MatchString(value)
 	case "ipv6":
-		ipv6Regex := `^(([0-9a-fA-F]{1,4}:){7,7}[0-9a-fA-F]{1,4}|([0-9a-fA-F]{1,4}:){1,7}:|([0-9a-fA-F]{1,4}:){1,6}:[0-9a-fA-F]{1,4}|([0-9a-fA-F]{1,4}:){1,5}(:[0-9a-fA-F]{1,4}){1,2}|([0-9a-fA-F]{1,4}:){1,4}(:[0-9a-fA-F]{1,4}){1,3}|([0-9a-fA-F]{1,4}:){1,3}(:[0-9a-fA-F]{1,4}){1,4}|([0-9a-fA-F]{1,4}:){1,2}(:[0-9a-fA-F]{1,4}){1,5}|[0-9a-fA-F]{1,4}:((:[0-9a-fA-F]{1,4}){1,6})|:((:[0-9a-fA-F]{1,4}){1,7}|:))$`
-		matched, _ := regexp.MatchString(ipv6Regex, value)
-		return matched
+		return ipv6Regex.MatchString(value)
 	case "uuid":
-		uuidRegex := `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`
-		matched, _ := regexp.MatchString(uuidRegex, value)
-		return matched
+		return uuidRegex.MatchString(value)
 	case "date":
-		dateRegex := `^\d{4}-(0[1-9]|1[0-2])-(0[1-9]|[12][0-9]|3[01])$`
-		matched, _ := regexp.MatchString(dateRegex, value)
+		matched := dateRegex.MatchString(value)
 		if !matched {
 			return false
 		}
@@ -442,18 +780,77 @@ func validateFormat(value, format string) bool {
 		}
 		return true
 	case "date-time", "datetime":
-		dateTimeRegex := `^\d{4}-(0[1-9]|1[0-2])-(0[1-9]|[12][0-9]|3[01])T([01][0-9]|2[0-3]):[0-5][0-9]:[0-5][0-9](\.\d+)?(Z|[+-]\d{2}:\d{2})$`
-		matched, _ := regexp.MatchString(dateTimeRegex, value)
-		return matched
+		return dateTimeRegex.MatchString(value)
 	case "time":
-		timeRegex := `^([01][0-9]|2[0-3]):[0-5][0-9]:[0-5][0-9]$`
-		matched, _ := regexp.MatchString(timeRegex, value)
-		return matched
+		return timeRegex.MatchString(value)
 	default:
 		return true // Unknown format, assume valid
 	}
 }
 
+// validateContent checks a string holding embedded data and returns an error message,
+// or "" if it is valid. A base64 encoding must decode, ignoring line breaks and spaces
+// as in !!binary block scalars. The media type check is a heuristic: JSON must parse,
+// text types must be valid UTF-8, and other types only fail when the decoded bytes
+// start with the signature of a different image, PDF, zip or gzip type. Unknown
+// encodings are not checked.
+func validateContent(value, encoding, mediaType string) string {
+	content := []byte(value)
+	switch strings.ToLower(encoding) {
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+		if err != nil {
+			return fmt.Sprintf("string is not valid base64: %v", err)
+		}
+		content = decoded
+	}
+
+	if mediaType == "" {
+		return ""
+	}
+	wanted := strings.ToLower(strings.TrimSpace(strings.Split(mediaType, ";")[0]))
+	switch {
+	case wanted == "application/json" || strings.HasSuffix(wanted, "+json"):
+		if !json.Valid(content) {
+			return fmt.Sprintf("content is not valid %s", mediaType)
+		}
+	case strings.HasPrefix(wanted, "text/"):
+		if !utf8.Valid(content) {
+			return fmt.Sprintf("content is not valid %s", mediaType)
+		}
+	default:
+		if detected := detectMediaType(content); detected != "" && detected != wanted {
+			return fmt.Sprintf("content does not match media type %s (detected %s)", mediaType, detected)
+		}
+	}
+	return ""
+}
+
+// mediaTypeSignatures are the leading bytes of common binary formats
+var mediaTypeSignatures = []struct {
+	magic     string
+	mediaType string
+}{
+	{"\x89PNG\r\n\x1a\n", "image/png"},
+	{"\xff\xd8\xff", "image/jpeg"},
+	{"GIF87a", "image/gif"},
+	{"GIF89a", "image/gif"},
+	{"%PDF-", "application/pdf"},
+	{"PK\x03\x04", "application/zip"},
+	{"\x1f\x8b\x08", "application/gzip"},
+}
+
+// detectMediaType returns the media type whose signature content starts with, or ""
+// if it has none of the known signatures
+func detectMediaType(content []byte) string {
+	for _, signature := range mediaTypeSignatures {
+		if strings.HasPrefix(string(content), signature.magic) {
+			return signature.mediaType
+		}
+	}
+	return ""
+}
+
 // StreamParser provides streaming YAML parsing for large files
 type StreamParser struct {
 	reader           *bufio.Reader
@@ -461,6 +858,10 @@ type StreamParser struct {
 	buffer           []string
 	inDocument       bool
 	documentCallback func(*NodeTree) error
+
+	schema             *Schema
+	validationCallback func(index int, errs []ValidationError) error
+	documentIndex      int
 }
 
 // NewStreamParser creates a new streaming YAML parser
@@ -477,6 +878,20 @@ func (sp *StreamParser) SetDocumentCallback(callback func(*NodeTree) error) {
 	sp.documentCallback = callback
 }
 
+// SetSchema validates every streamed document against schema before it is passed to
+// the document callback. Failures are reported to the validation callback, or stop
+// the parse with an error when no validation callback is set.
+func (sp *StreamParser) SetSchema(schema *Schema) {
+	sp.schema = schema
+}
+
+// SetValidationCallback sets the function receiving the validation errors of each
+// invalid document together with its zero-based index in the stream. Returning an
+// error stops the parse.
+func (sp *StreamParser) SetValidationCallback(callback func(index int, errs []ValidationError) error) {
+	sp.validationCallback = callback
+}
+
 // Parse starts the streaming parse process
 func (sp *StreamParser) Parse() error {
 	for {
@@ -493,7 +908,7 @@ func (sp *StreamParser) Parse() error {
 			if trimmed == "---" {
 				// Process current buffer if not empty
 				if len(sp.buffer) > 0 {
-					if err := sp.processBuffer(); err != nil {
+					if err := sp.processBuffer(false); err != nil {
 						return err
 					}
 				}
@@ -501,7 +916,7 @@ func (sp *StreamParser) Parse() error {
 			} else if trimmed == "..." {
 				// Document end marker
 				if len(sp.buffer) > 0 {
-					if err := sp.processBuffer(); err != nil {
+					if err := sp.processBuffer(true); err != nil {
 						return err
 					}
 				}
@@ -526,7 +941,7 @@ func (sp *StreamParser) Parse() error {
 		if err == io.EOF {
 			// Process any remaining buffer
 			if len(sp.buffer) > 0 {
-				if err := sp.processBuffer(); err != nil {
+				if err := sp.processBuffer(false); err != nil {
 					return err
 				}
 			}
@@ -537,7 +952,8 @@ func (sp *StreamParser) Parse() error {
 	return nil
 }
 
-func (sp *StreamParser) processBuffer() error {
+// processBuffer parses the buffered document, which explicitEnd marks as closed by ...
+func (sp *StreamParser) processBuffer(explicitEnd bool) error {
 	if len(sp.buffer) == 0 {
 		return nil
 	}
@@ -548,6 +964,17 @@ func (sp *StreamParser) processBuffer() error {
 		return fmt.Errorf("error parsing document at line %d: %w", sp.currentLine-len(sp.buffer), err)
 	}
 
+	if n := len(tree.Documents); n > 0 {
+		tree.Documents[n-1].ExplicitEnd = explicitEnd
+	}
+
+	index := sp.documentIndex
+	sp.documentIndex++
+
+	if err := sp.validate(tree, index); err != nil {
+		return err
+	}
+
 	if sp.documentCallback != nil {
 		if err := sp.documentCallback(tree); err != nil {
 			return fmt.Errorf("callback error: %w", err)
@@ -558,17 +985,87 @@ func (sp *StreamParser) processBuffer() error {
 	return nil
 }
 
+// validate checks the content of a streamed document against the schema, if any
+func (sp *StreamParser) validate(tree *NodeTree, index int) error {
+	if sp.schema == nil {
+		return nil
+	}
+
+	var errs []ValidationError
+	for _, doc := range tree.Documents {
+		if doc.Root == nil || (doc.Root.Kind == DocumentNode && len(doc.Root.Children) == 0) {
+			continue
+		}
+		errs = append(errs, sp.schema.Validate(documentContent(doc.Root), "$")...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	if sp.validationCallback == nil {
+		return fmt.Errorf("document %d failed validation: %w", index, errs[0])
+	}
+	if err := sp.validationCallback(index, errs); err != nil {
+		return fmt.Errorf("validation callback error: %w", err)
+	}
+	return nil
+}
+
 // Transform represents a transformation operation on nodes
 type Transform struct {
 	name        string
 	description string
 	operation   func(*Node) (*Node, error)
+	rootOnly    bool // operation runs once on each document root instead of on every node
 }
 
 // TransformDSL provides a fluent interface for YAML transformations
 type TransformDSL struct {
-	transforms []Transform
-	errors     []error
+	transforms    []Transform
+	errors        []error
+	collectErrors bool
+}
+
+// TransformError records a transform that failed on one node
+type TransformError struct {
+	Transform string
+	Document  int    // index of the document in the tree
+	Path      string // path of the node within its document, in the $.a.b[0] form of Node.Path
+	Err       error
+}
+
+func (e TransformError) Error() string {
+	return fmt.Sprintf("transform '%s' failed at %s in document %d: %v", e.Transform, e.Path, e.Document, e.Err)
+}
+
+func (e TransformError) Unwrap() error {
+	return e.Err
+}
+
+// TransformErrors is the combined error returned by a DSL in CollectErrors mode
+type TransformErrors []TransformError
+
+func (e TransformErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return fmt.Sprintf("%d transform errors:\n%s", len(e), strings.Join(lines, "\n"))
+}
+
+// Unwrap returns the individual failures for errors.Is and errors.As
+func (e TransformErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// transformRun holds the state of one Apply or ApplyInPlace call
+type transformRun struct {
+	document int
+	errors   TransformErrors
 }
 
 // NewTransformDSL creates a new transformation DSL
@@ -579,6 +1076,16 @@ func NewTransformDSL() *TransformDSL {
 	}
 }
 
+// CollectErrors makes Apply and ApplyInPlace keep going when a transform fails on a node.
+// The failing transform is skipped for that node, the remaining transforms still run,
+// and once the whole tree is processed every failure is returned together as
+// TransformErrors, each with the transform name and node path. Apply returns no tree
+// when any transform failed; ApplyInPlace leaves the successful changes in place.
+func (dsl *TransformDSL) CollectErrors() *TransformDSL {
+	dsl.collectErrors = true
+	return dsl
+}
+
 // Select creates a transform that filters nodes matching a predicate
 func (dsl *TransformDSL) Select(predicate func(*Node) bool) *TransformDSL {
 	dsl.transforms = append(dsl.transforms, Transform{
@@ -665,6 +1172,96 @@ func (dsl *TransformDSL) Map(fn func(*Node) *Node) *TransformDSL {
 	return dsl
 }
 
+// MapAt applies fn only to the nodes query selects in each document, using the query
+// syntax of Query, so "users/*/name" transforms the name of every user and nothing
+// else. The result of fn replaces the selected node, and a nil result removes it, or
+// the whole entry when it is a mapping key or value. An invalid query is recorded as a
+// DSL error.
+func (dsl *TransformDSL) MapAt(query string, fn func(*Node) *Node) *TransformDSL {
+	compiled, err := CompileQuery(query)
+	if err != nil {
+		dsl.errors = append(dsl.errors, err)
+		return dsl
+	}
+
+	dsl.transforms = append(dsl.transforms, Transform{
+		name:        "mapAt",
+		description: fmt.Sprintf("Transform nodes matching '%s'", query),
+		rootOnly:    true,
+		operation: func(node *Node) (*Node, error) {
+			content := documentContent(node)
+			if content == node {
+				return mapAt(node, compiled, fn), nil
+			}
+			if replaced := mapAt(content, compiled, fn); replaced != nil {
+				replaced.Parent = node
+				node.Children[0] = replaced
+			} else {
+				node.Children = nil
+			}
+			return node, nil
+		},
+	})
+	return dsl
+}
+
+// mapAt runs query against root and replaces every match with the result of fn,
+// returning the new root
+func mapAt(root *Node, query *CompiledQuery, fn func(*Node) *Node) *Node {
+	matches := make(map[*Node]bool)
+	for _, match := range query.Run(root) {
+		matches[match] = true
+	}
+	if matches[root] {
+		return fn(root)
+	}
+	replaceMatches(root, matches, fn)
+	return root
+}
+
+// replaceMatches replaces the descendants of node found in matches with the result of fn
+func replaceMatches(node *Node, matches map[*Node]bool, fn func(*Node) *Node) {
+	if len(node.Children) == 0 {
+		return
+	}
+
+	children := make([]*Node, 0, len(node.Children))
+	for i := 0; i < len(node.Children); i++ {
+		child := node.Children[i]
+		if !matches[child] {
+			if child != nil {
+				replaceMatches(child, matches, fn)
+			}
+			children = append(children, child)
+			continue
+		}
+
+		replaced := fn(child)
+		if replaced == nil {
+			// Removing either half of a mapping entry removes the whole entry
+			if node.Kind == MappingNode {
+				if i%2 == 0 {
+					i++
+				} else {
+					children = children[:len(children)-1]
+				}
+			}
+			continue
+		}
+		replaced.Parent = node
+		children = append(children, replaced)
+	}
+
+	if node.Kind == MappingNode {
+		for i := 1; i < len(children); i += 2 {
+			if children[i] != nil {
+				children[i].Key = children[i-1]
+			}
+		}
+	}
+	node.Children = children
+}
+
 // SetValue sets the value of scalar nodes
 func (dsl *TransformDSL) SetValue(value interface{}) *TransformDSL {
 	dsl.transforms = append(dsl.transforms, Transform{
@@ -680,6 +1277,93 @@ func (dsl *TransformDSL) SetValue(value interface{}) *TransformDSL {
 	return dsl
 }
 
+// CoerceKey converts the scalar value of every key named key to typ, one of "string",
+// "integer", "number" or "boolean", so "8080" becomes 8080 for "integer". Values that
+// cannot be converted fail the transform, and null or non-scalar values are left
+// unchanged. An unknown type is recorded as a DSL error.
+func (dsl *TransformDSL) CoerceKey(key, typ string) *TransformDSL {
+	switch typ {
+	case "string", "integer", "number", "boolean":
+	default:
+		dsl.errors = append(dsl.errors, fmt.Errorf("cannot coerce key %q to unknown type %q", key, typ))
+		return dsl
+	}
+
+	dsl.transforms = append(dsl.transforms, Transform{
+		name:        "coerceKey",
+		description: fmt.Sprintf("Coerce '%s' values to %s", key, typ),
+		operation: func(node *Node) (*Node, error) {
+			if node.Kind != MappingNode {
+				return node, nil
+			}
+			for i := 0; i < len(node.Children)-1; i += 2 {
+				keyNode, value := node.Children[i], node.Children[i+1]
+				if keyNode.Kind != ScalarNode || fmt.Sprintf("%v", keyNode.Value) != key {
+					continue
+				}
+				if value == nil || value.Kind != ScalarNode || value.IsNull() {
+					continue
+				}
+				if err := coerceScalar(value, typ); err != nil {
+					return nil, fmt.Errorf("key %q: %w", key, err)
+				}
+			}
+			return node, nil
+		},
+	})
+	return dsl
+}
+
+// coerceScalar converts the value of a scalar node to the schema type typ and updates
+// its tag and style to match
+func coerceScalar(node *Node, typ string) error {
+	text := fmt.Sprintf("%v", node.Value)
+	if str, ok := node.Value.(string); ok {
+		text = strings.TrimSpace(str)
+	} else if node.hasCurrentRawValue() {
+		text = node.RawValue
+	}
+
+	var value interface{}
+	var tag string
+	switch typ {
+	case "string":
+		value, tag = text, "!!str"
+	case "integer":
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			value = i
+		} else if f, err := strconv.ParseFloat(text, 64); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			value = int64(f)
+		} else {
+			return fmt.Errorf("cannot coerce %q to integer", text)
+		}
+		tag = "!!int"
+	case "number":
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			value, tag = i, "!!int"
+		} else if f, ok := parseYAMLFloat(text); ok {
+			value, tag = f, "!!float"
+		} else {
+			return fmt.Errorf("cannot coerce %q to number", text)
+		}
+	case "boolean":
+		b, ok := yaml11Bool(text)
+		if !ok {
+			return fmt.Errorf("cannot coerce %q to boolean", text)
+		}
+		value, tag = b, "!!bool"
+	}
+
+	node.Value = value
+	node.Tag = tag
+	node.RawValue = ""
+	if typ != "string" {
+		// Quotes would turn the converted value back into a string
+		node.Style = DefaultStyle
+	}
+	return nil
+}
+
 // AddComment adds a comment to nodes
 func (dsl *TransformDSL) AddComment(comment string) *TransformDSL {
 	dsl.transforms = append(dsl.transforms, Transform{
@@ -699,23 +1383,44 @@ func (dsl *TransformDSL) RemoveKey(key string) *TransformDSL {
 		name:        "removeKey",
 		description: fmt.Sprintf("Remove key '%s'", key),
 		operation: func(node *Node) (*Node, error) {
-			if node.Kind == MappingNode {
-				newChildren := make([]*Node, 0)
-				for i := 0; i < len(node.Children)-1; i += 2 {
-					keyNode := node.Children[i]
-					valueNode := node.Children[i+1]
-					if keyNode.Kind != ScalarNode || fmt.Sprintf("%v", keyNode.Value) != key {
-						newChildren = append(newChildren, keyNode, valueNode)
-					}
-				}
-				node.Children = newChildren
-			}
+			removeEntries(node, func(k string, _ *Node) bool {
+				return k == key
+			})
+			return node, nil
+		},
+	})
+	return dsl
+}
+
+// RemoveWhere removes mapping entries for which pred returns true
+func (dsl *TransformDSL) RemoveWhere(pred func(key string, value *Node) bool) *TransformDSL {
+	dsl.transforms = append(dsl.transforms, Transform{
+		name:        "removeWhere",
+		description: "Remove entries matching a predicate",
+		operation: func(node *Node) (*Node, error) {
+			removeEntries(node, pred)
 			return node, nil
 		},
 	})
 	return dsl
 }
 
+// removeEntries drops the scalar-keyed entries of a mapping for which pred returns true
+func removeEntries(node *Node, pred func(key string, value *Node) bool) {
+	if node.Kind != MappingNode {
+		return
+	}
+	newChildren := make([]*Node, 0, len(node.Children))
+	for i := 0; i < len(node.Children)-1; i += 2 {
+		keyNode := node.Children[i]
+		valueNode := node.Children[i+1]
+		if keyNode.Kind != ScalarNode || !pred(fmt.Sprintf("%v", keyNode.Value), valueNode) {
+			newChildren = append(newChildren, keyNode, valueNode)
+		}
+	}
+	node.Children = newChildren
+}
+
 // RenameKey renames a key in mapping nodes
 func (dsl *TransformDSL) RenameKey(oldKey, newKey string) *TransformDSL {
 	dsl.transforms = append(dsl.transforms, Transform{
@@ -737,6 +1442,105 @@ func (dsl *TransformDSL) RenameKey(oldKey, newKey string) *TransformDSL {
 	return dsl
 }
 
+// RenameKeysRegex renames every key matching pattern to the result of
+// regexp.ReplaceAllString, so replacement may refer to capture groups as $1 or ${name}.
+// Keys are renamed together, so two keys may swap names. An invalid pattern is recorded
+// as a DSL error, and renames that would leave two equal keys in a mapping fail the
+// transform without renaming any key of that mapping.
+func (dsl *TransformDSL) RenameKeysRegex(pattern, replacement string) *TransformDSL {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		dsl.errors = append(dsl.errors, fmt.Errorf("invalid rename pattern %q: %w", pattern, err))
+		return dsl
+	}
+
+	dsl.transforms = append(dsl.transforms, Transform{
+		name:        "renameKeysRegex",
+		description: fmt.Sprintf("Rename keys matching '%s' to '%s'", pattern, replacement),
+		operation: func(node *Node) (*Node, error) {
+			if node.Kind != MappingNode {
+				return node, nil
+			}
+
+			// Every new name is computed and checked against the final key set before
+			// any key changes, so keys can trade names and a failed rename changes nothing
+			type rename struct {
+				node *Node
+				key  string
+			}
+			var renames []rename
+			final := make(map[string]string)
+			for i := 0; i < len(node.Children)-1; i += 2 {
+				keyNode := node.Children[i]
+				if keyNode.Kind != ScalarNode {
+					continue
+				}
+				oldKey := fmt.Sprintf("%v", keyNode.Value)
+				newKey := oldKey
+				if re.MatchString(oldKey) {
+					newKey = re.ReplaceAllString(oldKey, replacement)
+				}
+				if other, exists := final[newKey]; exists && (other != newKey || oldKey != newKey) {
+					if oldKey == newKey {
+						oldKey = other
+					}
+					return nil, fmt.Errorf("renaming key %q to %q would duplicate an existing key", oldKey, newKey)
+				}
+				final[newKey] = oldKey
+				if newKey != oldKey {
+					renames = append(renames, rename{keyNode, newKey})
+				}
+			}
+
+			for _, r := range renames {
+				r.node.Value = r.key
+			}
+			return node, nil
+		},
+	})
+	return dsl
+}
+
+// UnwrapSingleKey replaces every mapping whose only entry is key with that entry's
+// value, collapsing redundant nesting like {wrapper: {actual: value}}. Mappings with
+// other entries are left alone. Head, line and foot comments on the removed key each
+// move to the value when it has none of that kind of its own. A block collection has
+// no line of its own, so its line comment is added below the moved head comment.
+func (dsl *TransformDSL) UnwrapSingleKey(key string) *TransformDSL {
+	dsl.transforms = append(dsl.transforms, Transform{
+		name:        "unwrapSingleKey",
+		description: fmt.Sprintf("Unwrap single-key mappings under '%s'", key),
+		operation: func(node *Node) (*Node, error) {
+			for node.Kind == MappingNode && len(node.Children) == 2 &&
+				node.Children[0].Kind == ScalarNode && fmt.Sprintf("%v", node.Children[0].Value) == key {
+				wrapper, value := node.Children[0], node.Children[1]
+				lineComment := wrapper.LineComment
+				if (value.Kind == MappingNode || value.Kind == SequenceNode) && value.Style != FlowStyle {
+					// A block collection has no line of its own, so the comment goes above it
+					if len(value.HeadComment) == 0 && lineComment != "" {
+						value.HeadComment = append(append([]string(nil), wrapper.HeadComment...), lineComment)
+					}
+					lineComment = ""
+				}
+				if len(value.HeadComment) == 0 {
+					value.HeadComment = wrapper.HeadComment
+				}
+				if value.LineComment == "" {
+					value.LineComment = lineComment
+				}
+				if len(value.FootComment) == 0 {
+					value.FootComment = wrapper.FootComment
+				}
+				value.Parent = node.Parent
+				value.Key = node.Key
+				node = value
+			}
+			return node, nil
+		},
+	})
+	return dsl
+}
+
 // SortKeys sorts mapping keys alphabetically
 func (dsl *TransformDSL) SortKeys() *TransformDSL {
 	dsl.transforms = append(dsl.transforms, Transform{
@@ -757,6 +1561,14 @@ func (dsl *TransformDSL) SortKeys() *TransformDSL {
 					})
 				}
 
+				// A head comment block separated from the first key by a blank line
+				// describes the mapping as a whole, so it stays at the top instead
+				// of travelling with the key it happens to be attached to
+				var section []string
+				if len(pairs) > 0 {
+					section, pairs[0].key.HeadComment = splitSectionComment(pairs[0].key.HeadComment)
+				}
+
 				// Sort by key
 				for i := 0; i < len(pairs); i++ {
 					for j := i + 1; j < len(pairs); j++ {
@@ -768,6 +1580,10 @@ func (dsl *TransformDSL) SortKeys() *TransformDSL {
 					}
 				}
 
+				if len(section) > 0 {
+					pairs[0].key.HeadComment = append(section, pairs[0].key.HeadComment...)
+				}
+
 				// Rebuild children
 				newChildren := make([]*Node, 0)
 				for _, pair := range pairs {
@@ -781,6 +1597,108 @@ func (dsl *TransformDSL) SortKeys() *TransformDSL {
 	return dsl
 }
 
+// KeyOrderOptions configures OrderKeysWithOptions
+type KeyOrderOptions struct {
+	// SortUnlisted sorts the keys missing from the order alphabetically instead of
+	// keeping their original relative order
+	SortUnlisted bool
+	// TopLevelOnly reorders only the mapping at the document root
+	TopLevelOnly bool
+}
+
+// OrderKeys reorders mapping keys so the keys listed in order come first, in that
+// order, followed by the remaining keys in their original order
+func (dsl *TransformDSL) OrderKeys(order []string) *TransformDSL {
+	return dsl.OrderKeysWithOptions(order, KeyOrderOptions{})
+}
+
+// OrderKeysWithOptions reorders mapping keys like OrderKeys using the given options
+func (dsl *TransformDSL) OrderKeysWithOptions(order []string, opts KeyOrderOptions) *TransformDSL {
+	rank := make(map[string]int, len(order))
+	for i, key := range order {
+		if _, exists := rank[key]; !exists {
+			rank[key] = i
+		}
+	}
+
+	dsl.transforms = append(dsl.transforms, Transform{
+		name:        "orderKeys",
+		description: fmt.Sprintf("Order keys as %v", order),
+		rootOnly:    opts.TopLevelOnly,
+		operation: func(node *Node) (*Node, error) {
+			if opts.TopLevelOnly {
+				orderKeys(documentContent(node), rank, opts.SortUnlisted)
+			} else {
+				orderKeys(node, rank, opts.SortUnlisted)
+			}
+			return node, nil
+		},
+	})
+	return dsl
+}
+
+// orderKeys stably sorts the entries of a mapping by their rank, placing unranked keys last
+func orderKeys(node *Node, rank map[string]int, sortUnlisted bool) {
+	if node == nil || node.Kind != MappingNode || len(node.Children) < 4 {
+		return
+	}
+
+	type entry struct {
+		name  string
+		key   *Node
+		value *Node
+	}
+	entries := make([]entry, 0, len(node.Children)/2)
+	for i := 0; i < len(node.Children)-1; i += 2 {
+		entries = append(entries, entry{
+			name:  fmt.Sprintf("%v", node.Children[i].Value),
+			key:   node.Children[i],
+			value: node.Children[i+1],
+		})
+	}
+
+	// Keep a section comment at the top of the mapping, as SortKeys does
+	var section []string
+	section, entries[0].key.HeadComment = splitSectionComment(entries[0].key.HeadComment)
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		ri, iListed := rank[entries[i].name]
+		rj, jListed := rank[entries[j].name]
+		switch {
+		case iListed && jListed:
+			return ri < rj
+		case iListed != jListed:
+			return iListed
+		case sortUnlisted:
+			return entries[i].name < entries[j].name
+		default:
+			return false
+		}
+	})
+
+	if len(section) > 0 {
+		entries[0].key.HeadComment = append(section, entries[0].key.HeadComment...)
+	}
+
+	node.Children = node.Children[:0]
+	for _, e := range entries {
+		node.Children = append(node.Children, e.key, e.value)
+	}
+}
+
+// splitSectionComment splits a head comment at its last blank line marker.
+// Lines up to and including the marker form a section comment, the rest belong to the node.
+func splitSectionComment(comments []string) (section, own []string) {
+	for i := len(comments) - 1; i >= 0; i-- {
+		if strings.TrimSpace(comments[i]) == "" {
+			section = append([]string(nil), comments[:i+1]...)
+			own = append([]string(nil), comments[i+1:]...)
+			return section, own
+		}
+	}
+	return nil, comments
+}
+
 // Flatten flattens nested mappings using dot notation
 func (dsl *TransformDSL) Flatten() *TransformDSL {
 	dsl.transforms = append(dsl.transforms, Transform{
@@ -835,6 +1753,518 @@ func flattenRecursive(node *Node, prefix string, result map[string]*Node) {
 	}
 }
 
+// FoldLongStrings renders string scalars longer than maxWidth as folded block scalars
+func (dsl *TransformDSL) FoldLongStrings(maxWidth int) *TransformDSL {
+	dsl.transforms = append(dsl.transforms, Transform{
+		name:        "foldLongStrings",
+		description: fmt.Sprintf("Fold strings longer than %d characters", maxWidth),
+		operation: func(node *Node) (*Node, error) {
+			if node.Kind == ScalarNode {
+				if str, ok := node.Value.(string); ok && len(str) > maxWidth && isFoldable(str) {
+					node.Style = FoldedStyle
+				}
+			}
+			return node, nil
+		},
+	})
+	return dsl
+}
+
+// DepthLimitOptions configures LimitDepthWithOptions
+type DepthLimitOptions struct {
+	// Drop removes elided entries instead of replacing them with the placeholder
+	Drop bool
+	// Placeholder is the scalar value that replaces an elided collection, "..." when empty
+	Placeholder string
+}
+
+// LimitDepth truncates each document for previews and logs by replacing mappings and
+// sequences nested more than maxDepth levels below the document content with "...".
+// Aliases to an anchor inside an elided collection are replaced as well.
+func (dsl *TransformDSL) LimitDepth(maxDepth int) *TransformDSL {
+	return dsl.LimitDepthWithOptions(maxDepth, DepthLimitOptions{})
+}
+
+// LimitDepthWithOptions truncates nested collections like LimitDepth using the given
+// options. The document content is at depth 0 and the values of its entries at depth
+// 1, so a limit of 0 keeps only the top-level scalars. A negative limit is recorded as
+// a DSL error.
+func (dsl *TransformDSL) LimitDepthWithOptions(maxDepth int, opts DepthLimitOptions) *TransformDSL {
+	if maxDepth < 0 {
+		dsl.errors = append(dsl.errors, fmt.Errorf("max depth must not be negative, got %d", maxDepth))
+		return dsl
+	}
+	if opts.Placeholder == "" {
+		opts.Placeholder = "..."
+	}
+
+	dsl.transforms = append(dsl.transforms, Transform{
+		name:        "limitDepth",
+		description: fmt.Sprintf("Limit nesting to %d levels", maxDepth),
+		rootOnly:    true,
+		operation: func(node *Node) (*Node, error) {
+			limitDepth(documentContent(node), 0, maxDepth, opts)
+			elideDanglingAliases(documentContent(node), opts)
+			return node, nil
+		},
+	})
+	return dsl
+}
+
+// limitDepth elides the collections below node, which is at the given depth, that are
+// nested deeper than maxDepth
+func limitDepth(node *Node, depth, maxDepth int, opts DepthLimitOptions) {
+	if node == nil || (node.Kind != MappingNode && node.Kind != SequenceNode) {
+		return
+	}
+
+	elided := func(child *Node) bool {
+		return depth >= maxDepth && child != nil && (child.Kind == MappingNode || child.Kind == SequenceNode)
+	}
+
+	children := make([]*Node, 0, len(node.Children))
+	for i := 0; i < len(node.Children); i++ {
+		child := node.Children[i]
+		if node.Kind == MappingNode && i%2 == 0 {
+			// Keys are kept or dropped together with their value
+			if i+1 < len(node.Children) && opts.Drop && elided(node.Children[i+1]) {
+				i++
+				continue
+			}
+			children = append(children, child)
+			continue
+		}
+
+		switch {
+		case !elided(child):
+			limitDepth(child, depth+1, maxDepth, opts)
+		case opts.Drop:
+			continue
+		default:
+			placeholder := NewScalarNode(opts.Placeholder)
+			placeholder.Parent = node
+			placeholder.Key = child.Key
+			child = placeholder
+		}
+		children = append(children, child)
+	}
+	node.Children = children
+}
+
+// elideDanglingAliases elides, like limitDepth, the aliases under root whose anchor
+// was removed with an elided collection, so the output still parses
+func elideDanglingAliases(root *Node, opts DepthLimitOptions) {
+	if root == nil {
+		return
+	}
+	kept := make(map[*Node]bool)
+	anchors := make(map[string]bool)
+	root.Walk(func(n *Node) bool {
+		kept[n] = true
+		if n.Anchor != "" {
+			anchors[n.Anchor] = true
+		}
+		return true
+	})
+	dangling := func(n *Node) bool {
+		if n == nil || n.Kind != AliasNode {
+			return false
+		}
+		if n.Alias != nil {
+			return !kept[n.Alias]
+		}
+		return !anchors[n.aliasName()]
+	}
+
+	root.Walk(func(node *Node) bool {
+		if node.Kind != MappingNode && node.Kind != SequenceNode {
+			return true
+		}
+		children := make([]*Node, 0, len(node.Children))
+		for i := 0; i < len(node.Children); i++ {
+			child := node.Children[i]
+			if node.Kind == MappingNode && i%2 == 0 {
+				if i+1 < len(node.Children) && opts.Drop && dangling(node.Children[i+1]) {
+					i++
+					continue
+				}
+				children = append(children, child)
+				continue
+			}
+			if dangling(child) {
+				if opts.Drop {
+					continue
+				}
+				placeholder := NewScalarNode(opts.Placeholder)
+				placeholder.Parent = node
+				placeholder.Key = child.Key
+				child = placeholder
+			}
+			children = append(children, child)
+		}
+		node.Children = children
+		return true
+	})
+}
+
+// isFoldable reports whether a string keeps its exact value as a folded block scalar.
+// Line breaks, tabs and leading or trailing whitespace would be altered by folding.
+func isFoldable(str string) bool {
+	if strings.ContainsAny(str, "\n\r\t") {
+		return false
+	}
+	if strings.TrimSpace(str) != str {
+		return false
+	}
+	return !strings.Contains(str, "  ")
+}
+
+// SetStyle sets style on every node of the given kind. Combinations that would change
+// the data or produce invalid output are skipped: collections only accept the default
+// and flow styles, and quoted or block styles only apply to string scalars, with block
+// styles never applied to mapping keys.
+func (dsl *TransformDSL) SetStyle(kind NodeKind, style NodeStyle) *TransformDSL {
+	dsl.transforms = append(dsl.transforms, Transform{
+		name:        "setStyle",
+		description: fmt.Sprintf("Set %s style to %s", kind, style),
+		rootOnly:    true,
+		operation: func(node *Node) (*Node, error) {
+			setStyle(node, false, kind, style)
+			return node, nil
+		},
+	})
+	return dsl
+}
+
+func setStyle(node *Node, isKey bool, kind NodeKind, style NodeStyle) {
+	if node == nil {
+		return
+	}
+	if node.Kind == kind && styleApplies(node, isKey, style) {
+		node.Style = style
+	}
+	for i, child := range node.Children {
+		setStyle(child, node.Kind == MappingNode && i%2 == 0, kind, style)
+	}
+}
+
+// styleApplies reports whether style can be set on node without changing its value
+func styleApplies(node *Node, isKey bool, style NodeStyle) bool {
+	switch node.Kind {
+	case MappingNode, SequenceNode:
+		return style == DefaultStyle || style == FlowStyle
+	case ScalarNode:
+		switch style {
+		case DefaultStyle:
+			return true
+		case QuotedStyle, SingleQuotedStyle, DoubleQuotedStyle:
+			_, isString := node.Value.(string)
+			return isString
+		case LiteralStyle:
+			_, isString := node.Value.(string)
+			return isString && !isKey
+		case FoldedStyle:
+			str, isString := node.Value.(string)
+			return isString && !isKey && isFoldable(str)
+		}
+	}
+	return false
+}
+
+// ApplyTemplate renders string scalars as text/template templates with data. Strings
+// without template actions are left untouched, and referencing a missing field or
+// map key makes Apply fail with the template error.
+func (dsl *TransformDSL) ApplyTemplate(data interface{}) *TransformDSL {
+	dsl.transforms = append(dsl.transforms, Transform{
+		name:        "applyTemplate",
+		description: "Render string values as Go templates",
+		operation: func(node *Node) (*Node, error) {
+			if node.Kind != ScalarNode {
+				return node, nil
+			}
+			str, ok := node.Value.(string)
+			if !ok || !strings.Contains(str, "{{") {
+				return node, nil
+			}
+
+			rendered, err := renderTemplate(str, data)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", node.Line, err)
+			}
+			node.Value = rendered
+			return node, nil
+		},
+	})
+	return dsl
+}
+
+func renderTemplate(text string, data interface{}) (string, error) {
+	tmpl, err := template.New("value").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// InlineAliases replaces every alias with a copy of the node its anchor marks and
+// clears all anchors, producing a document without anchors or aliases. Merge keys
+// (<<) referring to mappings are folded into the surrounding mapping, where explicit
+// keys win over merged ones and earlier merge sources win over later ones.
+// An alias that refers to a node containing itself is reported as an error.
+func (dsl *TransformDSL) InlineAliases() *TransformDSL {
+	dsl.transforms = append(dsl.transforms, Transform{
+		name:        "inlineAliases",
+		description: "Replace aliases with their anchored nodes",
+		operation: func(node *Node) (*Node, error) {
+			return inlineAliases(node, make(map[string]*Node), make(map[*Node]bool))
+		},
+		rootOnly: true,
+	})
+	return dsl
+}
+
+// inlineAliases returns a copy of node with aliases expanded. anchors holds the anchors
+// seen so far in document order, used for aliases that are not linked (as in cloned
+// trees), and active holds the anchored nodes currently being expanded, to detect
+// aliases nested inside their own anchor.
+func inlineAliases(node *Node, anchors map[string]*Node, active map[*Node]bool) (*Node, error) {
+	if node.Kind == AliasNode {
+		target := node.Alias
+		if target == nil {
+			target = anchors[node.aliasName()]
+		}
+		if target == nil {
+			return nil, fmt.Errorf("alias *%s has no anchor", node.aliasName())
+		}
+		if active[target] {
+			return nil, fmt.Errorf("alias *%s is nested inside its own anchor", node.aliasName())
+		}
+		active[target] = true
+		defer delete(active, target)
+
+		expanded, err := inlineAliases(target, anchors, active)
+		if err != nil {
+			return nil, err
+		}
+		// Keep the comments written next to the alias instead of those of the anchor
+		expanded.HeadComment = append([]string(nil), node.HeadComment...)
+		expanded.LineComment = node.LineComment
+		expanded.FootComment = append([]string(nil), node.FootComment...)
+		expanded.Line, expanded.Column = node.Line, node.Column
+		return expanded, nil
+	}
+
+	if node.Anchor != "" {
+		anchors[node.Anchor] = node
+	}
+
+	result := *node
+	result.Anchor = ""
+	result.Parent = nil
+	result.Key = nil
+	result.HeadComment = append([]string(nil), node.HeadComment...)
+	result.FootComment = append([]string(nil), node.FootComment...)
+	result.EmptyLines = append([]int(nil), node.EmptyLines...)
+	result.Metadata = make(map[string]interface{}, len(node.Metadata))
+	for k, v := range node.Metadata {
+		result.Metadata[k] = v
+	}
+	result.Children = make([]*Node, 0, len(node.Children))
+	for _, child := range node.Children {
+		expanded, err := inlineAliases(child, anchors, active)
+		if err != nil {
+			return nil, err
+		}
+		result.AddChild(expanded)
+		if result.Kind == MappingNode && len(result.Children)%2 == 0 {
+			expanded.Key = result.Children[len(result.Children)-2]
+		}
+	}
+
+	if result.Kind == MappingNode {
+		foldMergeKeys(&result)
+	}
+	return &result, nil
+}
+
+// isMergeKey reports whether key is the YAML merge key <<
+func isMergeKey(key *Node) bool {
+	return key.Kind == ScalarNode && key.Value == "<<" && (key.Tag == "" || key.Tag == "!!merge") &&
+		key.Style == DefaultStyle
+}
+
+// foldMergeKeys replaces the << entries of mapping with the entries of the mappings
+// they refer to, skipping keys the mapping already defines
+func foldMergeKeys(mapping *Node) {
+	defined := make(map[string]bool)
+	hasMerge := false
+	for i := 0; i < len(mapping.Children)-1; i += 2 {
+		if isMergeKey(mapping.Children[i]) {
+			hasMerge = true
+		} else {
+			defined[fmt.Sprintf("%v", mapping.Children[i].Value)] = true
+		}
+	}
+	if !hasMerge {
+		return
+	}
+
+	children := make([]*Node, 0, len(mapping.Children))
+	for i := 0; i < len(mapping.Children)-1; i += 2 {
+		key, value := mapping.Children[i], mapping.Children[i+1]
+		sources := []*Node{value}
+		if value.Kind == SequenceNode {
+			sources = value.Children
+		}
+		if !isMergeKey(key) || !allMappings(sources) {
+			children = append(children, key, value)
+			continue
+		}
+
+		for _, source := range sources {
+			for j := 0; j < len(source.Children)-1; j += 2 {
+				name := fmt.Sprintf("%v", source.Children[j].Value)
+				if defined[name] {
+					continue
+				}
+				defined[name] = true
+				children = append(children, source.Children[j], source.Children[j+1])
+			}
+		}
+	}
+
+	mapping.Children = children
+	for i, child := range children {
+		child.Parent = mapping
+		if i%2 == 1 {
+			child.Key = children[i-1]
+		}
+	}
+}
+
+// allMappings reports whether every node is a mapping
+func allMappings(nodes []*Node) bool {
+	for _, node := range nodes {
+		if node.Kind != MappingNode {
+			return false
+		}
+	}
+	return true
+}
+
+// MoveKey detaches the entry at fromPath and reattaches it at toPath, creating
+// intermediate mappings as needed. Paths use the $.a.b syntax produced by Node.Path.
+// Moving onto an existing key replaces it, and a missing source leaves the tree unchanged.
+func (dsl *TransformDSL) MoveKey(fromPath, toPath string) *TransformDSL {
+	dsl.transforms = append(dsl.transforms, Transform{
+		name:        "moveKey",
+		description: fmt.Sprintf("Move '%s' to '%s'", fromPath, toPath),
+		rootOnly:    true,
+		operation: func(node *Node) (*Node, error) {
+			return node, moveKey(documentContent(node), fromPath, toPath)
+		},
+	})
+	return dsl
+}
+
+func moveKey(root *Node, fromPath, toPath string) error {
+	fromSegments, err := splitPath(fromPath)
+	if err != nil {
+		return err
+	}
+	toSegments, err := splitPath(toPath)
+	if err != nil {
+		return err
+	}
+	if len(fromSegments) == 0 || len(toSegments) == 0 {
+		return fmt.Errorf("cannot move the document root")
+	}
+	if len(toSegments) > len(fromSegments) && equalPathSegments(toSegments[:len(fromSegments)], fromSegments) {
+		return fmt.Errorf("cannot move '%s' into itself", fromPath)
+	}
+	last, destination := fromSegments[len(fromSegments)-1], toSegments[len(toSegments)-1]
+	if destination.isIndex {
+		return fmt.Errorf("cannot move '%s' to sequence item %s", fromPath, destination)
+	}
+
+	source := lookupPath(root, fromSegments[:len(fromSegments)-1])
+	if source == nil || source.Kind != MappingNode || last.isIndex {
+		return nil
+	}
+	idx := findMapEntry(source, last.key)
+	if idx < 0 {
+		return nil
+	}
+	key, value := source.Children[idx], source.Children[idx+1]
+
+	// Create the destination parents before detaching so a failure leaves the tree intact
+	target, err := ensureMappingPath(root, toSegments[:len(toSegments)-1])
+	if err != nil {
+		return err
+	}
+	if target.Kind != MappingNode {
+		return fmt.Errorf("destination parent of '%s' is a %s, not a mapping", toPath, target.Kind)
+	}
+
+	source.Children = append(source.Children[:idx], source.Children[idx+2:]...)
+
+	key.Value = destination.key
+	key.Parent = target
+	value.Parent = target
+	value.Key = key
+	if existing := findMapEntry(target, destination.key); existing >= 0 {
+		target.Children[existing] = key
+		target.Children[existing+1] = value
+	} else {
+		target.Children = append(target.Children, key, value)
+	}
+	return nil
+}
+
+// equalPathSegments reports whether a and b name the same path
+func equalPathSegments(a, b []pathSegment) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ensureMappingPath follows key segments from root, adding empty mappings for missing
+// keys, and returns the node at the end of the path
+func ensureMappingPath(root *Node, segments []pathSegment) (*Node, error) {
+	target := root
+	for _, segment := range segments {
+		if segment.isIndex {
+			// Sequence items are followed but never created
+			if target = lookupPath(target, []pathSegment{segment}); target == nil {
+				return nil, fmt.Errorf("sequence item %s does not exist", segment)
+			}
+			continue
+		}
+		if target.Kind != MappingNode {
+			return nil, fmt.Errorf("cannot create '%s' under a %s", segment, target.Kind)
+		}
+		next := target.GetMapValue(segment.key)
+		if next == nil {
+			next = NewMappingNode()
+			if err := target.AddKeyValue(NewScalarNode(segment.key), next); err != nil {
+				return nil, err
+			}
+		}
+		target = next
+	}
+	return target, nil
+}
+
 // Apply executes all transformations on a node tree
 func (dsl *TransformDSL) Apply(tree *NodeTree) (*NodeTree, error) {
 	if tree == nil {
@@ -850,19 +2280,22 @@ func (dsl *TransformDSL) Apply(tree *NodeTree) (*NodeTree, error) {
 	}
 
 	resultTree := NewNodeTree()
+	run := &transformRun{}
 
-	for _, doc := range tree.Documents {
+	for i, doc := range tree.Documents {
 		if doc == nil {
 			return nil, fmt.Errorf("tree contains nil document")
 		}
+		run.document = i
 		newDoc := &Document{
-			Directives: doc.Directives,
-			Version:    doc.Version,
-			Anchors:    make(map[string]*Node),
+			Directives:  doc.Directives,
+			Version:     doc.Version,
+			Anchors:     make(map[string]*Node),
+			ExplicitEnd: doc.ExplicitEnd,
 		}
 
 		if doc.Root != nil {
-			transformedRoot, err := dsl.applyToNode(doc.Root)
+			transformedRoot, err := dsl.applyToNode(doc.Root, true, "$", run)
 			if err != nil {
 				return nil, err
 			}
@@ -873,10 +2306,13 @@ func (dsl *TransformDSL) Apply(tree *NodeTree) (*NodeTree, error) {
 		resultTree.Current = newDoc
 	}
 
+	if len(run.errors) > 0 {
+		return nil, run.errors
+	}
 	return resultTree, nil
 }
 
-func (dsl *TransformDSL) applyToNode(node *Node) (*Node, error) {
+func (dsl *TransformDSL) applyToNode(node *Node, isRoot bool, path string, run *transformRun) (*Node, error) {
 	if node == nil {
 		return nil, nil
 	}
@@ -888,24 +2324,16 @@ func (dsl *TransformDSL) applyToNode(node *Node) (*Node, error) {
 		}
 	}
 
-	result := node.Clone()
-
-	for _, transform := range dsl.transforms {
-		var err error
-		result, err = transform.operation(result)
-		if err != nil {
-			return nil, fmt.Errorf("transform '%s' failed: %w", transform.name, err)
-		}
-		if result == nil {
-			return nil, nil // Node filtered out
-		}
+	result, err := dsl.runTransforms(node.Clone(), isRoot, path, run)
+	if result == nil || err != nil {
+		return nil, err // Node filtered out or failed
 	}
 
 	// Apply transformations to children recursively
 	if result.Kind == MappingNode || result.Kind == SequenceNode || result.Kind == DocumentNode {
 		newChildren := make([]*Node, 0)
-		for _, child := range result.Children {
-			transformedChild, err := dsl.applyToNode(child)
+		for i, child := range result.Children {
+			transformedChild, err := dsl.applyToNode(child, false, transformChildPath(result, i, path), run)
 			if err != nil {
 				return nil, err
 			}
@@ -919,42 +2347,280 @@ func (dsl *TransformDSL) applyToNode(node *Node) (*Node, error) {
 	return result, nil
 }
 
-// Query provides XPath-like querying for YAML
+// ApplyInPlace applies the transformations to tree itself instead of building a new
+// tree, which avoids cloning every node. Documents, mappings and sequences are
+// modified where they are, nodes removed by a transform are dropped from their
+// parent and a root replaced by a transform becomes the document root. Operations
+// see the original nodes, including their Parent. If a transform fails the tree is
+// left partially transformed, so use Apply when the input must stay unchanged.
+func (dsl *TransformDSL) ApplyInPlace(tree *NodeTree) error {
+	if tree == nil {
+		return fmt.Errorf("tree is nil")
+	}
+
+	if len(dsl.errors) > 0 {
+		return fmt.Errorf("DSL has %d errors", len(dsl.errors))
+	}
+
+	run := &transformRun{}
+	for i, doc := range tree.Documents {
+		if doc == nil {
+			return fmt.Errorf("tree contains nil document")
+		}
+		if doc.Root == nil {
+			continue
+		}
+		run.document = i
+
+		root, err := dsl.applyInPlace(doc.Root, true, "$", run)
+		if err != nil {
+			return err
+		}
+		doc.Root = root
+		doc.ReindexAnchors()
+	}
+
+	if len(run.errors) > 0 {
+		return run.errors
+	}
+	return nil
+}
+
+func (dsl *TransformDSL) applyInPlace(node *Node, isRoot bool, path string, run *transformRun) (*Node, error) {
+	if node == nil {
+		return nil, nil
+	}
+
+	for _, transform := range dsl.transforms {
+		if transform.name == "select" {
+			return transform.operation(node)
+		}
+	}
+
+	result, err := dsl.runTransforms(node, isRoot, path, run)
+	if result == nil || err != nil {
+		return nil, err
+	}
+
+	if result.Kind == MappingNode || result.Kind == SequenceNode || result.Kind == DocumentNode {
+		// Filter in place: the write index never passes the read index
+		kept := result.Children[:0]
+		for i, child := range result.Children {
+			transformedChild, err := dsl.applyInPlace(child, false, transformChildPath(result, i, path), run)
+			if err != nil {
+				return nil, err
+			}
+			if transformedChild != nil {
+				transformedChild.Parent = result
+				kept = append(kept, transformedChild)
+			}
+		}
+		for i := len(kept); i < len(result.Children); i++ {
+			result.Children[i] = nil
+		}
+		result.Children = kept
+	}
+
+	return result, nil
+}
+
+// runTransforms runs every transform on node in order, returning nil if one removed it.
+// In CollectErrors mode a failing transform is recorded in run and skipped.
+func (dsl *TransformDSL) runTransforms(node *Node, isRoot bool, path string, run *transformRun) (*Node, error) {
+	result := node
+	for _, transform := range dsl.transforms {
+		if transform.rootOnly && !isRoot {
+			continue
+		}
+		transformed, err := transform.operation(result)
+		if err != nil {
+			if dsl.collectErrors {
+				run.errors = append(run.errors, TransformError{Transform: transform.name, Document: run.document, Path: path, Err: err})
+				continue
+			}
+			return nil, fmt.Errorf("transform '%s' failed: %w", transform.name, err)
+		}
+		if transformed == nil {
+			return nil, nil
+		}
+		result = transformed
+	}
+	return result, nil
+}
+
+// transformChildPath returns the path of the child at index i of node at path. Keys
+// share the path of their value, and the content of a document shares its path.
+func transformChildPath(node *Node, i int, path string) string {
+	switch node.Kind {
+	case MappingNode:
+		if key := node.Children[i-i%2]; key != nil && key.Kind == ScalarNode {
+			return path + pathKey(fmt.Sprintf("%v", key.Value))
+		}
+	case SequenceNode:
+		return fmt.Sprintf("%s[%d]", path, i)
+	}
+	return path
+}
+
+// Query provides XPath-like querying for YAML. Segments are separated by / and are a
+// mapping key, * for every child, [n] for a sequence item, where [-1] is the last, or
+// [start:end] for the half-open slice of sequence items, where either bound may be
+// omitted or negative.
 func Query(node *Node, query string) []*Node {
-	// Simple query parser
-	parts := strings.Split(query, "/")
-	results := []*Node{node}
+	compiled, err := CompileQuery(query)
+	if err != nil {
+		return []*Node{}
+	}
+	return compiled.Run(node)
+}
 
-	for _, part := range parts {
-		if part == "" {
+// querySegmentKind identifies the kind of a compiled query segment
+type querySegmentKind int
+
+const (
+	queryKey querySegmentKind = iota
+	queryIndex
+	queryWildcard
+	querySlice
+)
+
+// querySegment is a single step of a compiled query
+type querySegment struct {
+	kind  querySegmentKind
+	key   string
+	index int
+	// end, hasStart and hasEnd describe a [start:end] slice, with start held in index
+	end      int
+	hasStart bool
+	hasEnd   bool
+}
+
+// CompiledQuery is a parsed query that can be run repeatedly without re-parsing
+type CompiledQuery struct {
+	source   string
+	segments []querySegment
+}
+
+// CompileQuery parses a query in the syntax accepted by Query. Malformed array
+// indexes are reported as errors instead of silently matching nothing.
+func CompileQuery(query string) (*CompiledQuery, error) {
+	compiled := &CompiledQuery{source: query}
+
+	for _, part := range strings.Split(query, "/") {
+		switch {
+		case part == "":
 			continue
+		case part == "*":
+			compiled.segments = append(compiled.segments, querySegment{kind: queryWildcard})
+		case strings.HasPrefix(part, "["):
+			if !strings.HasSuffix(part, "]") {
+				return nil, fmt.Errorf("unterminated array index %q in query %q", part, query)
+			}
+			if bounds := strings.SplitN(part[1:len(part)-1], ":", 2); len(bounds) == 2 {
+				segment, err := compileSlice(bounds[0], bounds[1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid array slice %q in query %q", part, query)
+				}
+				compiled.segments = append(compiled.segments, segment)
+				continue
+			}
+			index, err := strconv.Atoi(part[1 : len(part)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid array index %q in query %q", part, query)
+			}
+			compiled.segments = append(compiled.segments, querySegment{kind: queryIndex, index: index})
+		default:
+			compiled.segments = append(compiled.segments, querySegment{kind: queryKey, key: part})
+		}
+	}
+
+	return compiled, nil
+}
+
+// compileSlice parses the bounds of a [start:end] slice, either of which may be empty
+func compileSlice(start, end string) (querySegment, error) {
+	segment := querySegment{kind: querySlice}
+	var err error
+	if start = strings.TrimSpace(start); start != "" {
+		if segment.index, err = strconv.Atoi(start); err != nil {
+			return segment, err
+		}
+		segment.hasStart = true
+	}
+	if end = strings.TrimSpace(end); end != "" {
+		if segment.end, err = strconv.Atoi(end); err != nil {
+			return segment, err
+		}
+		segment.hasEnd = true
+	}
+	return segment, nil
+}
+
+// sliceBounds returns the half-open range a slice selects from length items. Negative
+// bounds count from the end and out-of-range bounds are clamped.
+func (s querySegment) sliceBounds(length int) (int, int) {
+	clamp := func(bound int, set bool, fallback int) int {
+		if !set {
+			return fallback
 		}
+		if bound < 0 {
+			bound += length
+		}
+		if bound < 0 {
+			return 0
+		}
+		if bound > length {
+			return length
+		}
+		return bound
+	}
+	return clamp(s.index, s.hasStart, 0), clamp(s.end, s.hasEnd, length)
+}
+
+// String returns the query the CompiledQuery was compiled from
+func (q *CompiledQuery) String() string {
+	return q.source
+}
 
+// Run executes the compiled query against node
+func (q *CompiledQuery) Run(node *Node) []*Node {
+	results := []*Node{node}
+
+	for _, segment := range q.segments {
 		newResults := []*Node{}
 		for _, n := range results {
 			if n == nil {
 				continue
 			}
 
-			if part == "*" {
+			switch segment.kind {
+			case queryWildcard:
 				// Wildcard - get all children
 				newResults = append(newResults, n.Children...)
-			} else if strings.HasPrefix(part, "[") && strings.HasSuffix(part, "]") {
-				// Array index
-				indexStr := part[1 : len(part)-1]
-				if index, err := strconv.Atoi(indexStr); err == nil {
-					if n.Kind == SequenceNode && index >= 0 && index < len(n.Children) {
-						newResults = append(newResults, n.Children[index])
+			case queryIndex:
+				if n.Kind != SequenceNode {
+					continue
+				}
+				index := segment.index
+				if index < 0 {
+					// Negative indexes count from the end
+					index += len(n.Children)
+				}
+				if index >= 0 && index < len(n.Children) {
+					newResults = append(newResults, n.Children[index])
+				}
+			case querySlice:
+				if n.Kind == SequenceNode {
+					if start, end := segment.sliceBounds(len(n.Children)); start < end {
+						newResults = append(newResults, n.Children[start:end]...)
 					}
 				}
-			} else {
-				// Key name
+			case queryKey:
 				if n.Kind == MappingNode {
 					for i := 0; i < len(n.Children)-1; i += 2 {
 						keyNode := n.Children[i]
-						valueNode := n.Children[i+1]
-						if keyNode.Kind == ScalarNode && fmt.Sprintf("%v", keyNode.Value) == part {
-							newResults = append(newResults, valueNode)
+						if keyNode.Kind == ScalarNode && fmt.Sprintf("%v", keyNode.Value) == segment.key {
+							newResults = append(newResults, n.Children[i+1])
 							break
 						}
 					}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -595,103 +597,1981 @@ metadata:
 		// Keep only config section nodes
 		dsl := NewTransformDSL().Select(func(node *Node) bool {
 			// Keep config key and its children
-			if node.Key != nil {
-				if keyStr, ok := node.Key.Value.(string); ok && keyStr == "config" {
+			if key, ok := node.KeyName(); ok && key == "config" {
+				return true
+			}
+			// Keep nodes that are children of config
+			if node.Parent != nil {
+				if key, ok := node.Parent.KeyName(); ok && key == "config" {
 					return true
 				}
 			}
-			// Keep nodes that are children of config
-			if node.Parent != nil && node.Parent.Key != nil {
-				if keyStr, ok := node.Parent.Key.Value.(string); ok && keyStr == "config" {
-					return true
-				}
+			return false
+		})
+		result, err := dsl.Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+
+		output, _ := result.ToYAML()
+		if !strings.Contains(string(output), "config:") {
+			t.Errorf("Config should be kept. Output: %s", string(output))
+		}
+		if strings.Contains(string(output), "metadata:") {
+			t.Error("Metadata should be filtered out")
+		}
+	})
+
+	t.Run("Map", func(t *testing.T) {
+		// Custom transform to uppercase all string values
+		dsl := NewTransformDSL().Map(func(node *Node) *Node {
+			if node.Kind == ScalarNode && node.Value != nil {
+				if str, ok := node.Value.(string); ok {
+					node.Value = strings.ToUpper(str)
+				}
+			}
+			return node
+		})
+		result, err := dsl.Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+
+		output, _ := result.ToYAML()
+		if !strings.Contains(string(output), "LOCALHOST") {
+			t.Error("String values should be uppercase")
+		}
+	})
+
+	t.Run("Chained transforms", func(t *testing.T) {
+		dsl := NewTransformDSL().
+			RemoveKey("password").
+			RenameKey("username", "user").
+			SortKeys().
+			AddComment("Modified")
+
+		result, err := dsl.Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+
+		output, _ := result.ToYAML()
+
+		// Verify all transforms were applied
+		if strings.Contains(string(output), "password") {
+			t.Error("Password should be removed")
+		}
+		if strings.Contains(string(output), "username:") {
+			t.Error("Username should be renamed")
+		}
+		if !strings.Contains(string(output), "user:") {
+			t.Error("User key should exist")
+		}
+		if !strings.Contains(string(output), "Modified") {
+			t.Error("Comment should be added")
+		}
+	})
+
+	t.Run("Transform with nil tree", func(t *testing.T) {
+		dsl := NewTransformDSL().RemoveKey("test")
+		result, err := dsl.Apply(nil)
+		if err == nil {
+			t.Error("Should error on nil tree")
+		}
+		if result != nil {
+			t.Error("Result should be nil on error")
+		}
+	})
+
+	t.Run("Transform empty tree", func(t *testing.T) {
+		emptyTree := &NodeTree{}
+		dsl := NewTransformDSL().AddComment("test")
+		result, err := dsl.Apply(emptyTree)
+		if err != nil {
+			t.Errorf("Should handle empty tree: %v", err)
+		}
+		if result == nil {
+			t.Error("Should return non-nil result")
+		}
+	})
+}
+
+func TestTransformDSLFoldLongStrings(t *testing.T) {
+	input := `name: short
+description: This is a very long description that goes well beyond the configured width threshold
+indented: "  leading spaces that are long enough to exceed the threshold"
+multiline: "first line that is long enough\nsecond line"
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	result, err := NewTransformDSL().FoldLongStrings(40).Apply(tree)
+	if err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+
+	root := result.Documents[0].Root.Children[0]
+	if style := root.GetMapValue("description").Style; style != FoldedStyle {
+		t.Errorf("Long description style = %v, want FoldedStyle", style)
+	}
+	if style := root.GetMapValue("name").Style; style != DefaultStyle {
+		t.Errorf("Short value style = %v, want DefaultStyle", style)
+	}
+	if style := root.GetMapValue("indented").Style; style == FoldedStyle {
+		t.Error("Value with leading whitespace should not be folded")
+	}
+	if style := root.GetMapValue("multiline").Style; style == FoldedStyle {
+		t.Error("Value with line breaks should not be folded")
+	}
+
+	output, err := result.ToYAML()
+	if err != nil {
+		t.Fatalf("Failed to serialize: %v", err)
+	}
+	if !strings.Contains(string(output), "description: >-") {
+		t.Errorf("Expected folded block scalar, got:\n%s", output)
+	}
+	if !strings.Contains(string(output), "name: short") {
+		t.Errorf("Short value should stay plain, got:\n%s", output)
+	}
+
+	// The folded output must parse back to the same string
+	reparsed, err := UnmarshalYAML(output)
+	if err != nil {
+		t.Fatalf("Failed to parse folded output: %v", err)
+	}
+	original := tree.Documents[0].Root.Children[0].GetMapValue("description").Value
+	roundTripped := reparsed.Documents[0].Root.Children[0].GetMapValue("description").Value
+	if original != roundTripped {
+		t.Errorf("Folded value changed: %q vs %q", roundTripped, original)
+	}
+}
+
+func TestTransformDSLSortKeysComments(t *testing.T) {
+	t.Run("comments follow their keys", func(t *testing.T) {
+		input := `settings:
+  # head zebra
+  zebra: 1 # line zebra
+  # foot zebra
+
+  # head mango
+  mango: 2 # line mango
+  # foot mango
+
+  # head apple
+  apple: 3 # line apple
+  # foot apple
+`
+		tree, _ := UnmarshalYAML([]byte(input))
+		result, err := NewTransformDSL().SortKeys().Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+
+		settings := result.Documents[0].Root.Children[0].GetMapValue("settings")
+		for i, name := range []string{"apple", "mango", "zebra"} {
+			key := settings.Children[i*2]
+			value := settings.Children[i*2+1]
+			if key.Value != name {
+				t.Fatalf("Key %d = %v, want %s", i, key.Value, name)
+			}
+			if !equalStringSlices(key.HeadComment, []string{"# head " + name}) {
+				t.Errorf("%s head comment = %q", name, key.HeadComment)
+			}
+			if value.LineComment != "# line "+name {
+				t.Errorf("%s line comment = %q", name, value.LineComment)
+			}
+			if !equalStringSlices(key.FootComment, []string{"# foot " + name}) {
+				t.Errorf("%s foot comment = %q", name, key.FootComment)
+			}
+		}
+
+		output, _ := result.ToYAML()
+		last := -1
+		for _, marker := range []string{
+			"# head apple", "apple: 3 # line apple", "# foot apple",
+			"# head mango", "mango: 2 # line mango", "# foot mango",
+			"# head zebra", "zebra: 1 # line zebra", "# foot zebra",
+		} {
+			idx := strings.Index(string(output), marker)
+			if idx <= last {
+				t.Fatalf("%q out of order in output:\n%s", marker, output)
+			}
+			last = idx
+		}
+	})
+
+	t.Run("section comment stays at the top", func(t *testing.T) {
+		input := `settings:
+  # Settings section
+
+  # zebra doc
+  zebra: 1
+  apple: 2
+`
+		tree, _ := UnmarshalYAML([]byte(input))
+		result, err := NewTransformDSL().SortKeys().Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+
+		settings := result.Documents[0].Root.Children[0].GetMapValue("settings")
+		apple, zebra := settings.Children[0], settings.Children[2]
+		if apple.Value != "apple" || zebra.Value != "zebra" {
+			t.Fatalf("Unexpected key order: %v, %v", apple.Value, zebra.Value)
+		}
+		if len(apple.HeadComment) == 0 || apple.HeadComment[0] != "# Settings section" {
+			t.Errorf("Section comment should move to the new first key, got %q", apple.HeadComment)
+		}
+		if !equalStringSlices(zebra.HeadComment, []string{"# zebra doc"}) {
+			t.Errorf("zebra should keep only its own comment, got %q", zebra.HeadComment)
+		}
+	})
+}
+
+func TestTransformDSLMoveKey(t *testing.T) {
+	input := `# Application config
+app:
+  name: demo
+  # Database connection
+  database:
+    host: localhost # primary host
+    port: 5432
+  legacy_port: 8080
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	t.Run("move subtree under new parent", func(t *testing.T) {
+		result, err := NewTransformDSL().MoveKey("$.app.database", "$.services.database").Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+
+		root := result.Documents[0].Root.Children[0]
+		if root.GetMapValue("app").GetMapValue("database") != nil {
+			t.Error("database should be detached from app")
+		}
+		services := root.GetMapValue("services")
+		if services == nil {
+			t.Fatal("services parent should be created")
+		}
+		database := services.GetMapValue("database")
+		if database == nil || database.GetMapValue("port").Value != int64(5432) {
+			t.Fatal("database subtree should be reattached under services")
+		}
+		if !equalStringSlices(services.Children[0].HeadComment, []string{"# Database connection"}) {
+			t.Errorf("Key comment should move with the entry, got %q", services.Children[0].HeadComment)
+		}
+		if database.GetMapValue("host").LineComment != "# primary host" {
+			t.Error("Nested comments should move with the subtree")
+		}
+
+		// The original tree is untouched
+		if tree.Documents[0].Root.Children[0].GetMapValue("app").GetMapValue("database") == nil {
+			t.Error("Apply should not modify the source tree")
+		}
+	})
+
+	t.Run("move and rename leaf onto existing key", func(t *testing.T) {
+		result, err := NewTransformDSL().MoveKey("$.app.legacy_port", "$.app.database.port").Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+
+		app := result.Documents[0].Root.Children[0].GetMapValue("app")
+		if app.GetMapValue("legacy_port") != nil {
+			t.Error("legacy_port should be removed from its old location")
+		}
+		database := app.GetMapValue("database")
+		if v := database.GetMapValue("port").Value; v != int64(8080) {
+			t.Errorf("port = %v, want 8080 replacing the old value", v)
+		}
+		if len(database.Children) != 4 {
+			t.Errorf("Replacing a key should not add a duplicate entry, got %d children", len(database.Children))
+		}
+	})
+
+	t.Run("missing source is a no-op", func(t *testing.T) {
+		result, err := NewTransformDSL().MoveKey("$.nope", "$.other").Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+		if result.Documents[0].Root.Children[0].GetMapValue("other") != nil {
+			t.Error("Nothing should be created for a missing source")
+		}
+	})
+
+	t.Run("move into itself fails", func(t *testing.T) {
+		if _, err := NewTransformDSL().MoveKey("$.app", "$.app.nested").Apply(tree); err == nil {
+			t.Error("Moving a subtree into itself should fail")
+		}
+	})
+}
+
+// TestTransformDSLRemoveWhere tests removing mapping entries with a predicate
+func TestTransformDSLRemoveWhere(t *testing.T) {
+	input := `app:
+  name: demo
+  description: ""
+  features:
+    search:
+      enabled: true
+    billing:
+      enabled: false
+    export:
+      enabled: false
+      note: ""
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	t.Run("empty string values", func(t *testing.T) {
+		result, err := NewTransformDSL().RemoveWhere(func(key string, value *Node) bool {
+			return value.Kind == ScalarNode && value.Value == ""
+		}).Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+
+		app := result.Documents[0].Root.Children[0].GetMapValue("app")
+		if app.GetMapValue("description") != nil {
+			t.Error("description with an empty value should be removed")
+		}
+		if app.GetMapValue("name") == nil {
+			t.Error("name should be kept")
+		}
+		export := app.GetMapValue("features").GetMapValue("export")
+		if export.GetMapValue("note") != nil {
+			t.Error("nested empty values should be removed")
+		}
+		if export.GetMapValue("enabled") == nil {
+			t.Error("nested non-empty values should be kept")
+		}
+	})
+
+	t.Run("disabled features", func(t *testing.T) {
+		result, err := NewTransformDSL().RemoveWhere(func(key string, value *Node) bool {
+			enabled := value.GetMapValue("enabled")
+			return value.Kind == MappingNode && enabled != nil && enabled.Value == false
+		}).Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+
+		features := result.Documents[0].Root.Children[0].GetMapValue("app").GetMapValue("features")
+		if features.GetMapValue("billing") != nil || features.GetMapValue("export") != nil {
+			t.Error("disabled features should be removed")
+		}
+		if features.GetMapValue("search") == nil {
+			t.Error("enabled features should be kept")
+		}
+	})
+
+	t.Run("key and value combination", func(t *testing.T) {
+		result, err := NewTransformDSL().RemoveWhere(func(key string, value *Node) bool {
+			return key == "enabled" && value.Value == false
+		}).Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+
+		features := result.Documents[0].Root.Children[0].GetMapValue("app").GetMapValue("features")
+		if features.GetMapValue("billing").GetMapValue("enabled") != nil {
+			t.Error("enabled: false should be removed")
+		}
+		if features.GetMapValue("search").GetMapValue("enabled") == nil {
+			t.Error("enabled: true should be kept")
+		}
+	})
+
+	t.Run("original tree untouched", func(t *testing.T) {
+		if tree.Documents[0].Root.Children[0].GetMapValue("app").GetMapValue("description") == nil {
+			t.Error("RemoveWhere should not modify the input tree")
+		}
+	})
+}
+
+// TestTransformDSLSetStyle tests setting the style of every node of a kind
+func TestTransformDSLSetStyle(t *testing.T) {
+	input := `name: api
+ports:
+  - 80
+  - 443
+routes:
+  - path: /
+    methods:
+      - GET
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	render := func(t *testing.T, dsl *TransformDSL) string {
+		result, err := dsl.Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+		output, err := result.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		reparsed, err := UnmarshalYAML(output)
+		if err != nil {
+			t.Fatalf("output does not parse: %v\n%s", err, output)
+		}
+		if !tree.Equal(reparsed, EqualOptions{IgnoreStyle: true}) {
+			t.Errorf("styling changed the data:\n%s", output)
+		}
+		return string(output)
+	}
+
+	t.Run("flow sequences", func(t *testing.T) {
+		output := render(t, NewTransformDSL().SetStyle(SequenceNode, FlowStyle))
+		want := "name: api\nports: [80, 443]\nroutes: [{path: /, methods: [GET]}]\n"
+		if output != want {
+			t.Errorf("output = %q, want %q", output, want)
+		}
+	})
+
+	t.Run("double quoted scalars", func(t *testing.T) {
+		output := render(t, NewTransformDSL().SetStyle(ScalarNode, DoubleQuotedStyle))
+		want := "\"name\": \"api\"\n\"ports\":\n  - 80\n  - 443\n\"routes\":\n  - \"path\": \"/\"\n    \"methods\":\n      - \"GET\"\n"
+		if output != want {
+			t.Errorf("output = %q, want %q", output, want)
+		}
+	})
+
+	t.Run("incompatible combinations ignored", func(t *testing.T) {
+		output := render(t, NewTransformDSL().
+			SetStyle(MappingNode, LiteralStyle).
+			SetStyle(SequenceNode, DoubleQuotedStyle).
+			SetStyle(ScalarNode, FlowStyle))
+		if output != input {
+			t.Errorf("incompatible styles should be ignored, got:\n%s", output)
+		}
+	})
+
+	t.Run("block styles skip keys and numbers", func(t *testing.T) {
+		output := render(t, NewTransformDSL().SetStyle(ScalarNode, LiteralStyle))
+		if !strings.Contains(output, "name: |-\n  api\n") || !strings.Contains(output, "  - 80\n") {
+			t.Errorf("only string values should become literal blocks, got:\n%s", output)
+		}
+	})
+}
+
+// TestTransformDSLOrderKeys tests enforcing a canonical key order
+func TestTransformDSLOrderKeys(t *testing.T) {
+	input := `# Deployment manifest
+
+spec:
+  replicas: 2
+  selector: {}
+status: {}
+metadata:
+  name: web
+  labels: {}
+  annotations: {}
+kind: Deployment
+apiVersion: apps/v1
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	order := []string{"apiVersion", "kind", "metadata", "spec"}
+
+	keysOf := func(node *Node) []string {
+		var keys []string
+		for i := 0; i < len(node.Children)-1; i += 2 {
+			keys = append(keys, fmt.Sprintf("%v", node.Children[i].Value))
+		}
+		return keys
+	}
+
+	tests := []struct {
+		name         string
+		order        []string
+		opts         KeyOrderOptions
+		wantTop      []string
+		wantMetadata []string
+	}{
+		{
+			name:         "recursive",
+			order:        append(order, "name"),
+			wantTop:      []string{"apiVersion", "kind", "metadata", "spec", "status"},
+			wantMetadata: []string{"name", "labels", "annotations"},
+		},
+		{
+			name:         "sort unlisted",
+			order:        order,
+			opts:         KeyOrderOptions{SortUnlisted: true},
+			wantTop:      []string{"apiVersion", "kind", "metadata", "spec", "status"},
+			wantMetadata: []string{"annotations", "labels", "name"},
+		},
+		{
+			name:         "top level only",
+			order:        append(order, "name"),
+			opts:         KeyOrderOptions{TopLevelOnly: true, SortUnlisted: true},
+			wantTop:      []string{"apiVersion", "kind", "metadata", "spec", "status"},
+			wantMetadata: []string{"name", "labels", "annotations"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewTransformDSL().OrderKeysWithOptions(tt.order, tt.opts).Apply(tree)
+			if err != nil {
+				t.Fatalf("Transform failed: %v", err)
+			}
+			root := result.Documents[0].Root.Children[0]
+			if got := keysOf(root); !reflect.DeepEqual(got, tt.wantTop) {
+				t.Errorf("top-level keys = %v, want %v", got, tt.wantTop)
+			}
+			if got := keysOf(root.GetMapValue("metadata")); !reflect.DeepEqual(got, tt.wantMetadata) {
+				t.Errorf("metadata keys = %v, want %v", got, tt.wantMetadata)
+			}
+			if output, _ := result.ToYAML(); !strings.HasPrefix(string(output), "# Deployment manifest\n\napiVersion: apps/v1\n") {
+				t.Errorf("document comment should stay at the top, got:\n%s", output)
+			}
+		})
+	}
+
+	t.Run("OrderKeys keeps unlisted order", func(t *testing.T) {
+		result, err := NewTransformDSL().OrderKeys([]string{"kind"}).Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+		want := []string{"kind", "spec", "status", "metadata", "apiVersion"}
+		if got := keysOf(result.Documents[0].Root.Children[0]); !reflect.DeepEqual(got, want) {
+			t.Errorf("keys = %v, want %v", got, want)
+		}
+	})
+}
+
+// TestTransformDSLApplyInPlace tests transforming a tree without building a new one
+func TestTransformDSLApplyInPlace(t *testing.T) {
+	input := `config:
+  username: admin
+  password: secret
+  servers:
+    - name: b
+      port: 80
+    - name: a
+      port: 81
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	root := tree.Documents[0].Root
+	config := root.Children[0].GetMapValue("config")
+
+	dsl := NewTransformDSL().
+		RemoveKey("password").
+		RenameKey("username", "user").
+		SortKeys()
+	expected, err := dsl.Apply(tree)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	if err := dsl.ApplyInPlace(tree); err != nil {
+		t.Fatalf("ApplyInPlace() error = %v", err)
+	}
+
+	if tree.Documents[0].Root != root || root.Children[0].GetMapValue("config") != config {
+		t.Error("ApplyInPlace() should keep the original nodes")
+	}
+	if config.GetMapValue("password") != nil || config.GetMapValue("user") == nil {
+		t.Errorf("changes should be visible on the original tree, got %v", nodeToInterface(config))
+	}
+	if !tree.Equal(expected, EqualOptions{}) {
+		t.Error("ApplyInPlace() should produce the same result as Apply()")
+	}
+	for _, child := range config.Children {
+		if child.Parent != config {
+			t.Errorf("child %v should point to its mapping", child.Value)
+		}
+	}
+
+	t.Run("RemovedRoot", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("a: 1\n"))
+		remove := NewTransformDSL().Map(func(n *Node) *Node {
+			if n.Kind == DocumentNode {
+				return nil
+			}
+			return n
+		})
+		if err := remove.ApplyInPlace(tree); err != nil {
+			t.Fatalf("ApplyInPlace() error = %v", err)
+		}
+		if tree.Documents[0].Root != nil {
+			t.Error("a removed root should leave the document empty")
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if err := dsl.ApplyInPlace(nil); err == nil {
+			t.Error("ApplyInPlace(nil) should return an error")
+		}
+		failing := NewTransformDSL().ApplyTemplate(map[string]string{})
+		tree, _ := UnmarshalYAML([]byte("a: \"{{ .missing }}\"\n"))
+		if err := failing.ApplyInPlace(tree); err == nil {
+			t.Error("ApplyInPlace() should report transform errors")
+		}
+	})
+}
+
+func BenchmarkTransformDSLApplyInPlace(b *testing.B) {
+	var builder strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&builder, "service%d:\n  name: svc\n  port: %d\n  tags: [a, b]\n", i, i)
+	}
+	tree, _ := UnmarshalYAML([]byte(builder.String()))
+	dsl := NewTransformDSL().RenameKey("name", "title").SortKeys()
+
+	b.Run("Apply", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = dsl.Apply(tree)
+		}
+	})
+
+	b.Run("ApplyInPlace", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = dsl.ApplyInPlace(tree)
+		}
+	})
+}
+
+// TestTransformDSLInlineAliases tests expanding aliases and merge keys
+func TestTransformDSLInlineAliases(t *testing.T) {
+	t.Run("AnchorsAndMergeKeys", func(t *testing.T) {
+		input := anchorsYAML + `
+  timeout: 60
+servers:
+  - &primary
+    name: db1
+  - *primary
+backup: *primary
+`
+		tree, err := UnmarshalYAML([]byte(input))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+
+		result, err := NewTransformDSL().InlineAliases().Apply(tree)
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		output, err := result.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		for _, marker := range []string{"*", "&", "<<"} {
+			if strings.Contains(string(output), marker) {
+				t.Errorf("output should not contain %q:\n%s", marker, output)
+			}
+		}
+
+		root := result.Documents[0].Root.Children[0]
+		development := root.GetMapValue("development")
+		want := map[string]interface{}{"timeout": 60, "retries": 3, "host": "localhost"}
+		if got := nodeToInterface(development); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("development = %v, want %v", got, want)
+		}
+		if backup := root.GetMapValue("backup"); backup.GetMapValue("name").Value != "db1" {
+			t.Errorf("backup = %v, want the inlined primary server", nodeToInterface(backup))
+		}
+		if servers := root.GetMapValue("servers"); servers.Children[1].Kind != MappingNode {
+			t.Error("sequence aliases should be replaced by mappings")
+		}
+
+		if tree.Documents[0].Root.Children[0].GetMapValue("backup").Kind != AliasNode {
+			t.Error("Apply() should not change the input tree")
+		}
+	})
+
+	t.Run("InPlace", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte(anchorsYAML))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if err := NewTransformDSL().InlineAliases().ApplyInPlace(tree); err != nil {
+			t.Fatalf("ApplyInPlace() error = %v", err)
+		}
+		doc := tree.Documents[0]
+		if len(doc.Anchors) != 0 {
+			t.Errorf("Anchors = %v, want none", doc.Anchors)
+		}
+		development := doc.Root.Children[0].GetMapValue("development")
+		if timeout, _ := development.GetMapValue("timeout").AsInt(); timeout != 30 {
+			t.Errorf("development.timeout = %v, want 30", timeout)
+		}
+	})
+
+	t.Run("CyclicAnchor", func(t *testing.T) {
+		mapping := NewMappingNode()
+		mapping.Anchor = "self"
+		alias := NewAliasNode("self")
+		alias.Alias = mapping
+		mapping.AddKeyValue(NewScalarNode("child"), alias)
+		root := NewNode(DocumentNode)
+		root.AddChild(mapping)
+		tree := NewNodeTree()
+		tree.AddDocument().SetRoot(root)
+
+		if _, err := NewTransformDSL().InlineAliases().Apply(tree); err == nil {
+			t.Error("Apply() should report an alias nested inside its anchor")
+		}
+	})
+}
+
+// TestTransformDSLUnwrapSingleKey tests collapsing single-key wrapper mappings
+func TestTransformDSLUnwrapSingleKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "NestedWrapper",
+			input: "service:\n  wrapper:\n    name: api\n    port: 80\n",
+			want:  "service:\n  name: api\n  port: 80\n",
+		},
+		{
+			name:  "RootWrapper",
+			input: "wrapper:\n  actual: value\n",
+			want:  "actual: value\n",
+		},
+		{
+			name:  "RepeatedWrapper",
+			input: "a:\n  wrapper:\n    wrapper: [1, 2]\n",
+			want:  "a: [1, 2]\n",
+		},
+		{
+			name:  "MultiKeyMappingUntouched",
+			input: "wrapper:\n  actual: value\nother: 1\n",
+			want:  "wrapper:\n  actual: value\nother: 1\n",
+		},
+		{
+			name:  "OtherKeyUntouched",
+			input: "outer:\n  actual: value\n",
+			want:  "outer:\n  actual: value\n",
+		},
+		{
+			name:  "ScalarLineComment",
+			input: "list:\n  - wrapper: x # note\n",
+			want:  "list:\n  - x # note\n",
+		},
+		{
+			name:  "CollectionLineComment",
+			input: "service:\n  # head\n  wrapper: # note\n    name: api\n",
+			want:  "service:\n\n  # head\n  # note\n  name: api\n",
+		},
+		{
+			name:  "FootComment",
+			input: "a:\n  wrapper: x\n  # foot\nb: 1\n",
+			want:  "a: x\n\n# foot\n\nb: 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			result, err := NewTransformDSL().UnwrapSingleKey("wrapper").Apply(tree)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			output, err := result.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if string(output) != tt.want {
+				t.Errorf("UnwrapSingleKey() =\n%s\nwant\n%s", output, tt.want)
+			}
+		})
+	}
+
+	t.Run("ValueKeepsOwnComments", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte("a:\n  wrapper: x\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		wrapper := tree.Documents[0].Root.Children[0].GetMapValue("a").Children[0]
+		value := wrapper.Parent.Children[1]
+		wrapper.LineComment, wrapper.FootComment = "# wrapper", []string{"# wrapper foot"}
+		value.LineComment, value.FootComment = "# value", []string{"# value foot"}
+
+		result, err := NewTransformDSL().UnwrapSingleKey("wrapper").Apply(tree)
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		got := result.Documents[0].Root.Children[0].GetMapValue("a")
+		if got.LineComment != "# value" || len(got.FootComment) != 1 || got.FootComment[0] != "# value foot" {
+			t.Errorf("comments = %q, %q, want the value's own", got.LineComment, got.FootComment)
+		}
+	})
+}
+
+// TestTransformDSLRenameKeysRegex tests renaming keys with a regular expression
+func TestTransformDSLRenameKeysRegex(t *testing.T) {
+	tests := []struct {
+		name        string
+		pattern     string
+		replacement string
+		input       string
+		want        string
+	}{
+		{
+			name:        "CaptureGroup",
+			pattern:     `^old_(.*)$`,
+			replacement: "new_$1",
+			input:       "old_name: api\nold_port: 80\nkeep: true\nnested:\n  old_flag: on\n",
+			want:        "new_name: api\nnew_port: 80\nkeep: true\nnested:\n  new_flag: on\n",
+		},
+		{
+			name:        "StripPrefix",
+			pattern:     `^legacy_`,
+			replacement: "",
+			input:       "legacy_timeout: 30\nretries: 3\n",
+			want:        "timeout: 30\nretries: 3\n",
+		},
+		{
+			name:        "NamedGroup",
+			pattern:     `^(?P<word>[a-z]+)-(?P<rest>[a-z]+)$`,
+			replacement: "${word}_${rest}",
+			input:       "max-size: 1\nitems:\n  - some-key: x\n",
+			want:        "max_size: 1\nitems:\n  - some_key: x\n",
+		},
+		{
+			name:        "SuffixKeys",
+			pattern:     `^(a|b)$`,
+			replacement: "${1}1",
+			input:       "a: 1\nb: 2\n",
+			want:        "a1: 1\nb1: 2\n",
+		},
+		{
+			name:        "SwapKeys",
+			pattern:     `^(\w+)_(\w+)$`,
+			replacement: "${2}_${1}",
+			input:       "a_b: 1\nb_a: 2\n",
+			want:        "b_a: 1\na_b: 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			result, err := NewTransformDSL().RenameKeysRegex(tt.pattern, tt.replacement).Apply(tree)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			output, err := result.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if string(output) != tt.want {
+				t.Errorf("RenameKeysRegex() =\n%s\nwant\n%s", output, tt.want)
+			}
+		})
+	}
+
+	t.Run("InvalidPattern", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("a: 1\n"))
+		if _, err := NewTransformDSL().RenameKeysRegex(`(`, "x").Apply(tree); err == nil {
+			t.Error("Apply() should fail for an invalid pattern")
+		}
+	})
+
+	t.Run("DuplicateKey", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("old_name: a\nnew_name: b\n"))
+		if _, err := NewTransformDSL().RenameKeysRegex(`^old_`, "new_").Apply(tree); err == nil {
+			t.Error("Apply() should fail when a rename duplicates a key")
+		}
+	})
+
+	t.Run("FailedRenameChangesNothing", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("old_a: 1\nold_b: 2\nnew_b: 3\n"))
+		if err := NewTransformDSL().RenameKeysRegex(`^old_`, "new_").ApplyInPlace(tree); err == nil {
+			t.Fatal("ApplyInPlace() should fail when a rename duplicates a key")
+		}
+		if content := tree.Documents[0].Root.Children[0]; content.GetMapValue("old_a") == nil || content.GetMapValue("new_a") != nil {
+			t.Error("keys of a mapping with a failed rename should keep their names")
+		}
+	})
+}
+
+// TestTransformDSLCollectErrors tests reporting every transform failure at once
+func TestTransformDSLCollectErrors(t *testing.T) {
+	input := `old_name: a
+new_name: b
+service:
+  endpoint: "{{ .Missing }}"
+  ports:
+    - "{{ .Port }}"
+`
+	newDSL := func() *TransformDSL {
+		return NewTransformDSL().
+			RenameKeysRegex(`^old_`, "new_").
+			ApplyTemplate(map[string]interface{}{"Port": 80}).
+			SetStyle(ScalarNode, DoubleQuotedStyle)
+	}
+
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	if _, err := newDSL().Apply(tree); err == nil {
+		t.Fatal("Apply() should fail")
+	} else if _, ok := err.(TransformErrors); ok {
+		t.Error("Apply() without CollectErrors should fail on the first error")
+	}
+
+	result, err := newDSL().CollectErrors().Apply(tree)
+	if result != nil {
+		t.Error("Apply() should not return a tree when transforms failed")
+	}
+	var errs TransformErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Apply() error = %v, want TransformErrors", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("Apply() reported %d errors, want 2: %v", len(errs), err)
+	}
+
+	want := []struct{ transform, path string }{
+		{"renameKeysRegex", "$"},
+		{"applyTemplate", "$.service.endpoint"},
+	}
+	for i, w := range want {
+		if errs[i].Transform != w.transform || errs[i].Path != w.path || errs[i].Document != 0 {
+			t.Errorf("error %d = %+v, want %s at %s", i, errs[i], w.transform, w.path)
+		}
+		if !strings.Contains(err.Error(), w.transform) || !strings.Contains(err.Error(), w.path) {
+			t.Errorf("combined error %q should mention %s at %s", err, w.transform, w.path)
+		}
+	}
+
+	t.Run("InPlaceKeepsGoing", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte(input))
+		err := newDSL().CollectErrors().ApplyInPlace(tree)
+		if errs, ok := err.(TransformErrors); !ok || len(errs) != 2 {
+			t.Fatalf("ApplyInPlace() error = %v, want 2 TransformErrors", err)
+		}
+		port := tree.Documents[0].Root.Children[0].GetMapValue("service").GetMapValue("ports").Children[0]
+		if port.Value != "80" || port.Style != DoubleQuotedStyle {
+			t.Errorf("port = %v (style %v), want the later transforms applied", port.Value, port.Style)
+		}
+	})
+
+	t.Run("NoErrors", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("a: 1\n"))
+		if _, err := NewTransformDSL().CollectErrors().RenameKey("a", "b").Apply(tree); err != nil {
+			t.Errorf("Apply() error = %v", err)
+		}
+	})
+}
+
+// TestTransformDSLMapAt tests transforming only the nodes selected by a query
+func TestTransformDSLMapAt(t *testing.T) {
+	upper := func(node *Node) *Node {
+		if node.Kind == ScalarNode {
+			node.Value = strings.ToUpper(fmt.Sprintf("%v", node.Value))
+		}
+		return node
+	}
+	remove := func(*Node) *Node { return nil }
+
+	input := "users:\n  - name: alice\n    role: admin\n  - name: bob\n    role: dev\nname: team\n"
+
+	tests := []struct {
+		name  string
+		query string
+		fn    func(*Node) *Node
+		want  string
+	}{
+		{
+			name:  "WildcardPath",
+			query: "users/*/name",
+			fn:    upper,
+			want:  "users:\n  - name: ALICE\n    role: admin\n  - name: BOB\n    role: dev\nname: team\n",
+		},
+		{
+			name:  "IndexPath",
+			query: "users/[1]/role",
+			fn:    upper,
+			want:  "users:\n  - name: alice\n    role: admin\n  - name: bob\n    role: DEV\nname: team\n",
+		},
+		{
+			name:  "ReplaceNode",
+			query: "name",
+			fn:    func(*Node) *Node { return NewScalarNode("platform") },
+			want:  "users:\n  - name: alice\n    role: admin\n  - name: bob\n    role: dev\nname: platform\n",
+		},
+		{
+			name:  "RemoveMappingValue",
+			query: "users/*/role",
+			fn:    remove,
+			want:  "users:\n  - name: alice\n  - name: bob\nname: team\n",
+		},
+		{
+			name:  "RemoveSequenceItem",
+			query: "users/[0]",
+			fn:    remove,
+			want:  "users:\n  - name: bob\n    role: dev\nname: team\n",
+		},
+		{
+			name:  "NoMatch",
+			query: "groups/*/name",
+			fn:    upper,
+			want:  input,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+
+			result, err := NewTransformDSL().MapAt(tt.query, tt.fn).Apply(tree)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			output, err := result.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if string(output) != tt.want {
+				t.Errorf("MapAt() =\n%s\nwant\n%s", output, tt.want)
+			}
+
+			if err := NewTransformDSL().MapAt(tt.query, tt.fn).ApplyInPlace(tree); err != nil {
+				t.Fatalf("ApplyInPlace() error = %v", err)
+			}
+			if output, _ := tree.ToYAML(); string(output) != tt.want {
+				t.Errorf("MapAt() in place =\n%s\nwant\n%s", output, tt.want)
+			}
+		})
+	}
+
+	t.Run("OriginalUntouched", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte(input))
+		if _, err := NewTransformDSL().MapAt("users/*/name", upper).Apply(tree); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		if output, _ := tree.ToYAML(); string(output) != input {
+			t.Errorf("Apply() modified the input tree:\n%s", output)
+		}
+	})
+
+	t.Run("InvalidQuery", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte(input))
+		if _, err := NewTransformDSL().MapAt("users/[x]", upper).Apply(tree); err == nil {
+			t.Error("Apply() should fail for an invalid query")
+		}
+	})
+}
+
+// TestTransformDSLCoerceKey tests converting the values of a key to a type
+func TestTransformDSLCoerceKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		typ   string
+		input string
+		want  string
+	}{
+		{
+			name:  "PortsToInteger",
+			key:   "port",
+			typ:   "integer",
+			input: "port: \"8080\"\nservices:\n  - name: api\n    port: '9090'\n  - name: web\n    port: 80\ndb:\n  port: \" 5432 \"\n",
+			want:  "port: 8080\nservices:\n  - name: api\n    port: 9090\n  - name: web\n    port: 80\ndb:\n  port: 5432\n",
+		},
+		{
+			name:  "ToString",
+			key:   "version",
+			typ:   "string",
+			input: "version: 1.10\napp:\n  version: 2\n",
+			want:  "version: \"1.10\"\napp:\n  version: \"2\"\n",
+		},
+		{
+			name:  "ToNumber",
+			key:   "ratio",
+			typ:   "number",
+			input: "ratio: \"0.5\"\nother:\n  ratio: \"2\"\n",
+			want:  "ratio: 0.5\nother:\n  ratio: 2\n",
+		},
+		{
+			name:  "ToBoolean",
+			key:   "enabled",
+			typ:   "boolean",
+			input: "enabled: \"yes\"\nfeature:\n  enabled: \"false\"\n",
+			want:  "enabled: true\nfeature:\n  enabled: false\n",
+		},
+		{
+			name:  "NullAndCollectionsUntouched",
+			key:   "port",
+			typ:   "integer",
+			input: "port:\nnested:\n  port: [80]\n",
+			want:  "port:\nnested:\n  port: [80]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			result, err := NewTransformDSL().CoerceKey(tt.key, tt.typ).Apply(tree)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			output, err := result.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if string(output) != tt.want {
+				t.Errorf("CoerceKey() =\n%s\nwant\n%s", output, tt.want)
+			}
+		})
+	}
+
+	t.Run("TypedValues", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("port: \"8080\"\nservices:\n  - port: '9090'\n"))
+		result, err := NewTransformDSL().CoerceKey("port", "integer").Apply(tree)
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		for _, port := range Query(result.Documents[0].Root.Children[0], "services/*/port") {
+			if value, ok := port.Value.(int64); !ok || value != 9090 || port.Tag != "!!int" {
+				t.Errorf("port = %#v with tag %s, want int64 9090 tagged !!int", port.Value, port.Tag)
+			}
+		}
+	})
+
+	t.Run("CoercionFailure", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("port: http\n"))
+		_, err := NewTransformDSL().CoerceKey("port", "integer").Apply(tree)
+		if err == nil || !strings.Contains(err.Error(), `cannot coerce "http" to integer`) {
+			t.Errorf("Apply() error = %v, want a coercion error", err)
+		}
+	})
+
+	t.Run("UnknownType", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("port: 80\n"))
+		if _, err := NewTransformDSL().CoerceKey("port", "date").Apply(tree); err == nil {
+			t.Error("Apply() should fail for an unknown type")
+		}
+	})
+}
+
+// TestTransformDSLLimitDepth tests truncating deeply nested structures
+func TestTransformDSLLimitDepth(t *testing.T) {
+	deepNesting := `# Deeply nested structure with comments at every level
+level1:
+  # Level 2 comment
+  level2:
+    # Level 3 comment
+    level3:
+      # Level 4 comment
+      level4:
+        # Level 5 comment
+        level5:
+          # Level 6 comment
+          level6:
+            # Deep value with metadata
+            value: "deep"
+            # Sibling at depth
+            sibling: "also deep"
+          # Back at level 6
+          parallel6:
+            data: "parallel"
+        # Array at level 5
+        array5:
+          - item1  # First item
+          - item2  # Second item
+          - # Third item is a map
+            nested: true
+            complex: yes
+      # Back to level 4
+      level4b:
+        key: value
+`
+	tree, err := UnmarshalYAML([]byte(deepNesting))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		dsl         *TransformDSL
+		placeholder string
+		elided      []string
+		kept        []string
+		dropped     []string
+	}{
+		{
+			name:        "Placeholder",
+			dsl:         NewTransformDSL().LimitDepth(2),
+			placeholder: "...",
+			elided:      []string{"level1/level2/level3"},
+			kept:        []string{"level1/level2"},
+		},
+		{
+			name:        "DeeperLimit",
+			dsl:         NewTransformDSL().LimitDepth(4),
+			placeholder: "...",
+			elided:      []string{"level1/level2/level3/level4/level5", "level1/level2/level3/level4/array5"},
+			kept:        []string{"level1/level2/level3/level4b/key"},
+		},
+		{
+			name:        "CustomPlaceholder",
+			dsl:         NewTransformDSL().LimitDepthWithOptions(0, DepthLimitOptions{Placeholder: "<elided>"}),
+			placeholder: "<elided>",
+			elided:      []string{"level1"},
+		},
+		{
+			name:    "Drop",
+			dsl:     NewTransformDSL().LimitDepthWithOptions(3, DepthLimitOptions{Drop: true}),
+			kept:    []string{"level1/level2/level3"},
+			dropped: []string{"level1/level2/level3/level4", "level1/level2/level3/level4b"},
+		},
+		{
+			name: "WithinLimit",
+			dsl:  NewTransformDSL().LimitDepth(10),
+			kept: []string{"level1/level2/level3/level4/level5/level6/value", "level1/level2/level3/level4/array5/2/nested"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.dsl.Apply(tree)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			content := result.Documents[0].Root.Children[0]
+
+			for _, path := range tt.elided {
+				node := content.Resolve(path)
+				if node == nil || node.Kind != ScalarNode || node.Value != tt.placeholder {
+					t.Errorf("%s = %v, want the placeholder %q", path, node, tt.placeholder)
+				}
+			}
+			for _, path := range tt.kept {
+				if content.Resolve(path) == nil {
+					t.Errorf("%s should be kept", path)
+				}
+			}
+			for _, path := range tt.dropped {
+				if content.Resolve(path) != nil {
+					t.Errorf("%s should be dropped", path)
+				}
+			}
+		})
+	}
+
+	t.Run("ReparsesAsYAML", func(t *testing.T) {
+		result, err := NewTransformDSL().LimitDepth(1).Apply(tree)
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		output, err := result.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		reparsed, err := UnmarshalYAML(output)
+		if err != nil {
+			t.Fatalf("Failed to re-parse %s: %v", output, err)
+		}
+		if level2 := reparsed.Documents[0].Root.Children[0].Resolve("level1/level2"); level2 == nil || level2.Value != "..." {
+			t.Errorf("level2 = %v, want the placeholder after a round trip", level2)
+		}
+		if strings.Contains(string(output), "Level 3 comment") {
+			t.Error("comments inside elided subtrees should be dropped")
+		}
+	})
+
+	t.Run("Sequences", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte("matrix:\n  - [1, 2]\n  - [3, 4]\n  - 5\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		result, err := NewTransformDSL().LimitDepth(1).Apply(tree)
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		matrix := result.Documents[0].Root.Children[0].GetMapValue("matrix")
+		if len(matrix.Children) != 3 || matrix.Children[0].Value != "..." || matrix.Children[1].Value != "..." {
+			t.Errorf("nested sequences should be elided, got %v", matrix.Children)
+		}
+		if value, _ := matrix.Children[2].AsInt(); value != 5 {
+			t.Errorf("matrix[2] = %v, want 5", matrix.Children[2].Value)
+		}
+	})
+
+	t.Run("AliasIntoElidedSubtree", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte("a:\n  b: &x\n    c: 1\nd: *x\nkeep: &y 2\ne: *y\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		tests := []struct {
+			name string
+			dsl  *TransformDSL
+			want string
+		}{
+			{"Placeholder", NewTransformDSL().LimitDepth(1), "a:\n  b: '...'\nd: '...'\nkeep: &y 2\ne: *y\n"},
+			{"Drop", NewTransformDSL().LimitDepthWithOptions(1, DepthLimitOptions{Drop: true}), "a: {}\nkeep: &y 2\ne: *y\n"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				result, err := tt.dsl.Apply(tree)
+				if err != nil {
+					t.Fatalf("Apply() error = %v", err)
+				}
+				output, err := result.ToYAML()
+				if err != nil {
+					t.Fatalf("ToYAML() error = %v", err)
+				}
+				if string(output) != tt.want {
+					t.Errorf("LimitDepth() =\n%q\nwant\n%q", output, tt.want)
+				}
+				if _, err := UnmarshalYAML(output); err != nil {
+					t.Errorf("Failed to re-parse %s: %v", output, err)
+				}
+			})
+		}
+	})
+
+	t.Run("NegativeDepth", func(t *testing.T) {
+		if _, err := NewTransformDSL().LimitDepth(-1).Apply(tree); err == nil {
+			t.Error("Apply() should fail for a negative depth")
+		}
+	})
+}
+
+// TestTransformDSLApplyTemplate tests rendering string values as Go templates
+func TestTransformDSLApplyTemplate(t *testing.T) {
+	input := `service:
+  endpoint: "https://{{ .Region }}.example.com"
+  replicas: 3
+  tags:
+    - "{{ .Env }}-{{ .Region }}"
+    - static
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	t.Run("render values", func(t *testing.T) {
+		data := map[string]string{"Region": "eu-west-1", "Env": "prod"}
+		result, err := NewTransformDSL().ApplyTemplate(data).Apply(tree)
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+
+		service := result.Documents[0].Root.Children[0].GetMapValue("service")
+		if got := service.GetMapValue("endpoint").Value; got != "https://eu-west-1.example.com" {
+			t.Errorf("endpoint = %v, want https://eu-west-1.example.com", got)
+		}
+		tags := service.GetMapValue("tags")
+		if got := tags.Children[0].Value; got != "prod-eu-west-1" {
+			t.Errorf("tags[0] = %v, want prod-eu-west-1", got)
+		}
+		if got := tags.Children[1].Value; got != "static" {
+			t.Errorf("tags[1] = %v, want static", got)
+		}
+		if got, _ := service.GetMapValue("replicas").AsInt(); got != 3 {
+			t.Errorf("replicas = %v, want 3", got)
+		}
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		data := struct{ Region string }{Region: "eu-west-1"}
+		_, err := NewTransformDSL().ApplyTemplate(data).Apply(tree)
+		if err == nil {
+			t.Fatal("Apply() should fail when a template references a missing field")
+		}
+		if !strings.Contains(err.Error(), "applyTemplate") || !strings.Contains(err.Error(), "Env") {
+			t.Errorf("error should name the transform and the missing field, got %v", err)
+		}
+	})
+
+	t.Run("missing map key", func(t *testing.T) {
+		_, err := NewTransformDSL().ApplyTemplate(map[string]string{"Region": "eu-west-1"}).Apply(tree)
+		if err == nil {
+			t.Fatal("Apply() should fail when a template references a missing map key")
+		}
+	})
+}
+
+// TestSchemaRef tests resolving $ref against the root schema's definitions
+func TestSchemaRef(t *testing.T) {
+	schema := &Schema{
+		Type: "object",
+		Definitions: map[string]*Schema{
+			"Port": {Type: "integer", Minimum: float64Ptr(1), Maximum: float64Ptr(65535)},
+			"Service": {
+				Type:     "object",
+				Required: []string{"name"},
+				Properties: map[string]*Schema{
+					"name": {Type: "string"},
+					"port": {Ref: "#/definitions/Port"},
+				},
+			},
+			"Group": {
+				Type: "object",
+				Properties: map[string]*Schema{
+					"name":     {Type: "string"},
+					"children": {Type: "array", Items: &Schema{Ref: "#/definitions/Group"}},
+				},
+			},
+			"Loop":  {Ref: "#/definitions/Other"},
+			"Other": {Ref: "#/definitions/Loop"},
+		},
+		Properties: map[string]*Schema{
+			"services": {Type: "array", Items: &Schema{Ref: "#/definitions/Service"}},
+			"admin":    {Ref: "#/definitions/Port"},
+			"groups":   {Ref: "#/definitions/Group"},
+			"loop":     {Ref: "#/definitions/Loop"},
+			"missing":  {Ref: "#/definitions/Missing"},
+			"remote":   {Ref: "other.json#/definitions/Port"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		input     string
+		wantPaths []string
+		wantText  string
+	}{
+		{
+			name:  "ValidSharedDefinition",
+			input: "services:\n  - name: api\n    port: 8080\n  - name: web\n    port: 80\nadmin: 9000\n",
+		},
+		{
+			name:      "InvalidSharedDefinition",
+			input:     "services:\n  - name: api\n    port: 70000\n  - port: 80\nadmin: 0\n",
+			wantPaths: []string{"$.admin", "$.services[0].port", "$.services[1]"},
+		},
+		{
+			name:  "RecursiveDefinition",
+			input: "groups:\n  name: root\n  children:\n    - name: a\n      children:\n        - name: b\n",
+		},
+		{
+			name:      "RecursiveDefinitionError",
+			input:     "groups:\n  name: root\n  children:\n    - name: [a]\n",
+			wantPaths: []string{"$.groups.children[0].name"},
+		},
+		{
+			name:      "CircularRef",
+			input:     "loop: 1\n",
+			wantPaths: []string{"$.loop"},
+			wantText:  "circular $ref",
+		},
+		{
+			name:      "UndefinedRef",
+			input:     "missing: 1\n",
+			wantPaths: []string{"$.missing"},
+			wantText:  "undefined $ref",
+		},
+		{
+			name:      "ExternalRef",
+			input:     "remote: 1\n",
+			wantPaths: []string{"$.remote"},
+			wantText:  "unsupported $ref",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			errs := schema.Validate(tree.Documents[0].Root.Children[0], "$")
+
+			var paths []string
+			for _, e := range errs {
+				paths = append(paths, e.Path)
+				if tt.wantText != "" && !strings.Contains(e.Message, tt.wantText) {
+					t.Errorf("error %q should mention %q", e.Message, tt.wantText)
+				}
+			}
+			sort.Strings(paths)
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("Validate() error paths = %v, want %v (%v)", paths, tt.wantPaths, errs)
+			}
+		})
+	}
+}
+
+// TestSchemaConditional tests if/then/else validation
+func TestSchemaConditional(t *testing.T) {
+	conditional := &Schema{
+		Type: "object",
+		If: &Schema{
+			Properties: map[string]*Schema{"type": {Enum: []interface{}{"ingress"}}},
+			Required:   []string{"type"},
+		},
+		Then: &Schema{Required: []string{"host"}},
+		Else: &Schema{Required: []string{"port"}},
+	}
+
+	tests := []struct {
+		name       string
+		schema     *Schema
+		input      string
+		wantErrors int
+		wantText   string
+	}{
+		{"ThenBranchValid", conditional, "type: ingress\nhost: example.com\n", 0, ""},
+		{"ThenBranchInvalid", conditional, "type: ingress\nport: 80\n", 1, "'host'"},
+		{"ElseBranchValid", conditional, "type: service\nport: 80\n", 0, ""},
+		{"ElseBranchInvalid", conditional, "type: service\nhost: example.com\n", 1, "'port'"},
+		{"ThenOnly", &Schema{If: conditional.If, Then: conditional.Then}, "type: service\n", 0, ""},
+		{"NoIfSchema", &Schema{Then: conditional.Then, Else: conditional.Else}, "type: ingress\n", 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			errs := tt.schema.Validate(tree.Documents[0].Root.Children[0], "$")
+			if len(errs) != tt.wantErrors {
+				t.Fatalf("Validate() returned %d errors, want %d: %v", len(errs), tt.wantErrors, errs)
+			}
+			if tt.wantText != "" && !strings.Contains(errs[0].Message, tt.wantText) {
+				t.Errorf("error %q should mention %s", errs[0].Message, tt.wantText)
+			}
+		})
+	}
+}
+
+// TestSchemaExamples tests including titles and examples in validation messages
+func TestSchemaExamples(t *testing.T) {
+	schema := &Schema{
+		Type:     "object",
+		Required: []string{"email"},
+		Properties: map[string]*Schema{
+			"email": {
+				Type:     "string",
+				Format:   "email",
+				Examples: []interface{}{"user@example.com", "admin@example.com"},
+			},
+			"port": {
+				Type:     "integer",
+				Title:    "Service port",
+				Minimum:  float64Ptr(1),
+				Examples: []interface{}{8080},
+			},
+			"name": {Type: "string", MinLength: intPtr(3)},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"FormatExample", "email: not-an-email\n", "string does not match format email, e.g. user@example.com"},
+		{"TitleAndExample", "email: a@b.co\nport: 0\n", "Service port: value 0.000000 is less than minimum 1.000000, e.g. 8080"},
+		{"TypeMismatchExample", "email: a@b.co\nport: high\n", "Service port: expected type integer but got string, e.g. 8080"},
+		{"NoAnnotations", "email: a@b.co\nname: x\n", "string length 1 is less than minimum 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			errs := schema.Validate(tree.Documents[0].Root.Children[0], "$")
+			if len(errs) != 1 {
+				t.Fatalf("Validate() returned %d errors, want 1: %v", len(errs), errs)
+			}
+			if errs[0].Message != tt.want {
+				t.Errorf("Message = %q, want %q", errs[0].Message, tt.want)
+			}
+		})
+	}
+}
+
+// TestSchemaStringLengthRunes tests that string lengths count characters rather than bytes
+func TestSchemaStringLengthRunes(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		minLength int
+		maxLength int
+		wantValid bool
+	}{
+		{"EmojiWithinMax", "🎉🎊", 1, 2, true},
+		{"AccentedWithinMax", "café", 4, 4, true},
+		{"EmojiBelowMin", "🎉", 2, 10, false},
+		{"AccentedAboveMax", "héllo wörld", 1, 10, false},
+		{"CJKExactLength", "日本語", 3, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := &Schema{Type: "string", MinLength: intPtr(tt.minLength), MaxLength: intPtr(tt.maxLength)}
+			errors := schema.Validate(NewScalarNode(tt.value), "$")
+			if valid := len(errors) == 0; valid != tt.wantValid {
+				t.Errorf("Validate(%q) valid = %v, want %v: %v", tt.value, valid, tt.wantValid, errors)
+			}
+		})
+	}
+
+	t.Run("MessageReportsCharacters", func(t *testing.T) {
+		schema := &Schema{Type: "string", MaxLength: intPtr(1)}
+		errors := schema.Validate(NewScalarNode("🎉🎊"), "$")
+		if len(errors) != 1 || !strings.Contains(errors[0].Message, "string length 2 exceeds maximum 1") {
+			t.Errorf("Validate() = %v, want a length 2 error", errors)
+		}
+	})
+}
+
+// TestSchemaContentEncoding tests validating embedded base64 data and its media type
+func TestSchemaContentEncoding(t *testing.T) {
+	gif := "R0lGODlhDAAMAIQAAP//9/X17unp5WZmZgAAAOfn515eXvPz7Y6OjuDg4J+fn5"
+
+	tests := []struct {
+		name      string
+		schema    *Schema
+		value     string
+		wantError string
+	}{
+		{"ValidBase64", &Schema{Type: "string", ContentEncoding: "base64"}, "aGVsbG8gd29ybGQ=", ""},
+		{"InvalidBase64", &Schema{Type: "string", ContentEncoding: "base64"}, "not base64!", "string is not valid base64"},
+		{"BadPadding", &Schema{Type: "string", ContentEncoding: "base64"}, "aGVsbG8", "string is not valid base64"},
+		{"BlockScalarLineBreaks", &Schema{Type: "string", ContentEncoding: "base64"}, "aGVsbG8g\nd29ybGQ=\n", ""},
+		{"JSONMediaType", &Schema{Type: "string", ContentEncoding: "base64", ContentMediaType: "application/json"}, "eyJhIjogMX0=", ""},
+		{"InvalidJSON", &Schema{Type: "string", ContentEncoding: "base64", ContentMediaType: "application/json"}, "aGVsbG8gd29ybGQ=", "content is not valid application/json"},
+		{"PlainJSON", &Schema{Type: "string", ContentMediaType: "application/json"}, `{"a": 1}`, ""},
+		{"MatchingImage", &Schema{Type: "string", ContentEncoding: "base64", ContentMediaType: "image/gif"}, gif + "==", ""},
+		{"MismatchedImage", &Schema{Type: "string", ContentEncoding: "base64", ContentMediaType: "image/png"}, gif + "==", "detected image/gif"},
+		{"MismatchedDocument", &Schema{Type: "string", ContentEncoding: "base64", ContentMediaType: "image/png"}, "JVBERi0xLjQ=", "detected application/pdf"},
+		{"UnrecognizedBytes", &Schema{Type: "string", ContentEncoding: "base64", ContentMediaType: "image/png"}, "AAECAw==", ""},
+		{"UnknownEncoding", &Schema{Type: "string", ContentEncoding: "quoted-printable"}, "anything", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := tt.schema.Validate(NewScalarNode(tt.value), "$")
+			if tt.wantError == "" {
+				if len(errors) != 0 {
+					t.Errorf("Validate() = %v, want no errors", errors)
+				}
+				return
+			}
+			if len(errors) != 1 || !strings.Contains(errors[0].Message, tt.wantError) {
+				t.Errorf("Validate() = %v, want an error containing %q", errors, tt.wantError)
+			}
+		})
+	}
+
+	t.Run("BinaryExample", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte("binary: !!binary |\n  " + gif + "==\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		schema := &Schema{
+			Type:       "object",
+			Properties: map[string]*Schema{"binary": {Type: "string", ContentEncoding: "base64", ContentMediaType: "image/gif"}},
+		}
+		if errors := schema.Validate(tree.Documents[0].Root.Children[0], "$"); len(errors) != 0 {
+			t.Errorf("Validate() = %v, want no errors", errors)
+		}
+	})
+}
+
+// TestSchemaAnnotate tests documenting a tree with schema descriptions
+func TestSchemaAnnotate(t *testing.T) {
+	schema := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"name": {Type: "string", Description: "Name of the service"},
+			"port": {Type: "integer"},
+			"database": {
+				Type:        "object",
+				Description: "Database connection\nUsed by every worker",
+				Properties: map[string]*Schema{
+					"host": {Type: "string", Description: "Database host"},
+				},
+			},
+			"workers": {
+				Type:  "array",
+				Items: &Schema{Ref: "#/definitions/worker"},
+			},
+		},
+		Definitions: map[string]*Schema{
+			"worker": {
+				Type: "object",
+				Properties: map[string]*Schema{
+					"queue": {Description: "Queue the worker consumes"},
+				},
+			},
+		},
+	}
+
+	input := `name: api
+# Listening port
+port: 8080
+database:
+  host: db
+workers:
+  - queue: jobs
+  - queue: mail
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	schema.Annotate(tree.Documents[0].Root)
+
+	root := tree.Documents[0].Root.Children[0]
+	keyComment := func(mapping *Node, key string) []string {
+		for i := 0; i < len(mapping.Children)-1; i += 2 {
+			if mapping.Children[i].Value == key {
+				return mapping.Children[i].HeadComment
+			}
+		}
+		t.Fatalf("key %s not found", key)
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		mapping *Node
+		key     string
+		want    []string
+	}{
+		{"Described", root, "name", []string{"# Name of the service"}},
+		{"ExistingCommentKept", root, "port", []string{"# Listening port"}},
+		{"MultiLine", root, "database", []string{"# Database connection", "# Used by every worker"}},
+		{"Nested", root.GetMapValue("database"), "host", []string{"# Database host"}},
+		{"NoDescription", root, "workers", nil},
+		{"ItemsByRef", root.GetMapValue("workers").Children[1], "queue", []string{"# Queue the worker consumes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keyComment(tt.mapping, tt.key); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s head comment = %q, want %q", tt.key, got, tt.want)
 			}
-			return false
 		})
-		result, err := dsl.Apply(tree)
+	}
+
+	t.Run("Output", func(t *testing.T) {
+		output, err := tree.ToYAML()
 		if err != nil {
-			t.Fatalf("Transform failed: %v", err)
+			t.Fatalf("ToYAML() error = %v", err)
 		}
-
-		output, _ := result.ToYAML()
-		if !strings.Contains(string(output), "config:") {
-			t.Errorf("Config should be kept. Output: %s", string(output))
+		for _, comment := range []string{"# Name of the service\nname: api", "# Database host\n  host: db", "# Listening port\nport: 8080"} {
+			if !strings.Contains(string(output), comment) {
+				t.Errorf("output missing %q:\n%s", comment, output)
+			}
 		}
-		if strings.Contains(string(output), "metadata:") {
-			t.Error("Metadata should be filtered out")
+	})
+
+	t.Run("Idempotent", func(t *testing.T) {
+		before, _ := tree.ToYAML()
+		schema.Annotate(tree.Documents[0].Root)
+		if after, _ := tree.ToYAML(); string(after) != string(before) {
+			t.Errorf("second Annotate() changed the output:\n%s", after)
 		}
 	})
+}
 
-	t.Run("Map", func(t *testing.T) {
-		// Custom transform to uppercase all string values
-		dsl := NewTransformDSL().Map(func(node *Node) *Node {
-			if node.Kind == ScalarNode && node.Value != nil {
-				if str, ok := node.Value.(string); ok {
-					node.Value = strings.ToUpper(str)
+// TestSchemaValidateWithSeverity tests ranking schema violations as warnings or errors
+func TestSchemaValidateWithSeverity(t *testing.T) {
+	schema := &Schema{
+		Type:     "object",
+		Required: []string{"name", "owner"},
+		Properties: map[string]*Schema{
+			"name":    {Type: "string"},
+			"email":   {Type: "string", Format: "email"},
+			"replica": {Type: "integer", Minimum: float64Ptr(1)},
+			"config":  {Type: "string", ContentMediaType: "application/json"},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]Severity
+	}{
+		{
+			name:  "Valid",
+			input: "name: api\nowner: team-a\nemail: ops@example.com\n",
+		},
+		{
+			name:  "BadFormatIsWarning",
+			input: "name: api\nowner: team-a\nemail: not-an-email\n",
+			want:  map[string]Severity{"$.email": SeverityWarning},
+		},
+		{
+			name:  "BadContentIsWarning",
+			input: "name: api\nowner: team-a\nconfig: '{broken'\n",
+			want:  map[string]Severity{"$.config": SeverityWarning},
+		},
+		{
+			name:  "MissingRequiredIsError",
+			input: "name: api\nemail: ops@example.com\n",
+			want:  map[string]Severity{"$": SeverityError},
+		},
+		{
+			name:  "Mixed",
+			input: "name: 42\nowner: team-a\nemail: nope\nreplica: 0\n",
+			want:  map[string]Severity{"$.name": SeverityError, "$.email": SeverityWarning, "$.replica": SeverityError},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			root := tree.Documents[0].Root.Children[0]
+
+			issues := schema.ValidateWithSeverity(root, "$")
+			if len(issues) != len(tt.want) {
+				t.Fatalf("ValidateWithSeverity() = %v, want %d issues", issues, len(tt.want))
+			}
+			for _, issue := range issues {
+				want, ok := tt.want[issue.Path]
+				if !ok {
+					t.Errorf("unexpected issue %v", issue)
+					continue
+				}
+				if issue.Severity != want {
+					t.Errorf("issue at %s has severity %s, want %s", issue.Path, issue.Severity, want)
+				}
+				if issue.Message == "" {
+					t.Errorf("issue at %s has no message", issue.Path)
 				}
 			}
-			return node
+
+			if errs := schema.Validate(root, "$"); len(errs) != len(issues) {
+				t.Errorf("Validate() returned %d errors, want the %d issues", len(errs), len(issues))
+			}
 		})
-		result, err := dsl.Apply(tree)
-		if err != nil {
-			t.Fatalf("Transform failed: %v", err)
-		}
+	}
 
-		output, _ := result.ToYAML()
-		if !strings.Contains(string(output), "LOCALHOST") {
-			t.Error("String values should be uppercase")
+	t.Run("String", func(t *testing.T) {
+		issue := ValidationIssue{ValidationError: ValidationError{Path: "$.email", Message: "bad", Value: "x"}, Severity: SeverityWarning}
+		if got := issue.String(); !strings.HasPrefix(got, "warning: ") || !strings.Contains(got, "$.email") {
+			t.Errorf("String() = %q", got)
 		}
 	})
+}
 
-	t.Run("Chained transforms", func(t *testing.T) {
-		dsl := NewTransformDSL().
-			RemoveKey("password").
-			RenameKey("username", "user").
-			SortKeys().
-			AddComment("Modified")
+// TestSchemaPatternCache tests that cached patterns and formats validate consistently
+func TestSchemaPatternCache(t *testing.T) {
+	schema := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"code":  {Type: "string", Pattern: `^[A-Z]{3}-\d+$`},
+			"email": {Type: "string", Format: "email"},
+			"id":    {Type: "string", Format: "uuid"},
+			"bad":   {Type: "string", Pattern: `([`},
+		},
+	}
 
-		result, err := dsl.Apply(tree)
-		if err != nil {
-			t.Fatalf("Transform failed: %v", err)
-		}
+	tests := []struct {
+		name       string
+		input      string
+		wantErrors int
+	}{
+		{"Valid", "code: ABC-1\nemail: a@b.com\nid: 123e4567-e89b-12d3-a456-426614174000\n", 0},
+		{"PatternMismatch", "code: abc-1\n", 1},
+		{"FormatMismatch", "email: nope\nid: 123\n", 2},
+		{"InvalidPattern", "bad: anything\n", 1},
+	}
 
-		output, _ := result.ToYAML()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			node := tree.Documents[0].Root.Children[0]
+			// Repeated validations must hit the cache and agree with the first run
+			for i := 0; i < 3; i++ {
+				if errs := schema.Validate(node, "$"); len(errs) != tt.wantErrors {
+					t.Fatalf("run %d: Validate() returned %d errors, want %d: %v", i, len(errs), tt.wantErrors, errs)
+				}
+			}
+		})
+	}
 
-		// Verify all transforms were applied
-		if strings.Contains(string(output), "password") {
-			t.Error("Password should be removed")
-		}
-		if strings.Contains(string(output), "username:") {
-			t.Error("Username should be renamed")
-		}
-		if !strings.Contains(string(output), "user:") {
-			t.Error("User key should exist")
+	t.Run("SameCompiledPattern", func(t *testing.T) {
+		if cachedRegexp(`^x+$`) != cachedRegexp(`^x+$`) {
+			t.Error("cachedRegexp() should return the same compiled pattern")
 		}
-		if !strings.Contains(string(output), "Modified") {
-			t.Error("Comment should be added")
+		if cachedRegexp(`([`) != nil {
+			t.Error("cachedRegexp() should return nil for an invalid pattern")
 		}
 	})
+}
 
-	t.Run("Transform with nil tree", func(t *testing.T) {
-		dsl := NewTransformDSL().RemoveKey("test")
-		result, err := dsl.Apply(nil)
-		if err == nil {
-			t.Error("Should error on nil tree")
-		}
-		if result != nil {
-			t.Error("Result should be nil on error")
-		}
+// TestRegisterFormat tests validating strings against a custom named format
+func TestRegisterFormat(t *testing.T) {
+	RegisterFormat("duration", func(value string) bool {
+		_, err := time.ParseDuration(value)
+		return err == nil
 	})
+	defer RegisterFormat("duration", nil)
 
-	t.Run("Transform empty tree", func(t *testing.T) {
-		emptyTree := &NodeTree{}
-		dsl := NewTransformDSL().AddComment("test")
-		result, err := dsl.Apply(emptyTree)
-		if err != nil {
-			t.Errorf("Should handle empty tree: %v", err)
-		}
-		if result == nil {
-			t.Error("Should return non-nil result")
+	schema := &Schema{Type: "string", Format: "duration"}
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"30s", true},
+		{"1h30m", true},
+		{"bad", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			errs := schema.Validate(&Node{Kind: ScalarNode, Value: tt.value}, "$")
+			if valid := len(errs) == 0; valid != tt.valid {
+				t.Errorf("Validate(%q) valid = %v, want %v: %v", tt.value, valid, tt.valid, errs)
+			}
+		})
+	}
+
+	t.Run("Unregistered", func(t *testing.T) {
+		RegisterFormat("duration", nil)
+		if errs := schema.Validate(&Node{Kind: ScalarNode, Value: "bad"}, "$"); len(errs) != 0 {
+			t.Errorf("unknown formats should be accepted, got %v", errs)
 		}
 	})
 }
@@ -893,10 +2773,114 @@ func TestQueryEdgeCases(t *testing.T) {
 			root = root.Children[0]
 		}
 
-		results := Query(root, "list/[-1]")
-		// Negative indices might be supported to get from end
-		// or might return empty - implementation dependent
-		_ = results
+		tests := []struct {
+			query string
+			want  []string
+		}{
+			{"list/[-1]", []string{"c"}},
+			{"list/[-2]", []string{"b"}},
+			{"list/[-3]", []string{"a"}},
+			{"list/[-4]", nil},
+			{"list/[-99]", nil},
+		}
+		for _, tt := range tests {
+			var got []string
+			for _, node := range Query(root, tt.query) {
+				got = append(got, fmt.Sprintf("%v", node.Value))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Query(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		}
+	})
+}
+
+// TestQuerySlice tests selecting ranges of sequence items
+func TestQuerySlice(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte("users: [a, b, c, d, e]\nname: x\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	root := tree.Documents[0].Root.Children[0]
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"Forward", "users/[1:3]", []string{"b", "c"}},
+		{"OpenStart", "users/[:2]", []string{"a", "b"}},
+		{"OpenEnd", "users/[2:]", []string{"c", "d", "e"}},
+		{"Whole", "users/[:]", []string{"a", "b", "c", "d", "e"}},
+		{"NegativeStart", "users/[-2:]", []string{"d", "e"}},
+		{"NegativeEnd", "users/[:-3]", []string{"a", "b"}},
+		{"BothNegative", "users/[-4:-2]", []string{"b", "c"}},
+		{"ClampedEnd", "users/[3:99]", []string{"d", "e"}},
+		{"ClampedStart", "users/[-99:1]", []string{"a"}},
+		{"EmptyRange", "users/[3:1]", nil},
+		{"PastEnd", "users/[7:9]", nil},
+		{"NotASequence", "name/[0:1]", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, node := range Query(root, tt.query) {
+				got = append(got, fmt.Sprintf("%v", node.Value))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Query(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("FollowedByKey", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("users:\n  - name: Alice\n  - name: Bob\n  - name: Carol\n"))
+		results := Query(tree.Documents[0].Root.Children[0], "users/[1:]/name")
+		if len(results) != 2 || results[0].Value != "Bob" || results[1].Value != "Carol" {
+			t.Errorf("Query() = %v, want [Bob Carol]", results)
+		}
+	})
+}
+
+// TestCompileQuery tests compiling queries once and running them repeatedly
+func TestCompileQuery(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte("users:\n  - name: Alice\n  - name: Bob\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	root := tree.Documents[0].Root.Children[0]
+
+	t.Run("MatchesQuery", func(t *testing.T) {
+		for _, query := range []string{"users/*/name", "users/[1]/name", "users/[5]", "users/[0:1]/name", "missing", ""} {
+			compiled, err := CompileQuery(query)
+			if err != nil {
+				t.Fatalf("CompileQuery(%q) error = %v", query, err)
+			}
+			if got, want := compiled.Run(root), Query(root, query); !reflect.DeepEqual(got, want) {
+				t.Errorf("Run(%q) = %v, want %v", query, got, want)
+			}
+		}
+	})
+
+	t.Run("Reusable", func(t *testing.T) {
+		compiled, _ := CompileQuery("users/[0]/name")
+		for i := 0; i < 2; i++ {
+			if results := compiled.Run(root); len(results) != 1 || results[0].Value != "Alice" {
+				t.Errorf("run %d: Run() = %v, want [Alice]", i, results)
+			}
+		}
+	})
+
+	t.Run("InvalidSyntax", func(t *testing.T) {
+		for _, query := range []string{"users/[abc]", "users/[0", "users/[]", "users/[a:2]", "users/[1:2:3]"} {
+			if _, err := CompileQuery(query); err == nil {
+				t.Errorf("CompileQuery(%q) should return an error", query)
+			}
+			if results := Query(root, query); len(results) != 0 {
+				t.Errorf("Query(%q) = %v, want no results", query, results)
+			}
+		}
 	})
 }
 
@@ -954,6 +2938,79 @@ incomplete: [`
 	})
 }
 
+// TestStreamParserSchema tests validating each streamed document against a schema
+func TestStreamParserSchema(t *testing.T) {
+	stream := `---
+name: first
+replicas: 1
+---
+name: second
+replicas: many
+---
+name: third
+replicas: 3
+`
+	schema := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"name":     {Type: "string"},
+			"replicas": {Type: "integer"},
+		},
+		Required: []string{"name", "replicas"},
+	}
+
+	t.Run("validation callback", func(t *testing.T) {
+		parser := NewStreamParser(strings.NewReader(stream))
+		parser.SetSchema(schema)
+
+		var invalid []int
+		parser.SetValidationCallback(func(index int, errs []ValidationError) error {
+			invalid = append(invalid, index)
+			if len(errs) != 1 || errs[0].Path != "$.replicas" {
+				t.Errorf("document %d errors = %v, want one error at $.replicas", index, errs)
+			}
+			return nil
+		})
+		docCount := 0
+		parser.SetDocumentCallback(func(tree *NodeTree) error {
+			docCount++
+			return nil
+		})
+
+		if err := parser.Parse(); err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if len(invalid) != 1 || invalid[0] != 1 {
+			t.Errorf("invalid documents = %v, want [1]", invalid)
+		}
+		if docCount != 3 {
+			t.Errorf("Expected all 3 documents to reach the document callback, got %d", docCount)
+		}
+	})
+
+	t.Run("no validation callback", func(t *testing.T) {
+		parser := NewStreamParser(strings.NewReader(stream))
+		parser.SetSchema(schema)
+
+		err := parser.Parse()
+		if err == nil || !strings.Contains(err.Error(), "document 1") {
+			t.Errorf("Parse() error = %v, want a validation error for document 1", err)
+		}
+	})
+
+	t.Run("callback stops parsing", func(t *testing.T) {
+		parser := NewStreamParser(strings.NewReader(stream))
+		parser.SetSchema(schema)
+		parser.SetValidationCallback(func(index int, errs []ValidationError) error {
+			return errors.New("stop")
+		})
+
+		if err := parser.Parse(); err == nil {
+			t.Error("Parse() should fail when the validation callback returns an error")
+		}
+	})
+}
+
 type errorReader struct {
 	err error
 }
@@ -1030,6 +3087,26 @@ email: "john@example.com"
 	}
 }
 
+func BenchmarkSchemaPatternValidation(b *testing.B) {
+	pattern := `^[a-z0-9]+(-[a-z0-9]+)*\.example\.com$`
+	value := "api-gateway-01.example.com"
+
+	b.Run("Uncompiled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = regexp.MatchString(pattern, value)
+		}
+	})
+
+	b.Run("Cached", func(b *testing.B) {
+		schema := &Schema{Type: "string", Pattern: pattern}
+		node := &Node{Kind: ScalarNode, Value: value}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = schema.Validate(node, "$")
+		}
+	})
+}
+
 func BenchmarkStreamParser(b *testing.B) {
 	// Create multi-document YAML
 	var sb strings.Builder
@@ -1094,6 +3171,26 @@ deeply:
 	}
 }
 
+func BenchmarkCompiledQuery(b *testing.B) {
+	tree, _ := UnmarshalYAML([]byte("a:\n  b:\n    items:\n      - c:\n          d: found\n"))
+	root := tree.Documents[0].Root.Children[0]
+	query := "a/b/items/[0]/c/d"
+
+	b.Run("Query", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = Query(root, query)
+		}
+	})
+
+	b.Run("Compiled", func(b *testing.B) {
+		compiled, _ := CompileQuery(query)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = compiled.Run(root)
+		}
+	})
+}
+
 // Test concurrent access (if applicable)
 func TestConcurrentAccess(t *testing.T) {
 	yamlContent := `
@@ -0,0 +1,139 @@
+package golang_yaml_advanced
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// anchorNameInvalid matches characters that are replaced when deriving an anchor name
+// from a mapping key
+var anchorNameInvalid = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// AutoAnchor finds mappings and sequences that occur more than once in the document
+// with identical content, anchors the first occurrence and replaces the others with
+// aliases to it. It returns the number of aliases created.
+//
+// Names are deterministic: an anchor is named after the mapping key of its first
+// occurrence, or "anchor" for sequence items and the root, with a -2, -3, ... suffix
+// when the name is already taken. Anchors are named in document order, so running
+// AutoAnchor on equal documents always produces the same output. Comments and styles
+// are ignored when comparing content, and subtrees that already contain anchors or
+// aliases are left alone.
+func (d *Document) AutoAnchor() int {
+	if d == nil || d.Root == nil {
+		return 0
+	}
+
+	keys := make(map[*Node]string)
+	contentKey(d.Root, keys)
+
+	used := make(map[string]bool)
+	for name := range d.Anchors {
+		used[name] = true
+	}
+	d.Root.Walk(func(n *Node) bool {
+		if n.Anchor != "" {
+			used[n.Anchor] = true
+		}
+		return true
+	})
+
+	first := make(map[string]*Node)
+	aliases := 0
+
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		for i, child := range n.Children {
+			key := keys[child]
+			if key == "" || (child.Kind != MappingNode && child.Kind != SequenceNode) || len(child.Children) == 0 {
+				visit(child)
+				continue
+			}
+
+			target, seen := first[key]
+			if !seen {
+				first[key] = child
+				visit(child)
+				continue
+			}
+
+			if target.Anchor == "" {
+				d.RegisterAnchor(uniqueAnchorName(anchorBaseName(target), used), target)
+			}
+			alias := NewAliasNode(target.Anchor)
+			alias.Alias = target
+			alias.Parent = n
+			alias.Key = child.Key
+			alias.HeadComment = child.HeadComment
+			alias.LineComment = child.LineComment
+			alias.FootComment = child.FootComment
+			alias.Line, alias.Column = child.Line, child.Column
+			n.Children[i] = alias
+			aliases++
+		}
+	}
+	visit(d.Root)
+
+	return aliases
+}
+
+// AutoAnchor runs Document.AutoAnchor on every document and returns the total
+// number of aliases created
+func (nt *NodeTree) AutoAnchor() int {
+	aliases := 0
+	for _, doc := range nt.Documents {
+		aliases += doc.AutoAnchor()
+	}
+	return aliases
+}
+
+// contentKey records in keys a string identifying the content of n and each of its
+// descendants. Subtrees containing anchors or aliases get an empty key.
+func contentKey(n *Node, keys map[*Node]string) string {
+	var b strings.Builder
+	eligible := n.Anchor == "" && n.Kind != AliasNode
+
+	fmt.Fprintf(&b, "%d|%s|", n.Kind, n.Tag)
+	if n.Kind == ScalarNode {
+		fmt.Fprintf(&b, "%T:%q", n.Value, fmt.Sprintf("%v", n.Value))
+	}
+	b.WriteString("(")
+	for _, child := range n.Children {
+		childKey := contentKey(child, keys)
+		if childKey == "" {
+			eligible = false
+		}
+		b.WriteString(childKey)
+		b.WriteString(",")
+	}
+	b.WriteString(")")
+
+	if !eligible {
+		keys[n] = ""
+		return ""
+	}
+	keys[n] = b.String()
+	return keys[n]
+}
+
+// anchorBaseName derives an anchor name from the key a node is stored under
+func anchorBaseName(n *Node) string {
+	if key, ok := n.KeyName(); ok {
+		if name := strings.Trim(anchorNameInvalid.ReplaceAllString(key, "-"), "-"); name != "" {
+			return name
+		}
+	}
+	return "anchor"
+}
+
+// uniqueAnchorName returns base, or base with the smallest free numeric suffix, and
+// marks the result as used
+func uniqueAnchorName(base string, used map[string]bool) string {
+	name := base
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	used[name] = true
+	return name
+}
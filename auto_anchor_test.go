@@ -0,0 +1,109 @@
+package golang_yaml_advanced
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestAutoAnchor tests replacing repeated subtrees with deterministic anchors and aliases
+func TestAutoAnchor(t *testing.T) {
+	input := `defaults:
+  timeout: 30
+  retries: 3
+services:
+  api:
+    settings:
+      timeout: 30
+      retries: 3
+    ports: [80, 443]
+  web:
+    settings:
+      timeout: 30
+      retries: 3
+    ports: [80, 443]
+  worker:
+    ports: [80, 443]
+`
+
+	anchorNames := func(tree *NodeTree) []string {
+		var names []string
+		tree.Documents[0].Root.Walk(func(n *Node) bool {
+			if n.Anchor != "" {
+				names = append(names, n.Anchor)
+			}
+			return true
+		})
+		return names
+	}
+
+	t.Run("Deterministic", func(t *testing.T) {
+		original, err := UnmarshalYAML([]byte(input))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+
+		first, second := original.Clone(), original.Clone()
+		if aliases := first.AutoAnchor(); aliases != 3 {
+			t.Errorf("AutoAnchor() = %d, want 3", aliases)
+		}
+		second.AutoAnchor()
+
+		if got, want := anchorNames(first), []string{"defaults", "api", "ports"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("anchor names = %v, want %v", got, want)
+		}
+		if !reflect.DeepEqual(anchorNames(first), anchorNames(second)) {
+			t.Errorf("anchor names differ between runs: %v and %v", anchorNames(first), anchorNames(second))
+		}
+
+		firstOutput, err := first.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		secondOutput, _ := second.ToYAML()
+		if string(firstOutput) != string(secondOutput) {
+			t.Errorf("output differs between runs:\n%s\n---\n%s", firstOutput, secondOutput)
+		}
+		for _, want := range []string{"&defaults", "*defaults", "&api", "*api", "&ports", "*ports"} {
+			if !strings.Contains(string(firstOutput), want) {
+				t.Errorf("output missing %s:\n%s", want, firstOutput)
+			}
+		}
+
+		var got, want interface{}
+		if err := yaml.Unmarshal(firstOutput, &got); err != nil {
+			t.Fatalf("Failed to re-parse: %v", err)
+		}
+		if err := yaml.Unmarshal([]byte(input), &want); err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("re-parsed value = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("NameCollision", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte("base: &ports {a: 1}\nx:\n  ports: [1, 2]\ny:\n  ports: [1, 2]\n  z: 1\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if aliases := tree.AutoAnchor(); aliases != 1 {
+			t.Fatalf("AutoAnchor() = %d, want 1", aliases)
+		}
+		if got, want := anchorNames(tree), []string{"ports", "ports-2"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("anchor names = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("NoDuplicates", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte("a: [1]\nb: [2]\nc: x\nd: x\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if aliases := tree.AutoAnchor(); aliases != 0 {
+			t.Errorf("AutoAnchor() = %d, want 0", aliases)
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package golang_yaml_advanced
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// indentedBlock is a literal block scalar emitted with an explicit indentation indicator
+type indentedBlock struct {
+	placeholder string
+	value       string
+	indent      int
+}
+
+// trackBlockIndents records explicit indentation indicators (|2, >4-) of block scalars
+func trackBlockIndents(content string, root *Node) {
+	lines := strings.Split(content, "\n")
+	root.Walk(func(n *Node) bool {
+		if n.Kind != ScalarNode || (n.Style != LiteralStyle && n.Style != FoldedStyle) {
+			return true
+		}
+		if n.Line < 1 || n.Line > len(lines) || n.Column < 1 {
+			return true
+		}
+		line := lines[n.Line-1]
+		if n.Column > len(line) || (line[n.Column-1] != '|' && line[n.Column-1] != '>') {
+			return true
+		}
+		for _, c := range line[n.Column:] {
+			if c >= '1' && c <= '9' {
+				n.BlockIndent = int(c - '0')
+				break
+			}
+			if c != '+' && c != '-' {
+				break
+			}
+		}
+		return true
+	})
+}
+
+// replaceIndentedBlocks swaps literal scalars that have a BlockIndent for unique plain
+// placeholders, because yaml.v3 always derives the indentation indicator from the
+// encoder indentation. The returned blocks are written back by restoreIndentedBlocks.
+func replaceIndentedBlocks(node *Node, yamlNode *yaml.Node) []indentedBlock {
+	var blocks []indentedBlock
+	collectIndentedBlocks(node, yamlNode, &blocks)
+	return blocks
+}
+
+func collectIndentedBlocks(node *Node, yamlNode *yaml.Node, blocks *[]indentedBlock) {
+	if node == nil || yamlNode == nil {
+		return
+	}
+
+	if node.Kind == ScalarNode {
+		value, ok := node.Value.(string)
+		if !ok || node.BlockIndent < 1 || node.BlockIndent > 9 || node.Style != LiteralStyle || !isLiteralContent(value) {
+			return
+		}
+		placeholder := fmt.Sprintf("__yaml_block_indent_%d__", len(*blocks))
+		*blocks = append(*blocks, indentedBlock{placeholder: placeholder, value: value, indent: node.BlockIndent})
+		yamlNode.Value = placeholder
+		yamlNode.Style = 0
+		return
+	}
+
+	// Block scalars cannot appear inside flow collections
+	if node.Style == FlowStyle || len(node.Children) != len(yamlNode.Content) {
+		return
+	}
+	for i, child := range node.Children {
+		if node.Kind == MappingNode && i%2 == 0 {
+			// Block scalar keys would need the complex key syntax
+			continue
+		}
+		collectIndentedBlocks(child, yamlNode.Content[i], blocks)
+	}
+}
+
+// isLiteralContent reports whether value can be written as a literal block scalar
+func isLiteralContent(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r != '\n' && r != '\t' && !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// restoreIndentedBlocks replaces the placeholders left by replaceIndentedBlocks with
+// literal block scalars that carry an explicit indentation indicator
+func restoreIndentedBlocks(output []byte, blocks []indentedBlock) []byte {
+	if len(blocks) == 0 {
+		return output
+	}
+
+	lines := strings.Split(string(output), "\n")
+	for _, block := range blocks {
+		for i, line := range lines {
+			idx := strings.Index(line, block.placeholder)
+			if idx < 0 {
+				continue
+			}
+			prefix := line[:idx]
+			suffix := line[idx+len(block.placeholder):]
+			replacement := append([]string{prefix + block.header() + suffix},
+				block.contentLines(blockParentIndent(prefix)+block.indent)...)
+			lines = append(lines[:i], append(replacement, lines[i+1:]...)...)
+			break
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// header returns the block scalar header, e.g. |2 or |2-
+func (b indentedBlock) header() string {
+	header := "|" + strconv.Itoa(b.indent)
+	switch {
+	case !strings.HasSuffix(b.value, "\n"):
+		header += "-"
+	case strings.HasSuffix(b.value, "\n\n"):
+		header += "+"
+	}
+	return header
+}
+
+// contentLines returns the block content indented by indent spaces
+func (b indentedBlock) contentLines(indent int) []string {
+	content := strings.TrimSuffix(b.value, "\n")
+	lines := strings.Split(content, "\n")
+	padding := strings.Repeat(" ", indent)
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = padding + line
+		}
+	}
+	return lines
+}
+
+// blockParentIndent returns the indentation of the collection entry that owns the
+// scalar written after prefix, which is what an indentation indicator is relative to
+func blockParentIndent(prefix string) int {
+	i := 0
+	for i < len(prefix) && prefix[i] == ' ' {
+		i++
+	}
+	dash := -1
+	for strings.HasPrefix(prefix[i:], "- ") {
+		dash = i
+		i += 2
+		for i < len(prefix) && prefix[i] == ' ' {
+			i++
+		}
+	}
+
+	rest := prefix[i:]
+	if rest == "" || rest[0] == '&' || rest[0] == '!' {
+		// The scalar is a sequence item or the document itself
+		if dash >= 0 {
+			return dash
+		}
+		return 0
+	}
+	return i
+}
@@ -0,0 +1,126 @@
+package golang_yaml_advanced
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestBlockIndentRoundTrip tests that literal blocks keep their indentation indicator
+func TestBlockIndentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		path      string
+		indent    int
+		wantValue string
+	}{
+		{
+			name:      "IndentedFirstLine",
+			input:     "script: |2\n    indented first line\n  normal line\n",
+			path:      "script",
+			indent:    2,
+			wantValue: "  indented first line\nnormal line\n",
+		},
+		{
+			name:      "WiderIndicator",
+			input:     "script: |4\n      deep\n    base\n",
+			path:      "script",
+			indent:    4,
+			wantValue: "  deep\nbase\n",
+		},
+		{
+			name:      "TabIndentedLines",
+			input:     "literal_block: |2\n  line one\n  \tTab indented\n  \t\tTwice\n",
+			path:      "literal_block",
+			indent:    2,
+			wantValue: "line one\n\tTab indented\n\t\tTwice\n",
+		},
+		{
+			name:      "StripChomping",
+			input:     "nested:\n  text: |2-\n      spaced\n    end\n",
+			path:      "nested.text",
+			indent:    2,
+			wantValue: "  spaced\nend",
+		},
+		{
+			name:      "SequenceItem",
+			input:     "items:\n  - |3\n        six\n     three\n",
+			path:      "items[0]",
+			indent:    3,
+			wantValue: "   six\nthree\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+
+			node := blockAt(t, tree, tt.path)
+			if node == nil {
+				t.Fatalf("No node at %s", tt.path)
+			}
+			if node.BlockIndent != tt.indent {
+				t.Errorf("BlockIndent = %d, want %d", node.BlockIndent, tt.indent)
+			}
+			if node.Value != tt.wantValue {
+				t.Errorf("Value = %q, want %q", node.Value, tt.wantValue)
+			}
+
+			output, err := tree.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if string(output) != tt.input {
+				t.Errorf("ToYAML() = %q, want %q", output, tt.input)
+			}
+
+			reparsed, err := UnmarshalYAML(output)
+			if err != nil {
+				t.Fatalf("Failed to re-parse output: %v", err)
+			}
+			if got := blockAt(t, reparsed, tt.path).Value; got != tt.wantValue {
+				t.Errorf("Round-trip value = %q, want %q", got, tt.wantValue)
+			}
+		})
+	}
+
+	t.Run("ProgrammaticIndicator", func(t *testing.T) {
+		value := NewScalarNode("  leading spaces\nrest\n")
+		value.Style = LiteralStyle
+		value.BlockIndent = 4
+
+		root := NewMappingNode()
+		root.AddKeyValue(NewScalarNode("text"), value)
+		tree := NewNodeTree()
+		tree.AddDocument().SetRoot(root)
+
+		output, err := tree.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		if !strings.HasPrefix(string(output), "text: |4\n      leading spaces\n    rest\n") {
+			t.Errorf("ToYAML() = %q, want an explicit |4 indicator", output)
+		}
+	})
+
+	t.Run("AutomaticWithoutBlockIndent", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("text: |\n  plain\n"))
+		output, _ := tree.ToYAML()
+		if string(output) != "text: |\n  plain\n" {
+			t.Errorf("ToYAML() = %q, want the automatic header", output)
+		}
+	})
+}
+
+// blockAt returns the node at path in the first document of tree
+func blockAt(t *testing.T, tree *NodeTree, path string) *Node {
+	t.Helper()
+	segments, err := splitPath(path)
+	if err != nil {
+		t.Fatalf("splitPath(%q) error = %v", path, err)
+	}
+	return lookupPath(documentContent(tree.Documents[0].Root), segments)
+}
@@ -0,0 +1,160 @@
+package golang_yaml_advanced
+
+import "fmt"
+
+// TreeBuilder constructs a single-document NodeTree through chained calls.
+// Map and Seq open a collection that stays current until End, Key names the next
+// mapping value, and Scalar adds a leaf. The first error is kept and reported by Tree.
+//
+//	tree, err := Build().
+//		Map().
+//		Key("app").Map().
+//		Key("name").Scalar("x").
+//		End().
+//		End().
+//		Tree()
+type TreeBuilder struct {
+	root       *Node
+	stack      []*Node
+	pendingKey *Node
+	entry      *Node // node that receives comments for the most recent entry
+	err        error
+}
+
+// Build starts a new TreeBuilder
+func Build() *TreeBuilder {
+	return &TreeBuilder{}
+}
+
+// Map opens a mapping as the root, as the value of the pending key or as a sequence item
+func (b *TreeBuilder) Map() *TreeBuilder {
+	node := NewMappingNode()
+	if b.add(node) {
+		b.stack = append(b.stack, node)
+	}
+	return b
+}
+
+// Seq opens a sequence as the root, as the value of the pending key or as a sequence item
+func (b *TreeBuilder) Seq() *TreeBuilder {
+	node := NewSequenceNode()
+	if b.add(node) {
+		b.stack = append(b.stack, node)
+	}
+	return b
+}
+
+// Key sets the key for the next value added to the current mapping
+func (b *TreeBuilder) Key(key string) *TreeBuilder {
+	if b.err != nil {
+		return b
+	}
+	current := b.current()
+	if current == nil || current.Kind != MappingNode {
+		b.err = fmt.Errorf("key %q must be added inside a mapping", key)
+		return b
+	}
+	if b.pendingKey != nil {
+		b.err = fmt.Errorf("key %v has no value", b.pendingKey.Value)
+		return b
+	}
+	b.pendingKey = NewScalarNode(key)
+	b.entry = b.pendingKey
+	return b
+}
+
+// Scalar adds a scalar value as the root, as the value of the pending key or as a sequence item
+func (b *TreeBuilder) Scalar(value interface{}) *TreeBuilder {
+	b.add(NewScalarNode(value))
+	return b
+}
+
+// Comment adds a head comment line to the most recent entry: the key of a mapping
+// entry, a sequence item or the root node
+func (b *TreeBuilder) Comment(text string) *TreeBuilder {
+	if b.err != nil {
+		return b
+	}
+	if b.entry == nil {
+		b.err = fmt.Errorf("comment %q has no node to attach to", text)
+		return b
+	}
+	b.entry.HeadComment = append(b.entry.HeadComment, text)
+	return b
+}
+
+// End closes the current mapping or sequence
+func (b *TreeBuilder) End() *TreeBuilder {
+	if b.err != nil {
+		return b
+	}
+	if len(b.stack) == 0 {
+		b.err = fmt.Errorf("end called without an open collection")
+		return b
+	}
+	if b.pendingKey != nil {
+		b.err = fmt.Errorf("key %v has no value", b.pendingKey.Value)
+		return b
+	}
+	b.stack = b.stack[:len(b.stack)-1]
+	return b
+}
+
+// Tree returns the built tree. Collections that are still open are closed implicitly.
+func (b *TreeBuilder) Tree() (*NodeTree, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.pendingKey != nil {
+		return nil, fmt.Errorf("key %v has no value", b.pendingKey.Value)
+	}
+
+	tree := NewNodeTree()
+	doc := tree.AddDocument()
+	if b.root != nil {
+		docNode := NewNode(DocumentNode)
+		docNode.AddChild(b.root)
+		doc.SetRoot(docNode)
+	}
+	return tree, nil
+}
+
+// current returns the innermost open collection, or nil at the top level
+func (b *TreeBuilder) current() *Node {
+	if len(b.stack) == 0 {
+		return nil
+	}
+	return b.stack[len(b.stack)-1]
+}
+
+// add attaches node at the current position and reports whether it was added
+func (b *TreeBuilder) add(node *Node) bool {
+	if b.err != nil {
+		return false
+	}
+
+	current := b.current()
+	switch {
+	case current == nil:
+		if b.root != nil {
+			b.err = fmt.Errorf("document already has a root %s", b.root.Kind)
+			return false
+		}
+		b.root = node
+		b.entry = node
+	case current.Kind == MappingNode:
+		if b.pendingKey == nil {
+			b.err = fmt.Errorf("%s added to a mapping without a key", node.Kind)
+			return false
+		}
+		if err := current.AddKeyValue(b.pendingKey, node); err != nil {
+			b.err = err
+			return false
+		}
+		b.pendingKey = nil
+	default:
+		current.AddChild(node)
+		b.entry = node
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package golang_yaml_advanced
+
+import "testing"
+
+// TestTreeBuilder tests building trees with chained calls
+func TestTreeBuilder(t *testing.T) {
+	t.Run("NestedMapping", func(t *testing.T) {
+		tree, err := Build().
+			Map().
+			Key("app").Map().
+			Key("name").Scalar("x").
+			End().
+			End().
+			Tree()
+		if err != nil {
+			t.Fatalf("Tree() error = %v", err)
+		}
+
+		output, err := tree.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		if want := "app:\n  name: x\n"; string(output) != want {
+			t.Errorf("ToYAML() = %q, want %q", output, want)
+		}
+	})
+
+	t.Run("SequencesAndComments", func(t *testing.T) {
+		tree, err := Build().
+			Map().
+			Key("name").Comment("# Service name").Scalar("api").
+			Key("ports").Seq().
+			Scalar(80).
+			Scalar(443).
+			End().
+			Key("routes").Seq().
+			Map().Key("path").Scalar("/").End().
+			Tree()
+		if err != nil {
+			t.Fatalf("Tree() error = %v", err)
+		}
+
+		output, err := tree.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		want := "# Service name\nname: api\nports:\n  - 80\n  - 443\nroutes:\n  - path: /\n"
+		if string(output) != want {
+			t.Errorf("ToYAML() = %q, want %q", output, want)
+		}
+
+		reparsed, err := UnmarshalYAML(output)
+		if err != nil {
+			t.Fatalf("Failed to re-parse: %v", err)
+		}
+		ports := reparsed.Documents[0].Root.Children[0].GetMapValue("ports")
+		if port, _ := ports.Children[1].AsInt(); port != 443 {
+			t.Errorf("ports[1] = %v, want 443", ports.Children[1].Value)
+		}
+	})
+
+	t.Run("ScalarRoot", func(t *testing.T) {
+		tree, err := Build().Scalar("hello").Tree()
+		if err != nil {
+			t.Fatalf("Tree() error = %v", err)
+		}
+		output, _ := tree.ToYAML()
+		if string(output) != "hello\n" {
+			t.Errorf("ToYAML() = %q, want %q", output, "hello\n")
+		}
+	})
+
+	errorTests := []struct {
+		name  string
+		build func() *TreeBuilder
+	}{
+		{"ValueWithoutKey", func() *TreeBuilder { return Build().Map().Scalar(1) }},
+		{"KeyOutsideMapping", func() *TreeBuilder { return Build().Seq().Key("a") }},
+		{"KeyWithoutValue", func() *TreeBuilder { return Build().Map().Key("a").End() }},
+		{"DanglingKey", func() *TreeBuilder { return Build().Map().Key("a") }},
+		{"TwoRoots", func() *TreeBuilder { return Build().Scalar(1).Scalar(2) }},
+		{"UnbalancedEnd", func() *TreeBuilder { return Build().Map().End().End() }},
+		{"CommentWithoutNode", func() *TreeBuilder { return Build().Comment("# lost") }},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.build().Tree(); err == nil {
+				t.Error("Tree() should return an error")
+			}
+		})
+	}
+}
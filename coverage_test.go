@@ -1,6 +1,7 @@
 package golang_yaml_advanced
 
 import (
+	"math"
 	"strings"
 	"testing"
 )
@@ -409,6 +410,66 @@ func TestNodeToInterface(t *testing.T) {
 	}
 }
 
+// TestNodeToInterfaceTags tests that explicit core tags decide the converted type
+func TestNodeToInterfaceTags(t *testing.T) {
+	input := `forced: !!str 007
+quoted: "1.50"
+plain: 007
+hex: !!int 0x1F
+octal: !!int 0o17
+quotedInt: !!int "42"
+float: !!float 3
+positive: !!float .inf
+yes: !!bool "yes"
+empty: !!null ""
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	converted, ok := nodeToInterface(tree.Documents[0].Root.Children[0]).(map[string]interface{})
+	if !ok {
+		t.Fatal("nodeToInterface() should return a map")
+	}
+
+	tests := []struct {
+		key  string
+		want interface{}
+	}{
+		{"forced", "007"},
+		{"quoted", "1.50"},
+		{"plain", int64(7)},
+		{"hex", int64(31)},
+		{"octal", int64(15)},
+		{"quotedInt", int64(42)},
+		{"float", float64(3)},
+		{"positive", math.Inf(1)},
+		{"yes", true},
+		{"empty", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := converted[tt.key]; got != tt.want {
+				t.Errorf("%s = %#v (%T), want %#v (%T)", tt.key, got, got, tt.want, tt.want)
+			}
+		})
+	}
+
+	t.Run("Untagged", func(t *testing.T) {
+		if got := nodeToInterface(NewScalarNode(7)); got != 7 {
+			t.Errorf("nodeToInterface() = %#v, want 7 unchanged", got)
+		}
+	})
+
+	t.Run("Unconvertible", func(t *testing.T) {
+		node := &Node{Kind: ScalarNode, Tag: "!!int", Value: "seven"}
+		if got := nodeToInterface(node); got != "seven" {
+			t.Errorf("nodeToInterface() = %#v, want the value unchanged", got)
+		}
+	})
+}
+
 // TestSetValue tests the SetValue transform
 func TestSetValue(t *testing.T) {
 	tree := NewNodeTree()
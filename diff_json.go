@@ -0,0 +1,67 @@
+package golang_yaml_advanced
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// diffJSON is the JSON form of a DiffResult without its node pointers
+type diffJSON struct {
+	Type        DiffType    `json:"type"`
+	Path        string      `json:"path"`
+	OldValue    interface{} `json:"oldValue"`
+	NewValue    interface{} `json:"newValue"`
+	OldComment  []string    `json:"oldComment,omitempty"`
+	NewComment  []string    `json:"newComment,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Significant bool        `json:"significant,omitempty"`
+}
+
+// MarshalText encodes the diff type as its name
+func (dt DiffType) MarshalText() ([]byte, error) {
+	return []byte(dt.String()), nil
+}
+
+// MarshalDiffJSON encodes diffs as a JSON array of objects with type, path, oldValue,
+// newValue, oldComment, newComment, description and significant fields. Node pointers are left out,
+// and entries are ordered by path and type so the output does not depend on the map
+// iteration order used while diffing.
+func MarshalDiffJSON(diffs []DiffResult) ([]byte, error) {
+	entries := make([]diffJSON, 0, len(diffs))
+	for _, diff := range diffs {
+		entries = append(entries, diffJSON{
+			Type:        diff.Type,
+			Path:        diff.Path,
+			OldValue:    diffJSONValue(diff.OldValue, diff.OldNode),
+			NewValue:    diffJSONValue(diff.NewValue, diff.NewNode),
+			OldComment:  diff.OldComment,
+			NewComment:  diff.NewComment,
+			Description: diff.Description,
+			Significant: diff.Significant,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Path != entries[j].Path {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Type < entries[j].Type
+	})
+
+	return json.MarshalIndent(entries, "", "  ")
+}
+
+// diffJSONValue converts a diff value for JSON output. Node kinds and styles are
+// written by name, and added or removed collections, which carry no scalar value,
+// are written as their plain content.
+func diffJSONValue(value interface{}, node *Node) interface{} {
+	switch v := value.(type) {
+	case NodeKind, NodeStyle:
+		return fmt.Sprintf("%v", v)
+	}
+	if (value == nil || value == "") && node != nil && (node.Kind == MappingNode || node.Kind == SequenceNode) {
+		return nodeToInterface(node)
+	}
+	return value
+}
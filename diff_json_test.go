@@ -0,0 +1,71 @@
+package golang_yaml_advanced
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestMarshalDiffJSON tests the JSON encoding of diff results
+func TestMarshalDiffJSON(t *testing.T) {
+	oldTree, _ := UnmarshalYAML([]byte("name: api\nport: 80\nlegacy: true\n"))
+	newTree, _ := UnmarshalYAML([]byte("name: api\nport: 8080 # changed\ntls:\n  enabled: true\n"))
+
+	output, err := MarshalDiffJSON(DiffTrees(oldTree, newTree))
+	if err != nil {
+		t.Fatalf("MarshalDiffJSON() error = %v", err)
+	}
+
+	var got []map[string]interface{}
+	if err := json.Unmarshal(output, &got); err != nil {
+		t.Fatalf("output is not a JSON array: %v\n%s", err, output)
+	}
+
+	want := []map[string]interface{}{
+		{"type": "Removed", "path": "$[document:0].legacy", "oldValue": true, "newValue": nil, "description": "Key 'legacy' removed"},
+		{"type": "Modified", "path": "$[document:0].port", "oldValue": 80.0, "newValue": 8080.0, "description": "Value changed at $[document:0].port from '80' to '8080'"},
+		{"type": "CommentChanged", "path": "$[document:0].port", "oldValue": nil, "newValue": nil,
+			"oldComment": []interface{}{""}, "newComment": []interface{}{"# changed"}, "description": "Line comment changed at $[document:0].port"},
+		{"type": "Added", "path": "$[document:0].tls", "oldValue": nil, "newValue": map[string]interface{}{"enabled": true}, "description": "Key 'tls' added"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MarshalDiffJSON() =\n%s\nwant %v", output, want)
+	}
+
+	t.Run("Stable", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			again, _ := MarshalDiffJSON(DiffTrees(oldTree, newTree))
+			if string(again) != string(output) {
+				t.Fatalf("output changed between runs:\n%s\n%s", output, again)
+			}
+		}
+	})
+
+	t.Run("KindsAndStylesByName", func(t *testing.T) {
+		output, err := MarshalDiffJSON([]DiffResult{
+			{Type: DiffModified, Path: "$.a", OldValue: ScalarNode, NewValue: MappingNode},
+			{Type: DiffStyleChanged, Path: "$.b", OldValue: DefaultStyle, NewValue: FlowStyle, OldNode: &Node{}, NewNode: &Node{}},
+		})
+		if err != nil {
+			t.Fatalf("MarshalDiffJSON() error = %v", err)
+		}
+		var got []map[string]interface{}
+		_ = json.Unmarshal(output, &got)
+		if got[0]["oldValue"] != "ScalarNode" || got[0]["newValue"] != "MappingNode" {
+			t.Errorf("node kinds should be written by name, got %v", got[0])
+		}
+		if got[1]["oldValue"] != "DefaultStyle" || got[1]["newValue"] != "FlowStyle" {
+			t.Errorf("node styles should be written by name, got %v", got[1])
+		}
+		if _, ok := got[1]["oldNode"]; ok {
+			t.Error("node pointers should not be written")
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		output, err := MarshalDiffJSON(nil)
+		if err != nil || string(output) != "[]" {
+			t.Errorf("MarshalDiffJSON(nil) = %s, %v, want []", output, err)
+		}
+	})
+}
@@ -0,0 +1,15 @@
+package golang_yaml_advanced
+
+// DiffOptions configures how nodes and trees are compared by DiffNodesWithOptions
+// and DiffTreesWithOptions
+type DiffOptions struct {
+	// DetectKeyReorder reports a DiffReordered result for mappings whose keys are
+	// the same but appear in a different order. By default mappings are compared
+	// by key set only.
+	DetectKeyReorder bool
+}
+
+// DefaultDiffOptions returns the options used by DiffNodes and DiffTrees
+func DefaultDiffOptions() DiffOptions {
+	return DiffOptions{}
+}
@@ -0,0 +1,32 @@
+package golang_yaml_advanced
+
+// EncodeOptions configures how nodes are converted back into YAML
+type EncodeOptions struct {
+	// PreserveRawValues emits a scalar's RawValue verbatim instead of its parsed Value.
+	// The raw text is only used while it still decodes to the node's current Value,
+	// so scalars modified after parsing are emitted from Value as usual.
+	PreserveRawValues bool
+	// QuoteAmbiguousScalars double-quotes plain string scalars that a YAML 1.1 or 1.2
+	// parser could read as another type, such as yes, null, ~ or 12:30, so the output
+	// re-parses to the same strings
+	QuoteAmbiguousScalars bool
+	// YAMLVersion selects the tokens used for booleans. YAML12 emits true and false;
+	// YAML11 emits yes and no and quotes strings such as on or no that YAML 1.1
+	// parsers would read as booleans. Booleans that kept their source spelling, such
+	// as yes parsed with YAML11, are emitted as written in both modes.
+	YAMLVersion YAMLVersion
+}
+
+// DefaultEncodeOptions returns the default encoding options
+func DefaultEncodeOptions() EncodeOptions {
+	return EncodeOptions{
+		PreserveRawValues: false,
+	}
+}
+
+// RawEncodeOptions returns encoding options that keep the original scalar text
+func RawEncodeOptions() EncodeOptions {
+	return EncodeOptions{
+		PreserveRawValues: true,
+	}
+}
@@ -0,0 +1,327 @@
+package golang_yaml_advanced
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// flatEntry is a single leaf of a flattened tree
+type flatEntry struct {
+	path  []string
+	value *Node
+}
+
+// ToEnv exports the tree as KEY=value lines suitable for a .env file.
+// Keys are the uppercased path segments joined with underscores and prefixed
+// with prefix when it is not empty; sequence items use their index as segment.
+func (nt *NodeTree) ToEnv(prefix string) ([]byte, error) {
+	entries, err := nt.flattenLeaves()
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	for _, entry := range entries {
+		segments := entry.path
+		if prefix != "" {
+			segments = append([]string{prefix}, segments...)
+		}
+		sb.WriteString(envKey(segments))
+		sb.WriteString("=")
+		sb.WriteString(envValue(leafString(entry.value)))
+		sb.WriteString("\n")
+	}
+	return []byte(sb.String()), nil
+}
+
+// ToProperties exports the tree as Java .properties lines using dotted keys (a.b.c=value)
+func (nt *NodeTree) ToProperties() ([]byte, error) {
+	entries, err := nt.flattenLeaves()
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	for _, entry := range entries {
+		escaped := make([]string, len(entry.path))
+		for i, segment := range entry.path {
+			escaped[i] = propertiesEscape(segment, true)
+		}
+		sb.WriteString(strings.Join(escaped, "."))
+		sb.WriteString("=")
+		sb.WriteString(propertiesEscape(leafString(entry.value), false))
+		sb.WriteString("\n")
+	}
+	return []byte(sb.String()), nil
+}
+
+// flattenLeaves collects every leaf of every document in source order
+func (nt *NodeTree) flattenLeaves() ([]flatEntry, error) {
+	var entries []flatEntry
+	for _, doc := range nt.Documents {
+		if doc == nil || doc.Root == nil {
+			continue
+		}
+		if err := collectLeaves(doc.Root, nil, &entries); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+func collectLeaves(node *Node, path []string, entries *[]flatEntry) error {
+	switch node.Kind {
+	case DocumentNode:
+		for _, child := range node.Children {
+			if err := collectLeaves(child, path, entries); err != nil {
+				return err
+			}
+		}
+	case MappingNode:
+		for i := 0; i < len(node.Children)-1; i += 2 {
+			keyNode := node.Children[i]
+			if keyNode.Kind != ScalarNode {
+				return fmt.Errorf("cannot flatten non-scalar key at %s", node.Path())
+			}
+			childPath := append(append([]string(nil), path...), fmt.Sprintf("%v", keyNode.Value))
+			if err := collectLeaves(node.Children[i+1], childPath, entries); err != nil {
+				return err
+			}
+		}
+	case SequenceNode:
+		for i, child := range node.Children {
+			childPath := append(append([]string(nil), path...), strconv.Itoa(i))
+			if err := collectLeaves(child, childPath, entries); err != nil {
+				return err
+			}
+		}
+	case AliasNode:
+		if node.Alias == nil {
+			return fmt.Errorf("unresolved alias %s", node.aliasName())
+		}
+		return collectLeaves(node.Alias, path, entries)
+	default:
+		if len(path) > 0 {
+			*entries = append(*entries, flatEntry{path: path, value: node})
+		}
+	}
+	return nil
+}
+
+// leafString renders a scalar leaf, using an empty string for null values
+func leafString(node *Node) string {
+	if node.IsNull() {
+		return ""
+	}
+	return fmt.Sprintf("%v", node.Value)
+}
+
+// envKey builds an environment variable name from path segments
+func envKey(segments []string) string {
+	key := strings.ToUpper(strings.Join(segments, "_"))
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// envValue quotes values that a .env parser would otherwise misread
+func envValue(value string) string {
+	if strings.ContainsAny(value, " \t\n\r\"'#=\\$") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// propertiesEscape escapes characters with special meaning in .properties files
+func propertiesEscape(value string, isKey bool) string {
+	var sb strings.Builder
+	for i, r := range value {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '=', ':', '#', '!':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case ' ':
+			if isKey || i == 0 {
+				sb.WriteString(`\ `)
+			} else {
+				sb.WriteRune(r)
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// FromEnv parses KEY=value lines (as produced by ToEnv or found in .env files) into a tree.
+// Keys are lowercased and split on separator to rebuild nested mappings, so A_B_C=1 with
+// separator "_" becomes a: {b: {c: 1}}. Mappings whose keys are exactly 0..n-1 become
+// sequences. Comment lines are attached as head comments to the key that follows them,
+// and KEY= with no value produces a null scalar.
+func FromEnv(data []byte, separator string) (*NodeTree, error) {
+	root := NewMappingNode()
+	var pending []string
+
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "#") {
+			pending = append(pending, trimmed)
+			continue
+		}
+
+		trimmed = strings.TrimPrefix(trimmed, "export ")
+		eq := strings.Index(trimmed, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("line %d: expected KEY=value", i+1)
+		}
+
+		name := strings.ToLower(strings.TrimSpace(trimmed[:eq]))
+		segments := []string{name}
+		if separator != "" {
+			segments = strings.Split(name, separator)
+		}
+
+		value, err := parseEnvValue(strings.TrimSpace(trimmed[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		keyNode, err := setEnvPath(root, segments, value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if len(pending) > 0 {
+			keyNode.HeadComment = pending
+			pending = nil
+		}
+	}
+
+	docNode := NewNode(DocumentNode)
+	docNode.AddChild(indexedMappingsToSequences(root))
+	docNode.FootComment = pending
+
+	tree := NewNodeTree()
+	doc := tree.AddDocument()
+	doc.SetRoot(docNode)
+	return tree, nil
+}
+
+// parseEnvValue decodes a .env value, unquoting it or inferring its scalar type
+func parseEnvValue(raw string) (*Node, error) {
+	if raw == "" {
+		node := NewScalarNode(nil)
+		node.Tag = "!!null"
+		return node, nil
+	}
+	if strings.HasPrefix(raw, "\"") {
+		unquoted, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted value %s: %w", raw, err)
+		}
+		return NewScalarNode(unquoted), nil
+	}
+	if len(raw) >= 2 && strings.HasPrefix(raw, "'") && strings.HasSuffix(raw, "'") {
+		return NewScalarNode(raw[1 : len(raw)-1]), nil
+	}
+
+	// Strip trailing inline comments from unquoted values
+	if idx := strings.Index(raw, " #"); idx >= 0 {
+		raw = strings.TrimSpace(raw[:idx])
+	}
+	return NewScalarNode(decodeScalarValue(raw, "")), nil
+}
+
+// setEnvPath stores value under the nested key path and returns the leaf key node
+func setEnvPath(root *Node, segments []string, value *Node) (*Node, error) {
+	current := root
+	for i, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("empty key segment in %s", strings.Join(segments, "."))
+		}
+		last := i == len(segments)-1
+
+		var existingKey, existingValue *Node
+		for j := 0; j < len(current.Children)-1; j += 2 {
+			if fmt.Sprintf("%v", current.Children[j].Value) == segment {
+				existingKey, existingValue = current.Children[j], current.Children[j+1]
+				break
+			}
+		}
+
+		if last {
+			if existingValue == nil {
+				keyNode := NewScalarNode(segment)
+				if err := current.AddKeyValue(keyNode, value); err != nil {
+					return nil, err
+				}
+				return keyNode, nil
+			}
+			if existingValue.Kind == MappingNode {
+				return nil, fmt.Errorf("key %s is both a value and a parent of other keys", strings.Join(segments, "."))
+			}
+			// Later assignments win, as in a shell
+			if err := existingValue.ReplaceWith(value); err != nil {
+				return nil, err
+			}
+			return existingKey, nil
+		}
+
+		if existingValue == nil {
+			existingValue = NewMappingNode()
+			if err := current.AddKeyValue(NewScalarNode(segment), existingValue); err != nil {
+				return nil, err
+			}
+		} else if existingValue.Kind != MappingNode {
+			return nil, fmt.Errorf("key %s is both a value and a parent of other keys", strings.Join(segments[:i+1], "."))
+		}
+		current = existingValue
+	}
+	return nil, fmt.Errorf("empty key")
+}
+
+// indexedMappingsToSequences converts mappings keyed 0..n-1 back into sequences
+func indexedMappingsToSequences(node *Node) *Node {
+	if node.Kind != MappingNode {
+		return node
+	}
+
+	isSequence := len(node.Children) > 0
+	for i := 0; i < len(node.Children)-1; i += 2 {
+		converted := indexedMappingsToSequences(node.Children[i+1])
+		if converted != node.Children[i+1] {
+			converted.Parent = node
+			converted.Key = node.Children[i]
+			node.Children[i+1] = converted
+		}
+		if fmt.Sprintf("%v", node.Children[i].Value) != strconv.Itoa(i/2) {
+			isSequence = false
+		}
+	}
+	if !isSequence {
+		return node
+	}
+
+	sequence := NewSequenceNode()
+	for i := 0; i < len(node.Children)-1; i += 2 {
+		item := node.Children[i+1]
+		item.Key = nil
+		item.HeadComment = append(node.Children[i].HeadComment, item.HeadComment...)
+		sequence.AddChild(item)
+	}
+	return sequence
+}
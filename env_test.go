@@ -0,0 +1,196 @@
+package golang_yaml_advanced
+
+import (
+	"strings"
+	"testing"
+)
+
+const envConfigYAML = `
+config:
+  database:
+    host: "localhost"
+    port: 5432
+    password: "p@ss word"
+  features:
+    - authentication
+    - logging
+  cache: null
+metadata:
+  version: "1.0.0"
+`
+
+// TestToEnv tests exporting a tree as .env lines
+func TestToEnv(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte(envConfigYAML))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	t.Run("WithPrefix", func(t *testing.T) {
+		output, err := tree.ToEnv("app")
+		if err != nil {
+			t.Fatalf("ToEnv() error = %v", err)
+		}
+
+		want := []string{
+			"APP_CONFIG_DATABASE_HOST=localhost",
+			"APP_CONFIG_DATABASE_PORT=5432",
+			`APP_CONFIG_DATABASE_PASSWORD="p@ss word"`,
+			"APP_CONFIG_FEATURES_0=authentication",
+			"APP_CONFIG_FEATURES_1=logging",
+			"APP_CONFIG_CACHE=",
+			"APP_METADATA_VERSION=1.0.0",
+		}
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		if len(lines) != len(want) {
+			t.Fatalf("ToEnv() produced %d lines, want %d:\n%s", len(lines), len(want), output)
+		}
+		for i, line := range lines {
+			if line != want[i] {
+				t.Errorf("ToEnv() line %d = %q, want %q", i, line, want[i])
+			}
+		}
+	})
+
+	t.Run("WithoutPrefix", func(t *testing.T) {
+		output, err := tree.ToEnv("")
+		if err != nil {
+			t.Fatalf("ToEnv() error = %v", err)
+		}
+		if !strings.HasPrefix(string(output), "CONFIG_DATABASE_HOST=localhost\n") {
+			t.Errorf("ToEnv() without prefix = %q", output)
+		}
+	})
+
+	t.Run("EmptyTree", func(t *testing.T) {
+		output, err := NewNodeTree().ToEnv("app")
+		if err != nil {
+			t.Fatalf("ToEnv() error = %v", err)
+		}
+		if len(output) != 0 {
+			t.Errorf("ToEnv() on empty tree = %q, want empty", output)
+		}
+	})
+}
+
+// TestToProperties tests exporting a tree as .properties lines
+func TestToProperties(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte(envConfigYAML))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	output, err := tree.ToProperties()
+	if err != nil {
+		t.Fatalf("ToProperties() error = %v", err)
+	}
+
+	want := []string{
+		"config.database.host=localhost",
+		"config.database.port=5432",
+		"config.database.password=p@ss word",
+		"config.features.0=authentication",
+		"config.features.1=logging",
+		"config.cache=",
+		"metadata.version=1.0.0",
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("ToProperties() produced %d lines, want %d:\n%s", len(lines), len(want), output)
+	}
+	for i, line := range lines {
+		if line != want[i] {
+			t.Errorf("ToProperties() line %d = %q, want %q", i, line, want[i])
+		}
+	}
+}
+
+// TestFromEnv tests rebuilding a tree from .env lines
+func TestFromEnv(t *testing.T) {
+	t.Run("NestedKeys", func(t *testing.T) {
+		input := `# Database settings
+DATABASE_HOST=localhost
+DATABASE_PORT=5432
+export DATABASE_NAME="app db"
+CACHE_TTL=
+DEBUG=true
+`
+		tree, err := FromEnv([]byte(input), "_")
+		if err != nil {
+			t.Fatalf("FromEnv() error = %v", err)
+		}
+
+		root := tree.Documents[0].Root.Children[0]
+		database := root.GetMapValue("database")
+		if database == nil || database.Kind != MappingNode {
+			t.Fatalf("FromEnv() should build a database mapping")
+		}
+		if v := database.GetMapValue("host").Value; v != "localhost" {
+			t.Errorf("database.host = %v, want localhost", v)
+		}
+		if v := database.GetMapValue("port").Value; v != int64(5432) {
+			t.Errorf("database.port = %v, want 5432", v)
+		}
+		if v := database.GetMapValue("name").Value; v != "app db" {
+			t.Errorf("database.name = %v, want app db", v)
+		}
+		if ttl := root.GetMapValue("cache").GetMapValue("ttl"); !ttl.IsNull() {
+			t.Errorf("cache.ttl = %v, want null", ttl.Value)
+		}
+		if v := root.GetMapValue("debug").Value; v != true {
+			t.Errorf("debug = %v, want true", v)
+		}
+
+		// The comment belongs to the key that follows it
+		hostKey := database.Children[0]
+		if !equalStringSlices(hostKey.HeadComment, []string{"# Database settings"}) {
+			t.Errorf("host key head comment = %q", hostKey.HeadComment)
+		}
+	})
+
+	t.Run("RoundTripWithToEnv", func(t *testing.T) {
+		original, _ := UnmarshalYAML([]byte(envConfigYAML))
+		exported, _ := original.ToEnv("")
+
+		tree, err := FromEnv(exported, "_")
+		if err != nil {
+			t.Fatalf("FromEnv() error = %v", err)
+		}
+
+		features := tree.Documents[0].Root.Children[0].GetMapValue("config").GetMapValue("features")
+		if features == nil || features.Kind != SequenceNode || len(features.Children) != 2 {
+			t.Fatalf("Indexed keys should become a sequence, got %v", features)
+		}
+		if features.Children[1].Value != "logging" {
+			t.Errorf("features[1] = %v, want logging", features.Children[1].Value)
+		}
+
+		password := tree.Documents[0].Root.Children[0].GetMapValue("config").GetMapValue("database").GetMapValue("password")
+		if password.Value != "p@ss word" {
+			t.Errorf("password = %v, want quoted value to be unquoted", password.Value)
+		}
+	})
+
+	t.Run("MergeWithYAMLDefaults", func(t *testing.T) {
+		defaults, _ := UnmarshalYAML([]byte("database:\n  host: db.local\n  port: 5432\n"))
+		secrets, err := FromEnv([]byte("DATABASE_PASSWORD=secret\n"), "_")
+		if err != nil {
+			t.Fatalf("FromEnv() error = %v", err)
+		}
+
+		merged := MergeTrees(defaults, secrets)
+		database := merged.Documents[0].Root.Children[0].GetMapValue("database")
+		if database.GetMapValue("host").Value != "db.local" || database.GetMapValue("password").Value != "secret" {
+			t.Errorf("Merged database mapping is missing values")
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := FromEnv([]byte("NOT_AN_ASSIGNMENT\n"), "_"); err == nil {
+			t.Error("FromEnv() should reject lines without '='")
+		}
+		if _, err := FromEnv([]byte("A=1\nA_B=2\n"), "_"); err == nil {
+			t.Error("FromEnv() should reject a key that is both a value and a parent")
+		}
+	})
+}
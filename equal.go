@@ -0,0 +1,176 @@
+package golang_yaml_advanced
+
+import "fmt"
+
+// EqualOptions configures structural comparison of nodes and trees.
+// Source positions, empty line tracking, raw scalar text and metadata are never compared.
+type EqualOptions struct {
+	// IgnoreComments skips head, line and foot comments
+	IgnoreComments bool
+	// IgnoreStyle skips presentation styles such as quoting and flow collections
+	IgnoreStyle bool
+	// IgnoreKeyOrder compares mappings as unordered sets of entries
+	IgnoreKeyOrder bool
+}
+
+// Equal reports whether two nodes are structurally equal. Aliases are compared by
+// name rather than by following them, so cyclic documents can be compared.
+func (n *Node) Equal(other *Node, opts EqualOptions) bool {
+	if n == nil || other == nil {
+		return n == other
+	}
+
+	if n.Kind != other.Kind || n.Tag != other.Tag || n.Anchor != other.Anchor {
+		return false
+	}
+	if !opts.IgnoreStyle && n.Style != other.Style {
+		return false
+	}
+	if !opts.IgnoreComments && !commentsEqual(n, other) {
+		return false
+	}
+
+	switch n.Kind {
+	case ScalarNode:
+		return fmt.Sprintf("%v", n.Value) == fmt.Sprintf("%v", other.Value)
+	case AliasNode:
+		return n.aliasName() == other.aliasName()
+	case MappingNode:
+		if opts.IgnoreKeyOrder {
+			return mappingsEqualUnordered(n, other, opts)
+		}
+	}
+
+	if len(n.Children) != len(other.Children) {
+		return false
+	}
+	for i, child := range n.Children {
+		if !child.Equal(other.Children[i], opts) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal reports whether both trees have the same number of documents and each pair
+// of document roots is structurally equal
+func (nt *NodeTree) Equal(other *NodeTree, opts EqualOptions) bool {
+	if nt == nil || other == nil {
+		return nt == other
+	}
+	if len(nt.Documents) != len(other.Documents) {
+		return false
+	}
+	for i, doc := range nt.Documents {
+		otherDoc := other.Documents[i]
+		if doc == nil || otherDoc == nil {
+			if doc != otherDoc {
+				return false
+			}
+			continue
+		}
+		if !doc.Root.Equal(otherDoc.Root, opts) {
+			return false
+		}
+	}
+	return true
+}
+
+// commentsEqual compares the comments attached to two nodes
+func commentsEqual(a, b *Node) bool {
+	return equalStringSlices(a.HeadComment, b.HeadComment) &&
+		a.LineComment == b.LineComment &&
+		equalStringSlices(a.FootComment, b.FootComment)
+}
+
+// mappingsEqualUnordered compares two mappings entry by entry regardless of key order
+func mappingsEqualUnordered(a, b *Node, opts EqualOptions) bool {
+	if len(a.Children) != len(b.Children) {
+		return false
+	}
+
+	matched := make([]bool, len(b.Children))
+	for i := 0; i < len(a.Children)-1; i += 2 {
+		found := false
+		for j := 0; j < len(b.Children)-1; j += 2 {
+			if matched[j] {
+				continue
+			}
+			if a.Children[i].Equal(b.Children[j], opts) && a.Children[i+1].Equal(b.Children[j+1], opts) {
+				matched[j] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// FirstDiff walks a and b together and returns the path of the first difference in
+// kind, scalar value or structure, stopping as soon as one is found. The path uses the
+// form Path writes, so GetPath resolves it from a or b. Comments, styles and mapping
+// key order are ignored, as in DiffNodes. Equal nodes return "" and true.
+func FirstDiff(a, b *Node) (path string, equal bool) {
+	return firstDiff(a, b, "$")
+}
+
+func firstDiff(a, b *Node, path string) (string, bool) {
+	if a == nil || b == nil {
+		if a == b {
+			return "", true
+		}
+		return path, false
+	}
+	if a.Kind != b.Kind {
+		return path, false
+	}
+
+	switch a.Kind {
+	case ScalarNode:
+		if fmt.Sprintf("%v", a.Value) != fmt.Sprintf("%v", b.Value) {
+			return path, false
+		}
+	case AliasNode:
+		if a.aliasName() != b.aliasName() {
+			return path, false
+		}
+	case MappingNode:
+		for i := 0; i < len(a.Children)-1; i += 2 {
+			key := fmt.Sprintf("%v", a.Children[i].Value)
+			other := b.GetMapValue(key)
+			if other == nil {
+				return path + pathKey(key), false
+			}
+			if diff, ok := firstDiff(a.Children[i+1], other, path+pathKey(key)); !ok {
+				return diff, false
+			}
+		}
+		for i := 0; i < len(b.Children)-1; i += 2 {
+			key := fmt.Sprintf("%v", b.Children[i].Value)
+			if a.GetMapValue(key) == nil {
+				return path + pathKey(key), false
+			}
+		}
+	case SequenceNode:
+		for i := 0; i < len(a.Children) && i < len(b.Children); i++ {
+			if diff, ok := firstDiff(a.Children[i], b.Children[i], fmt.Sprintf("%s[%d]", path, i)); !ok {
+				return diff, false
+			}
+		}
+		if len(a.Children) != len(b.Children) {
+			shorter := len(a.Children)
+			if len(b.Children) < shorter {
+				shorter = len(b.Children)
+			}
+			return fmt.Sprintf("%s[%d]", path, shorter), false
+		}
+	case DocumentNode:
+		if diff, ok := firstDiff(firstChild(a), firstChild(b), path); !ok {
+			return diff, false
+		}
+	}
+	return "", true
+}
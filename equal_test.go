@@ -0,0 +1,149 @@
+package golang_yaml_advanced
+
+import "testing"
+
+// TestNodeTreeEqual tests whole-tree structural equality
+func TestNodeTreeEqual(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte(complexYAML + "---\n" + anchorsYAML))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	t.Run("EqualToClone", func(t *testing.T) {
+		clone := tree.Clone()
+		if !tree.Equal(clone, EqualOptions{}) {
+			t.Error("Equal() should be true for a tree and its clone")
+		}
+	})
+
+	t.Run("EqualToReparsed", func(t *testing.T) {
+		output, err := tree.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		reparsed, err := UnmarshalYAML(output)
+		if err != nil {
+			t.Fatalf("Failed to re-parse: %v", err)
+		}
+		// The merge key is written back as an explicitly tagged !!merge, which changes its style
+		if !tree.Equal(reparsed, EqualOptions{IgnoreComments: true, IgnoreStyle: true}) {
+			t.Error("Equal() should be true after a round trip")
+		}
+	})
+
+	t.Run("ValueChange", func(t *testing.T) {
+		clone := tree.Clone()
+		clone.Documents[0].Root.Children[0].GetMapValue("app").GetMapValue("version").Value = "2.0.0"
+		if tree.Equal(clone, EqualOptions{}) {
+			t.Error("Equal() should be false after a value change")
+		}
+	})
+
+	t.Run("DocumentCount", func(t *testing.T) {
+		single, _ := UnmarshalYAML([]byte(complexYAML))
+		if tree.Equal(single, EqualOptions{}) {
+			t.Error("Equal() should be false for different document counts")
+		}
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		var nilTree *NodeTree
+		if !nilTree.Equal(nil, EqualOptions{}) {
+			t.Error("Equal() should be true for two nil trees")
+		}
+		if tree.Equal(nil, EqualOptions{}) {
+			t.Error("Equal() should be false against nil")
+		}
+	})
+}
+
+// TestNodeEqualOptions tests the comparison options of Node.Equal
+func TestNodeEqualOptions(t *testing.T) {
+	parse := func(input string) *Node {
+		tree, err := UnmarshalYAML([]byte(input))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		return tree.Documents[0].Root
+	}
+
+	tests := []struct {
+		name  string
+		a, b  string
+		opts  EqualOptions
+		equal bool
+	}{
+		{"Identical", "a: 1\nb: [x]\n", "a: 1\nb: [x]\n", EqualOptions{}, true},
+		{"CommentDiffers", "a: 1 # one\n", "a: 1\n", EqualOptions{}, false},
+		{"IgnoreComments", "a: 1 # one\n", "a: 1\n", EqualOptions{IgnoreComments: true}, true},
+		{"StyleDiffers", "a: [x]\n", "a:\n  - x\n", EqualOptions{}, false},
+		{"IgnoreStyle", "a: [x]\n", "a:\n  - x\n", EqualOptions{IgnoreStyle: true}, true},
+		{"KeyOrderDiffers", "a: 1\nb: 2\n", "b: 2\na: 1\n", EqualOptions{}, false},
+		{"IgnoreKeyOrder", "a: 1\nb: 2\n", "b: 2\na: 1\n", EqualOptions{IgnoreKeyOrder: true}, true},
+		{"IgnoreKeyOrderValueDiffers", "a: 1\nb: 2\n", "b: 3\na: 1\n", EqualOptions{IgnoreKeyOrder: true}, false},
+		{"SequenceOrderMatters", "- a\n- b\n", "- b\n- a\n", EqualOptions{IgnoreKeyOrder: true}, false},
+		{"AliasByName", "a: &x 1\nb: *x\n", "a: &x 1\nb: *x\n", EqualOptions{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parse(tt.a).Equal(parse(tt.b), tt.opts); got != tt.equal {
+				t.Errorf("Equal() = %v, want %v", got, tt.equal)
+			}
+		})
+	}
+}
+
+// TestFirstDiff tests finding the path of the first difference between two nodes
+func TestFirstDiff(t *testing.T) {
+	parse := func(input string) *Node {
+		tree, err := UnmarshalYAML([]byte(input))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		return tree.Documents[0].Root
+	}
+
+	tests := []struct {
+		name  string
+		a, b  string
+		path  string
+		equal bool
+	}{
+		{"Equal", "a:\n  b: [1, 2]\n", "a:\n  b: [1, 2]\n", "", true},
+		{"IgnoresCommentsStyleAndOrder", "a: 1 # one\nb: [x]\n", "b:\n  - x\na: 1\n", "", true},
+		{"NestedValue", "a:\n  b:\n    c: 1\n  d: 2\n", "a:\n  b:\n    c: 5\n  d: 3\n", "$.a.b.c", false},
+		{"SequenceItem", "list:\n  - x\n  - y\n", "list:\n  - x\n  - z\n", "$.list[1]", false},
+		{"SequenceLength", "list: [x]\n", "list: [x, y]\n", "$.list[1]", false},
+		{"MissingKey", "a: 1\nb: 2\n", "a: 1\n", "$.b", false},
+		{"AddedKey", "a: 1\n", "a: 1\nc: 3\n", "$.c", false},
+		{"KindChanged", "a:\n  b: 1\n", "a: [1]\n", "$.a", false},
+		{"SpecialKeys", "app.kubernetes.io/name:\n  \"my key\": 1\n", "app.kubernetes.io/name:\n  \"my key\": 2\n", `$["app.kubernetes.io/name"]["my key"]`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, equal := FirstDiff(parse(tt.a), parse(tt.b))
+			if path != tt.path || equal != tt.equal {
+				t.Errorf("FirstDiff() = %q, %v, want %q, %v", path, equal, tt.path, tt.equal)
+			}
+			if !equal {
+				// The differing node exists on at least one side
+				inA, err := parse(tt.a).GetPath(path)
+				inB, _ := parse(tt.b).GetPath(path)
+				if err != nil || (inA == nil && inB == nil) {
+					t.Errorf("GetPath(%q) found no node, error = %v", path, err)
+				}
+			}
+		})
+	}
+
+	t.Run("Nil", func(t *testing.T) {
+		if path, equal := FirstDiff(nil, nil); path != "" || !equal {
+			t.Errorf("FirstDiff(nil, nil) = %q, %v, want \"\", true", path, equal)
+		}
+		if path, equal := FirstDiff(parse("a: 1\n"), nil); path != "$" || equal {
+			t.Errorf("FirstDiff(node, nil) = %q, %v, want $, false", path, equal)
+		}
+	})
+}
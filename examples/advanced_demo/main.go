@@ -340,15 +340,8 @@ settings:
 					nameNode := userNode.GetMapValue("name")
 					rolesNode := userNode.GetMapValue("roles")
 
-					if rolesNode != nil && rolesNode.Kind == golang_yaml_advanced.SequenceNode {
-						for _, roleNode := range rolesNode.Children {
-							if roleNode.Kind == golang_yaml_advanced.ScalarNode && fmt.Sprintf("%v", roleNode.Value) == "admin" {
-								if nameNode != nil && nameNode.Kind == golang_yaml_advanced.ScalarNode {
-									fmt.Printf("  User %d: %v is an admin\n", i, nameNode.Value)
-								}
-								break
-							}
-						}
+					if rolesNode.SequenceContains("admin") && nameNode != nil && nameNode.Kind == golang_yaml_advanced.ScalarNode {
+						fmt.Printf("  User %d: %v is an admin\n", i, nameNode.Value)
 					}
 				}
 			}
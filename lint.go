@@ -0,0 +1,240 @@
+package golang_yaml_advanced
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Severity ranks how serious a reported problem is. The zero value is not a
+// valid severity, so an issue whose severity was never set does not read as an error.
+type Severity int
+
+const (
+	// SeverityError marks problems that make the YAML invalid or must be fixed
+	SeverityError Severity = iota + 1
+	// SeverityWarning marks problems that are legal YAML but worth fixing
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Unknown(%d)", s)
+	}
+}
+
+// LintIssue is a problem found in raw YAML text
+type LintIssue struct {
+	Line     int    // 1-based line number
+	Column   int    // 1-based column of the offending character
+	Rule     string // Identifier of the rule that reported the issue
+	Message  string
+	Severity Severity
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("line %d, column %d: %s: %s (%s)", i.Line, i.Column, i.Severity, i.Message, i.Rule)
+}
+
+// blockScalarHeader matches lines that open a literal or folded block scalar
+var blockScalarHeader = regexp.MustCompile(`(^|\s)[|>][1-9+-]{0,2}\s*(#.*)?$`)
+
+// Lint reports common hygiene problems in raw YAML text, ordered by position:
+// tab indentation (an error, see LintIndentation) and, as warnings, trailing
+// whitespace, indentation steps that differ from the first one used in the file,
+// and a missing newline at the end of the input.
+func Lint(data []byte) []LintIssue {
+	issues := LintIndentation(data)
+	issues = append(issues, lintTrailingWhitespace(data)...)
+	issues = append(issues, lintIndentationWidth(data)...)
+
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		lines := strings.Split(string(data), "\n")
+		issues = append(issues, LintIssue{
+			Line:     len(lines),
+			Column:   len(lines[len(lines)-1]) + 1,
+			Rule:     "missing-final-newline",
+			Message:  "file does not end with a newline",
+			Severity: SeverityWarning,
+		})
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Column < issues[j].Column
+	})
+	return issues
+}
+
+// LintIndentation reports lines that use tab characters for indentation, which YAML
+// forbids. Tabs inside block scalar content and comment lines are allowed. Run it
+// before UnmarshalYAML to turn yaml.v3's parse error into an actionable message.
+func LintIndentation(data []byte) []LintIssue {
+	var issues []LintIssue
+
+	lintLines(data, func(i int, line string, blockContent bool) {
+		trimmed := strings.TrimLeft(line, " \t")
+		if blockContent || trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			return
+		}
+		indentation := line[:len(line)-len(trimmed)]
+		if tab := strings.IndexByte(indentation, '\t'); tab >= 0 {
+			issues = append(issues, LintIssue{
+				Line:     i + 1,
+				Column:   tab + 1,
+				Rule:     "tab-indentation",
+				Message:  "tab character used for indentation, YAML requires spaces",
+				Severity: SeverityError,
+			})
+		}
+	})
+
+	return issues
+}
+
+// lintTrailingWhitespace reports lines ending in spaces or tabs
+func lintTrailingWhitespace(data []byte) []LintIssue {
+	var issues []LintIssue
+
+	lintLines(data, func(i int, line string, _ bool) {
+		if trimmed := strings.TrimRight(line, " \t"); len(trimmed) < len(line) {
+			issues = append(issues, LintIssue{
+				Line:     i + 1,
+				Column:   len(trimmed) + 1,
+				Rule:     "trailing-whitespace",
+				Message:  "line ends with whitespace",
+				Severity: SeverityWarning,
+			})
+		}
+	})
+
+	return issues
+}
+
+// lintIndentationWidth reports lines whose indentation step differs from the first
+// step used in the input. Content following a sequence dash opens a level at its own
+// column, so "- name:" items are not mistaken for a different width.
+func lintIndentationWidth(data []byte) []LintIssue {
+	var issues []LintIssue
+
+	var levels []int
+	step := 0
+	flowDepth := 0
+
+	lintLines(data, func(i int, line string, blockContent bool) {
+		trimmed := strings.TrimLeft(line, " ")
+		if blockContent || trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "\t") {
+			return
+		}
+		if strings.HasPrefix(trimmed, "---") || strings.HasPrefix(trimmed, "...") || strings.HasPrefix(trimmed, "%") {
+			levels, flowDepth = nil, 0
+			return
+		}
+
+		// Lines continuing a multi-line flow collection follow their own layout
+		inFlow := flowDepth > 0
+		flowDepth += flowDepthChange(trimmed)
+		if inFlow {
+			return
+		}
+
+		indent := len(line) - len(trimmed)
+		for len(levels) > 0 && levels[len(levels)-1] > indent {
+			levels = levels[:len(levels)-1]
+		}
+		if len(levels) == 0 || levels[len(levels)-1] < indent {
+			if len(levels) > 0 {
+				width := indent - levels[len(levels)-1]
+				if step == 0 {
+					step = width
+				} else if width != step {
+					issues = append(issues, LintIssue{
+						Line:     i + 1,
+						Column:   indent + 1,
+						Rule:     "indentation-width",
+						Message:  fmt.Sprintf("indented by %d spaces, but %d spaces are used elsewhere", width, step),
+						Severity: SeverityWarning,
+					})
+				}
+			}
+			levels = append(levels, indent)
+		}
+
+		if strings.HasPrefix(trimmed, "- ") {
+			content := strings.TrimLeft(trimmed[1:], " ")
+			if content != "" && !strings.HasPrefix(content, "#") {
+				levels = append(levels, indent+len(trimmed)-len(content))
+			}
+		}
+	})
+
+	return issues
+}
+
+// flowDepthChange returns how many flow collections a line opens minus how many it
+// closes, ignoring quoted text and comments
+func flowDepthChange(line string) int {
+	depth := 0
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' '):
+			return depth
+		case r == '[' || r == '{':
+			depth++
+		case r == ']' || r == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// lintLines calls fn for every line of data with its 0-based index, the line without
+// its line ending and whether the line belongs to the content of a block scalar
+func lintLines(data []byte, fn func(index int, line string, blockContent bool)) {
+	// Indentation of the line that opened the current block scalar, or -1
+	blockParent := -1
+	// Indentation of the current block scalar content once known, or -1
+	blockIndent := -1
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			fn(i, line, blockParent >= 0)
+			continue
+		}
+		spaces := len(line) - len(strings.TrimLeft(line, " "))
+
+		if blockParent >= 0 {
+			if blockIndent < 0 && spaces > blockParent {
+				blockIndent = spaces
+			}
+			if blockIndent >= 0 && spaces >= blockIndent {
+				fn(i, line, true)
+				continue
+			}
+			blockParent, blockIndent = -1, -1
+		}
+
+		fn(i, line, false)
+
+		if blockScalarHeader.MatchString(line) {
+			blockParent = spaces
+		}
+	}
+}
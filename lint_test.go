@@ -0,0 +1,192 @@
+package golang_yaml_advanced
+
+import "testing"
+
+// TestLintIndentation tests reporting tab indentation
+func TestSeverityString(t *testing.T) {
+	tests := []struct {
+		severity Severity
+		expected string
+	}{
+		{SeverityError, "error"},
+		{SeverityWarning, "warning"},
+		{Severity(0), "Unknown(0)"}, // the zero value is not an error
+		{Severity(99), "Unknown(99)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if got := tt.severity.String(); got != tt.expected {
+				t.Errorf("Severity.String() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	var issue LintIssue
+	if issue.Severity == SeverityError {
+		t.Error("zero LintIssue should not have SeverityError")
+	}
+}
+
+func TestLintIndentation(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantLines []int
+		wantCols  []int
+	}{
+		{
+			name:      "LeadingTab",
+			input:     "app:\n\tname: demo\n  port: 80\n",
+			wantLines: []int{2},
+			wantCols:  []int{1},
+		},
+		{
+			name:      "TabAfterSpaces",
+			input:     "app:\n  name: demo\n  \tport: 80\n",
+			wantLines: []int{3},
+			wantCols:  []int{3},
+		},
+		{
+			name:      "SeveralLines",
+			input:     "a:\n\tb: 1\n\tc: 2\n",
+			wantLines: []int{2, 3},
+			wantCols:  []int{1, 1},
+		},
+		{
+			name:  "CleanInput",
+			input: "app:\n  name: demo # a\ttab in a comment\n  list:\n    - x\n",
+		},
+		{
+			name:  "TabsInBlockScalar",
+			input: "script: |\n  line one\n  \tindented with a tab\n  \t\ttwice\nnext: value\n",
+		},
+		{
+			name:      "TabAfterBlockScalar",
+			input:     "script: >-\n  folded\n\tbad: true\n",
+			wantLines: []int{3},
+			wantCols:  []int{1},
+		},
+		{
+			name:  "TabIndentedComment",
+			input: "a: 1\n\t# comment\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := LintIndentation([]byte(tt.input))
+			if len(issues) != len(tt.wantLines) {
+				t.Fatalf("LintIndentation() returned %d issues, want %d: %v", len(issues), len(tt.wantLines), issues)
+			}
+			for i, issue := range issues {
+				if issue.Line != tt.wantLines[i] {
+					t.Errorf("issue %d Line = %d, want %d", i, issue.Line, tt.wantLines[i])
+				}
+				if issue.Column != tt.wantCols[i] {
+					t.Errorf("issue %d Column = %d, want %d", i, issue.Column, tt.wantCols[i])
+				}
+				if issue.Rule != "tab-indentation" || issue.Message == "" {
+					t.Errorf("issue %d = %v, want a tab-indentation issue with a message", i, issue)
+				}
+			}
+		})
+	}
+
+	t.Run("ExplainsParseFailure", func(t *testing.T) {
+		input := []byte("app:\n\tname: demo\n")
+		if _, err := UnmarshalYAML(input); err == nil {
+			t.Fatal("UnmarshalYAML() should reject tab indentation")
+		}
+		issues := LintIndentation(input)
+		if len(issues) != 1 || issues[0].Line != 2 {
+			t.Errorf("LintIndentation() = %v, want one issue on line 2", issues)
+		}
+	})
+}
+
+// TestLint tests aggregating YAML hygiene issues
+func TestLint(t *testing.T) {
+	type want struct {
+		line     int
+		column   int
+		rule     string
+		severity Severity
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  []want
+	}{
+		{
+			name:  "CleanInput",
+			input: "app:\n  name: demo\n  ports:\n    - 80\n  servers:\n    - name: a\n      port: 1\n",
+		},
+		{
+			name:  "TrailingWhitespace",
+			input: "app: \n  name: demo\t\n",
+			want: []want{
+				{1, 5, "trailing-whitespace", SeverityWarning},
+				{2, 13, "trailing-whitespace", SeverityWarning},
+			},
+		},
+		{
+			name:  "MixedIndentationWidths",
+			input: "app:\n  name: demo\n  settings:\n      debug: true\n      port: 80\nother:\n   value: 1\n",
+			want: []want{
+				{4, 7, "indentation-width", SeverityWarning},
+				{7, 4, "indentation-width", SeverityWarning},
+			},
+		},
+		{
+			name:  "SequenceItemsKeepWidth",
+			input: "servers:\n    - name: a\n      port: 1\n      tags:\n          - x\n",
+		},
+		{
+			name:  "FlowAndBlockScalarsIgnored",
+			input: "list: [\n     a,\n   b]\nscript: |\n     indented\n   less\nnext: 1\n",
+		},
+		{
+			name:  "Tabs",
+			input: "app:\n\tname: demo\n",
+			want: []want{
+				{2, 1, "tab-indentation", SeverityError},
+			},
+		},
+		{
+			name:  "MissingFinalNewline",
+			input: "app:\n  name: demo",
+			want: []want{
+				{2, 13, "missing-final-newline", SeverityWarning},
+			},
+		},
+		{
+			name:  "SeveralIssuesInOrder",
+			input: "a: 1 \nb:\n    c: 2\n    d:\n      e: 3",
+			want: []want{
+				{1, 5, "trailing-whitespace", SeverityWarning},
+				{5, 7, "indentation-width", SeverityWarning},
+				{5, 11, "missing-final-newline", SeverityWarning},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := Lint([]byte(tt.input))
+			if len(issues) != len(tt.want) {
+				t.Fatalf("Lint() returned %d issues, want %d: %v", len(issues), len(tt.want), issues)
+			}
+			for i, issue := range issues {
+				w := tt.want[i]
+				if issue.Line != w.line || issue.Column != w.column || issue.Rule != w.rule || issue.Severity != w.severity {
+					t.Errorf("issue %d = %v, want line %d column %d %s %s", i, issue, w.line, w.column, w.severity, w.rule)
+				}
+				if issue.Message == "" {
+					t.Errorf("issue %d has no message", i)
+				}
+			}
+		})
+	}
+}
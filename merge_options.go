@@ -0,0 +1,307 @@
+package golang_yaml_advanced
+
+import "fmt"
+
+// SequenceMergeStrategy controls how two sequences are combined during a merge
+type SequenceMergeStrategy int
+
+const (
+	// SequenceMergeDefault keeps the historical MergeNodes behavior: sequences under
+	// a mapping key are replaced by the overlay, top-level sequences are appended
+	SequenceMergeDefault SequenceMergeStrategy = iota
+	// SequenceMergeReplace replaces the base sequence with the overlay sequence
+	SequenceMergeReplace
+	// SequenceMergeAppend appends the overlay items to the base items
+	SequenceMergeAppend
+	// SequenceMergeByKey merges mapping items that share the same SequenceKey value
+	// and appends the remaining overlay items
+	SequenceMergeByKey
+	// SequenceMergeUnion appends only the overlay items not already present, compared
+	// structurally ignoring comments and style. It is meant for sequences of scalars or
+	// other simply comparable items; mapping items that differ in any field are kept
+	// side by side rather than merged.
+	SequenceMergeUnion
+)
+
+func (s SequenceMergeStrategy) String() string {
+	switch s {
+	case SequenceMergeDefault:
+		return "Default"
+	case SequenceMergeReplace:
+		return "Replace"
+	case SequenceMergeAppend:
+		return "Append"
+	case SequenceMergeByKey:
+		return "MergeByKey"
+	case SequenceMergeUnion:
+		return "Union"
+	default:
+		return "Unknown"
+	}
+}
+
+// CommentMergeMode controls which comments are kept for entries present in both inputs
+type CommentMergeMode int
+
+const (
+	// CommentMergeDefault keeps the historical MergeNodes behavior: overlay key comments
+	// replace base key comments on replaced values, merged mappings keep base comments
+	CommentMergeDefault CommentMergeMode = iota
+	// CommentMergePreferBase keeps the base comments, using overlay comments only where base has none
+	CommentMergePreferBase
+	// CommentMergePreferOverlay keeps the overlay comments, using base comments only where overlay has none
+	CommentMergePreferOverlay
+	// CommentMergeConcatenate keeps both, with overlay comments after base comments
+	CommentMergeConcatenate
+)
+
+func (m CommentMergeMode) String() string {
+	switch m {
+	case CommentMergeDefault:
+		return "Default"
+	case CommentMergePreferBase:
+		return "PreferBase"
+	case CommentMergePreferOverlay:
+		return "PreferOverlay"
+	case CommentMergeConcatenate:
+		return "Concatenate"
+	default:
+		return "Unknown"
+	}
+}
+
+// MergeKeyOrder controls the order of keys in merged mappings
+type MergeKeyOrder int
+
+const (
+	// KeyOrderBaseFirst keeps the historical MergeNodes behavior: base keys keep their
+	// positions and overlay-only keys are appended in overlay order
+	KeyOrderBaseFirst MergeKeyOrder = iota
+	// KeyOrderOverlayFirst orders the keys present in the overlay as in the overlay,
+	// followed by the base-only keys in base order
+	KeyOrderOverlayFirst
+	// KeyOrderAlphabetical sorts the merged keys by name
+	KeyOrderAlphabetical
+)
+
+func (o MergeKeyOrder) String() string {
+	switch o {
+	case KeyOrderBaseFirst:
+		return "BaseFirst"
+	case KeyOrderOverlayFirst:
+		return "OverlayFirst"
+	case KeyOrderAlphabetical:
+		return "Alphabetical"
+	default:
+		return "Unknown"
+	}
+}
+
+// DefaultSequenceKey is the item field used by SequenceMergeByKey when SequenceKey is empty
+const DefaultSequenceKey = "name"
+
+// DefaultProvenanceKey is the metadata key used by MergeTreesWithProvenance
+const DefaultProvenanceKey = "source"
+
+// MergeOptions configures how nodes, documents and trees are merged
+type MergeOptions struct {
+	// SequenceStrategy controls how sequences present in both inputs are combined
+	SequenceStrategy SequenceMergeStrategy
+	// SequenceKey names the field identifying sequence items for SequenceMergeByKey
+	SequenceKey string
+	// PreferBase keeps the base value when both inputs set the same leaf
+	PreferBase bool
+	// DeleteOnNull removes a key from the result when the overlay sets it to null
+	DeleteOnNull bool
+	// Resolver decides conflicting leaves and takes precedence over PreferBase
+	Resolver MergeResolver
+	// CommentMode controls how comments of entries present in both inputs are combined
+	CommentMode CommentMergeMode
+	// CoerceScalarToSequence merges a scalar with a sequence instead of replacing it:
+	// a scalar base is prepended to a sequence overlay and a scalar overlay is appended
+	// to a sequence base. Coercion is applied before Resolver and PreferBase, which are
+	// never consulted for such pairs. Null scalars are not coerced.
+	CoerceScalarToSequence bool
+	// ProvenanceKey, when set, records in the metadata of every merged node which input
+	// it was taken from: BaseLabel for nodes retained from base and OverlayLabel for
+	// nodes taken from the overlay. Collections present in both inputs keep BaseLabel.
+	ProvenanceKey string
+	BaseLabel     string
+	OverlayLabel  string
+	// AnnotateOverrides prepends a "# overridden from <base value>" comment to the head
+	// comment of every key whose value the overlay replaced with a different value, so
+	// the merged file documents what it changed. Merged mappings and sequences are not
+	// annotated themselves, only the leaves they contain.
+	AnnotateOverrides bool
+	// KeyOrder controls the order of keys in every merged mapping. Reordering keeps a
+	// section comment at the top of the mapping, as the OrderKeys transform does.
+	KeyOrder MergeKeyOrder
+	// BlankLineBeforeAdded writes an empty line before every key the overlay adds to a
+	// mapping that already has entries, so merged-in settings stand out in the output
+	BlankLineBeforeAdded bool
+
+	// plan collects the changes made by the merge for MergePlan
+	plan *[]MergeChange
+}
+
+// DefaultMergeOptions returns the options used by MergeNodes, MergeDocuments and MergeTrees
+func DefaultMergeOptions() MergeOptions {
+	return MergeOptions{
+		SequenceStrategy: SequenceMergeDefault,
+	}
+}
+
+// sequenceKey returns the field used to match sequence items
+func (opts MergeOptions) sequenceKey() string {
+	if opts.SequenceKey == "" {
+		return DefaultSequenceKey
+	}
+	return opts.SequenceKey
+}
+
+// mergesNestedSequences reports whether sequences under a shared key are merged
+// instead of being replaced by the overlay
+func (opts MergeOptions) mergesNestedSequences() bool {
+	return opts.SequenceStrategy == SequenceMergeAppend || opts.SequenceStrategy == SequenceMergeByKey ||
+		opts.SequenceStrategy == SequenceMergeUnion
+}
+
+// coercesToSequence reports whether base and overlay are a scalar and a sequence
+// that are merged into one sequence
+func (opts MergeOptions) coercesToSequence(base, overlay *Node) bool {
+	if !opts.CoerceScalarToSequence {
+		return false
+	}
+	isScalar := func(n *Node) bool { return n.Kind == ScalarNode && !n.IsNull() }
+	return (isScalar(base) && overlay.Kind == SequenceNode) || (base.Kind == SequenceNode && isScalar(overlay))
+}
+
+// choose picks the node to keep for a conflicting leaf at path
+func (opts MergeOptions) choose(path string, base, overlay *Node) *Node {
+	if opts.Resolver != nil {
+		return opts.Resolver(path, base, overlay)
+	}
+	if opts.PreferBase {
+		return base
+	}
+	return overlay
+}
+
+// stampProvenance returns a copy of node whose nodes carry label under the provenance
+// key, or node itself when provenance is not tracked or label is empty. Nodes already
+// labelled, such as the result of an earlier merge, keep their label.
+func (opts MergeOptions) stampProvenance(node *Node, label string) *Node {
+	if opts.ProvenanceKey == "" || label == "" || node == nil {
+		return node
+	}
+	stamped := node.Clone()
+	opts.labelNodes(stamped, label)
+	return stamped
+}
+
+// stampDocument returns a copy of doc whose nodes are labelled like stampProvenance,
+// or doc itself when provenance is not tracked or label is empty
+func (opts MergeOptions) stampDocument(doc *Document, label string) *Document {
+	if opts.ProvenanceKey == "" || label == "" || doc == nil || doc.Root == nil {
+		return doc
+	}
+	stamped := &Document{
+		Root:        opts.stampProvenance(doc.Root, label),
+		Directives:  append([]Directive(nil), doc.Directives...),
+		Version:     doc.Version,
+		ExplicitEnd: doc.ExplicitEnd,
+	}
+	stamped.ReindexAnchors()
+	return stamped
+}
+
+// labelNodes sets label under the provenance key on node and its descendants that
+// do not have a provenance label yet
+func (opts MergeOptions) labelNodes(node *Node, label string) {
+	if opts.ProvenanceKey == "" || label == "" || node == nil {
+		return
+	}
+	node.Walk(func(n *Node) bool {
+		if _, labelled := n.GetMeta(opts.ProvenanceKey); !labelled {
+			n.SetMeta(opts.ProvenanceKey, label)
+		}
+		return true
+	})
+}
+
+// orderMergedKeys reorders the keys of a merged mapping according to KeyOrder
+func (opts MergeOptions) orderMergedKeys(result, overlay *Node) {
+	switch opts.KeyOrder {
+	case KeyOrderOverlayFirst:
+		rank := make(map[string]int)
+		for i := 0; i < len(overlay.Children)-1; i += 2 {
+			if key := overlay.Children[i]; key.Kind == ScalarNode {
+				name := fmt.Sprintf("%v", key.Value)
+				if _, exists := rank[name]; !exists {
+					rank[name] = i
+				}
+			}
+		}
+		orderKeys(result, rank, false)
+	case KeyOrderAlphabetical:
+		orderKeys(result, nil, true)
+	}
+}
+
+// overrideComment returns the comment recording that a key used to hold base
+func overrideComment(base *Node) string {
+	if base.Kind == ScalarNode {
+		if base.IsNull() {
+			return "# overridden from null"
+		}
+		if base.hasCurrentRawValue() {
+			return "# overridden from " + base.RawValue
+		}
+		return fmt.Sprintf("# overridden from %v", base.Value)
+	}
+
+	return "# overridden from " + flowText(base)
+}
+
+// mergeComments sets the comments of dst from base and overlay according to mode
+func mergeComments(dst, base, overlay *Node, mode CommentMergeMode) {
+	first, second := overlay, base
+	if mode == CommentMergePreferBase {
+		first, second = base, overlay
+	}
+
+	if mode == CommentMergeConcatenate {
+		dst.HeadComment = concatComments(base.HeadComment, overlay.HeadComment)
+		dst.FootComment = concatComments(base.FootComment, overlay.FootComment)
+		switch {
+		case overlay.LineComment == "" || overlay.LineComment == base.LineComment:
+			dst.LineComment = base.LineComment
+		case base.LineComment == "":
+			dst.LineComment = overlay.LineComment
+		default:
+			dst.LineComment = base.LineComment + " " + overlay.LineComment
+		}
+		return
+	}
+
+	dst.HeadComment = append([]string(nil), first.HeadComment...)
+	if len(dst.HeadComment) == 0 {
+		dst.HeadComment = append([]string(nil), second.HeadComment...)
+	}
+	dst.LineComment = first.LineComment
+	if dst.LineComment == "" {
+		dst.LineComment = second.LineComment
+	}
+	dst.FootComment = append([]string(nil), first.FootComment...)
+	if len(dst.FootComment) == 0 {
+		dst.FootComment = append([]string(nil), second.FootComment...)
+	}
+}
+
+// concatComments appends overlay comment lines after base ones, skipping an identical block
+func concatComments(base, overlay []string) []string {
+	if equalStringSlices(base, overlay) {
+		return append([]string(nil), base...)
+	}
+	return append(append([]string(nil), base...), overlay...)
+}
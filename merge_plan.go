@@ -0,0 +1,93 @@
+package golang_yaml_advanced
+
+import "fmt"
+
+// MergeAction is what a merge does at one location
+type MergeAction int
+
+const (
+	// MergeActionAdd adds a key, sequence item or document only the overlay has
+	MergeActionAdd MergeAction = iota
+	// MergeActionOverride replaces a base value with a different overlay value
+	MergeActionOverride
+	// MergeActionKeep keeps a base value the overlay also sets, either because both
+	// values are equal or because the merge prefers the base
+	MergeActionKeep
+)
+
+func (a MergeAction) String() string {
+	switch a {
+	case MergeActionAdd:
+		return "Add"
+	case MergeActionOverride:
+		return "Override"
+	case MergeActionKeep:
+		return "Keep"
+	default:
+		return "Unknown"
+	}
+}
+
+// MergeChange describes what a merge does at Path. OldValue is the base value and
+// NewValue the value in the merged result, both converted to Go values as ToInterface
+// does; OldValue is nil for additions.
+type MergeChange struct {
+	Path     string
+	Action   MergeAction
+	OldValue interface{}
+	NewValue interface{}
+}
+
+func (c MergeChange) String() string {
+	switch c.Action {
+	case MergeActionAdd:
+		return fmt.Sprintf("%s %s = %v", c.Action, c.Path, c.NewValue)
+	case MergeActionOverride:
+		return fmt.Sprintf("%s %s: %v -> %v", c.Action, c.Path, c.OldValue, c.NewValue)
+	default:
+		return fmt.Sprintf("%s %s = %v", c.Action, c.Path, c.OldValue)
+	}
+}
+
+// MergePlan reports what MergeTrees(base, overlay) would do without returning the
+// merged tree, like a dry run: every key, sequence item and document the overlay adds,
+// and every leaf set by both inputs with whether the overlay value overrides the base
+// value or the base value is kept. Mappings present in both inputs are not listed
+// themselves, only their entries, and keys only in base are not listed. Paths use the
+// $.a.b form passed to a MergeResolver; documents after the first are numbered as
+// $[document:N] by their position in the merged tree. The inputs are not modified.
+func MergePlan(base, overlay *NodeTree) []MergeChange {
+	if base == nil {
+		base = NewNodeTree()
+	}
+	var changes []MergeChange
+	opts := DefaultMergeOptions()
+	opts.plan = &changes
+	MergeTreesWithOptions(base, overlay, opts)
+	return changes
+}
+
+// record adds a change to the merge plan, if one is being collected. Overrides by an
+// equal value are recorded as kept.
+func (opts MergeOptions) record(action MergeAction, path string, base, result *Node) {
+	if opts.plan == nil {
+		return
+	}
+	if action == MergeActionOverride && base.Equal(result, EqualOptions{IgnoreComments: true, IgnoreStyle: true}) {
+		action = MergeActionKeep
+	}
+	*opts.plan = append(*opts.plan, MergeChange{
+		Path:     path,
+		Action:   action,
+		OldValue: nodeToInterface(base),
+		NewValue: nodeToInterface(result),
+	})
+}
+
+// recordDocument adds a document the overlay adds at index i of the merged tree to the
+// merge plan
+func (opts MergeOptions) recordDocument(i int, doc *Document) {
+	if doc != nil {
+		opts.record(MergeActionAdd, fmt.Sprintf("$[document:%d]", i), nil, documentContent(doc.Root))
+	}
+}
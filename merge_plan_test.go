@@ -0,0 +1,117 @@
+package golang_yaml_advanced
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// TestMergePlan tests previewing a merge without building the merged tree
+func TestMergePlan(t *testing.T) {
+	parse := func(input string) *NodeTree {
+		tree, err := UnmarshalYAML([]byte(input))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		return tree
+	}
+
+	base := parse("app:\n  name: demo\n  replicas: 1\n  image: demo:1.0\nports: [80]\nlegacy: true\n")
+	overlay := parse("app:\n  name: demo\n  replicas: 3\n  debug: true\nports: [443]\n")
+	baseYAML, _ := base.ToYAML()
+	overlayYAML, _ := overlay.ToYAML()
+
+	changes := MergePlan(base, overlay)
+
+	type change struct {
+		path   string
+		action MergeAction
+	}
+	var got []change
+	for _, c := range changes {
+		got = append(got, change{c.Path, c.Action})
+	}
+	want := []change{
+		{"$.app.name", MergeActionKeep},
+		{"$.app.replicas", MergeActionOverride},
+		{"$.app.debug", MergeActionAdd},
+		{"$.ports", MergeActionOverride},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("MergePlan() = %v, want %v", changes, want)
+	}
+
+	t.Run("Values", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			change   MergeChange
+			oldValue interface{}
+			newValue interface{}
+		}{
+			{"Keep", changes[0], "demo", "demo"},
+			{"Override", changes[1], 1, 3},
+			{"Add", changes[2], nil, true},
+			{"OverrideSequence", changes[3], []interface{}{80}, []interface{}{443}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				// Compare printed values since parsed integers are int64
+				if fmt.Sprint(tt.change.OldValue) != fmt.Sprint(tt.oldValue) || fmt.Sprint(tt.change.NewValue) != fmt.Sprint(tt.newValue) {
+					t.Errorf("%s values = %#v -> %#v, want %#v -> %#v", tt.change.Path,
+						tt.change.OldValue, tt.change.NewValue, tt.oldValue, tt.newValue)
+				}
+			})
+		}
+	})
+
+	t.Run("InputsUnchanged", func(t *testing.T) {
+		if after, _ := base.ToYAML(); string(after) != string(baseYAML) {
+			t.Error("MergePlan() modified the base tree")
+		}
+		if after, _ := overlay.ToYAML(); string(after) != string(overlayYAML) {
+			t.Error("MergePlan() modified the overlay tree")
+		}
+	})
+
+	t.Run("ExtraDocuments", func(t *testing.T) {
+		changes := MergePlan(parse("a: 1\n"), parse("a: 1\n---\nb: 2\n"))
+		if len(changes) != 2 || changes[1].Path != "$[document:1]" || changes[1].Action != MergeActionAdd {
+			t.Errorf("MergePlan() = %v, want a keep and a document add", changes)
+		}
+	})
+
+	t.Run("EmptyBase", func(t *testing.T) {
+		changes := MergePlan(nil, parse("a: 1\n"))
+		if len(changes) != 1 || changes[0].Action != MergeActionAdd {
+			t.Errorf("MergePlan() = %v, want one add", changes)
+		}
+	})
+
+	t.Run("MergeUnaffected", func(t *testing.T) {
+		merged, _ := MergeTrees(base, overlay).ToYAML()
+		want := "app:\n  name: demo\n  replicas: 3\n  image: demo:1.0\n  debug: true\nports: [443]\nlegacy: true\n"
+		if string(merged) != want {
+			t.Errorf("MergeTrees() =\n%s\nwant\n%s", merged, want)
+		}
+	})
+}
+
+// TestMergeChangeString tests the text form of planned merge changes
+func TestMergeChangeString(t *testing.T) {
+	tests := []struct {
+		change MergeChange
+		want   string
+	}{
+		{MergeChange{Path: "$.a", Action: MergeActionAdd, NewValue: 1}, "Add $.a = 1"},
+		{MergeChange{Path: "$.a", Action: MergeActionOverride, OldValue: 1, NewValue: 2}, "Override $.a: 1 -> 2"},
+		{MergeChange{Path: "$.a", Action: MergeActionKeep, OldValue: 1, NewValue: 1}, "Keep $.a = 1"},
+	}
+	for _, tt := range tests {
+		if got := tt.change.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+	if got := MergeAction(99).String(); got != "Unknown" {
+		t.Errorf("String() = %q, want Unknown", got)
+	}
+}
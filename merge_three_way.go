@@ -0,0 +1,215 @@
+package golang_yaml_advanced
+
+import "fmt"
+
+// MergeConflict is a location where ours and theirs both changed the base differently
+type MergeConflict struct {
+	Path   string // resolves in the merged tree with NodeTree.GetPath
+	Base   *Node  // nil when the node did not exist in the base
+	Ours   *Node  // nil when ours removed the node
+	Theirs *Node  // nil when theirs removed the node
+}
+
+func (c MergeConflict) Error() string {
+	return fmt.Sprintf("merge conflict at %s", c.Path)
+}
+
+// MergeThreeWay merges the changes ours and theirs made to their common ancestor base.
+// Changes made by only one side are applied, mappings changed by both sides are merged
+// key by key, and any other node changed differently by both sides is reported as a
+// conflict. Conflicting locations keep the ours version in the merged tree. Sequences
+// are compared as a whole, so concurrent edits to the same sequence conflict.
+// Comments and styles never conflict: they are merged separately, taking the side
+// that changed them, or ours when both did.
+func MergeThreeWay(base, ours, theirs *NodeTree) (*NodeTree, []MergeConflict) {
+	result := NewNodeTree()
+	var conflicts []MergeConflict
+
+	count := len(treeDocuments(ours))
+	if n := len(treeDocuments(theirs)); n > count {
+		count = n
+	}
+
+	for i := 0; i < count; i++ {
+		baseDoc, oursDoc, theirsDoc := documentAt(base, i), documentAt(ours, i), documentAt(theirs, i)
+
+		root := mergeThreeWayNodes(documentRoot(baseDoc), documentRoot(oursDoc), documentRoot(theirsDoc),
+			fmt.Sprintf("$[document:%d]", i), &conflicts)
+		if root == nil {
+			continue
+		}
+		mergeThreeWayFormatting(root, documentRoot(baseDoc), documentRoot(oursDoc), documentRoot(theirsDoc))
+
+		doc := result.AddDocument()
+		source := oursDoc
+		if source == nil {
+			source = theirsDoc
+		}
+		if source != nil {
+			doc.Directives = append([]Directive(nil), source.Directives...)
+			doc.Version = source.Version
+		}
+		doc.SetRoot(root)
+		doc.ReindexAnchors()
+	}
+
+	return result, conflicts
+}
+
+// threeWayDataOptions compares the data of nodes, leaving comments and styles to
+// mergeThreeWayFormatting
+var threeWayDataOptions = EqualOptions{IgnoreComments: true, IgnoreStyle: true}
+
+func mergeThreeWayNodes(base, ours, theirs *Node, path string, conflicts *[]MergeConflict) *Node {
+	switch {
+	case ours.Equal(theirs, threeWayDataOptions):
+		return ours.Clone()
+	case base.Equal(ours, threeWayDataOptions):
+		return theirs.Clone()
+	case base.Equal(theirs, threeWayDataOptions):
+		return ours.Clone()
+	}
+
+	if ours != nil && theirs != nil && ours.Kind == theirs.Kind && (base == nil || base.Kind == ours.Kind) {
+		switch ours.Kind {
+		case MappingNode:
+			return mergeThreeWayMappings(base, ours, theirs, path, conflicts)
+		case DocumentNode:
+			result := ours.Clone()
+			result.Children = nil
+			if merged := mergeThreeWayNodes(firstChild(base), firstChild(ours), firstChild(theirs), path, conflicts); merged != nil {
+				result.AddChild(merged)
+			}
+			return result
+		}
+	}
+
+	*conflicts = append(*conflicts, MergeConflict{Path: path, Base: base, Ours: ours, Theirs: theirs})
+	return ours.Clone()
+}
+
+// mergeThreeWayMappings merges two changed mappings key by key. Keys keep the order of
+// ours, followed by the keys only theirs added.
+func mergeThreeWayMappings(base, ours, theirs *Node, path string, conflicts *[]MergeConflict) *Node {
+	result := ours.Clone()
+	result.Children = make([]*Node, 0, len(ours.Children))
+
+	var keys []*Node
+	seen := make(map[string]bool)
+	for _, mapping := range []*Node{ours, theirs} {
+		for i := 0; i < len(mapping.Children)-1; i += 2 {
+			key := mapping.Children[i]
+			name := fmt.Sprintf("%v", key.Value)
+			if key.Kind == ScalarNode && !seen[name] {
+				seen[name] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		name := fmt.Sprintf("%v", key.Value)
+		var baseValue *Node
+		if base != nil {
+			baseValue = base.GetMapValue(name)
+		}
+		merged := mergeThreeWayNodes(baseValue, ours.GetMapValue(name), theirs.GetMapValue(name),
+			path+pathKey(name), conflicts)
+		if merged != nil {
+			result.AddKeyValue(key.Clone(), merged)
+		}
+	}
+
+	return result
+}
+
+// mergeThreeWayFormatting sets the comments and style of result and its descendants
+// from the matching nodes of base, ours and theirs: a side that changed them from base
+// wins, and ours wins when both did. Mapping entries are matched by key, and sequence
+// items by index when no side changed the length. Nodes missing on a side are left as
+// the data merge produced them.
+func mergeThreeWayFormatting(result, base, ours, theirs *Node) {
+	if result == nil || ours == nil || theirs == nil || ours.Kind != result.Kind || theirs.Kind != result.Kind {
+		return
+	}
+	if base == nil || base.Kind != result.Kind {
+		// Both sides added the node, so ours wins unless it has no comments
+		base = &Node{Kind: result.Kind, Style: theirs.Style}
+	}
+
+	source := theirs
+	if !commentsEqual(ours, base) {
+		source = ours
+	}
+	result.HeadComment = append([]string(nil), source.HeadComment...)
+	result.LineComment = source.LineComment
+	result.FootComment = append([]string(nil), source.FootComment...)
+	if ours.Style != base.Style {
+		result.Style = ours.Style
+	} else {
+		result.Style = theirs.Style
+	}
+
+	switch result.Kind {
+	case MappingNode:
+		for i := 0; i < len(result.Children)-1; i += 2 {
+			name := fmt.Sprintf("%v", result.Children[i].Value)
+			mergeThreeWayFormatting(result.Children[i], mapKeyNode(base, name), mapKeyNode(ours, name), mapKeyNode(theirs, name))
+			mergeThreeWayFormatting(result.Children[i+1], base.GetMapValue(name), ours.GetMapValue(name), theirs.GetMapValue(name))
+		}
+	case SequenceNode, DocumentNode:
+		count := len(result.Children)
+		if len(ours.Children) != count || len(theirs.Children) != count {
+			return
+		}
+		for i, child := range result.Children {
+			var baseChild *Node
+			if len(base.Children) == count {
+				baseChild = base.Children[i]
+			}
+			mergeThreeWayFormatting(child, baseChild, ours.Children[i], theirs.Children[i])
+		}
+	}
+}
+
+// mapKeyNode returns the key node of the entry named name in mapping, or nil
+func mapKeyNode(mapping *Node, name string) *Node {
+	for i := 0; i < len(mapping.Children)-1; i += 2 {
+		if key := mapping.Children[i]; key.Kind == ScalarNode && fmt.Sprintf("%v", key.Value) == name {
+			return key
+		}
+	}
+	return nil
+}
+
+// firstChild returns the content of a document node, or nil if it has none
+func firstChild(node *Node) *Node {
+	if node == nil || len(node.Children) == 0 {
+		return nil
+	}
+	return node.Children[0]
+}
+
+// treeDocuments returns the documents of a possibly nil tree
+func treeDocuments(tree *NodeTree) []*Document {
+	if tree == nil {
+		return nil
+	}
+	return tree.Documents
+}
+
+// documentAt returns the document at index i, or nil if the tree has no such document
+func documentAt(tree *NodeTree, i int) *Document {
+	if docs := treeDocuments(tree); i < len(docs) {
+		return docs[i]
+	}
+	return nil
+}
+
+// documentRoot returns the root of a possibly nil document
+func documentRoot(doc *Document) *Node {
+	if doc == nil {
+		return nil
+	}
+	return doc.Root
+}
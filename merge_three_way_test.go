@@ -0,0 +1,166 @@
+package golang_yaml_advanced
+
+import "testing"
+
+// TestMergeThreeWay tests merging two sets of changes against a common ancestor
+func TestMergeThreeWay(t *testing.T) {
+	parse := func(input string) *NodeTree {
+		tree, err := UnmarshalYAML([]byte(input))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		return tree
+	}
+
+	base := parse(`app:
+  name: demo
+  replicas: 1
+  image: demo:1.0
+ports: [80]
+legacy: true
+`)
+
+	t.Run("CleanAutoMerge", func(t *testing.T) {
+		ours := parse(`app:
+  name: demo
+  replicas: 3
+  image: demo:1.0
+ports: [80]
+legacy: true
+owner: team-a
+`)
+		theirs := parse(`app:
+  name: demo
+  replicas: 1
+  image: demo:2.0
+ports: [80, 443]
+`)
+
+		merged, conflicts := MergeThreeWay(base, ours, theirs)
+		if len(conflicts) != 0 {
+			t.Fatalf("MergeThreeWay() conflicts = %v, want none", conflicts)
+		}
+
+		output, err := merged.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		want := "app:\n  name: demo\n  replicas: 3\n  image: demo:2.0\nports: [80, 443]\nowner: team-a\n"
+		if string(output) != want {
+			t.Errorf("merged =\n%s\nwant\n%s", output, want)
+		}
+	})
+
+	t.Run("ConflictingEdit", func(t *testing.T) {
+		ours := parse("app:\n  name: demo\n  replicas: 3\n  image: demo:1.0\nports: [80]\nlegacy: maybe\n")
+		theirs := parse("app:\n  name: demo\n  replicas: 5\n  image: demo:1.0\nports: [80]\nlegacy: false\n")
+
+		merged, conflicts := MergeThreeWay(base, ours, theirs)
+		if len(conflicts) != 2 {
+			t.Fatalf("MergeThreeWay() conflicts = %v, want 2", conflicts)
+		}
+
+		conflict := conflicts[0]
+		if conflict.Path != "$[document:0].app.replicas" {
+			t.Errorf("conflict path = %s, want $[document:0].app.replicas", conflict.Path)
+		}
+		baseValue, _ := conflict.Base.AsInt()
+		oursValue, _ := conflict.Ours.AsInt()
+		theirsValue, _ := conflict.Theirs.AsInt()
+		if baseValue != 1 || oursValue != 3 || theirsValue != 5 {
+			t.Errorf("conflict values = %d/%d/%d, want 1/3/5", baseValue, oursValue, theirsValue)
+		}
+		if conflicts[1].Path != "$[document:0].legacy" {
+			t.Errorf("conflict path = %s, want $[document:0].legacy", conflicts[1].Path)
+		}
+
+		app := merged.Documents[0].Root.Children[0].GetMapValue("app")
+		if replicas, _ := app.GetMapValue("replicas").AsInt(); replicas != 3 {
+			t.Error("conflicting values should keep ours")
+		}
+	})
+
+	t.Run("DeleteVersusEdit", func(t *testing.T) {
+		ours := parse("app:\n  name: demo\n  replicas: 1\n  image: demo:1.0\nports: [80]\n")
+		theirs := parse("app:\n  name: demo\n  replicas: 1\n  image: demo:1.0\nports: [80]\nlegacy: false\n")
+
+		merged, conflicts := MergeThreeWay(base, ours, theirs)
+		if len(conflicts) != 1 || conflicts[0].Ours != nil || conflicts[0].Theirs == nil {
+			t.Fatalf("conflicts = %v, want one delete/edit conflict", conflicts)
+		}
+		if merged.Documents[0].Root.Children[0].GetMapValue("legacy") != nil {
+			t.Error("delete/edit conflict should keep ours, which removed the key")
+		}
+	})
+
+	t.Run("BothAddSameKey", func(t *testing.T) {
+		ours := parse("app:\n  name: demo\n  replicas: 1\n  image: demo:1.0\nports: [80]\nlegacy: true\nregion: eu\n")
+		theirs := parse("app:\n  name: demo\n  replicas: 1\n  image: demo:1.0\nports: [80]\nlegacy: true\nregion: us\n")
+
+		_, conflicts := MergeThreeWay(base, ours, theirs)
+		if len(conflicts) != 1 || conflicts[0].Base != nil || conflicts[0].Path != "$[document:0].region" {
+			t.Errorf("conflicts = %v, want an add/add conflict at region", conflicts)
+		}
+	})
+
+	t.Run("ConflictPathResolves", func(t *testing.T) {
+		base := parse("labels:\n  app.kubernetes.io/name: demo\n")
+		ours := parse("labels:\n  app.kubernetes.io/name: ours\n")
+		theirs := parse("labels:\n  app.kubernetes.io/name: theirs\n")
+
+		merged, conflicts := MergeThreeWay(base, ours, theirs)
+		if len(conflicts) != 1 {
+			t.Fatalf("MergeThreeWay() conflicts = %v, want 1", conflicts)
+		}
+		if want := `$[document:0].labels["app.kubernetes.io/name"]`; conflicts[0].Path != want {
+			t.Errorf("conflict path = %s, want %s", conflicts[0].Path, want)
+		}
+		node, err := merged.GetPath(conflicts[0].Path)
+		if err != nil {
+			t.Fatalf("GetPath() error = %v", err)
+		}
+		if value, _ := node.AsString(); value != "ours" {
+			t.Errorf("GetPath() = %v, want ours", node)
+		}
+	})
+
+	t.Run("CommentsMergedSeparately", func(t *testing.T) {
+		base := parse("# Application\napp:\n  replicas: 1 # count\n  image: demo:1.0\nports: [80]\n")
+		ours := parse("# Application\napp:\n  replicas: 1 # scaled by the HPA\n  image: demo:1.0\nports:\n  - 80\n")
+		theirs := parse("# The demo application\napp:\n  replicas: 3 # count\n  # Pinned image\n  image: demo:1.0\nports: [80]\n")
+
+		merged, conflicts := MergeThreeWay(base, ours, theirs)
+		if len(conflicts) != 0 {
+			t.Fatalf("MergeThreeWay() conflicts = %v, want none", conflicts)
+		}
+		output, err := merged.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		want := "# The demo application\napp:\n  replicas: 3 # scaled by the HPA\n\n  # Pinned image\n  image: demo:1.0\nports:\n  - 80\n"
+		if string(output) != want {
+			t.Errorf("merged =\n%s\nwant\n%s", output, want)
+		}
+	})
+
+	t.Run("BothChangedComment", func(t *testing.T) {
+		base := parse("replicas: 1 # count\n")
+		ours := parse("replicas: 1 # ours\n")
+		theirs := parse("replicas: 1 # theirs\n")
+
+		merged, conflicts := MergeThreeWay(base, ours, theirs)
+		if len(conflicts) != 0 {
+			t.Fatalf("MergeThreeWay() conflicts = %v, want none", conflicts)
+		}
+		if comment := merged.Documents[0].Root.Children[0].GetMapValue("replicas").LineComment; comment != "# ours" {
+			t.Errorf("line comment = %q, want ours", comment)
+		}
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		merged, conflicts := MergeThreeWay(base, base.Clone(), base.Clone())
+		if len(conflicts) != 0 || !merged.Equal(base, EqualOptions{}) {
+			t.Error("merging unchanged trees should return the base without conflicts")
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package golang_yaml_advanced
+
+import "fmt"
+
+// YAMLVersion selects the YAML specification used to interpret plain scalars
+type YAMLVersion int
+
+const (
+	// YAML12 follows YAML 1.2, where only true and false are booleans
+	YAML12 YAMLVersion = iota
+	// YAML11 follows YAML 1.1, where yes/no and on/off are booleans as well
+	YAML11
+)
+
+func (v YAMLVersion) String() string {
+	switch v {
+	case YAML12:
+		return "1.2"
+	case YAML11:
+		return "1.1"
+	default:
+		return fmt.Sprintf("Unknown(%d)", v)
+	}
+}
+
+// ParseOptions configures how YAML input is converted into nodes
+type ParseOptions struct {
+	// YAMLVersion controls which plain scalars are interpreted as booleans.
+	// Mapping keys always keep their literal text.
+	YAMLVersion YAMLVersion
+	// KeepEmptyDocuments keeps documents without content between separators as
+	// documents with a nil root instead of dropping them
+	KeepEmptyDocuments bool
+}
+
+// DefaultParseOptions returns the default parsing options
+func DefaultParseOptions() ParseOptions {
+	return ParseOptions{
+		YAMLVersion: YAML12,
+	}
+}
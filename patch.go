@@ -0,0 +1,169 @@
+package golang_yaml_advanced
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// patchOperation is a single RFC 6902 JSON Patch operation
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ComputePatch returns an RFC 6902 JSON Patch that turns the content of oldTree into
+// the content of newTree, built from the meaningful differences DiffTrees reports:
+// added nodes become add operations, removed nodes remove operations and changed
+// values or node kinds replace operations. Comments, styles and key order are not
+// part of JSON and are ignored. Removed sequence items are removed from the highest
+// index down so every path is valid when the operations are applied in order.
+// A JSON Patch describes a single document, so trees with more than one document
+// are rejected.
+func ComputePatch(oldTree, newTree *NodeTree) ([]byte, error) {
+	for name, tree := range map[string]*NodeTree{"old": oldTree, "new": newTree} {
+		if n := len(treeDocuments(tree)); n > 1 {
+			return nil, fmt.Errorf("json patch describes a single document, %s tree has %d", name, n)
+		}
+	}
+
+	oldContent := documentContent(documentRoot(documentAt(oldTree, 0)))
+	newContent := documentContent(documentRoot(documentAt(newTree, 0)))
+	if oldContent == nil || newContent == nil || oldContent.Kind == DocumentNode || newContent.Kind == DocumentNode {
+		// One side has no content, so the whole document changes
+		if isEmptyDocumentContent(oldContent) && isEmptyDocumentContent(newContent) {
+			return json.Marshal([]patchOperation{})
+		}
+		op, err := newPatchOperation("replace", "", newContent)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal([]patchOperation{op})
+	}
+
+	var replaces, removes, adds []patchOperation
+	replaced := make(map[string]bool)
+	for _, diff := range DiffNodes(oldContent, newContent, "$") {
+		var op patchOperation
+		var err error
+		switch diff.Type {
+		case DiffAdded:
+			op, err = newPatchOperation("add", jsonPointer(diff.NewNode), diff.NewNode)
+			adds = append(adds, op)
+		case DiffRemoved:
+			op = patchOperation{Op: "remove", Path: jsonPointer(diff.OldNode)}
+			removes = append(removes, op)
+		case DiffModified:
+			// A value and a tag change at the same node need a single replace
+			path := jsonPointer(diff.NewNode)
+			if replaced[path] {
+				continue
+			}
+			replaced[path] = true
+			op, err = newPatchOperation("replace", path, diff.NewNode)
+			replaces = append(replaces, op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ops := make([]patchOperation, 0, len(replaces)+len(removes)+len(adds))
+	ops = append(append(append(ops, replaces...), removes...), adds...)
+	sort.Slice(ops, func(i, j int) bool {
+		return patchOperationLess(ops[i], ops[j])
+	})
+	return json.Marshal(ops)
+}
+
+// newPatchOperation returns an operation carrying the plain value of node
+func newPatchOperation(op, path string, node *Node) (patchOperation, error) {
+	var value interface{}
+	if node != nil && node.Kind != DocumentNode {
+		value = nodeToInterface(node)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return patchOperation{}, fmt.Errorf("cannot encode value at %q: %w", path, err)
+	}
+	return patchOperation{Op: op, Path: path, Value: data}, nil
+}
+
+// isEmptyDocumentContent reports whether node is missing or a document without content
+func isEmptyDocumentContent(node *Node) bool {
+	return node == nil || (node.Kind == DocumentNode && len(node.Children) == 0)
+}
+
+// jsonPointer returns the RFC 6901 JSON Pointer of node within its document, built
+// from its mapping keys and sequence indexes
+func jsonPointer(node *Node) string {
+	var tokens []string
+	for child := node; child != nil && child.Parent != nil && child.Parent.Kind != DocumentNode; child = child.Parent {
+		parent := child.Parent
+		for i, sibling := range parent.Children {
+			if sibling != child {
+				continue
+			}
+			switch parent.Kind {
+			case MappingNode:
+				tokens = append(tokens, mapKeyString(parent.Children[i-i%2]))
+			case SequenceNode:
+				tokens = append(tokens, strconv.Itoa(i))
+			}
+			break
+		}
+	}
+
+	var pointer strings.Builder
+	escape := strings.NewReplacer("~", "~0", "/", "~1")
+	for i := len(tokens) - 1; i >= 0; i-- {
+		pointer.WriteString("/")
+		pointer.WriteString(escape.Replace(tokens[i]))
+	}
+	return pointer.String()
+}
+
+// patchOperationRank orders replace operations before removes and removes before adds
+var patchOperationRank = map[string]int{"replace": 0, "remove": 1, "add": 2}
+
+// patchOperationLess orders operations by kind, then parent pointer and index, then
+// path. Removes run from the deepest parent and the highest index down and adds the
+// other way round, so every path is valid when the operations are applied in order.
+func patchOperationLess(a, b patchOperation) bool {
+	if a.Op != b.Op {
+		return patchOperationRank[a.Op] < patchOperationRank[b.Op]
+	}
+	parentA, indexA := splitPointer(a.Path)
+	parentB, indexB := splitPointer(b.Path)
+	remove := a.Op == "remove"
+	if parentA != parentB {
+		if remove {
+			return parentA > parentB
+		}
+		return parentA < parentB
+	}
+	if indexA != indexB {
+		if remove {
+			return indexA > indexB
+		}
+		return indexA < indexB
+	}
+	return a.Path < b.Path
+}
+
+// splitPointer splits a pointer into its parent pointer and its last token read as a
+// sequence index, which is -1 when the token is not a number
+func splitPointer(pointer string) (string, int) {
+	slash := strings.LastIndex(pointer, "/")
+	if slash < 0 {
+		return "", -1
+	}
+	index, err := strconv.Atoi(pointer[slash+1:])
+	if err != nil {
+		return pointer[:slash], -1
+	}
+	return pointer[:slash], index
+}
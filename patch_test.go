@@ -0,0 +1,264 @@
+package golang_yaml_advanced
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// applyTestPatch applies JSON Patch add, remove and replace operations to a decoded JSON value
+func applyTestPatch(t *testing.T, doc interface{}, patch []byte) interface{} {
+	t.Helper()
+	var ops []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		t.Fatalf("invalid patch %s: %v", patch, err)
+	}
+
+	for _, op := range ops {
+		var value interface{}
+		if op.Op != "remove" {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				t.Fatalf("operation %s %q has invalid value: %v", op.Op, op.Path, err)
+			}
+		}
+		if op.Path == "" {
+			doc = value
+			continue
+		}
+
+		tokens := strings.Split(op.Path[1:], "/")
+		for i, token := range tokens {
+			tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		}
+		parent := doc
+		for _, token := range tokens[:len(tokens)-1] {
+			switch container := parent.(type) {
+			case map[string]interface{}:
+				parent = container[token]
+			case []interface{}:
+				index, _ := strconv.Atoi(token)
+				parent = container[index]
+			}
+		}
+
+		last := tokens[len(tokens)-1]
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			if op.Op == "remove" {
+				delete(container, last)
+			} else {
+				container[last] = value
+			}
+		case []interface{}:
+			index, err := strconv.Atoi(last)
+			if err != nil || index > len(container) {
+				t.Fatalf("operation %s %q has an invalid index", op.Op, op.Path)
+			}
+			switch op.Op {
+			case "replace":
+				container[index] = value
+			case "remove":
+				container = append(container[:index], container[index+1:]...)
+			case "add":
+				container = append(container[:index], append([]interface{}{value}, container[index:]...)...)
+			}
+			doc = setTestPointer(doc, tokens[:len(tokens)-1], container)
+		default:
+			t.Fatalf("operation %s %q has no container", op.Op, op.Path)
+		}
+	}
+	return doc
+}
+
+// setTestPointer stores value at the location named by tokens and returns the updated document
+func setTestPointer(doc interface{}, tokens []string, value interface{}) interface{} {
+	if len(tokens) == 0 {
+		return value
+	}
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		container[tokens[0]] = setTestPointer(container[tokens[0]], tokens[1:], value)
+	case []interface{}:
+		index, _ := strconv.Atoi(tokens[0])
+		container[index] = setTestPointer(container[index], tokens[1:], value)
+	}
+	return doc
+}
+
+// TestComputePatch tests producing JSON Patches that turn one tree into another
+func TestComputePatch(t *testing.T) {
+	parse := func(input string) *NodeTree {
+		tree, err := UnmarshalYAML([]byte(input))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		return tree
+	}
+	normalize := func(value interface{}) string {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		var decoded interface{}
+		_ = json.Unmarshal(data, &decoded)
+		return fmt.Sprint(decoded)
+	}
+	content := func(tree *NodeTree) interface{} {
+		if root := documentContent(tree.Documents[0].Root); root != nil && root.Kind != DocumentNode {
+			return nodeToInterface(root)
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		oldYAML string
+		newYAML string
+		want    string
+	}{
+		{
+			name:    "Identical",
+			oldYAML: "a: 1\nb: [x, y]\n",
+			newYAML: "# comment\na: 1\nb: [x, y]\n",
+			want:    `[]`,
+		},
+		{
+			name:    "ReplaceScalar",
+			oldYAML: "app:\n  replicas: 1\n",
+			newYAML: "app:\n  replicas: 3\n",
+			want:    `[{"op":"replace","path":"/app/replicas","value":3}]`,
+		},
+		{
+			name:    "AddAndRemoveKeys",
+			oldYAML: "name: demo\nlegacy: true\n",
+			newYAML: "name: demo\nowner: team-a\n",
+			want:    `[{"op":"remove","path":"/legacy"},{"op":"add","path":"/owner","value":"team-a"}]`,
+		},
+		{
+			name:    "GrowSequence",
+			oldYAML: "ports: [80]\n",
+			newYAML: "ports: [80, 443, 8080]\n",
+			want:    `[{"op":"add","path":"/ports/1","value":443},{"op":"add","path":"/ports/2","value":8080}]`,
+		},
+		{
+			name:    "ShrinkSequence",
+			oldYAML: "ports: [80, 443, 8080]\n",
+			newYAML: "ports: [81]\n",
+			want:    `[{"op":"replace","path":"/ports/0","value":81},{"op":"remove","path":"/ports/2"},{"op":"remove","path":"/ports/1"}]`,
+		},
+		{
+			name:    "EscapedKeys",
+			oldYAML: "\"a/b\": 1\n\"c~d\": 2\n",
+			newYAML: "\"a/b\": 2\n\"c~d\": 2\n",
+			want:    `[{"op":"replace","path":"/a~1b","value":2}]`,
+		},
+		{
+			name:    "KindChange",
+			oldYAML: "db: none\n",
+			newYAML: "db:\n  host: localhost\n",
+			want:    `[{"op":"replace","path":"/db","value":{"host":"localhost"}}]`,
+		},
+		{
+			name:    "NullValue",
+			oldYAML: "a: 1\n",
+			newYAML: "a: 1\nb: null\n",
+			want:    `[{"op":"add","path":"/b","value":null}]`,
+		},
+		{
+			name:    "RootReplaced",
+			oldYAML: "a: 1\n",
+			newYAML: "- a\n- b\n",
+			want:    `[{"op":"replace","path":"","value":["a","b"]}]`,
+		},
+		{
+			name:    "EmptyToContent",
+			oldYAML: "",
+			newYAML: "a: 1\n",
+			want:    `[{"op":"replace","path":"","value":{"a":1}}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldTree, newTree := parse(tt.oldYAML), parse(tt.newYAML)
+			patch, err := ComputePatch(oldTree, newTree)
+			if err != nil {
+				t.Fatalf("ComputePatch() error = %v", err)
+			}
+			if string(patch) != tt.want {
+				t.Errorf("ComputePatch() = %s, want %s", patch, tt.want)
+			}
+
+			applied := applyTestPatch(t, content(oldTree), patch)
+			if got, want := normalize(applied), normalize(content(newTree)); got != want {
+				t.Errorf("applying the patch gave %s, want %s", got, want)
+			}
+		})
+	}
+
+	t.Run("NestedRoundTrip", func(t *testing.T) {
+		oldTree := parse(`app:
+  name: demo
+  ports: [80, 443]
+  servers:
+    - name: a
+      zone: eu
+    - name: b
+  legacy: true
+`)
+		newTree := parse(`app:
+  name: demo-v2
+  ports: [443]
+  servers:
+    - name: a
+      zone: us
+      weight: 2
+  owner: team-a
+`)
+		patch, err := ComputePatch(oldTree, newTree)
+		if err != nil {
+			t.Fatalf("ComputePatch() error = %v", err)
+		}
+		applied := applyTestPatch(t, content(oldTree), patch)
+		if got, want := normalize(applied), normalize(content(newTree)); got != want {
+			t.Errorf("applying %s gave %s, want %s", patch, got, want)
+		}
+	})
+
+	t.Run("Deterministic", func(t *testing.T) {
+		oldYAML := "a: 1\nb: 2\nc: 3\nd: [1, 2, 3]\ne: {x: 1, y: 2}\nf: [{k: 1}, {k: 2}, {k: 3}]\n"
+		newYAML := "a: 9\nc: 8\nd: [1]\ne: {z: 3}\nf: [{j: 1}]\ng: 7\nh: [1]\n"
+		want := `[{"op":"replace","path":"/a","value":9},{"op":"replace","path":"/c","value":8},` +
+			`{"op":"remove","path":"/f/0/k"},{"op":"remove","path":"/f/2"},{"op":"remove","path":"/f/1"},` +
+			`{"op":"remove","path":"/e/x"},{"op":"remove","path":"/e/y"},{"op":"remove","path":"/d/2"},` +
+			`{"op":"remove","path":"/d/1"},{"op":"remove","path":"/b"},` +
+			`{"op":"add","path":"/g","value":7},{"op":"add","path":"/h","value":[1]},` +
+			`{"op":"add","path":"/e/z","value":3},{"op":"add","path":"/f/0/j","value":1}]`
+		for i := 0; i < 20; i++ {
+			oldTree, newTree := parse(oldYAML), parse(newYAML)
+			patch, err := ComputePatch(oldTree, newTree)
+			if err != nil {
+				t.Fatalf("ComputePatch() error = %v", err)
+			}
+			if string(patch) != want {
+				t.Fatalf("ComputePatch() = %s, want %s", patch, want)
+			}
+			applied := applyTestPatch(t, content(oldTree), patch)
+			if got, want := normalize(applied), normalize(content(newTree)); got != want {
+				t.Fatalf("applying %s gave %s, want %s", patch, got, want)
+			}
+		}
+	})
+
+	t.Run("MultipleDocuments", func(t *testing.T) {
+		if _, err := ComputePatch(parse("a: 1\n---\nb: 2\n"), parse("a: 1\n")); err == nil {
+			t.Error("ComputePatch() should reject trees with several documents")
+		}
+	})
+}
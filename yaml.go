@@ -1,9 +1,14 @@
 package golang_yaml_advanced
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
+	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"gopkg.in/yaml.v3"
 )
@@ -74,32 +79,78 @@ func (s NodeStyle) String() string {
 	}
 }
 
+// nodeStyleFromYAML converts a yaml.v3 style bitmask into a NodeStyle.
+// yaml.v3 combines TaggedStyle with the presentation style for explicitly
+// tagged nodes, so the presentation bits are checked individually.
+func nodeStyleFromYAML(style yaml.Style) NodeStyle {
+	switch {
+	case style&yaml.FlowStyle != 0:
+		return FlowStyle
+	case style&yaml.LiteralStyle != 0:
+		return LiteralStyle
+	case style&yaml.FoldedStyle != 0:
+		return FoldedStyle
+	case style&yaml.SingleQuotedStyle != 0:
+		return QuotedStyle
+	case style&yaml.DoubleQuotedStyle != 0:
+		return DoubleQuotedStyle
+	case style&yaml.TaggedStyle != 0:
+		return TaggedStyle
+	default:
+		return DefaultStyle
+	}
+}
+
+// yamlStyle converts a NodeStyle into the yaml.v3 style used for encoding
+func (s NodeStyle) yamlStyle() yaml.Style {
+	switch s {
+	case LiteralStyle:
+		return yaml.LiteralStyle
+	case FoldedStyle:
+		return yaml.FoldedStyle
+	case QuotedStyle, SingleQuotedStyle:
+		return yaml.SingleQuotedStyle
+	case DoubleQuotedStyle:
+		return yaml.DoubleQuotedStyle
+	case FlowStyle:
+		return yaml.FlowStyle
+	case TaggedStyle:
+		return yaml.TaggedStyle
+	default:
+		return 0
+	}
+}
+
 type Node struct {
-	Kind            NodeKind
-	Style           NodeStyle
-	Tag             string
-	Value           interface{}
-	Anchor          string
-	Alias           *Node
-	Parent          *Node
-	Children        []*Node
-	Key             *Node
-	Line            int
-	Column          int
-	HeadComment     []string // We can have multiple lines, including empty line markers
-	LineComment     string
-	FootComment     []string // We can have multiple lines
-	EmptyLinesBefore int     // Number of empty lines before this node (will be encoded in HeadComment)
-	EmptyLinesAfter  int     // Number of empty lines after this node
-	EmptyLines      []int    // Deprecated: kept for backwards compatibility
-	Metadata        map[string]interface{}
+	Kind             NodeKind
+	Style            NodeStyle
+	BlockIndent      int // Explicit indentation indicator for literal blocks (|2), 0 for automatic
+	Tag              string
+	Value            interface{}
+	RawValue         string // Exact scalar text from the source, before type conversion
+	Anchor           string
+	Alias            *Node
+	Parent           *Node
+	Children         []*Node
+	Key              *Node
+	Line             int
+	Column           int
+	HeadComment      []string // We can have multiple lines, including empty line markers
+	LineComment      string
+	FootComment      []string // We can have multiple lines
+	EmptyLinesBefore int      // Number of empty lines before this node (will be encoded in HeadComment)
+	EmptyLinesAfter  int      // Number of empty lines after this node
+	EmptyLines       []int    // Deprecated: kept for backwards compatibility
+	Metadata         map[string]interface{}
 }
 
 type Document struct {
-	Root       *Node
-	Directives []Directive
-	Version    string
-	Anchors    map[string]*Node
+	Root        *Node
+	Directives  []Directive
+	Version     string
+	Anchors     map[string]*Node
+	ExplicitEnd bool // Document was closed by a "..." marker, which ToYAML re-emits
+	LineOffset  int  // Lines of the stream before the document source, so Node.Line+LineOffset is the stream line
 }
 
 type Directive struct {
@@ -112,12 +163,14 @@ type NodeTree struct {
 	Current         *Document
 	CurrentNode     *Node
 	EmptyLineConfig EmptyLineConfig // Configuration for empty line handling
+	EncodeOptions   EncodeOptions   // Configuration for node encoding
 }
 
 func NewNodeTree() *NodeTree {
 	return &NodeTree{
 		Documents:       make([]*Document, 0),
 		EmptyLineConfig: DefaultEmptyLineConfig(),
+		EncodeOptions:   DefaultEncodeOptions(),
 	}
 }
 
@@ -130,6 +183,65 @@ func (nt *NodeTree) AddDocument() *Document {
 	return doc
 }
 
+// Enter moves the cursor into the value of key in the current mapping, or into the
+// item at index key in the current sequence. The cursor starts at the content of the
+// Current document, or of the first document when none is current.
+func (nt *NodeTree) Enter(key string) error {
+	current := nt.Value()
+	if current == nil {
+		return fmt.Errorf("tree has no document to enter")
+	}
+
+	var next *Node
+	switch current.Kind {
+	case MappingNode:
+		next = current.GetMapValue(key)
+	case SequenceNode:
+		index, err := strconv.Atoi(key)
+		if err != nil {
+			return fmt.Errorf("cannot enter %q: %s is a sequence and needs an index", key, current.Path())
+		}
+		if index >= 0 && index < len(current.Children) {
+			next = current.Children[index]
+		}
+	default:
+		return fmt.Errorf("cannot enter %q: %s is a %s", key, current.Path(), current.Kind)
+	}
+	if next == nil {
+		return fmt.Errorf("key %q not found at %s", key, current.Path())
+	}
+
+	nt.CurrentNode = next
+	return nil
+}
+
+// Exit moves the cursor to the mapping or sequence containing the current node
+func (nt *NodeTree) Exit() error {
+	current := nt.Value()
+	if current == nil || current.Parent == nil || current.Parent.Kind == DocumentNode {
+		return fmt.Errorf("cursor is already at the document root")
+	}
+	nt.CurrentNode = current.Parent
+	return nil
+}
+
+// Value returns the node under the cursor, which is the content of the cursor's
+// document until Enter is called, or nil when the tree has no content
+func (nt *NodeTree) Value() *Node {
+	if nt.CurrentNode != nil {
+		return nt.CurrentNode
+	}
+
+	doc := nt.Current
+	if doc == nil && len(nt.Documents) > 0 {
+		doc = nt.Documents[0]
+	}
+	if doc == nil {
+		return nil
+	}
+	return documentContent(doc.Root)
+}
+
 func (d *Document) SetRoot(node *Node) {
 	d.Root = node
 	if node != nil {
@@ -160,6 +272,27 @@ func NewSequenceNode() *Node {
 	return NewNode(SequenceNode)
 }
 
+// NewAliasNode creates an alias referring to the given anchor.
+// The Alias target is left unset and is linked when the document's anchors are resolved.
+func NewAliasNode(anchor string) *Node {
+	node := NewNode(AliasNode)
+	node.Value = "*" + strings.TrimPrefix(anchor, "*")
+	return node
+}
+
+// SetAnchor marks the node with an anchor name so aliases can refer to it
+func (n *Node) SetAnchor(name string) {
+	n.Anchor = name
+}
+
+// aliasName returns the anchor name an alias node refers to, without the * prefix
+func (n *Node) aliasName() string {
+	if n.Value == nil {
+		return ""
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%v", n.Value), "*")
+}
+
 func (n *Node) AddChild(child *Node) {
 	if child != nil {
 		child.Parent = n
@@ -172,6 +305,9 @@ func (n *Node) AddKeyValue(key, value *Node) error {
 		return fmt.Errorf("can only add key-value pairs to mapping nodes")
 	}
 	if key != nil {
+		if value == nil {
+			return fmt.Errorf("cannot add nil value for key %v", key.Value)
+		}
 		key.Parent = n
 		value.Parent = n
 		value.Key = key
@@ -180,6 +316,21 @@ func (n *Node) AddKeyValue(key, value *Node) error {
 	return nil
 }
 
+// AddKeyValueStrict is like AddKeyValue but also rejects nil keys and non-scalar keys,
+// which would otherwise produce mappings that cannot be serialized or looked up by name
+func (n *Node) AddKeyValueStrict(key, value *Node) error {
+	if n.Kind != MappingNode {
+		return fmt.Errorf("can only add key-value pairs to mapping nodes")
+	}
+	if key == nil {
+		return fmt.Errorf("cannot add nil key to mapping")
+	}
+	if key.Kind != ScalarNode {
+		return fmt.Errorf("mapping keys must be scalar nodes, got %s", key.Kind)
+	}
+	return n.AddKeyValue(key, value)
+}
+
 func (n *Node) AddSequenceItem(item *Node) error {
 	if n.Kind != SequenceNode {
 		return fmt.Errorf("can only add items to sequence nodes")
@@ -201,6 +352,346 @@ func (n *Node) GetMapValue(key string) *Node {
 	return nil
 }
 
+// KeyName returns the name of the scalar key the node is stored under as a mapping
+// value, formatted the way GetMapValue matches keys, so KeyName of a value found with
+// GetMapValue(name) is name. Sequence items, document content and values under complex
+// keys return false.
+func (n *Node) KeyName() (string, bool) {
+	if n == nil || n.Key == nil || n.Key.Kind != ScalarNode {
+		return "", false
+	}
+	return fmt.Sprintf("%v", n.Key.Value), true
+}
+
+// GetMapValueByKeyNode returns the value stored under a key equal to key, which may be
+// a complex key such as a sequence or mapping. Keys match when they have the same kind
+// and the same content, ignoring comments and styles; scalar keys compare like
+// GetMapValue.
+func (n *Node) GetMapValueByKeyNode(key *Node) *Node {
+	if n == nil || n.Kind != MappingNode || key == nil {
+		return nil
+	}
+	if i := findMapKeyNode(n, key); i >= 0 {
+		return n.Children[i+1]
+	}
+	return nil
+}
+
+// findMapKeyNode returns the index of the key node matching key in a mapping, or -1
+func findMapKeyNode(mapping *Node, key *Node) int {
+	want := mapKeyString(key)
+	for i := 0; i < len(mapping.Children)-1; i += 2 {
+		keyNode := mapping.Children[i]
+		if keyNode.Kind == key.Kind && mapKeyString(keyNode) == want {
+			return i
+		}
+	}
+	return -1
+}
+
+// mapKeyString returns the text identifying a mapping key: the value of a scalar key
+// and the flow-style YAML of a complex key, such as [a, b] or {x: 1}
+func mapKeyString(key *Node) string {
+	if key.Kind == ScalarNode {
+		return fmt.Sprintf("%v", key.Value)
+	}
+	return flowText(key)
+}
+
+// flowText renders n as single-line flow-style YAML without comments
+func flowText(n *Node) string {
+	flow := n.Clone()
+	flow.StripComments()
+	yamlNode := flow.ToYAMLNode()
+	setFlowStyle(yamlNode)
+	data, err := yaml.Marshal(yamlNode)
+	if err != nil {
+		return fmt.Sprintf("<%s>", n.Kind)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// setFlowStyle switches a yaml.v3 node and its collections to flow style
+func setFlowStyle(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		node.Style = yaml.FlowStyle
+	}
+	for _, child := range node.Content {
+		setFlowStyle(child)
+	}
+}
+
+// KV is a single key/value pair of a mapping
+type KV struct {
+	Key   string
+	Value *Node
+}
+
+// AsOrderedMap returns the entries of a mapping in document order. Unlike the
+// map conversion used by queries it reports duplicate keys as an error.
+func (n *Node) AsOrderedMap() ([]KV, error) {
+	if n == nil || n.Kind != MappingNode {
+		return nil, fmt.Errorf("node is not a mapping")
+	}
+
+	entries := make([]KV, 0, len(n.Children)/2)
+	seen := make(map[string]*Node)
+	for i := 0; i < len(n.Children)-1; i += 2 {
+		keyNode := n.Children[i]
+		if keyNode.Kind != ScalarNode {
+			return nil, fmt.Errorf("non-scalar key at line %d", keyNode.Line)
+		}
+		key := fmt.Sprintf("%v", keyNode.Value)
+		if first, exists := seen[key]; exists {
+			return nil, fmt.Errorf("duplicate key %q at line %d, first defined at line %d", key, keyNode.Line, first.Line)
+		}
+		seen[key] = keyNode
+		entries = append(entries, KV{Key: key, Value: n.Children[i+1]})
+	}
+	return entries, nil
+}
+
+// OmapToMapping converts a sequence of single-pair mappings, as used by !!omap and
+// !!pairs, into a regular mapping with the same entries in the same order. The
+// original node is left unchanged.
+func (n *Node) OmapToMapping() (*Node, error) {
+	if n == nil || n.Kind != SequenceNode {
+		return nil, fmt.Errorf("node is not a sequence")
+	}
+
+	mapping := NewMappingNode()
+	mapping.Style = n.Style
+	mapping.HeadComment = append([]string(nil), n.HeadComment...)
+	mapping.LineComment = n.LineComment
+	mapping.FootComment = append([]string(nil), n.FootComment...)
+
+	seen := make(map[string]bool)
+	for i, item := range n.Children {
+		if item.Kind != MappingNode || len(item.Children) != 2 {
+			return nil, fmt.Errorf("item %d is not a single-pair mapping", i)
+		}
+		key := item.Children[0].Clone()
+		if key.Kind == ScalarNode {
+			name := fmt.Sprintf("%v", key.Value)
+			if seen[name] {
+				return nil, fmt.Errorf("duplicate key %q in item %d", name, i)
+			}
+			seen[name] = true
+		}
+		key.HeadComment = append(append([]string(nil), item.HeadComment...), key.HeadComment...)
+		if err := mapping.AddKeyValue(key, item.Children[1].Clone()); err != nil {
+			return nil, err
+		}
+	}
+	return mapping, nil
+}
+
+// MappingToOmap converts a mapping into an !!omap sequence holding one single-pair
+// mapping per entry, in document order. The original node is left unchanged.
+func (n *Node) MappingToOmap() (*Node, error) {
+	if n == nil || n.Kind != MappingNode {
+		return nil, fmt.Errorf("node is not a mapping")
+	}
+
+	omap := NewSequenceNode()
+	omap.Tag = "!!omap"
+	omap.HeadComment = append([]string(nil), n.HeadComment...)
+	omap.LineComment = n.LineComment
+	omap.FootComment = append([]string(nil), n.FootComment...)
+
+	for i := 0; i < len(n.Children)-1; i += 2 {
+		key := n.Children[i].Clone()
+		item := NewMappingNode()
+		item.HeadComment, key.HeadComment = key.HeadComment, nil
+		if err := item.AddKeyValue(key, n.Children[i+1].Clone()); err != nil {
+			return nil, err
+		}
+		omap.AddChild(item)
+	}
+	return omap, nil
+}
+
+// findMapEntry returns the index of the key node for key in a mapping, or -1
+func findMapEntry(mapping *Node, key string) int {
+	for i := 0; i < len(mapping.Children)-1; i += 2 {
+		keyNode := mapping.Children[i]
+		if keyNode.Kind == ScalarNode && fmt.Sprintf("%v", keyNode.Value) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// documentContent returns the content node of a document root, or the node itself
+func documentContent(node *Node) *Node {
+	if node != nil && node.Kind == DocumentNode && len(node.Children) > 0 {
+		return node.Children[0]
+	}
+	return node
+}
+
+// pathSegment is a mapping key or a sequence index of a path
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func (s pathSegment) String() string {
+	if s.isIndex {
+		return fmt.Sprintf("[%d]", s.index)
+	}
+	return s.key
+}
+
+// pathKey returns the path segment naming a mapping key: .key for plain keys, or the
+// key quoted in brackets as in ["key with spaces"] when it is empty or contains
+// whitespace, control characters, quotes, backslashes or one of . / [ ]
+func pathKey(key string) string {
+	if key != "" && !strings.ContainsAny(key, `./[]"'\`) && strings.IndexFunc(key, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}) < 0 {
+		return "." + key
+	}
+	return "[" + strconv.Quote(key) + "]"
+}
+
+// splitPath splits a path into key and index segments. A path starts at $, which may
+// be omitted, and continues with .key for plain keys, ["key"] or .["key"] for keys
+// quoted with Go string escapes, and [n] for sequence indexes, the form Path writes.
+func splitPath(path string) ([]pathSegment, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	var segments []pathSegment
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if strings.HasPrefix(rest, `["`) {
+				quoted, err := strconv.QuotedPrefix(rest[1:])
+				if err != nil || !strings.HasPrefix(rest[1+len(quoted):], "]") {
+					return nil, fmt.Errorf("invalid path %q: unterminated quoted key", path)
+				}
+				key, _ := strconv.Unquote(quoted)
+				segments = append(segments, pathSegment{key: key})
+				rest = rest[len(quoted)+2:]
+				continue
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: unterminated index", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: bad index %s", path, rest[:end+1])
+			}
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+			rest = rest[end+1:]
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			segments = append(segments, pathSegment{key: rest[:end]})
+			rest = rest[end:]
+		}
+	}
+	return segments, nil
+}
+
+// lookupPath follows path segments from node, returning nil if any segment is missing
+func lookupPath(node *Node, segments []pathSegment) *Node {
+	current := node
+	for _, segment := range segments {
+		if current == nil {
+			return nil
+		}
+		if segment.isIndex {
+			if current.Kind != SequenceNode || segment.index < 0 || segment.index >= len(current.Children) {
+				return nil
+			}
+			current = current.Children[segment.index]
+			continue
+		}
+		current = current.GetMapValue(segment.key)
+	}
+	return current
+}
+
+// GetPath returns the node at path below n, treating n as $. The path uses the
+// grammar Path writes, so the Path of a node resolves back to it from the root of its
+// tree. A missing node returns nil and a malformed path an error.
+func (n *Node) GetPath(path string) (*Node, error) {
+	segments, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return lookupPath(documentContent(n), segments), nil
+}
+
+// GetPath returns the node at path in the tree. A path starting with $[document:N],
+// as written by DiffTrees and MergeThreeWay, is resolved in document N and any other
+// path in the first document. A missing node returns nil and a malformed path an error.
+func (nt *NodeTree) GetPath(path string) (*Node, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	index := 0
+	if strings.HasPrefix(rest, "[document:") {
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid path %q: unterminated document index", path)
+		}
+		n, err := strconv.Atoi(rest[len("[document:"):end])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid path %q: bad document index %s", path, rest[:end+1])
+		}
+		index, rest = n, rest[end+1:]
+	}
+	segments, err := splitPath(rest)
+	if err != nil {
+		return nil, err
+	}
+	return lookupPath(documentContent(documentRoot(documentAt(nt, index))), segments), nil
+}
+
+// Resolve follows a relative path from n and returns the node it names, or nil.
+// Segments are separated by slashes: "." is the current node, ".." its parent
+// collection, a [n] or plain number segment indexes a sequence and any other
+// segment is a mapping key, so "../port" is the sibling value under the key port.
+// Going above the document content with ".." returns nil.
+func (n *Node) Resolve(relative string) *Node {
+	current := n
+	for _, segment := range strings.Split(relative, "/") {
+		if current == nil {
+			return nil
+		}
+		if current.Kind == AliasNode && current.Alias != nil {
+			current = current.Alias
+		}
+
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			if current.Parent == nil || current.Parent.Kind == DocumentNode {
+				return nil
+			}
+			current = current.Parent
+			continue
+		}
+
+		if current.Kind == SequenceNode {
+			index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(segment, "["), "]"))
+			if err != nil || index < 0 || index >= len(current.Children) {
+				return nil
+			}
+			current = current.Children[index]
+			continue
+		}
+		current = current.GetMapValue(segment)
+	}
+	return current
+}
+
 func (n *Node) GetSequenceItems() []*Node {
 	if n.Kind != SequenceNode {
 		return nil
@@ -224,6 +715,72 @@ func (n *Node) walk(visitor func(*Node) bool) bool {
 	return true
 }
 
+// TreeVisitor receives the nodes of a traversal run by Node.Accept. Returning false
+// stops the traversal for that visitor.
+type TreeVisitor interface {
+	Visit(node *Node) bool
+}
+
+// Accept walks the node depth-first once, in the order of Walk, and passes every node
+// to each visitor that has not stopped. The walk ends early when all visitors stop.
+func (n *Node) Accept(visitors ...TreeVisitor) {
+	if n == nil {
+		return
+	}
+	active := append([]TreeVisitor(nil), visitors...)
+	n.accept(&active)
+}
+
+func (n *Node) accept(active *[]TreeVisitor) bool {
+	remaining := (*active)[:0]
+	for _, visitor := range *active {
+		if visitor.Visit(n) {
+			remaining = append(remaining, visitor)
+		}
+	}
+	*active = remaining
+	if len(remaining) == 0 {
+		return false
+	}
+
+	for _, child := range n.Children {
+		if child != nil && !child.accept(active) {
+			return false
+		}
+	}
+	return true
+}
+
+// WalkDetailed walks the node depth-first like Walk and also passes each node's parent,
+// its key node when it is a mapping value and its index when it is a sequence item
+// (otherwise -1). The starting node is visited with a nil parent and key.
+// Returning false from fn stops the walk.
+func (n *Node) WalkDetailed(fn func(node, parent, key *Node, index int) bool) {
+	n.walkDetailed(nil, nil, -1, fn)
+}
+
+func (n *Node) walkDetailed(parent, key *Node, index int, fn func(node, parent, key *Node, index int) bool) bool {
+	if !fn(n, parent, key, index) {
+		return false
+	}
+	for i, child := range n.Children {
+		var childKey *Node
+		childIndex := -1
+		switch n.Kind {
+		case MappingNode:
+			if i%2 == 1 {
+				childKey = n.Children[i-1]
+			}
+		case SequenceNode:
+			childIndex = i
+		}
+		if !child.walkDetailed(n, childKey, childIndex, fn) {
+			return false
+		}
+	}
+	return true
+}
+
 func (n *Node) Find(predicate func(*Node) bool) *Node {
 	var result *Node
 	n.Walk(func(node *Node) bool {
@@ -247,6 +804,50 @@ func (n *Node) FindAll(predicate func(*Node) bool) []*Node {
 	return results
 }
 
+// FindAllPaths returns the path of every node matching predicate, in walk order.
+// Paths are relative to n and use the same $.a.b[0] form as Path. A matching
+// mapping key yields the path of its entry, the same path as its value.
+func (n *Node) FindAllPaths(predicate func(*Node) bool) []string {
+	var results []string
+	paths := make(map[*Node]string)
+	n.WalkDetailed(func(node, parent, key *Node, index int) bool {
+		path := "$"
+		if parent != nil {
+			path = paths[parent]
+			if key == nil && parent.Kind == MappingNode {
+				key = node
+			}
+			switch {
+			case key != nil && key.Kind == ScalarNode:
+				path += pathKey(fmt.Sprintf("%v", key.Value))
+			case index >= 0:
+				path = fmt.Sprintf("%s[%d]", path, index)
+			}
+		}
+		if len(node.Children) > 0 {
+			paths[node] = path
+		}
+		if predicate(node) {
+			results = append(results, path)
+		}
+		return true
+	})
+	return results
+}
+
+// StripComments removes head, line and foot comments from the node and all its descendants
+func (n *Node) StripComments() {
+	n.Walk(func(node *Node) bool {
+		node.HeadComment = nil
+		node.LineComment = ""
+		node.FootComment = nil
+		return true
+	})
+}
+
+// Path returns the location of the node from the root of its tree, as in $.app.ports[0].
+// Keys that are empty or contain whitespace or path characters are quoted, as in
+// $["key with spaces"], so GetPath on the root resolves the path back to the node.
 func (n *Node) Path() string {
 	if n.Parent == nil {
 		return "$"
@@ -255,8 +856,8 @@ func (n *Node) Path() string {
 
 	switch n.Parent.Kind {
 	case MappingNode:
-		if n.Key != nil && n.Key.Kind == ScalarNode {
-			return fmt.Sprintf("%s.%v", path, n.Key.Value)
+		if name, ok := n.KeyName(); ok {
+			return path + pathKey(name)
 		}
 	case SequenceNode:
 		for i, child := range n.Parent.Children {
@@ -268,6 +869,41 @@ func (n *Node) Path() string {
 	return path
 }
 
+// CommonAncestorPath returns the deepest path shared by a and b, comparing their
+// Path values token by token, so two siblings share their parent's path and nodes
+// in unrelated subtrees share only the root $. A nil node yields "".
+func CommonAncestorPath(a, b *Node) string {
+	if a == nil || b == nil {
+		return ""
+	}
+
+	aTokens, bTokens := pathTokens(a.Path()), pathTokens(b.Path())
+	common := 0
+	for common < len(aTokens) && common < len(bTokens) && aTokens[common] == bTokens[common] {
+		common++
+	}
+	return strings.Join(aTokens[:common], "")
+}
+
+// pathTokens splits a $.a[0].b path before every key and index, keeping the separators.
+// Quoted keys such as ["a.b"] form a single token.
+func pathTokens(path string) []string {
+	var tokens []string
+	start := 0
+	for i := 1; i < len(path); i++ {
+		if path[i] == '.' || path[i] == '[' {
+			tokens = append(tokens, path[start:i])
+			start = i
+		}
+		if strings.HasPrefix(path[i:], `["`) {
+			if quoted, err := strconv.QuotedPrefix(path[i+1:]); err == nil {
+				i += len(quoted)
+			}
+		}
+	}
+	return append(tokens, path[start:])
+}
+
 func (n *Node) Clone() *Node {
 	return n.cloneWithSeen(make(map[*Node]*Node))
 }
@@ -285,8 +921,10 @@ func (n *Node) cloneWithSeen(seen map[*Node]*Node) *Node {
 	clone := &Node{
 		Kind:             n.Kind,
 		Style:            n.Style,
+		BlockIndent:      n.BlockIndent,
 		Tag:              n.Tag,
 		Value:            n.Value,
+		RawValue:         n.RawValue,
 		Anchor:           n.Anchor,
 		Line:             n.Line,
 		Column:           n.Column,
@@ -355,6 +993,7 @@ func (n *Node) convertToYAMLNode() *yaml.Node {
 	yamlNode.Tag = n.Tag
 	yamlNode.Value = fmt.Sprintf("%v", n.Value)
 	yamlNode.Anchor = n.Anchor
+	yamlNode.Style = n.Style.yamlStyle()
 
 	// Convert children
 	for _, child := range n.Children {
@@ -369,9 +1008,10 @@ func (n *Node) convertToYAMLNode() *yaml.Node {
 	if len(n.HeadComment) > 0 {
 		yamlNode.HeadComment = strings.Join(n.HeadComment, "\n")
 	}
-	yamlNode.LineComment = n.LineComment
-	if len(n.FootComment) > 0 {
-		yamlNode.FootComment = strings.Join(n.FootComment, "\n")
+	lineComment, continuation := splitLineComment(n.LineComment)
+	yamlNode.LineComment = lineComment
+	if footComment := append(continuation, n.FootComment...); len(footComment) > 0 {
+		yamlNode.FootComment = strings.Join(footComment, "\n")
 	}
 
 	// Handle alias
@@ -382,6 +1022,31 @@ func (n *Node) convertToYAMLNode() *yaml.Node {
 	return yamlNode
 }
 
+// splitLineComment splits a line comment spanning several lines into its first line
+// and the remaining lines, which cannot follow the node on its line and are written as
+// foot comment lines instead. Blank lines are dropped and lines without a # get one.
+func splitLineComment(comment string) (string, []string) {
+	if !strings.ContainsAny(comment, "\r\n") {
+		return comment, nil
+	}
+
+	var lines []string
+	for _, line := range strings.FieldsFunc(comment, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			line = "# " + line
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return lines[0], lines[1:]
+}
+
 func (n *Node) stringify(indent int) string {
 	indentStr := strings.Repeat("  ", indent)
 
@@ -413,46 +1078,501 @@ func (n *Node) stringify(indent int) string {
 		return ""
 	case AliasNode:
 		if n.Alias != nil {
-			return fmt.Sprintf("*%s", n.Value)
+			return fmt.Sprintf("*%s", n.aliasName())
 		}
 	}
 	return ""
 }
 
+// SetMeta stores a metadata value on the node. Metadata is copied by Clone and
+// combined by MergeNodes, where the overlay wins for keys set on both nodes.
+func (n *Node) SetMeta(key string, value interface{}) {
+	if n.Metadata == nil {
+		n.Metadata = make(map[string]interface{})
+	}
+	n.Metadata[key] = value
+}
+
+// GetMeta returns the metadata value stored under key and whether it is set
+func (n *Node) GetMeta(key string) (interface{}, bool) {
+	if n == nil {
+		return nil, false
+	}
+	value, ok := n.Metadata[key]
+	return value, ok
+}
+
 func (n *Node) IsNull() bool {
 	return n == nil || n.Kind == NullNode || (n.Kind == ScalarNode && n.Value == nil)
 }
 
-func (n *Node) Remove() error {
-	if n.Parent == nil {
-		return fmt.Errorf("cannot remove root node")
+// IsEmpty reports whether the node holds no data: nil and null nodes, mappings and
+// sequences without entries, scalars whose string value is empty or only whitespace,
+// and documents without content or with empty content. An alias reports the node it
+// refers to. Zero numbers and false are not empty.
+func (n *Node) IsEmpty() bool {
+	if n.IsNull() {
+		return true
+	}
+
+	switch n.Kind {
+	case MappingNode, SequenceNode:
+		return len(n.Children) == 0
+	case ScalarNode:
+		str, ok := n.Value.(string)
+		return ok && strings.TrimSpace(str) == ""
+	case DocumentNode:
+		return len(n.Children) == 0 || n.Children[0].IsEmpty()
+	case AliasNode:
+		return n.Alias != nil && n.Alias != n && n.Alias.IsEmpty()
+	}
+	return false
+}
+
+// ValueTypeHistogram counts the scalar values under the node by the type the schema
+// validator sees them as: string, integer, number, boolean or null. Mapping keys are
+// not values and are not counted, and aliases are counted once at their anchor.
+func (n *Node) ValueTypeHistogram() map[string]int {
+	histogram := make(map[string]int)
+	if n == nil {
+		return histogram
+	}
+
+	n.WalkDetailed(func(node, parent, key *Node, index int) bool {
+		if parent != nil && parent.Kind == MappingNode && key == nil {
+			return true
+		}
+		switch node.Kind {
+		case ScalarNode:
+			histogram[getNodeType(node)]++
+		case NullNode:
+			histogram["null"]++
+		}
+		return true
+	})
+	return histogram
+}
+
+// ResolvedTag returns the node's explicit Tag, or the tag YAML would resolve for it
+// when none is set: !!map, !!seq and !!null for collections and nulls, and for scalars
+// the tag matching the Go type of Value. Plain strings are resolved like the YAML 1.2
+// core schema would read them back, so "42" is !!int and quoted strings are !!str.
+// Aliases report the tag of their anchor, documents an empty string.
+func (n *Node) ResolvedTag() string {
+	if n == nil {
+		return ""
+	}
+	if n.Tag != "" {
+		return n.Tag
+	}
+
+	switch n.Kind {
+	case MappingNode:
+		return "!!map"
+	case SequenceNode:
+		return "!!seq"
+	case NullNode:
+		return "!!null"
+	case AliasNode:
+		if n.Alias != nil {
+			return n.Alias.ResolvedTag()
+		}
+		return ""
+	case ScalarNode:
+		return n.implicitScalarTag()
+	default:
+		return ""
+	}
+}
+
+// implicitScalarTag resolves the tag of an untagged scalar from its value and style
+func (n *Node) implicitScalarTag() string {
+	switch value := n.Value.(type) {
+	case nil:
+		return "!!null"
+	case bool:
+		return "!!bool"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "!!int"
+	case float32, float64:
+		return "!!float"
+	case string:
+		if n.Style != DefaultStyle && n.Style != FlowStyle {
+			return "!!str"
+		}
+		return (&yaml.Node{Kind: yaml.ScalarNode, Value: value}).ShortTag()
+	default:
+		return (&yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprintf("%v", value)}).ShortTag()
+	}
+}
+
+// scalarValue returns the value of a scalar node, following aliases
+func (n *Node) scalarValue() (interface{}, bool) {
+	if n != nil && n.Kind == AliasNode && n.Alias != nil {
+		return n.Alias.scalarValue()
+	}
+	if n == nil || n.Kind != ScalarNode {
+		return nil, false
+	}
+	return n.Value, true
+}
+
+// AsString returns the value of a string scalar
+func (n *Node) AsString() (string, bool) {
+	value, ok := n.scalarValue()
+	if !ok {
+		return "", false
+	}
+	s, ok := value.(string)
+	return s, ok
+}
+
+// AsInt returns the value of an integer scalar
+func (n *Node) AsInt() (int64, bool) {
+	value, ok := n.scalarValue()
+	if !ok {
+		return 0, false
+	}
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// AsFloat returns the value of a float scalar, converting integer values
+func (n *Node) AsFloat() (float64, bool) {
+	value, ok := n.scalarValue()
+	if !ok {
+		return 0, false
+	}
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	default:
+		if i, ok := n.AsInt(); ok {
+			return float64(i), true
+		}
+		return 0, false
+	}
+}
+
+// AsBool returns the value of a boolean scalar
+func (n *Node) AsBool() (bool, bool) {
+	value, ok := n.scalarValue()
+	if !ok {
+		return false, false
+	}
+	b, ok := value.(bool)
+	return b, ok
+}
+
+// SequenceContains reports whether n is a sequence with a scalar item equal to value.
+// The comparison is type-aware and items are typed by their tag: "1" and a quoted
+// item "1" do not match 1, and "true" does not match true, while numbers match by
+// value regardless of their Go type, so 1, int64(1) and 1.0 are equal. A nil value
+// matches null items, and aliases are compared by their target. Values other than
+// strings, booleans, numbers and nil never match.
+func (n *Node) SequenceContains(value interface{}) bool {
+	if n == nil || n.Kind != SequenceNode {
+		return false
+	}
+	for _, item := range n.Children {
+		if item != nil && item.Kind == AliasNode && item.Alias != nil {
+			item = item.Alias
+		}
+		// The tag decides the type, so a quoted "1" is a string
+		if item != nil && item.Kind == ScalarNode && scalarValuesEqual(taggedScalarValue(item), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// scalarValuesEqual compares two scalar values, treating all numeric types as numbers
+func scalarValuesEqual(a, b interface{}) bool {
+	aNum, aIsNum := numericValue(a)
+	bNum, bIsNum := numericValue(b)
+	if aIsNum || bIsNum {
+		return aIsNum && bIsNum && aNum == bNum
+	}
+	switch bv := b.(type) {
+	case nil:
+		return a == nil
+	case string:
+		av, ok := a.(string)
+		return ok && av == bv
+	case bool:
+		av, ok := a.(bool)
+		return ok && av == bv
+	default:
+		return false
+	}
+}
+
+// numericValue converts Go integer and float values to float64
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+func (n *Node) Remove() error {
+	if n.Parent == nil {
+		return fmt.Errorf("cannot remove root node")
+	}
+
+	for i, child := range n.Parent.Children {
+		if child == n {
+			n.Parent.Children = append(n.Parent.Children[:i], n.Parent.Children[i+1:]...)
+			n.Parent = nil
+			return nil
+		}
+	}
+	return fmt.Errorf("node not found in parent's children")
+}
+
+func (n *Node) ReplaceWith(replacement *Node) error {
+	if n.Parent == nil {
+		return fmt.Errorf("cannot replace root node")
+	}
+
+	for i, child := range n.Parent.Children {
+		if child == n {
+			n.Parent.Children[i] = replacement
+			replacement.Parent = n.Parent
+			replacement.Key = n.Key
+			n.Parent = nil
+			return nil
+		}
+	}
+	return fmt.Errorf("node not found in parent's children")
+}
+
+// StripComments removes every comment from the tree and drops comment-only documents
+func (nt *NodeTree) StripComments() {
+	kept := nt.Documents[:0]
+	for _, doc := range nt.Documents {
+		if doc.Root != nil {
+			if doc.Root.Kind == DocumentNode && len(doc.Root.Children) == 0 && len(doc.Root.HeadComment) > 0 {
+				continue
+			}
+			doc.Root.StripComments()
+		}
+		kept = append(kept, doc)
+	}
+	for i := len(kept); i < len(nt.Documents); i++ {
+		nt.Documents[i] = nil
+	}
+	nt.Documents = kept
+
+	if len(nt.Documents) == 0 {
+		nt.Current = nil
+	} else {
+		nt.Current = nt.Documents[len(nt.Documents)-1]
+	}
+}
+
+// ExtractDocComments returns the documentation comments of mapping keys by value path,
+// such as $.image.tag, for generating values tables from Helm charts. A key is included
+// when a line of its head comment starts with prefix, for example "# --". The text after
+// the prefix and any comment lines following it are joined with spaces; lines before it
+// are ignored. When several documents define the same path the first one wins.
+func (nt *NodeTree) ExtractDocComments(prefix string) map[string]string {
+	comments := make(map[string]string)
+	for _, doc := range nt.Documents {
+		if doc.Root == nil {
+			continue
+		}
+		doc.Root.Walk(func(n *Node) bool {
+			if n.Kind != MappingNode {
+				return true
+			}
+			for i := 0; i < len(n.Children)-1; i += 2 {
+				text, ok := docComment(n.Children[i].HeadComment, prefix)
+				if !ok {
+					continue
+				}
+				path := n.Children[i+1].Path()
+				if _, exists := comments[path]; !exists {
+					comments[path] = text
+				}
+			}
+			return true
+		})
+	}
+	return comments
+}
+
+// docComment returns the text of the comment block starting at the first line with
+// prefix, and whether such a line exists
+func docComment(lines []string, prefix string) (string, bool) {
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+
+		parts := []string{strings.TrimSpace(strings.TrimPrefix(line, prefix))}
+		for _, next := range lines[i+1:] {
+			next = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(next), "#"))
+			if next != "" {
+				parts = append(parts, next)
+			}
+		}
+		return strings.TrimSpace(strings.Join(parts, " ")), true
+	}
+	return "", false
+}
+
+// Validate checks the structural invariants ToYAML and re-parsing rely on and returns
+// a descriptive error for the first violation: nil or unknown nodes, document nodes
+// below a document root, scalars, nulls or aliases with children, mappings with an odd
+// number of children, mapping keys that are not a scalar, alias or collection, a node
+// that contains itself, and aliases that do not refer to an anchor defined earlier in
+// the same document. Complex keys such as sequences and mappings are valid YAML and
+// are accepted.
+func (nt *NodeTree) Validate() error {
+	for i, doc := range nt.Documents {
+		if doc == nil {
+			return fmt.Errorf("document %d is nil", i)
+		}
+		if doc.Root == nil {
+			continue
+		}
+		anchors := make(map[string]bool)
+		if err := validateNode(doc.Root, "$", true, anchors, make(map[*Node]bool)); err != nil {
+			return fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateNode checks node at path and its descendants, recording anchors in document
+// order and the nodes currently being visited in active
+func validateNode(node *Node, path string, isRoot bool, anchors map[string]bool, active map[*Node]bool) error {
+	if node == nil {
+		return fmt.Errorf("nil node at %s", path)
+	}
+	if active[node] {
+		return fmt.Errorf("cycle at %s: the node contains itself", path)
+	}
+
+	switch node.Kind {
+	case DocumentNode:
+		if !isRoot {
+			return fmt.Errorf("document node at %s below the document root", path)
+		}
+	case MappingNode:
+		if len(node.Children)%2 != 0 {
+			return fmt.Errorf("mapping at %s has an odd number of children (%d)", path, len(node.Children))
+		}
+		for i := 0; i < len(node.Children); i += 2 {
+			// Complex keys are valid YAML, but a key must still be a value
+			switch key := node.Children[i]; {
+			case key == nil:
+				return fmt.Errorf("nil mapping key at %s", path)
+			case key.Kind != ScalarNode && key.Kind != NullNode && key.Kind != AliasNode &&
+				key.Kind != MappingNode && key.Kind != SequenceNode:
+				return fmt.Errorf("mapping key at %s is a %s, not a scalar or a collection", path, key.Kind)
+			}
+		}
+	case SequenceNode:
+	case ScalarNode, NullNode, AliasNode:
+		if len(node.Children) > 0 {
+			return fmt.Errorf("%s at %s has %d children", node.Kind, path, len(node.Children))
+		}
+	default:
+		return fmt.Errorf("unknown node kind %s at %s", node.Kind, path)
+	}
+
+	if node.Anchor != "" {
+		anchors[node.Anchor] = true
+	}
+	if node.Kind == AliasNode {
+		if name := node.aliasName(); !anchors[name] {
+			return fmt.Errorf("alias *%s at %s does not refer to an earlier anchor", name, path)
+		}
 	}
 
-	for i, child := range n.Parent.Children {
-		if child == n {
-			n.Parent.Children = append(n.Parent.Children[:i], n.Parent.Children[i+1:]...)
-			n.Parent = nil
-			return nil
+	active[node] = true
+	defer delete(active, node)
+	for i, child := range node.Children {
+		if err := validateNode(child, transformChildPath(node, i, path), false, anchors, active); err != nil {
+			return err
 		}
 	}
-	return fmt.Errorf("node not found in parent's children")
+	return nil
 }
 
-func (n *Node) ReplaceWith(replacement *Node) error {
-	if n.Parent == nil {
-		return fmt.Errorf("cannot replace root node")
+// Clone returns a deep copy of the tree. Each cloned document gets its own Anchors
+// map and alias links pointing at the cloned nodes, so the copy can be modified
+// without affecting the original.
+func (nt *NodeTree) Clone() *NodeTree {
+	if nt == nil {
+		return nil
 	}
 
-	for i, child := range n.Parent.Children {
-		if child == n {
-			n.Parent.Children[i] = replacement
-			replacement.Parent = n.Parent
-			replacement.Key = n.Key
-			n.Parent = nil
-			return nil
+	clone := &NodeTree{
+		Documents:       make([]*Document, 0, len(nt.Documents)),
+		EmptyLineConfig: nt.EmptyLineConfig,
+		EncodeOptions:   nt.EncodeOptions,
+	}
+
+	seen := make(map[*Node]*Node)
+	for _, doc := range nt.Documents {
+		if doc == nil {
+			clone.Documents = append(clone.Documents, nil)
+			continue
+		}
+		docClone := &Document{
+			Root:        doc.Root.cloneWithSeen(seen),
+			Directives:  append([]Directive(nil), doc.Directives...),
+			Version:     doc.Version,
+			ExplicitEnd: doc.ExplicitEnd,
+			LineOffset:  doc.LineOffset,
+		}
+		docClone.ReindexAnchors()
+		clone.Documents = append(clone.Documents, docClone)
+		if doc == nt.Current {
+			clone.Current = docClone
 		}
 	}
-	return fmt.Errorf("node not found in parent's children")
+	clone.CurrentNode = seen[nt.CurrentNode]
+
+	return clone
 }
 
 func (nt *NodeTree) Merge(other *NodeTree) {
@@ -463,16 +1583,89 @@ func (nt *NodeTree) Merge(other *NodeTree) {
 
 // MergeNodes merges two nodes, preserving comments from both
 func MergeNodes(base, overlay *Node) *Node {
+	return MergeNodesWithOptions(base, overlay, DefaultMergeOptions())
+}
+
+// MergeNodesWithOptions merges two nodes like MergeNodes using the given merge options
+func MergeNodesWithOptions(base, overlay *Node, opts MergeOptions) *Node {
+	base = opts.stampProvenance(base, opts.BaseLabel)
+	overlay = opts.stampProvenance(overlay, opts.OverlayLabel)
+	return mergeNodes(base, overlay, "$", opts)
+}
+
+// MergeResolver decides a merge conflict at path, returning the node to keep.
+// Returning base keeps the base value, returning overlay takes the overlay value,
+// any other node is used as the merged value and nil keeps the base value.
+type MergeResolver func(path string, base, overlay *Node) *Node
+
+// MergeNodesWithResolver merges two nodes like MergeNodes but calls resolve for every
+// conflicting leaf, i.e. a key present in both nodes whose values are not both mappings.
+// A nil resolver falls back to the default overlay-wins behavior.
+func MergeNodesWithResolver(base, overlay *Node, resolve func(path string, base, overlay *Node) *Node) *Node {
+	opts := DefaultMergeOptions()
+	opts.Resolver = resolve
+	return mergeNodes(base, overlay, "$", opts)
+}
+
+func mergeNodes(base, overlay *Node, path string, opts MergeOptions) *Node {
 	if base == nil {
 		if overlay == nil {
 			return nil
 		}
+		opts.record(MergeActionAdd, path, nil, overlay)
 		return overlay.Clone()
 	}
 	if overlay == nil {
 		return base.Clone()
 	}
 
+	result := mergeNodeValues(base, overlay, path, opts)
+	mergeMetadata(result, base, overlay, opts.ProvenanceKey)
+	return result
+}
+
+// addedKeyEmptyLines returns the number of empty lines to write before a key the
+// overlay adds to a mapping. The key keeps the spacing it had in the overlay, which is
+// recorded on the value when both share a line, and BlankLineBeforeAdded separates it
+// from a preceding entry.
+func addedKeyEmptyLines(key, value *Node, hasPreceding bool, opts MergeOptions) int {
+	count := key.EmptyLinesBefore
+	if value != nil && value.Line == key.Line && value.EmptyLinesBefore > count {
+		count = value.EmptyLinesBefore
+	}
+	if opts.BlankLineBeforeAdded && hasPreceding && count == 0 {
+		count = 1
+	}
+	return count
+}
+
+// mergeMetadata sets the metadata of dst to the union of the metadata of base and
+// overlay, where overlay wins for keys present in both. The provenance key keeps the
+// value dst already has, since it describes where dst itself came from.
+func mergeMetadata(dst, base, overlay *Node, provenanceKey string) {
+	if dst == nil {
+		return
+	}
+	provenance, tracked := dst.GetMeta(provenanceKey)
+	metadata := make(map[string]interface{}, len(base.Metadata)+len(overlay.Metadata))
+	for k, v := range base.Metadata {
+		metadata[k] = v
+	}
+	for k, v := range overlay.Metadata {
+		metadata[k] = v
+	}
+	dst.Metadata = metadata
+	if provenanceKey != "" && tracked {
+		dst.Metadata[provenanceKey] = provenance
+	}
+}
+
+// mergeNodeValues merges two non-nil nodes
+func mergeNodeValues(base, overlay *Node, path string, opts MergeOptions) *Node {
+	if opts.coercesToSequence(base, overlay) {
+		return coerceScalarToSequence(base, overlay)
+	}
+
 	// Clone the base to avoid modifying the original
 	result := base.Clone()
 
@@ -488,6 +1681,9 @@ func MergeNodes(base, overlay *Node) *Node {
 			}
 		}
 
+		// Base entries removed by DeleteOnNull, dropped once all keys are processed
+		removed := make(map[int]bool)
+
 		// Process overlay keys
 		for i := 0; i < len(overlay.Children)-1; i += 2 {
 			overlayKey := overlay.Children[i]
@@ -495,53 +1691,139 @@ func MergeNodes(base, overlay *Node) *Node {
 
 			if overlayKey.Kind == ScalarNode {
 				keyStr := fmt.Sprintf("%v", overlayKey.Value)
+				childPath := path + pathKey(keyStr)
+
+				if opts.DeleteOnNull && overlayValue.IsNull() {
+					if baseIdx, exists := baseKeys[keyStr]; exists {
+						removed[baseIdx] = true
+					}
+					continue
+				}
 
 				if baseIdx, exists := baseKeys[keyStr]; exists {
 					// Key exists in base - merge or replace the value
 					baseValue := result.Children[baseIdx+1]
+					mergeMetadata(result.Children[baseIdx], base.Children[baseIdx], overlayKey, opts.ProvenanceKey)
 
 					// If both values are mappings, merge them recursively
-					if baseValue.Kind == MappingNode && overlayValue.Kind == MappingNode {
-						merged := MergeNodes(baseValue, overlayValue)
+					if (baseValue.Kind == MappingNode && overlayValue.Kind == MappingNode) ||
+						(baseValue.Kind == SequenceNode && overlayValue.Kind == SequenceNode && opts.mergesNestedSequences()) ||
+						opts.coercesToSequence(baseValue, overlayValue) {
+						merged := mergeNodes(baseValue, overlayValue, childPath, opts)
+						if opts.CommentMode != CommentMergeDefault {
+							mergeComments(result.Children[baseIdx], base.Children[baseIdx], overlayKey, opts.CommentMode)
+							mergeComments(merged, base.Children[baseIdx+1], overlayValue, opts.CommentMode)
+						}
 						result.Children[baseIdx+1] = merged
 					} else {
-						// Replace with overlay value, but preserve overlay's comments
-						clonedValue := overlayValue.Clone()
-						clonedValue.Key = result.Children[baseIdx].Clone()
-
-						// Preserve the overlay key's comments on the existing key
-						if len(overlayKey.HeadComment) > 0 {
-							result.Children[baseIdx].HeadComment = overlayKey.HeadComment
+						chosen := opts.choose(childPath, base.Children[baseIdx+1], overlayValue)
+						if chosen == nil || chosen == base.Children[baseIdx+1] {
+							// Resolver kept the base value
+							opts.record(MergeActionKeep, childPath, baseValue, baseValue)
+							mergeMetadata(baseValue, base.Children[baseIdx+1], overlayValue, opts.ProvenanceKey)
+							continue
 						}
-						if overlayKey.LineComment != "" {
-							result.Children[baseIdx].LineComment = overlayKey.LineComment
+						opts.record(MergeActionOverride, childPath, baseValue, chosen)
+
+						// Replace with chosen value, but preserve overlay's comments
+						clonedValue := chosen.Clone()
+						clonedValue.Key = result.Children[baseIdx].Clone()
+						mergeMetadata(clonedValue, base.Children[baseIdx+1], overlayValue, opts.ProvenanceKey)
+
+						if opts.CommentMode != CommentMergeDefault {
+							mergeComments(result.Children[baseIdx], base.Children[baseIdx], overlayKey, opts.CommentMode)
+							mergeComments(clonedValue, base.Children[baseIdx+1], chosen, opts.CommentMode)
+						} else {
+							// Preserve the overlay key's comments on the existing key
+							if len(overlayKey.HeadComment) > 0 {
+								result.Children[baseIdx].HeadComment = overlayKey.HeadComment
+							}
+							if overlayKey.LineComment != "" {
+								result.Children[baseIdx].LineComment = overlayKey.LineComment
+							}
+							if len(overlayKey.FootComment) > 0 {
+								result.Children[baseIdx].FootComment = overlayKey.FootComment
+							}
 						}
-						if len(overlayKey.FootComment) > 0 {
-							result.Children[baseIdx].FootComment = overlayKey.FootComment
+
+						if opts.AnnotateOverrides && !base.Children[baseIdx+1].Equal(chosen, EqualOptions{IgnoreComments: true, IgnoreStyle: true}) {
+							key := result.Children[baseIdx]
+							key.HeadComment = append([]string{overrideComment(base.Children[baseIdx+1])}, key.HeadComment...)
 						}
 
 						result.Children[baseIdx+1] = clonedValue
 					}
 				} else {
 					// Key doesn't exist in base - add it
+					opts.record(MergeActionAdd, childPath, nil, overlayValue)
 					clonedKey := overlayKey.Clone()
 					clonedValue := overlayValue.Clone()
+					clonedKey.EmptyLinesBefore = addedKeyEmptyLines(overlayKey, overlayValue, len(result.Children) > 0, opts)
 					clonedKey.Parent = result
 					clonedValue.Parent = result
 					clonedValue.Key = clonedKey
 					result.Children = append(result.Children, clonedKey, clonedValue)
 				}
+			} else if baseIdx := findMapKeyNode(result, overlayKey); baseIdx >= 0 {
+				// Complex keys match structurally and their values merge like scalar-keyed ones
+				merged := mergeNodes(result.Children[baseIdx+1], overlayValue, path+pathKey(mapKeyString(overlayKey)), opts)
+				merged.Parent = result
+				merged.Key = result.Children[baseIdx]
+				result.Children[baseIdx+1] = merged
+			} else {
+				opts.record(MergeActionAdd, path+pathKey(mapKeyString(overlayKey)), nil, overlayValue)
+				clonedKey := overlayKey.Clone()
+				clonedValue := overlayValue.Clone()
+				clonedKey.Parent = result
+				clonedValue.Parent = result
+				clonedValue.Key = clonedKey
+				result.Children = append(result.Children, clonedKey, clonedValue)
+			}
+		}
+
+		if len(removed) > 0 {
+			kept := make([]*Node, 0, len(result.Children))
+			for i := 0; i < len(result.Children); i++ {
+				if removed[i] {
+					i++
+					continue
+				}
+				kept = append(kept, result.Children[i])
 			}
+			result.Children = kept
+		}
+
+		opts.orderMergedKeys(result, overlay)
+	} else if base.Kind == SequenceNode && overlay.Kind == SequenceNode && opts.SequenceStrategy != SequenceMergeReplace {
+		if opts.SequenceStrategy == SequenceMergeByKey {
+			mergeSequencesByKey(result, overlay, path, opts)
+			return result
 		}
-	} else if base.Kind == SequenceNode && overlay.Kind == SequenceNode {
+		if opts.SequenceStrategy == SequenceMergeUnion {
+			mergeSequencesUnion(result, overlay, path, opts)
+			return result
+		}
+
 		// For sequences, append overlay items to base
 		for _, item := range overlay.Children {
+			opts.record(MergeActionAdd, fmt.Sprintf("%s[%d]", path, len(result.Children)), nil, item)
 			cloned := item.Clone()
 			result.AddChild(cloned)
 		}
 	} else {
+		chosen := opts.choose(path, base, overlay)
+		if chosen == nil || chosen == base {
+			opts.record(MergeActionKeep, path, base, base)
+			return result
+		}
+		opts.record(MergeActionOverride, path, base, chosen)
+
 		// For other types, overlay replaces base but preserve base comments if overlay has none
-		result = overlay.Clone()
+		result = chosen.Clone()
+		if opts.CommentMode != CommentMergeDefault {
+			mergeComments(result, base, chosen, opts.CommentMode)
+			return result
+		}
 		if len(result.HeadComment) == 0 && len(base.HeadComment) > 0 {
 			result.HeadComment = base.HeadComment
 		}
@@ -557,32 +1839,115 @@ func MergeNodes(base, overlay *Node) *Node {
 	return result
 }
 
+// coerceScalarToSequence merges a scalar and a sequence into one sequence, keeping the
+// base item first. The sequence node provides the style and comments of the result.
+func coerceScalarToSequence(base, overlay *Node) *Node {
+	if base.Kind == SequenceNode {
+		result := base.Clone()
+		result.AddChild(overlay.Clone())
+		return result
+	}
+
+	result := overlay.Clone()
+	item := base.Clone()
+	item.Parent = result
+	result.Children = append([]*Node{item}, result.Children...)
+	return result
+}
+
+// mergeSequencesByKey merges overlay items into result, matching mapping items by
+// their SequenceKey field. Unmatched items are appended in overlay order.
+func mergeSequencesByKey(result, overlay *Node, path string, opts MergeOptions) {
+	key := opts.sequenceKey()
+	index := make(map[string]int)
+	for i, item := range result.Children {
+		if id, ok := sequenceItemID(item, key); ok {
+			index[id] = i
+		}
+	}
+
+	for _, item := range overlay.Children {
+		if id, ok := sequenceItemID(item, key); ok {
+			if j, exists := index[id]; exists {
+				merged := mergeNodes(result.Children[j], item, fmt.Sprintf("%s[%d]", path, j), opts)
+				merged.Parent = result
+				result.Children[j] = merged
+				continue
+			}
+			index[id] = len(result.Children)
+		}
+		opts.record(MergeActionAdd, fmt.Sprintf("%s[%d]", path, len(result.Children)), nil, item)
+		result.AddChild(item.Clone())
+	}
+}
+
+// mergeSequencesUnion appends the overlay items that are not yet in result
+func mergeSequencesUnion(result, overlay *Node, path string, opts MergeOptions) {
+	for _, item := range overlay.Children {
+		present := false
+		for _, existing := range result.Children {
+			if existing.Equal(item, EqualOptions{IgnoreComments: true, IgnoreStyle: true}) {
+				present = true
+				break
+			}
+		}
+		if !present {
+			opts.record(MergeActionAdd, fmt.Sprintf("%s[%d]", path, len(result.Children)), nil, item)
+			result.AddChild(item.Clone())
+		}
+	}
+}
+
+// sequenceItemID returns the scalar value of key in a mapping sequence item
+func sequenceItemID(item *Node, key string) (string, bool) {
+	if item == nil || item.Kind != MappingNode {
+		return "", false
+	}
+	value := item.GetMapValue(key)
+	if value == nil || value.Kind != ScalarNode {
+		return "", false
+	}
+	return fmt.Sprintf("%v", value.Value), true
+}
+
 // MergeDocuments merges two documents preserving comments
 func MergeDocuments(base, overlay *Document) *Document {
+	return MergeDocumentsWithOptions(base, overlay, DefaultMergeOptions())
+}
+
+// MergeDocumentsWithOptions merges two documents like MergeDocuments using the given merge options
+func MergeDocumentsWithOptions(base, overlay *Document, opts MergeOptions) *Document {
 	if base == nil && overlay == nil {
 		return nil
 	}
 	if base == nil {
+		root := overlay.Root.Clone()
+		opts.labelNodes(root, opts.OverlayLabel)
 		return &Document{
-			Root:       overlay.Root.Clone(),
-			Directives: append([]Directive{}, overlay.Directives...),
-			Version:    overlay.Version,
-			Anchors:    make(map[string]*Node),
+			Root:        root,
+			Directives:  append([]Directive{}, overlay.Directives...),
+			Version:     overlay.Version,
+			Anchors:     make(map[string]*Node),
+			ExplicitEnd: overlay.ExplicitEnd,
 		}
 	}
 	if overlay == nil {
+		root := base.Root.Clone()
+		opts.labelNodes(root, opts.BaseLabel)
 		return &Document{
-			Root:       base.Root.Clone(),
-			Directives: append([]Directive{}, base.Directives...),
-			Version:    base.Version,
-			Anchors:    make(map[string]*Node),
+			Root:        root,
+			Directives:  append([]Directive{}, base.Directives...),
+			Version:     base.Version,
+			Anchors:     make(map[string]*Node),
+			ExplicitEnd: base.ExplicitEnd,
 		}
 	}
 
 	merged := &Document{
-		Directives: append([]Directive{}, base.Directives...),
-		Version:    base.Version,
-		Anchors:    make(map[string]*Node),
+		Directives:  append([]Directive{}, base.Directives...),
+		Version:     base.Version,
+		Anchors:     make(map[string]*Node),
+		ExplicitEnd: base.ExplicitEnd,
 	}
 
 	// Merge directives from overlay
@@ -618,7 +1983,7 @@ func MergeDocuments(base, overlay *Document) *Document {
 	// Merge the actual content nodes
 	var mergedContent *Node
 	if baseContent != nil || overlayContent != nil {
-		mergedContent = MergeNodes(baseContent, overlayContent)
+		mergedContent = MergeNodesWithOptions(baseContent, overlayContent, opts)
 	}
 
 	// Create the document node
@@ -634,6 +1999,14 @@ func MergeDocuments(base, overlay *Document) *Document {
 		merged.Root.HeadComment = overlay.Root.HeadComment
 	}
 
+	// Trailing comments after the last node belong to the document, keep them the same way
+	if base.Root != nil && len(base.Root.FootComment) > 0 {
+		merged.Root.FootComment = base.Root.FootComment
+	}
+	if len(merged.Root.FootComment) == 0 && overlay.Root != nil && len(overlay.Root.FootComment) > 0 {
+		merged.Root.FootComment = overlay.Root.FootComment
+	}
+
 	if mergedContent != nil {
 		merged.Root.AddChild(mergedContent)
 	}
@@ -651,37 +2024,48 @@ func MergeDocuments(base, overlay *Document) *Document {
 
 // MergeTrees merges two NodeTrees preserving comments from both
 func MergeTrees(base, overlay *NodeTree) *NodeTree {
+	return MergeTreesWithOptions(base, overlay, DefaultMergeOptions())
+}
+
+// MergeTreesWithOptions merges two NodeTrees like MergeTrees using the given merge options
+func MergeTreesWithOptions(base, overlay *NodeTree, opts MergeOptions) *NodeTree {
 	if base == nil {
-		return overlay
+		return stampTreeDocuments(overlay, opts, opts.OverlayLabel)
 	}
 	if overlay == nil {
-		return base
+		return stampTreeDocuments(base, opts, opts.BaseLabel)
 	}
 
 	result := NewNodeTree()
 
 	// If both have documents, merge the first documents
 	if len(base.Documents) > 0 && len(overlay.Documents) > 0 {
-		merged := MergeDocuments(base.Documents[0], overlay.Documents[0])
+		merged := MergeDocumentsWithOptions(base.Documents[0], overlay.Documents[0], opts)
 		result.Documents = append(result.Documents, merged)
 		result.Current = merged
 
 		// Append any additional documents from base
 		for i := 1; i < len(base.Documents); i++ {
-			result.Documents = append(result.Documents, base.Documents[i])
+			result.Documents = append(result.Documents, opts.stampDocument(base.Documents[i], opts.BaseLabel))
 		}
 
 		// Append any additional documents from overlay
 		for i := 1; i < len(overlay.Documents); i++ {
-			result.Documents = append(result.Documents, overlay.Documents[i])
+			opts.recordDocument(len(result.Documents), overlay.Documents[i])
+			result.Documents = append(result.Documents, opts.stampDocument(overlay.Documents[i], opts.OverlayLabel))
 		}
 	} else if len(base.Documents) > 0 {
-		result.Documents = append(result.Documents, base.Documents...)
+		for _, doc := range base.Documents {
+			result.Documents = append(result.Documents, opts.stampDocument(doc, opts.BaseLabel))
+		}
 		if len(result.Documents) > 0 {
 			result.Current = result.Documents[0]
 		}
 	} else if len(overlay.Documents) > 0 {
-		result.Documents = append(result.Documents, overlay.Documents...)
+		for i, doc := range overlay.Documents {
+			opts.recordDocument(i, doc)
+			result.Documents = append(result.Documents, opts.stampDocument(doc, opts.OverlayLabel))
+		}
 		if len(result.Documents) > 0 {
 			result.Current = result.Documents[0]
 		}
@@ -690,6 +2074,132 @@ func MergeTrees(base, overlay *NodeTree) *NodeTree {
 	return result
 }
 
+// MergePath merges only the subtree at path: the node at path in the first overlay
+// document is merged into the node at the same path in a copy of the first base
+// document with MergeNodes, and everything else in base is left untouched. Missing
+// mapping keys along the path are created in the result. If the overlay has no node
+// at path the copy of base is returned unchanged.
+func MergePath(base *NodeTree, overlay *NodeTree, path string) (*NodeTree, error) {
+	segments, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if base == nil || len(base.Documents) == 0 || base.Documents[0].Root == nil {
+		return nil, fmt.Errorf("base tree has no document")
+	}
+	if overlay == nil || len(overlay.Documents) == 0 {
+		return nil, fmt.Errorf("overlay tree has no document")
+	}
+
+	result := base.Clone()
+	overlayValue := lookupPath(documentContent(overlay.Documents[0].Root), segments)
+	if overlayValue == nil {
+		return result, nil
+	}
+
+	doc := result.Documents[0]
+	if doc.Root.Kind == DocumentNode && len(doc.Root.Children) == 0 {
+		doc.Root.AddChild(NewMappingNode())
+	}
+	root := documentContent(doc.Root)
+
+	target := lookupPath(root, segments)
+	switch {
+	case target == root:
+		merged := MergeNodes(root, overlayValue)
+		if root == doc.Root {
+			doc.Root = merged
+		} else {
+			doc.Root.Children[0] = merged
+			merged.Parent = doc.Root
+		}
+	case target != nil:
+		if err := target.ReplaceWith(MergeNodes(target, overlayValue)); err != nil {
+			return nil, err
+		}
+	default:
+		// Follow the existing part of the path, then create the missing keys
+		parent, i := root, 0
+		for ; i < len(segments)-1; i++ {
+			next := lookupPath(parent, segments[i:i+1])
+			if next == nil {
+				break
+			}
+			parent = next
+		}
+		missing := segments[i:]
+		for _, segment := range missing {
+			if segment.isIndex {
+				return nil, fmt.Errorf("cannot create sequence item %s of path %s", segment, path)
+			}
+		}
+		parent, err := ensureMappingPath(parent, missing[:len(missing)-1])
+		if err != nil {
+			return nil, err
+		}
+		if parent.Kind != MappingNode {
+			return nil, fmt.Errorf("cannot create '%s' under a %s", missing[len(missing)-1], parent.Kind)
+		}
+		if err := parent.AddKeyValue(NewScalarNode(missing[len(missing)-1].key), overlayValue.Clone()); err != nil {
+			return nil, err
+		}
+	}
+
+	doc.ReindexAnchors()
+	return result, nil
+}
+
+// MergeAndDiff merges overlay into base like MergeTrees and also returns the
+// differences from base to the merged tree, which are exactly the changes the overlay
+// made. The NewNode of every difference is a node of the returned tree.
+func MergeAndDiff(base, overlay *NodeTree) (*NodeTree, []DiffResult) {
+	merged := MergeTrees(base, overlay)
+	return merged, DiffTrees(base, merged)
+}
+
+// MergeTreesWithProvenance merges trees like MergeTrees and records under the
+// DefaultProvenanceKey metadata key which input every node was taken from: baseLabel
+// for nodes retained from base and overlayLabel for nodes taken from overlay. Nodes
+// that already carry a label, such as those of an earlier merge result, keep it, so
+// merging layer by layer records the layer that set each value. An empty label leaves
+// the nodes of that input unlabelled. The input trees are not modified.
+func MergeTreesWithProvenance(base, overlay *NodeTree, baseLabel, overlayLabel string) *NodeTree {
+	opts := DefaultMergeOptions()
+	opts.ProvenanceKey = DefaultProvenanceKey
+	opts.BaseLabel = baseLabel
+	opts.OverlayLabel = overlayLabel
+	return MergeTreesWithOptions(base, overlay, opts)
+}
+
+// stampTreeDocuments returns tree, or a copy of it whose documents are labelled like
+// stampDocument when provenance is tracked
+func stampTreeDocuments(tree *NodeTree, opts MergeOptions, label string) *NodeTree {
+	if opts.ProvenanceKey == "" || label == "" {
+		return tree
+	}
+	stamped := &NodeTree{EmptyLineConfig: tree.EmptyLineConfig, EncodeOptions: tree.EncodeOptions}
+	for _, doc := range tree.Documents {
+		stamped.Documents = append(stamped.Documents, opts.stampDocument(doc, label))
+	}
+	if len(stamped.Documents) > 0 {
+		stamped.Current = stamped.Documents[0]
+	}
+	return stamped
+}
+
+// MergeAll merges trees left to right so that later trees override earlier ones.
+// Nil trees are skipped; if every tree is nil the result is nil.
+func MergeAll(trees ...*NodeTree) *NodeTree {
+	var result *NodeTree
+	for _, tree := range trees {
+		if tree == nil {
+			continue
+		}
+		result = MergeTrees(result, tree)
+	}
+	return result
+}
+
 func (d *Document) RegisterAnchor(name string, node *Node) {
 	if d.Anchors == nil {
 		d.Anchors = make(map[string]*Node)
@@ -702,11 +2212,169 @@ func (d *Document) GetAnchor(name string) *Node {
 	return d.Anchors[name]
 }
 
+// ReindexAnchors rebuilds the Anchors map from the nodes under Root and relinks every
+// alias to its anchor. Call it after replacing or cloning the root so the document
+// no longer refers to nodes of another tree.
+func (d *Document) ReindexAnchors() {
+	d.Anchors = make(map[string]*Node)
+	resolveAnchors(d.Root, d)
+}
+
+// NodeAtLine returns the most specific node starting at line, preferring the deepest
+// node and, between a key and its value, the value. If no node starts there it returns
+// the deepest node whose range spans the line, such as the mapping around a comment.
+// A collection spans from its first line to the last line of its descendants and a
+// block scalar spans the lines of its value. Lines are 1-based and relative to the
+// document source; nil is returned when the line is outside the document content.
+func (d *Document) NodeAtLine(line int) *Node {
+	if d == nil || d.Root == nil || line < 1 {
+		return nil
+	}
+
+	var exact, enclosing *Node
+	exactDepth, enclosingDepth := -1, -1
+
+	// visit returns the last line spanned by n
+	var visit func(n *Node, depth int) int
+	visit = func(n *Node, depth int) int {
+		end := scalarLastLine(n)
+		for _, child := range n.Children {
+			if childEnd := visit(child, depth+1); childEnd > end {
+				end = childEnd
+			}
+		}
+
+		if n.Line == line && depth >= exactDepth {
+			exact, exactDepth = n, depth
+		}
+		if n.Line > 0 && n.Line <= line && line <= end && depth > enclosingDepth {
+			enclosing, enclosingDepth = n, depth
+		}
+		return end
+	}
+	visit(d.Root, 0)
+
+	if exact != nil {
+		return exact
+	}
+	return enclosing
+}
+
+// scalarLastLine returns the last line spanned by n itself, which is past its start
+// line only for block scalars
+func scalarLastLine(n *Node) int {
+	if n.Kind == ScalarNode && (n.Style == LiteralStyle || n.Style == FoldedStyle) {
+		return n.Line + strings.Count(strings.TrimSuffix(fmt.Sprintf("%v", n.Value), "\n"), "\n") + 1
+	}
+	return n.Line
+}
+
+// lastLine returns the last line spanned by n and its descendants
+func lastLine(n *Node) int {
+	end := scalarLastLine(n)
+	for _, child := range n.Children {
+		if childEnd := lastLine(child); childEnd > end {
+			end = childEnd
+		}
+	}
+	return end
+}
+
+// FixCommentAttachment moves comments that yaml.v3 attached to the wrong node back to
+// the node they textually precede. A comment written directly above a sequence item is
+// parsed as a foot comment of the last entry of the previous item, so it is emitted
+// inside that item and drifts on every round trip. Such foot comments become head
+// comments of the following item. Comments separated from either item by a blank line
+// are left alone, since the blank line may mean they close the previous item.
+func (d *Document) FixCommentAttachment() {
+	if d == nil || d.Root == nil {
+		return
+	}
+
+	d.Root.Walk(func(n *Node) bool {
+		if n.Kind != SequenceNode {
+			return true
+		}
+		for i := 1; i < len(n.Children); i++ {
+			prev, item := n.Children[i-1], n.Children[i]
+			if item.Line == 0 {
+				continue
+			}
+
+			end := lastLine(prev)
+			var moved []string
+			var collect func(node, value *Node)
+			collect = func(node, value *Node) {
+				for j, child := range node.Children {
+					var childValue *Node
+					if node.Kind == MappingNode && j%2 == 0 && j+1 < len(node.Children) {
+						childValue = node.Children[j+1]
+					}
+					collect(child, childValue)
+				}
+				entry := node
+				if value != nil {
+					entry = value
+				}
+				if len(node.FootComment) > 0 && lastLine(entry) == end && commentLines(node.FootComment) == item.Line-end-1 {
+					moved = append(moved, node.FootComment...)
+					node.FootComment = nil
+				}
+			}
+			collect(prev, nil)
+
+			if len(moved) > 0 {
+				item.HeadComment = append(moved, item.HeadComment...)
+			}
+		}
+		return true
+	})
+}
+
+// commentLines returns the number of comment lines in comments, ignoring blank entries
+func commentLines(comments []string) int {
+	count := 0
+	for _, line := range comments {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// FixCommentAttachment runs Document.FixCommentAttachment on every document
+func (nt *NodeTree) FixCommentAttachment() {
+	for _, doc := range nt.Documents {
+		doc.FixCommentAttachment()
+	}
+}
+
+// NodeAtLine returns the node at line of the parsed stream, see Document.NodeAtLine.
+// The line is looked up in the last document starting before it, after subtracting
+// the document's LineOffset.
+func (nt *NodeTree) NodeAtLine(line int) *Node {
+	var found *Document
+	for _, doc := range nt.Documents {
+		if doc != nil && doc.LineOffset < line {
+			found = doc
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	return found.NodeAtLine(line - found.LineOffset)
+}
+
 func (n *Node) ToYAMLNode() *yaml.Node {
 	return n.ToYAMLNodeWithConfig(DefaultEmptyLineConfig())
 }
 
 func (n *Node) ToYAMLNodeWithConfig(config EmptyLineConfig) *yaml.Node {
+	return n.ToYAMLNodeWithOptions(DefaultEncodeOptions())
+}
+
+// ToYAMLNodeWithOptions converts the node to a yaml.Node using the given encoding options
+func (n *Node) ToYAMLNodeWithOptions(opts EncodeOptions) *yaml.Node {
 	if n == nil {
 		return nil
 	}
@@ -722,9 +2390,10 @@ func (n *Node) ToYAMLNodeWithConfig(config EmptyLineConfig) *yaml.Node {
 	if len(n.HeadComment) > 0 {
 		yamlNode.HeadComment = strings.Join(n.HeadComment, "\n")
 	}
-	yamlNode.LineComment = n.LineComment
-	if len(n.FootComment) > 0 {
-		yamlNode.FootComment = strings.Join(n.FootComment, "\n")
+	lineComment, continuation := splitLineComment(n.LineComment)
+	yamlNode.LineComment = lineComment
+	if footComment := append(continuation, n.FootComment...); len(footComment) > 0 {
+		yamlNode.FootComment = strings.Join(footComment, "\n")
 	}
 
 	switch n.Kind {
@@ -732,64 +2401,105 @@ func (n *Node) ToYAMLNodeWithConfig(config EmptyLineConfig) *yaml.Node {
 		yamlNode.Kind = yaml.DocumentNode
 		yamlNode.Content = make([]*yaml.Node, 0, len(n.Children))
 		for _, child := range n.Children {
-			yamlNode.Content = append(yamlNode.Content, child.ToYAMLNode())
+			yamlNode.Content = append(yamlNode.Content, child.ToYAMLNodeWithOptions(opts))
 		}
 	case MappingNode:
 		yamlNode.Kind = yaml.MappingNode
 		yamlNode.Content = make([]*yaml.Node, 0, len(n.Children))
 		for _, child := range n.Children {
-			yamlNode.Content = append(yamlNode.Content, child.ToYAMLNode())
+			yamlNode.Content = append(yamlNode.Content, child.ToYAMLNodeWithOptions(opts))
 		}
 	case SequenceNode:
 		yamlNode.Kind = yaml.SequenceNode
 		yamlNode.Content = make([]*yaml.Node, 0, len(n.Children))
 		for _, child := range n.Children {
-			yamlNode.Content = append(yamlNode.Content, child.ToYAMLNode())
+			yamlNode.Content = append(yamlNode.Content, child.ToYAMLNodeWithOptions(opts))
 		}
 	case ScalarNode:
 		yamlNode.Kind = yaml.ScalarNode
 		if n.Value == nil {
 			yamlNode.Value = ""
 		}
+		if opts.PreserveRawValues && n.hasCurrentRawValue() {
+			yamlNode.Value = n.RawValue
+		}
+		if token, ok := n.booleanToken(); ok {
+			yamlNode.Value = token
+			if n.Style == DefaultStyle {
+				// Leave implicit booleans untagged so they keep their plain spelling
+				yamlNode.Tag = ""
+			}
+		} else if b, isBool := n.Value.(bool); isBool && opts.YAMLVersion == YAML11 && n.Style == DefaultStyle &&
+			(n.Tag == "" || n.Tag == "!!bool") {
+			yamlNode.Value = "no"
+			if b {
+				yamlNode.Value = "yes"
+			}
+			yamlNode.Tag = ""
+		}
 	case AliasNode:
 		yamlNode.Kind = yaml.AliasNode
+		yamlNode.Value = n.aliasName()
 	case NullNode:
 		yamlNode.Kind = yaml.ScalarNode
 		yamlNode.Tag = "!!null"
 		yamlNode.Value = ""
 	}
 
-	switch n.Style {
-	case LiteralStyle:
-		yamlNode.Style = yaml.LiteralStyle
-	case FoldedStyle:
-		yamlNode.Style = yaml.FoldedStyle
-	case QuotedStyle:
-		yamlNode.Style = yaml.SingleQuotedStyle
-	case DoubleQuotedStyle:
-		yamlNode.Style = yaml.DoubleQuotedStyle
-	case FlowStyle:
-		yamlNode.Style = yaml.FlowStyle
-	default:
-		yamlNode.Style = 0
+	yamlNode.Style = n.Style.yamlStyle()
+	if n.Kind == ScalarNode && yamlNode.Style == 0 {
+		if str, ok := n.Value.(string); ok {
+			_, yaml11Boolean := yaml11Bool(str)
+			if (opts.QuoteAmbiguousScalars && isAmbiguousScalar(str)) || (opts.YAMLVersion == YAML11 && yaml11Boolean) {
+				yamlNode.Style = yaml.DoubleQuotedStyle
+			}
+		}
 	}
 
 	return yamlNode
 }
 
+// booleanToken returns the original spelling of a boolean parsed from a YAML 1.1
+// token such as yes or off, as long as it still matches the node's Value
+func (n *Node) booleanToken() (string, bool) {
+	value, isBool := n.Value.(bool)
+	if !isBool || n.Tag != "!!bool" {
+		return "", false
+	}
+	if parsed, ok := yaml11Bool(n.RawValue); ok && parsed == value {
+		return n.RawValue, true
+	}
+	return "", false
+}
+
+// hasCurrentRawValue reports whether RawValue still decodes to the node's Value
+func (n *Node) hasCurrentRawValue() bool {
+	if n.RawValue == "" {
+		return false
+	}
+	decoded := decodeScalarValue(n.RawValue, n.Tag)
+	return fmt.Sprintf("%v", decoded) == fmt.Sprintf("%v", n.Value)
+}
+
 func (d *Document) ToYAML() ([]byte, error) {
 	return d.ToYAMLWithConfig(DefaultEmptyLineConfig())
 }
 
 func (d *Document) ToYAMLWithConfig(config EmptyLineConfig) ([]byte, error) {
+	return d.ToYAMLWithOptions(config, DefaultEncodeOptions())
+}
+
+// ToYAMLWithOptions serializes the document using the given empty line and encoding options
+func (d *Document) ToYAMLWithOptions(config EmptyLineConfig, opts EncodeOptions) ([]byte, error) {
 	if d.Root == nil {
 		return []byte{}, nil
 	}
 
 	// Special case: if we have a document node with only comments
-	if d.Root.Kind == DocumentNode && len(d.Root.Children) == 0 && len(d.Root.HeadComment) > 0 {
+	if d.Root.Kind == DocumentNode && len(d.Root.Children) == 0 && (len(d.Root.HeadComment) > 0 || len(d.Root.FootComment) > 0) {
 		// Return just the comments as plain text
-		result := strings.Join(d.Root.HeadComment, "\n")
+		comments := append(append([]string(nil), d.Root.HeadComment...), d.Root.FootComment...)
+		result := strings.Join(comments, "\n")
 		if !strings.HasSuffix(result, "\n") {
 			result += "\n"
 		}
@@ -801,7 +2511,9 @@ func (d *Document) ToYAMLWithConfig(config EmptyLineConfig) ([]byte, error) {
 		return []byte(""), nil
 	}
 
-	yamlNode := d.Root.ToYAMLNode()
+	yamlNode := d.Root.ToYAMLNodeWithOptions(opts)
+	blocks := replaceIndentedBlocks(d.Root, yamlNode)
+	markEmptyLines(d.Root, yamlNode)
 
 	// Use encoder with 2-space indentation
 	var buf strings.Builder
@@ -812,7 +2524,8 @@ func (d *Document) ToYAMLWithConfig(config EmptyLineConfig) ([]byte, error) {
 		return nil, err
 	}
 
-	output := []byte(buf.String())
+	output := restoreIndentedBlocks([]byte(buf.String()), blocks)
+	output = restoreEmptyLines(output)
 
 	// Apply empty line policy
 	switch config.Policy {
@@ -837,19 +2550,52 @@ func (nt *NodeTree) ToYAML() ([]byte, error) {
 		return []byte{}, nil
 	}
 
-	result := []byte{}
+	buf := bytes.NewBuffer([]byte{})
+	if err := nt.WriteYAML(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteYAML serializes the tree like ToYAML, writing each document to w as soon as it
+// is encoded instead of building the whole output in memory
+func (nt *NodeTree) WriteYAML(w io.Writer) error {
+	for i, doc := range nt.Documents {
+		docBytes, err := doc.ToYAMLWithOptions(nt.EmptyLineConfig, nt.EncodeOptions)
+		if err != nil {
+			return fmt.Errorf("failed to marshal document %d: %w", i, err)
+		}
+
+		// An empty first document needs its own marker to keep its position
+		if i > 0 || (len(docBytes) == 0 && len(nt.Documents) > 1) {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return fmt.Errorf("failed to write document %d: %w", i, err)
+			}
+		}
+		if doc.ExplicitEnd {
+			if len(docBytes) > 0 && docBytes[len(docBytes)-1] != '\n' {
+				docBytes = append(docBytes, '\n')
+			}
+			docBytes = append(docBytes, "...\n"...)
+		}
+		if _, err := w.Write(docBytes); err != nil {
+			return fmt.Errorf("failed to write document %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// SplitToBytes serializes every document separately, in order and without a "---"
+// separator, using the tree's empty line and encoding configuration
+func (nt *NodeTree) SplitToBytes() ([][]byte, error) {
+	result := make([][]byte, 0, len(nt.Documents))
 	for i, doc := range nt.Documents {
-		docBytes, err := doc.ToYAMLWithConfig(nt.EmptyLineConfig)
+		docBytes, err := doc.ToYAMLWithOptions(nt.EmptyLineConfig, nt.EncodeOptions)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal document %d: %w", i, err)
 		}
-
-		if i > 0 {
-			result = append(result, []byte("---\n")...)
-		}
-		result = append(result, docBytes...)
+		result = append(result, docBytes)
 	}
-
 	return result, nil
 }
 
@@ -895,6 +2641,85 @@ func addEmptyLinesBeforeCommentBlocks(input []byte) []byte {
 	return []byte(strings.Join(output, "\n"))
 }
 
+// emptyLineMarker is a placeholder comment line written for each EmptyLinesBefore of a
+// mapping key. yaml.v3 indents a head comment that starts with an empty line, so the
+// markers are encoded as comments and turned into empty lines by restoreEmptyLines.
+const emptyLineMarker = "#__yaml_empty_line__"
+
+// markEmptyLines prepends an emptyLineMarker to the head comment of every mapping key
+// under node for each empty line it should be preceded by
+func markEmptyLines(node *Node, yamlNode *yaml.Node) {
+	markEmptyLinesFrom(node, yamlNode, 0)
+}
+
+// markEmptyLinesFrom marks the keys under node, where the encoder already writes
+// leading empty lines before the first key
+func markEmptyLinesFrom(node *Node, yamlNode *yaml.Node, leading int) {
+	// Flow collections are written on one line
+	if node == nil || yamlNode == nil || node.Style == FlowStyle || len(node.Children) != len(yamlNode.Content) {
+		return
+	}
+	for i, child := range node.Children {
+		if child == nil {
+			continue
+		}
+		written := 0
+		if i == 0 {
+			written = leading
+		} else if i >= 2 && (yamlNode.Content[i-2].FootComment != "" || yamlNode.Content[i-1].FootComment != "") {
+			// yaml.v3 separates a foot comment from the next key with an empty line
+			written = 1
+		}
+		if count := keyEmptyLines(node, i) - written; count > 0 {
+			markers := strings.TrimSuffix(strings.Repeat(emptyLineMarker+"\n", count), "\n")
+			if comment := yamlNode.Content[i].HeadComment; comment != "" {
+				markers += "\n" + comment
+			}
+			yamlNode.Content[i].HeadComment = markers
+		}
+		childLeading := 0
+		if yamlNode.Kind == yaml.DocumentNode && yamlNode.HeadComment != "" {
+			// yaml.v3 writes an empty line after the document head comment
+			childLeading = 1
+		}
+		markEmptyLinesFrom(child, yamlNode.Content[i], childLeading)
+	}
+}
+
+// keyEmptyLines returns the number of empty lines before the mapping key at index i
+// of node. The parser records the count on the last node that starts on a line, so
+// for a key whose value shares its line the count is read from the value.
+func keyEmptyLines(node *Node, i int) int {
+	if node.Kind != MappingNode || i%2 != 0 {
+		return 0
+	}
+	key := node.Children[i]
+	count := key.EmptyLinesBefore
+	if i+1 < len(node.Children) && node.Children[i+1] != nil && node.Children[i+1].Line == key.Line {
+		node.Children[i+1].Walk(func(n *Node) bool {
+			if n.Line == key.Line && n.EmptyLinesBefore > count {
+				count = n.EmptyLinesBefore
+			}
+			return true
+		})
+	}
+	return count
+}
+
+// restoreEmptyLines replaces the lines written for emptyLineMarker with empty lines
+func restoreEmptyLines(input []byte) []byte {
+	if !bytes.Contains(input, []byte(emptyLineMarker)) {
+		return input
+	}
+	lines := strings.Split(string(input), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == emptyLineMarker {
+			lines[i] = ""
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
 // Keep the old function name as an alias for backwards compatibility
 func addEmptyLinesBeforeSchemaComments(input []byte) []byte {
 	return addEmptyLinesBeforeCommentBlocks(input)
@@ -951,18 +2776,25 @@ func normalizeEmptyLines(input []byte, count int) []byte {
 
 // UnmarshalYAMLWithEmptyLines parses YAML and tracks empty lines
 func UnmarshalYAMLWithEmptyLines(data []byte) (*NodeTree, error) {
+	return unmarshalDocuments(data, DefaultParseOptions())
+}
+
+// unmarshalDocuments parses every document in data using the given options
+func unmarshalDocuments(data []byte, opts ParseOptions) (*NodeTree, error) {
 	tree := NewNodeTree()
 
 	// Split by document separator to handle multi-document YAML
 	content := string(data)
-	documents := splitDocuments(content)
+	documents, ended, offsets := splitDocumentStream(content, opts.KeepEmptyDocuments)
 
-	for _, docContent := range documents {
+	for i, docContent := range documents {
 		// Parse the document and track empty lines
-		doc, err := parseDocumentWithEmptyLines(docContent)
+		doc, err := parseDocumentWithOptions(docContent, opts)
 		if err != nil {
 			return nil, err
 		}
+		doc.ExplicitEnd = ended[i]
+		doc.LineOffset = offsets[i]
 		tree.Documents = append(tree.Documents, doc)
 	}
 
@@ -971,6 +2803,11 @@ func UnmarshalYAMLWithEmptyLines(data []byte) (*NodeTree, error) {
 
 // parseDocumentWithEmptyLines parses a single document and tracks empty lines
 func parseDocumentWithEmptyLines(docContent string) (*Document, error) {
+	return parseDocumentWithOptions(docContent, DefaultParseOptions())
+}
+
+// parseDocumentWithOptions parses a single document using the given options and tracks empty lines
+func parseDocumentWithOptions(docContent string, opts ParseOptions) (*Document, error) {
 	// First, parse normally with yaml.v3
 	var yamlNode yaml.Node
 	err := yaml.Unmarshal([]byte(docContent), &yamlNode)
@@ -1021,10 +2858,12 @@ func parseDocumentWithEmptyLines(docContent string) (*Document, error) {
 	}
 
 	// Convert to our Node structure
-	rootNode := ConvertFromYAMLNode(&yamlNode)
+	rootNode := ConvertFromYAMLNodeWithOptions(&yamlNode, opts)
 
 	// Now analyze the raw content to track empty lines
 	trackEmptyLines(docContent, rootNode)
+	trackBlockIndents(docContent, rootNode)
+	restoreHeaderComment(docContent, rootNode)
 
 	doc := &Document{
 		Anchors: make(map[string]*Node),
@@ -1070,8 +2909,54 @@ func trackEmptyLines(content string, root *Node) {
 	}
 }
 
+// restoreHeaderComment rebuilds the document head comment from the source lines.
+// yaml.v3 collapses consecutive blank lines between comment paragraphs into one,
+// so the header block at the top of the document is copied back as written.
+func restoreHeaderComment(content string, root *Node) {
+	if root == nil || root.Kind != DocumentNode || len(root.HeadComment) == 0 {
+		return
+	}
+
+	var want []string
+	for _, line := range root.HeadComment {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			want = append(want, trimmed)
+		}
+	}
+
+	var header []string
+	matched := 0
+	for _, line := range strings.Split(content, "\n") {
+		if matched == len(want) {
+			break
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || (matched == 0 && (trimmed == "---" || strings.HasPrefix(trimmed, "%"))) {
+			if matched > 0 {
+				header = append(header, "")
+			}
+			continue
+		}
+		if trimmed != want[matched] {
+			// The source does not start with the header, keep what yaml.v3 reported
+			return
+		}
+		header = append(header, trimmed)
+		matched++
+	}
+
+	if matched == len(want) {
+		root.HeadComment = header
+	}
+}
+
 // UnmarshalYAML is a custom unmarshal function that preserves comments even when there's no content
 func UnmarshalYAML(data []byte) (*NodeTree, error) {
+	return UnmarshalYAMLWithOptions(data, DefaultParseOptions())
+}
+
+// UnmarshalYAMLWithOptions parses YAML like UnmarshalYAML using the given parsing options
+func UnmarshalYAMLWithOptions(data []byte, opts ParseOptions) (*NodeTree, error) {
 	tree := NewNodeTree()
 
 	// Handle completely empty input
@@ -1082,7 +2967,132 @@ func UnmarshalYAML(data []byte) (*NodeTree, error) {
 	}
 
 	// Parse with empty line tracking
-	return UnmarshalYAMLWithEmptyLines(data)
+	return unmarshalDocuments(data, opts)
+}
+
+// UnmarshalYAMLStrict parses YAML like UnmarshalYAML but rejects any mapping that
+// defines the same key twice, which UnmarshalYAML accepts. The error names the key,
+// its document and the lines of both definitions, counted from the start of the
+// document.
+func UnmarshalYAMLStrict(data []byte) (*NodeTree, error) {
+	tree, err := UnmarshalYAML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, doc := range tree.Documents {
+		if err := checkDuplicateKeys(doc.Root); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+	return tree, nil
+}
+
+// checkDuplicateKeys returns an error for the first mapping under root with a repeated key
+func checkDuplicateKeys(root *Node) error {
+	if root == nil {
+		return nil
+	}
+	var err error
+	root.Walk(func(node *Node) bool {
+		if node.Kind != MappingNode {
+			return true
+		}
+		seen := make(map[string]*Node)
+		for i := 0; i < len(node.Children)-1; i += 2 {
+			keyNode := node.Children[i]
+			key := mapKeyString(keyNode)
+			if first, exists := seen[key]; exists {
+				err = fmt.Errorf("duplicate key %q at line %d, first defined at line %d", key, keyNode.Line, first.Line)
+				return false
+			}
+			seen[key] = keyNode
+		}
+		return true
+	})
+	return err
+}
+
+// UnmarshalYAMLReader parses YAML read from r like UnmarshalYAML. The stream is split
+// into documents as it is read and each document is parsed as soon as it is complete,
+// so only one document is held as text at a time.
+func UnmarshalYAMLReader(r io.Reader) (*NodeTree, error) {
+	opts := DefaultParseOptions()
+	tree := NewNodeTree()
+	splitter := &documentSplitter{keepEmpty: opts.KeepEmptyDocuments}
+	reader := bufio.NewReader(r)
+
+	addDocument := func(docContent string) error {
+		doc, err := parseDocumentWithOptions(docContent, opts)
+		if err != nil {
+			return err
+		}
+		doc.ExplicitEnd = splitter.ended[len(tree.Documents)]
+		doc.LineOffset = splitter.offsets[len(tree.Documents)]
+		tree.Documents = append(tree.Documents, doc)
+		return nil
+	}
+
+	read := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read yaml: %w", err)
+		}
+		read = read || line != ""
+
+		if doc, ok := splitter.addLine(strings.TrimSuffix(line, "\n")); ok {
+			if parseErr := addDocument(doc); parseErr != nil {
+				return nil, parseErr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	// Handle completely empty input
+	if !read {
+		tree.AddDocument().SetRoot(nil)
+		return tree, nil
+	}
+
+	for _, doc := range splitter.finish() {
+		if err := addDocument(doc); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
+
+// UnmarshalYAMLRange parses only count documents starting at document index start.
+// Documents outside the range are split off but never parsed. A start past the last
+// document returns an empty tree and a negative count selects every remaining document.
+func UnmarshalYAMLRange(data []byte, start, count int) (*NodeTree, error) {
+	if start < 0 {
+		return nil, fmt.Errorf("invalid document start %d", start)
+	}
+
+	tree := NewNodeTree()
+	documents, ended, offsets := splitDocumentStream(string(data), false)
+	if start >= len(documents) {
+		return tree, nil
+	}
+
+	end := len(documents)
+	if count >= 0 && start+count < end {
+		end = start + count
+	}
+	for i := start; i < end; i++ {
+		doc, err := parseDocumentWithOptions(documents[i], DefaultParseOptions())
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		doc.ExplicitEnd = ended[i]
+		doc.LineOffset = offsets[i]
+		tree.Documents = append(tree.Documents, doc)
+	}
+	return tree, nil
 }
 
 // Legacy parsing function - kept for reference but now redirects to new implementation
@@ -1158,58 +3168,147 @@ func UnmarshalYAMLLegacy(data []byte) (*NodeTree, error) {
 
 // splitDocuments splits a YAML string into separate documents by --- separator
 func splitDocuments(content string) []string {
-	lines := strings.Split(content, "\n")
+	return splitDocumentsWithOptions(content, false)
+}
+
+// splitDocumentsWithOptions splits a YAML stream into documents. When keepEmpty is
+// set, a document opened by --- that has no content is returned as an empty string
+// instead of being dropped, so document positions match the stream.
+func splitDocumentsWithOptions(content string, keepEmpty bool) []string {
+	documents, _, _ := splitDocumentStream(content, keepEmpty)
+	return documents
+}
+
+// splitDocumentStream splits a YAML stream like splitDocumentsWithOptions and also
+// reports, for each document, whether it was closed by an explicit ... marker and the
+// number of stream lines before its source
+func splitDocumentStream(content string, keepEmpty bool) ([]string, []bool, []int) {
+	splitter := &documentSplitter{keepEmpty: keepEmpty}
 	var documents []string
-	var currentDoc strings.Builder
-	inDocument := false
+	for _, line := range strings.Split(content, "\n") {
+		if doc, ok := splitter.addLine(line); ok {
+			documents = append(documents, doc)
+		}
+	}
+	return append(documents, splitter.finish()...), splitter.ended, splitter.offsets
+}
 
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
+// documentSplitter splits a YAML stream into documents one line at a time, so a
+// stream can be parsed document by document without holding all of it in memory
+type documentSplitter struct {
+	keepEmpty     bool
+	current       strings.Builder
+	inDocument    bool
+	explicitStart bool
+	emitted       int
+	// ended reports, for each document returned so far, whether it was closed by ...
+	ended []bool
+	// offsets holds, for each document returned so far, the number of lines before
+	// the first line of its source
+	offsets []int
+	lines   int
+	start   int
+	// leading holds the lines read before any document content, which become the only
+	// document of a stream made of markers and blank lines
+	leading []string
+}
 
-		if trimmed == "---" {
-			// Document separator found
-			if currentDoc.Len() > 0 {
-				documents = append(documents, currentDoc.String())
-				currentDoc.Reset()
-			}
-			inDocument = true
-		} else if trimmed == "..." {
-			// Document end marker
-			if currentDoc.Len() > 0 {
-				documents = append(documents, currentDoc.String())
-				currentDoc.Reset()
-			}
-			inDocument = false
+// addLine consumes one line without its line break and returns the document it
+// completes, if any
+func (s *documentSplitter) addLine(line string) (string, bool) {
+	defer func() { s.lines++ }()
+	if s.emitted == 0 && s.current.Len() == 0 {
+		s.leading = append(s.leading, line)
+	} else {
+		s.leading = nil
+	}
+
+	trimmed := strings.TrimSpace(line)
+	switch trimmed {
+	case "---", "...":
+		// Document separator or end marker
+		doc, ok := s.complete(trimmed == "...")
+		s.inDocument = trimmed == "---"
+		s.explicitStart = trimmed == "---"
+		return doc, ok
+	}
+
+	// Regular content line
+	if !s.inDocument && s.emitted == 0 {
+		// First document without explicit --- marker
+		s.inDocument = true
+	}
+	if s.inDocument {
+		if s.current.Len() > 0 {
+			s.current.WriteString("\n")
 		} else {
-			// Regular content line
-			if !inDocument && len(documents) == 0 {
-				// First document without explicit --- marker
-				inDocument = true
-			}
-			if inDocument {
-				if currentDoc.Len() > 0 {
-					currentDoc.WriteString("\n")
-				}
-				currentDoc.WriteString(line)
-			}
+			s.start = s.lines
 		}
+		s.current.WriteString(line)
 	}
+	return "", false
+}
 
-	// Add the last document if any
-	if currentDoc.Len() > 0 {
-		documents = append(documents, currentDoc.String())
+// complete ends the current document and returns it, unless it is empty and empty
+// documents are not kept. explicitEnd records that the document was closed by ...
+func (s *documentSplitter) complete(explicitEnd bool) (string, bool) {
+	var doc string
+	offset := s.start
+	switch {
+	case s.current.Len() > 0:
+		doc = s.current.String()
+		s.current.Reset()
+	case !s.keepEmpty || !s.explicitStart:
+		return "", false
+	default:
+		// An empty document starts at the marker that closes it
+		offset = s.lines
 	}
+	s.emitted++
+	s.ended = append(s.ended, explicitEnd)
+	s.offsets = append(s.offsets, offset)
+	return doc, true
+}
 
+// finish returns the documents remaining at the end of the stream
+func (s *documentSplitter) finish() []string {
+	if doc, ok := s.complete(false); ok {
+		return []string{doc}
+	}
 	// If no documents were found, treat the entire content as one document
-	if len(documents) == 0 && len(content) > 0 {
-		documents = append(documents, content)
+	if s.emitted == 0 {
+		if content := strings.Join(s.leading, "\n"); content != "" {
+			s.ended = append(s.ended, false)
+			s.offsets = append(s.offsets, 0)
+			return []string{content}
+		}
 	}
-
-	return documents
+	return nil
 }
 
-// resolveAnchors processes a node tree and registers anchors with the document
+// resolveAnchors processes a node tree and registers anchors with the document.
+// Aliases link to the closest anchor of the same name before them. Constructed or
+// merged trees can place an alias before its anchor, so aliases without an earlier
+// anchor are linked in a second pass to the first anchor that follows them.
 func resolveAnchors(node *Node, doc *Document) {
+	defined := make(map[string]*Node)
+	first := make(map[string]*Node)
+	var pending []*Node
+	collectAnchors(node, doc, defined, first, &pending)
+
+	for _, alias := range pending {
+		name := alias.aliasName()
+		if target := first[name]; target != nil {
+			alias.Alias = target
+		} else {
+			alias.Alias = doc.GetAnchor(name)
+		}
+	}
+}
+
+// collectAnchors registers the anchors under node in document order and links each
+// alias to the latest anchor defined before it. Aliases without one are added to pending.
+func collectAnchors(node *Node, doc *Document, defined, first map[string]*Node, pending *[]*Node) {
 	if node == nil {
 		return
 	}
@@ -1217,21 +3316,25 @@ func resolveAnchors(node *Node, doc *Document) {
 	// Register anchor if present
 	if node.Anchor != "" {
 		doc.RegisterAnchor(node.Anchor, node)
+		defined[node.Anchor] = node
+		if first[node.Anchor] == nil {
+			first[node.Anchor] = node
+		}
 	}
 
 	// Handle alias nodes
 	if node.Kind == AliasNode && node.Value != nil {
-		// The Value field contains the alias name
-		aliasName := fmt.Sprintf("%v", node.Value)
-		if aliasName != "" && aliasName[0] == '*' {
-			aliasName = aliasName[1:] // Remove the * prefix
+		// The Value field contains the alias name, optionally prefixed with *
+		if target := defined[node.aliasName()]; target != nil {
+			node.Alias = target
+		} else {
+			*pending = append(*pending, node)
 		}
-		node.Alias = doc.GetAnchor(aliasName)
 	}
 
 	// Process children recursively
 	for _, child := range node.Children {
-		resolveAnchors(child, doc)
+		collectAnchors(child, doc, defined, first, pending)
 	}
 }
 
@@ -1246,6 +3349,12 @@ type DiffResult struct {
 	OldComment  []string
 	NewComment  []string
 	Description string
+	// Significant is set on DiffStyleChanged results whose style change can alter the
+	// parsed content: switching a scalar to or from a literal or folded block, or
+	// adding or removing quotes around a string that would read as another type or
+	// value when plain. Changing the quote character or a collection's flow style is
+	// not significant.
+	Significant bool
 }
 
 type DiffType int
@@ -1281,8 +3390,60 @@ func (dt DiffType) String() string {
 	}
 }
 
+// IsMeaningful reports whether the difference changes the data rather than
+// only its comments or presentation style. Significant style changes are meaningful.
+func (r DiffResult) IsMeaningful() bool {
+	switch r.Type {
+	case DiffStyleChanged:
+		return r.Significant
+	case DiffNone, DiffCommentChanged:
+		return false
+	default:
+		return true
+	}
+}
+
+// styleChangeSignificant reports whether the style change between two nodes of the same
+// kind can alter the parsed content of the scalar
+func styleChangeSignificant(oldNode, newNode *Node) bool {
+	if oldNode.Kind != ScalarNode || oldNode.Style == newNode.Style {
+		return false
+	}
+	isBlock := func(style NodeStyle) bool { return style == LiteralStyle || style == FoldedStyle }
+	if isBlock(oldNode.Style) || isBlock(newNode.Style) {
+		return true
+	}
+
+	isQuoted := func(style NodeStyle) bool {
+		return style == QuotedStyle || style == DoubleQuotedStyle || style == SingleQuotedStyle
+	}
+	if isQuoted(oldNode.Style) == isQuoted(newNode.Style) {
+		return false
+	}
+	quoted := oldNode
+	if isQuoted(newNode.Style) {
+		quoted = newNode
+	}
+	str, isString := quoted.Value.(string)
+	return !isString || isAmbiguousScalar(str)
+}
+
+// SummarizeDiff counts the differences by type
+func SummarizeDiff(diffs []DiffResult) map[DiffType]int {
+	summary := make(map[DiffType]int)
+	for _, diff := range diffs {
+		summary[diff.Type]++
+	}
+	return summary
+}
+
 // DiffNodes performs a deep comparison of two nodes and returns differences
 func DiffNodes(oldNode, newNode *Node, path string) []DiffResult {
+	return DiffNodesWithOptions(oldNode, newNode, path, DefaultDiffOptions())
+}
+
+// DiffNodesWithOptions compares two nodes like DiffNodes using the given diff options
+func DiffNodesWithOptions(oldNode, newNode *Node, path string, opts DiffOptions) []DiffResult {
 	var diffs []DiffResult
 
 	// Handle nil cases
@@ -1349,6 +3510,7 @@ func DiffNodes(oldNode, newNode *Node, path string) []DiffResult {
 			OldNode:     oldNode,
 			NewNode:     newNode,
 			Description: fmt.Sprintf("Style changed at %s", path),
+			Significant: styleChangeSignificant(oldNode, newNode),
 		})
 	}
 
@@ -1429,7 +3591,7 @@ func DiffNodes(oldNode, newNode *Node, path string) []DiffResult {
 		// Check for removed keys
 		for key, oldValue := range oldKeys {
 			if _, exists := newKeys[key]; !exists {
-				childPath := fmt.Sprintf("%s.%s", path, key)
+				childPath := path + pathKey(key)
 				diffs = append(diffs, DiffResult{
 					Type:        DiffRemoved,
 					Path:        childPath,
@@ -1442,10 +3604,10 @@ func DiffNodes(oldNode, newNode *Node, path string) []DiffResult {
 
 		// Check for added or modified keys
 		for key, newValue := range newKeys {
-			childPath := fmt.Sprintf("%s.%s", path, key)
+			childPath := path + pathKey(key)
 			if oldValue, exists := oldKeys[key]; exists {
 				// Key exists in both - check for differences
-				childDiffs := DiffNodes(oldValue, newValue, childPath)
+				childDiffs := DiffNodesWithOptions(oldValue, newValue, childPath, opts)
 				diffs = append(diffs, childDiffs...)
 			} else {
 				// New key added
@@ -1458,6 +3620,21 @@ func DiffNodes(oldNode, newNode *Node, path string) []DiffResult {
 				})
 			}
 		}
+
+		if opts.DetectKeyReorder {
+			oldOrder, newOrder := mappingKeyOrder(oldNode), mappingKeyOrder(newNode)
+			if sameKeySet(oldKeys, newKeys) && !equalStringSlices(oldOrder, newOrder) {
+				diffs = append(diffs, DiffResult{
+					Type:        DiffReordered,
+					Path:        path,
+					OldValue:    oldOrder,
+					NewValue:    newOrder,
+					OldNode:     oldNode,
+					NewNode:     newNode,
+					Description: fmt.Sprintf("Keys reordered at %s", path),
+				})
+			}
+		}
 	}
 
 	// Compare children for sequence nodes
@@ -1473,7 +3650,7 @@ func DiffNodes(oldNode, newNode *Node, path string) []DiffResult {
 		// Compare common elements
 		for i := 0; i < minLen; i++ {
 			childPath := fmt.Sprintf("%s[%d]", path, i)
-			childDiffs := DiffNodes(oldNode.Children[i], newNode.Children[i], childPath)
+			childDiffs := DiffNodesWithOptions(oldNode.Children[i], newNode.Children[i], childPath, opts)
 			diffs = append(diffs, childDiffs...)
 		}
 
@@ -1504,13 +3681,37 @@ func DiffNodes(oldNode, newNode *Node, path string) []DiffResult {
 
 	// Compare children for document nodes
 	if oldNode.Kind == DocumentNode && len(oldNode.Children) > 0 && len(newNode.Children) > 0 {
-		childDiffs := DiffNodes(oldNode.Children[0], newNode.Children[0], path)
+		childDiffs := DiffNodesWithOptions(oldNode.Children[0], newNode.Children[0], path, opts)
 		diffs = append(diffs, childDiffs...)
 	}
 
 	return diffs
 }
 
+// mappingKeyOrder returns the scalar keys of a mapping in document order
+func mappingKeyOrder(node *Node) []string {
+	keys := make([]string, 0, len(node.Children)/2)
+	for i := 0; i < len(node.Children)-1; i += 2 {
+		if key := node.Children[i]; key.Kind == ScalarNode {
+			keys = append(keys, fmt.Sprintf("%v", key.Value))
+		}
+	}
+	return keys
+}
+
+// sameKeySet reports whether two key maps contain exactly the same keys
+func sameKeySet(a, b map[string]*Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 // equalStringSlices compares two string slices for equality
 func equalStringSlices(a, b []string) bool {
 	if len(a) != len(b) {
@@ -1526,6 +3727,11 @@ func equalStringSlices(a, b []string) bool {
 
 // DiffTrees compares two NodeTrees and returns all differences
 func DiffTrees(oldTree, newTree *NodeTree) []DiffResult {
+	return DiffTreesWithOptions(oldTree, newTree, DefaultDiffOptions())
+}
+
+// DiffTreesWithOptions compares two NodeTrees like DiffTrees using the given diff options
+func DiffTreesWithOptions(oldTree, newTree *NodeTree, opts DiffOptions) []DiffResult {
 	var allDiffs []DiffResult
 
 	if oldTree == nil && newTree == nil {
@@ -1589,7 +3795,7 @@ func DiffTrees(oldTree, newTree *NodeTree) []DiffResult {
 		}
 
 		// Compare documents
-		docDiffs := DiffNodes(oldTree.Documents[i].Root, newTree.Documents[i].Root, docPath)
+		docDiffs := DiffNodesWithOptions(oldTree.Documents[i].Root, newTree.Documents[i].Root, docPath, opts)
 		allDiffs = append(allDiffs, docDiffs...)
 	}
 
@@ -1627,6 +3833,7 @@ func convertFromYAMLNode(yamlNode *yaml.Node, parent *Node, anchors map[string]*
 	node.Value = yamlNode.Value
 	node.Tag = yamlNode.Tag
 	node.Anchor = yamlNode.Anchor
+	node.Style = nodeStyleFromYAML(yamlNode.Style)
 	node.Line = yamlNode.Line
 	node.Column = yamlNode.Column
 
@@ -1661,6 +3868,11 @@ func convertFromYAMLNode(yamlNode *yaml.Node, parent *Node, anchors map[string]*
 
 // ConvertFromYAMLNode converts a yaml.Node to our Node structure
 func ConvertFromYAMLNode(yamlNode *yaml.Node) *Node {
+	return ConvertFromYAMLNodeWithOptions(yamlNode, DefaultParseOptions())
+}
+
+// ConvertFromYAMLNodeWithOptions converts a yaml.Node into a Node using the given parsing options
+func ConvertFromYAMLNodeWithOptions(yamlNode *yaml.Node, opts ParseOptions) *Node {
 	if yamlNode == nil {
 		return nil
 	}
@@ -1685,47 +3897,20 @@ func ConvertFromYAMLNode(yamlNode *yaml.Node) *Node {
 
 	// For scalar nodes, decode the value properly
 	if nodeKind == ScalarNode {
-		var value interface{}
-		if yamlNode.Tag == "!!str" || yamlNode.Tag == "" {
-			// Check if it's a boolean, number, or null
-			switch yamlNode.Value {
-			case "true":
-				value = true
-			case "false":
-				value = false
-			case "null", "~":
-				value = nil
-			default:
-				// Try to parse as integer first to preserve large numbers
-				if intVal, err := strconv.ParseInt(yamlNode.Value, 10, 64); err == nil {
-					value = intVal
-				} else if floatVal, err := strconv.ParseFloat(yamlNode.Value, 64); err == nil {
-					value = floatVal
-				} else {
-					value = yamlNode.Value
-				}
-			}
-		} else if yamlNode.Tag == "!!bool" {
-			value = yamlNode.Value == "true"
-		} else if yamlNode.Tag == "!!int" {
-			if intVal, err := strconv.ParseInt(yamlNode.Value, 10, 64); err == nil {
-				value = intVal
-			} else {
-				value = yamlNode.Value
-			}
-		} else if yamlNode.Tag == "!!float" {
-			value, _ = strconv.ParseFloat(yamlNode.Value, 64)
-		} else if yamlNode.Tag == "!!null" {
-			value = nil
-		} else {
-			value = yamlNode.Value
-		}
-		node.Value = value
+		node.Value = decodeScalarValue(yamlNode.Value, yamlNode.Tag)
+		node.RawValue = yamlNode.Value
 	} else {
 		node.Value = yamlNode.Value
 	}
 
 	node.Tag = yamlNode.Tag
+	if nodeKind == ScalarNode && opts.YAMLVersion == YAML11 && yamlNode.Tag == "!!str" &&
+		yamlNode.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+		if b, ok := yaml11Bool(yamlNode.Value); ok {
+			node.Value = b
+			node.Tag = "!!bool"
+		}
+	}
 	node.Anchor = yamlNode.Anchor
 	node.Line = yamlNode.Line
 	node.Column = yamlNode.Column
@@ -1739,31 +3924,22 @@ func ConvertFromYAMLNode(yamlNode *yaml.Node) *Node {
 	}
 
 	// Convert style
-	switch yamlNode.Style {
-	case yaml.LiteralStyle:
-		node.Style = LiteralStyle
-	case yaml.FoldedStyle:
-		node.Style = FoldedStyle
-	case yaml.SingleQuotedStyle:
-		node.Style = QuotedStyle
-	case yaml.DoubleQuotedStyle:
-		node.Style = DoubleQuotedStyle
-	case yaml.FlowStyle:
-		node.Style = FlowStyle
-	default:
-		node.Style = DefaultStyle
-	}
+	node.Style = nodeStyleFromYAML(yamlNode.Style)
 
 	// Process children
 	if nodeKind == MappingNode {
 		for i := 0; i < len(yamlNode.Content)-1; i += 2 {
 			keyYamlNode := yamlNode.Content[i]
-			key := ConvertFromYAMLNode(keyYamlNode)
+			key := ConvertFromYAMLNodeWithOptions(keyYamlNode, opts)
 			// For mapping keys, preserve the literal string value
 			if key.Kind == ScalarNode && keyYamlNode.Value == "null" {
 				key.Value = "null"
 			}
-			value := ConvertFromYAMLNode(yamlNode.Content[i+1])
+			if _, isBool := key.Value.(bool); isBool && keyYamlNode.Tag == "!!str" {
+				key.Value = keyYamlNode.Value
+				key.Tag = keyYamlNode.Tag
+			}
+			value := ConvertFromYAMLNodeWithOptions(yamlNode.Content[i+1], opts)
 			if err := node.AddKeyValue(key, value); err != nil {
 				// Log but continue processing
 				fmt.Printf("Warning: failed to add key-value: %v\n", err)
@@ -1771,7 +3947,7 @@ func ConvertFromYAMLNode(yamlNode *yaml.Node) *Node {
 		}
 	} else if nodeKind == SequenceNode || nodeKind == DocumentNode {
 		for _, child := range yamlNode.Content {
-			childNode := ConvertFromYAMLNode(child)
+			childNode := ConvertFromYAMLNodeWithOptions(child, opts)
 			node.AddChild(childNode)
 		}
 	}
@@ -1779,6 +3955,87 @@ func ConvertFromYAMLNode(yamlNode *yaml.Node) *Node {
 	return node
 }
 
+// decodeScalarValue converts raw scalar text into a Go value based on its tag
+func decodeScalarValue(raw, tag string) interface{} {
+	var value interface{}
+	if tag == "!!str" {
+		// Quoted and explicitly tagged strings stay strings
+		value = raw
+	} else if tag == "" {
+		// Check if it's a boolean, number, or null
+		switch raw {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null", "~":
+			value = nil
+		default:
+			// Try to parse as integer first to preserve large numbers
+			if intVal, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				value = intVal
+			} else if floatVal, err := strconv.ParseFloat(raw, 64); err == nil {
+				value = floatVal
+			} else {
+				value = raw
+			}
+		}
+	} else if tag == "!!bool" {
+		// An explicit tag accepts every YAML 1.1 spelling
+		value, _ = yaml11Bool(raw)
+	} else if tag == "!!int" {
+		if intVal, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			value = intVal
+		} else {
+			value = raw
+		}
+	} else if tag == "!!float" {
+		value, _ = strconv.ParseFloat(raw, 64)
+	} else if tag == "!!null" {
+		value = nil
+	} else {
+		value = raw
+	}
+	return value
+}
+
+// yaml11Bool interprets the YAML 1.1 boolean tokens yes/no, on/off and true/false
+// in lower, title or upper case
+func yaml11Bool(raw string) (bool, bool) {
+	switch raw {
+	case "true", "True", "TRUE", "yes", "Yes", "YES", "on", "On", "ON":
+		return true, true
+	case "false", "False", "FALSE", "no", "No", "NO", "off", "Off", "OFF":
+		return false, true
+	}
+	return false, false
+}
+
+// sexagesimalRegex matches YAML 1.1 base 60 numbers such as 12:30 or 1:20:30.5
+var sexagesimalRegex = regexp.MustCompile(`^[-+]?[0-9][0-9_]*(:[0-5]?[0-9])+(\.[0-9_]*)?$`)
+
+// isAmbiguousScalar reports whether a string emitted as a plain scalar could be
+// read back as a different type or value by a YAML 1.1 or 1.2 parser
+func isAmbiguousScalar(value string) bool {
+	if value == "" || strings.TrimSpace(value) != value {
+		return true
+	}
+	if (&yaml.Node{Kind: yaml.ScalarNode, Value: value}).ShortTag() != "!!str" {
+		return true
+	}
+	if _, ok := yaml11Bool(value); ok {
+		return true
+	}
+	switch value {
+	case "y", "Y", "n", "N":
+		return true
+	}
+	if sexagesimalRegex.MatchString(value) {
+		return true
+	}
+	return strings.ContainsRune("@`!&*|>%'\"#{}[],?:-", rune(value[0]))
+}
+
 // Unmarshal provides compatibility with standard yaml.Unmarshal
 // It decodes YAML data into the provided interface
 func Unmarshal(data []byte, out interface{}) error {
@@ -1818,6 +4075,29 @@ func MarshalIndent(in interface{}, indent int) ([]byte, error) {
 	return []byte(buf.String()), nil
 }
 
+// MarshalDocuments encodes each value as its own YAML document, separated by ---,
+// using the same encoder settings as Marshal
+func MarshalDocuments(values []interface{}) ([]byte, error) {
+	if len(values) == 0 {
+		return []byte{}, nil
+	}
+
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+
+	for i, value := range values {
+		if err := encoder.Encode(value); err != nil {
+			return nil, fmt.Errorf("failed to marshal document %d: %w", i, err)
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return []byte(buf.String()), nil
+}
+
 // MergeFlexible provides flexible merging between NodeTree and interface{} types
 // Following the strategy:
 // - If base is NodeTree, convert override to NodeTree if needed, merge and return NodeTree
@@ -135,6 +135,58 @@ func TestNewSequenceNodeComplete(t *testing.T) {
 	}
 }
 
+// TestNewAliasNode tests the NewAliasNode constructor and SetAnchor
+func TestNewAliasNode(t *testing.T) {
+	alias := NewAliasNode("defaults")
+	if alias.Kind != AliasNode {
+		t.Errorf("NewAliasNode() Kind = %v, want AliasNode", alias.Kind)
+	}
+	if alias.Value != "*defaults" {
+		t.Errorf("NewAliasNode() Value = %v, want *defaults", alias.Value)
+	}
+	if alias.Alias != nil {
+		t.Errorf("NewAliasNode() Alias should be unresolved")
+	}
+
+	defaults := NewMappingNode()
+	defaults.AddKeyValue(NewScalarNode("timeout"), NewScalarNode(30))
+	defaults.SetAnchor("defaults")
+	if defaults.Anchor != "defaults" {
+		t.Errorf("SetAnchor() Anchor = %v, want defaults", defaults.Anchor)
+	}
+
+	root := NewMappingNode()
+	root.AddKeyValue(NewScalarNode("base"), defaults)
+	root.AddKeyValue(NewScalarNode("copy"), alias)
+
+	tree := NewNodeTree()
+	doc := tree.AddDocument()
+	doc.SetRoot(root)
+
+	output, err := tree.ToYAML()
+	if err != nil {
+		t.Fatalf("ToYAML() error = %v", err)
+	}
+	if !strings.Contains(string(output), "base: &defaults") {
+		t.Errorf("Expected anchor in output, got:\n%s", output)
+	}
+	if !strings.Contains(string(output), "copy: *defaults") {
+		t.Errorf("Expected alias in output, got:\n%s", output)
+	}
+
+	reparsed, err := UnmarshalYAML(output)
+	if err != nil {
+		t.Fatalf("Failed to parse output: %v", err)
+	}
+	copyNode := reparsed.Documents[0].Root.Children[0].GetMapValue("copy")
+	if copyNode.Kind != AliasNode || copyNode.Alias == nil {
+		t.Fatalf("Alias should resolve after round-trip")
+	}
+	if copyNode.Alias.GetMapValue("timeout").Value != int64(30) {
+		t.Errorf("Alias should point at the anchored mapping")
+	}
+}
+
 // TestNodeAddChild tests the AddChild method
 func TestNodeAddChild(t *testing.T) {
 	parent := NewNode(DocumentNode)
@@ -211,6 +263,70 @@ func TestNodeAddKeyValue(t *testing.T) {
 	})
 }
 
+// TestNodeAddKeyValueStrict tests the AddKeyValueStrict method
+func TestNodeAddKeyValueStrict(t *testing.T) {
+	t.Run("ValidMapping", func(t *testing.T) {
+		mapping := NewMappingNode()
+		key := NewScalarNode("key")
+		value := NewScalarNode("value")
+
+		if err := mapping.AddKeyValueStrict(key, value); err != nil {
+			t.Errorf("AddKeyValueStrict() error = %v", err)
+		}
+		if len(mapping.Children) != 2 || value.Key != key {
+			t.Errorf("AddKeyValueStrict() did not add the pair")
+		}
+	})
+
+	t.Run("NilValue", func(t *testing.T) {
+		mapping := NewMappingNode()
+
+		if err := mapping.AddKeyValueStrict(NewScalarNode("key"), nil); err == nil {
+			t.Errorf("AddKeyValueStrict() with nil value should return error")
+		}
+		if err := mapping.AddKeyValue(NewScalarNode("key"), nil); err == nil {
+			t.Errorf("AddKeyValue() with nil value should return error")
+		}
+		if len(mapping.Children) != 0 {
+			t.Errorf("Nil value should not add children")
+		}
+	})
+
+	t.Run("NilKey", func(t *testing.T) {
+		mapping := NewMappingNode()
+
+		if err := mapping.AddKeyValueStrict(nil, NewScalarNode("value")); err == nil {
+			t.Errorf("AddKeyValueStrict() with nil key should return error")
+		}
+	})
+
+	t.Run("NonScalarKey", func(t *testing.T) {
+		mapping := NewMappingNode()
+		key := NewSequenceNode()
+		key.AddChild(NewScalarNode("a"))
+
+		if err := mapping.AddKeyValueStrict(key, NewScalarNode("value")); err == nil {
+			t.Errorf("AddKeyValueStrict() with sequence key should return error")
+		}
+		if len(mapping.Children) != 0 {
+			t.Errorf("Rejected key should not add children")
+		}
+
+		// The lenient variant keeps accepting it
+		if err := mapping.AddKeyValue(key, NewScalarNode("value")); err != nil {
+			t.Errorf("AddKeyValue() with sequence key error = %v", err)
+		}
+	})
+
+	t.Run("NonMappingNode", func(t *testing.T) {
+		sequence := NewSequenceNode()
+
+		if err := sequence.AddKeyValueStrict(NewScalarNode("key"), NewScalarNode("value")); err == nil {
+			t.Errorf("AddKeyValueStrict() on non-mapping should return error")
+		}
+	})
+}
+
 // TestNodeAddSequenceItem tests the AddSequenceItem method
 func TestNodeAddSequenceItem(t *testing.T) {
 	t.Run("ValidSequence", func(t *testing.T) {
@@ -350,6 +466,149 @@ func TestNodeWalk(t *testing.T) {
 	}
 }
 
+// TestNodeWalkDetailed tests the WalkDetailed method
+func TestNodeWalkDetailed(t *testing.T) {
+	root := NewMappingNode()
+	key1 := NewScalarNode("key1")
+	value1 := NewScalarNode("value1")
+	key2 := NewScalarNode("key2")
+	value2 := NewSequenceNode()
+	item1 := NewScalarNode("item1")
+	item2 := NewScalarNode("item2")
+
+	root.AddKeyValue(key1, value1)
+	root.AddKeyValue(key2, value2)
+	value2.AddSequenceItem(item1)
+	value2.AddSequenceItem(item2)
+
+	type visit struct {
+		parent, key *Node
+		index       int
+	}
+	visits := make(map[*Node]visit)
+	root.WalkDetailed(func(node, parent, key *Node, index int) bool {
+		visits[node] = visit{parent, key, index}
+		return true
+	})
+
+	if len(visits) != 7 {
+		t.Errorf("WalkDetailed() visited %v nodes, want 7", len(visits))
+	}
+
+	tests := []struct {
+		name string
+		node *Node
+		want visit
+	}{
+		{"Root", root, visit{nil, nil, -1}},
+		{"MappingKey", key1, visit{root, nil, -1}},
+		{"MappingValue", value1, visit{root, key1, -1}},
+		{"SequenceValue", value2, visit{root, key2, -1}},
+		{"FirstItem", item1, visit{value2, nil, 0}},
+		{"SecondItem", item2, visit{value2, nil, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := visits[tt.node]
+			if !ok {
+				t.Fatal("WalkDetailed() did not visit the node")
+			}
+			if got.parent != tt.want.parent {
+				t.Errorf("WalkDetailed() parent = %v, want %v", got.parent, tt.want.parent)
+			}
+			if got.key != tt.want.key {
+				t.Errorf("WalkDetailed() key = %v, want %v", got.key, tt.want.key)
+			}
+			if got.index != tt.want.index {
+				t.Errorf("WalkDetailed() index = %v, want %v", got.index, tt.want.index)
+			}
+		})
+	}
+
+	// Test early termination
+	count := 0
+	root.WalkDetailed(func(node, parent, key *Node, index int) bool {
+		count++
+		return count < 3
+	})
+	if count != 3 {
+		t.Errorf("WalkDetailed() with early termination visited %v nodes, want 3", count)
+	}
+}
+
+// countingVisitor records the nodes it visits and stops after limit nodes when limit is set
+type countingVisitor struct {
+	seen  map[*Node]int
+	order []*Node
+	limit int
+}
+
+func (v *countingVisitor) Visit(node *Node) bool {
+	v.seen[node]++
+	v.order = append(v.order, node)
+	return v.limit == 0 || len(v.order) < v.limit
+}
+
+// TestNodeAccept tests running several visitors in one traversal
+func TestNodeAccept(t *testing.T) {
+	root := NewMappingNode()
+	value := NewSequenceNode()
+	value.AddSequenceItem(NewScalarNode("item1"))
+	value.AddSequenceItem(NewScalarNode("item2"))
+	root.AddKeyValue(NewScalarNode("key1"), NewScalarNode("value1"))
+	root.AddKeyValue(NewScalarNode("key2"), value)
+
+	var walked []*Node
+	root.Walk(func(n *Node) bool {
+		walked = append(walked, n)
+		return true
+	})
+
+	t.Run("EveryNodeOnce", func(t *testing.T) {
+		first := &countingVisitor{seen: make(map[*Node]int)}
+		second := &countingVisitor{seen: make(map[*Node]int)}
+		root.Accept(first, second)
+
+		for _, visitor := range []*countingVisitor{first, second} {
+			if !reflect.DeepEqual(visitor.order, walked) {
+				t.Errorf("Accept() visited %d nodes, want the %d nodes of Walk in order", len(visitor.order), len(walked))
+			}
+			for node, count := range visitor.seen {
+				if count != 1 {
+					t.Errorf("Accept() visited %v %d times, want once", node.Value, count)
+				}
+			}
+		}
+	})
+
+	t.Run("StoppedVisitor", func(t *testing.T) {
+		stopping := &countingVisitor{seen: make(map[*Node]int), limit: 2}
+		full := &countingVisitor{seen: make(map[*Node]int)}
+		root.Accept(stopping, full)
+
+		if len(stopping.order) != 2 {
+			t.Errorf("stopped visitor saw %d nodes, want 2", len(stopping.order))
+		}
+		if len(full.order) != len(walked) {
+			t.Errorf("other visitor saw %d nodes, want %d", len(full.order), len(walked))
+		}
+	})
+
+	t.Run("AllStopped", func(t *testing.T) {
+		stopping := &countingVisitor{seen: make(map[*Node]int), limit: 3}
+		root.Accept(stopping)
+		if len(stopping.order) != 3 {
+			t.Errorf("visitor saw %d nodes, want 3", len(stopping.order))
+		}
+	})
+
+	t.Run("NoVisitors", func(t *testing.T) {
+		root.Accept()
+		var nilNode *Node
+		nilNode.Accept(&countingVisitor{seen: make(map[*Node]int)})
+	})
+}
+
 // TestNodeFind tests the Find method
 func TestNodeFind(t *testing.T) {
 	root := NewMappingNode()
@@ -394,6 +653,319 @@ func TestNodeFindAll(t *testing.T) {
 	}
 }
 
+// TestNodeFindAllPaths tests the FindAllPaths method
+func TestNodeFindAllPaths(t *testing.T) {
+	input := `users:
+  - name: Alice
+    roles:
+      - admin
+      - developer
+  - name: Bob
+    roles:
+      - user
+  - name: Charlie
+    roles:
+      - user
+      - admin
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	root := tree.Documents[0].Root
+	paths := root.FindAllPaths(func(n *Node) bool {
+		return n.Kind == ScalarNode && n.Value == "admin"
+	})
+
+	expected := []string{"$.users[0].roles[0]", "$.users[2].roles[1]"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("FindAllPaths() = %v, want %v", paths, expected)
+	}
+
+	for i, node := range root.FindAll(func(n *Node) bool {
+		return n.Kind == ScalarNode && n.Value == "admin"
+	}) {
+		if node.Path() != paths[i] {
+			t.Errorf("FindAllPaths()[%d] = %v, want Path() %v", i, paths[i], node.Path())
+		}
+	}
+
+	if paths := root.FindAllPaths(func(n *Node) bool { return false }); len(paths) != 0 {
+		t.Errorf("FindAllPaths() = %v, want no matches", paths)
+	}
+
+	// Keys get the path of their entry, not of the enclosing mapping
+	paths = root.FindAllPaths(func(n *Node) bool {
+		return n.Kind == ScalarNode && n.Value == "roles"
+	})
+	expected = []string{"$.users[0].roles", "$.users[1].roles", "$.users[2].roles"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("FindAllPaths() = %v, want %v", paths, expected)
+	}
+	for _, path := range paths {
+		if got, err := root.GetPath(path); err != nil || got.Kind != SequenceNode {
+			t.Errorf("GetPath(%q) = %v, %v, want the roles sequence", path, got, err)
+		}
+	}
+}
+
+// TestCommonAncestorPath tests finding the deepest path shared by two nodes
+func TestCommonAncestorPath(t *testing.T) {
+	input := `spec:
+  containers:
+    - name: app
+      ports: [80, 443]
+    - name: sidecar
+  replicas: 2
+status:
+  ready: true
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	root := tree.Documents[0].Root.Children[0]
+	spec := root.GetMapValue("spec")
+	containers := spec.GetMapValue("containers")
+	ports := containers.Children[0].GetMapValue("ports")
+
+	tests := []struct {
+		name string
+		a, b *Node
+		want string
+	}{
+		{"Siblings", containers.Children[0].GetMapValue("name"), ports, "$.spec.containers[0]"},
+		{"SequenceItems", ports.Children[0], ports.Children[1], "$.spec.containers[0].ports"},
+		{"DifferentItems", ports.Children[1], containers.Children[1].GetMapValue("name"), "$.spec.containers"},
+		{"DifferentSubtrees", spec.GetMapValue("replicas"), root.GetMapValue("status").GetMapValue("ready"), "$"},
+		{"Ancestor", spec, ports, "$.spec"},
+		{"SameNode", ports, ports, "$.spec.containers[0].ports"},
+		{"Nil", ports, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CommonAncestorPath(tt.a, tt.b); got != tt.want {
+				t.Errorf("CommonAncestorPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("KeyPrefixIsNotShared", func(t *testing.T) {
+		mapping := NewMappingNode()
+		app, apps := NewScalarNode(1), NewScalarNode(2)
+		mapping.AddKeyValue(NewScalarNode("app"), app)
+		mapping.AddKeyValue(NewScalarNode("apps"), apps)
+		if got := CommonAncestorPath(app, apps); got != "$" {
+			t.Errorf("CommonAncestorPath() = %q, want $", got)
+		}
+	})
+}
+
+// TestOmapConversion tests converting between !!omap sequences and mappings
+func TestOmapConversion(t *testing.T) {
+	input := `omap: !!omap
+  - Mark: 65
+  - Sammy: 63
+  - Key: 58
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	omap := tree.Documents[0].Root.Children[0].GetMapValue("omap")
+
+	mapping, err := omap.OmapToMapping()
+	if err != nil {
+		t.Fatalf("OmapToMapping() error = %v", err)
+	}
+	entries, err := mapping.AsOrderedMap()
+	if err != nil {
+		t.Fatalf("AsOrderedMap() error = %v", err)
+	}
+	wantKeys := []string{"Mark", "Sammy", "Key"}
+	wantValues := []int64{65, 63, 58}
+	if len(entries) != len(wantKeys) {
+		t.Fatalf("mapping has %d entries, want %d", len(entries), len(wantKeys))
+	}
+	for i, entry := range entries {
+		value, _ := entry.Value.AsInt()
+		if entry.Key != wantKeys[i] || value != wantValues[i] {
+			t.Errorf("entry %d = %s: %v, want %s: %d", i, entry.Key, entry.Value.Value, wantKeys[i], wantValues[i])
+		}
+	}
+	if len(omap.Children) != 3 || omap.Children[0].Kind != MappingNode {
+		t.Error("OmapToMapping() should not modify the original sequence")
+	}
+
+	back, err := mapping.MappingToOmap()
+	if err != nil {
+		t.Fatalf("MappingToOmap() error = %v", err)
+	}
+	if err := omap.ReplaceWith(back); err != nil {
+		t.Fatalf("ReplaceWith() error = %v", err)
+	}
+	output, err := tree.ToYAML()
+	if err != nil {
+		t.Fatalf("ToYAML() error = %v", err)
+	}
+	if string(output) != input {
+		t.Errorf("round trip = %q, want %q", output, input)
+	}
+
+	errorTests := []struct {
+		name  string
+		input string
+	}{
+		{"NotASequence", "a: 1\n"},
+		{"ItemNotAMapping", "- a\n"},
+		{"ItemWithTwoPairs", "- a: 1\n  b: 2\n"},
+		{"DuplicateKey", "- a: 1\n- a: 2\n"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if _, err := tree.Documents[0].Root.Children[0].OmapToMapping(); err == nil {
+				t.Error("OmapToMapping() should return an error")
+			}
+		})
+	}
+
+	if _, err := NewSequenceNode().MappingToOmap(); err == nil {
+		t.Error("MappingToOmap() on a sequence should return an error")
+	}
+}
+
+// TestSequenceContains tests type-aware membership checks on sequences
+func TestSequenceContains(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte("roles: [admin, editor, 7, 2.5, true, null]\nname: admin\nanchored: &role viewer\nalias: [*role]\nquoted:\n  - \"1\"\n  - '2.5'\n  - \"true\"\n  - !!str 3\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	root := tree.Documents[0].Root.Children[0]
+	roles := root.GetMapValue("roles")
+
+	tests := []struct {
+		name  string
+		node  *Node
+		value interface{}
+		want  bool
+	}{
+		{"PresentString", roles, "admin", true},
+		{"AbsentString", roles, "owner", false},
+		{"PresentInt", roles, 7, true},
+		{"PresentInt64", roles, int64(7), true},
+		{"IntAsFloat", roles, 7.0, true},
+		{"PresentFloat", roles, 2.5, true},
+		{"StringIsNotInt", roles, "7", false},
+		{"PresentBool", roles, true, true},
+		{"StringIsNotBool", roles, "true", false},
+		{"Null", roles, nil, true},
+		{"UnsupportedType", roles, []string{"admin"}, false},
+		{"AliasItem", root.GetMapValue("alias"), "viewer", true},
+		{"QuotedNumber", root.GetMapValue("quoted"), "1", true},
+		{"QuotedNumberIsNotInt", root.GetMapValue("quoted"), 1, false},
+		{"QuotedFloatIsNotFloat", root.GetMapValue("quoted"), 2.5, false},
+		{"QuotedBoolIsNotBool", root.GetMapValue("quoted"), true, false},
+		{"TaggedString", root.GetMapValue("quoted"), "3", true},
+		{"TaggedStringIsNotInt", root.GetMapValue("quoted"), 3, false},
+		{"NotASequence", root.GetMapValue("name"), "admin", false},
+		{"NilNode", nil, "admin", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.node.SequenceContains(tt.value); got != tt.want {
+				t.Errorf("SequenceContains(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestComplexMappingKeys tests mappings whose keys are sequences or mappings
+func TestComplexMappingKeys(t *testing.T) {
+	inputs := []struct {
+		name  string
+		input string
+	}{
+		{"Block", "? - a\n  - b\n: seq value\n? x: 1\n  y: 2\n: map value\nplain: 1\n"},
+		{"Flow", "? [a, b]\n: seq value\n? {x: 1, y: 2}\n: map value\nplain: 1\n"},
+	}
+
+	for _, tt := range inputs {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			output, err := tree.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if string(output) != tt.input {
+				t.Errorf("round trip = %q, want %q", output, tt.input)
+			}
+			if err := tree.Validate(); err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+
+			root := tree.Documents[0].Root.Children[0]
+			if plain, _ := root.GetMapValue("plain").AsInt(); plain != 1 {
+				t.Errorf("GetMapValue(plain) = %v, want 1", plain)
+			}
+			if root.GetMapValue("") != nil || root.GetMapValue("<nil>") != nil {
+				t.Error("GetMapValue should skip complex keys")
+			}
+
+			seqKey := NewSequenceNode()
+			seqKey.AddChild(NewScalarNode("a"))
+			seqKey.AddChild(NewScalarNode("b"))
+			if got := root.GetMapValueByKeyNode(seqKey); got == nil || got.Value != "seq value" {
+				t.Errorf("GetMapValueByKeyNode([a, b]) = %v, want seq value", got)
+			}
+
+			mapKey := NewMappingNode()
+			_ = mapKey.AddKeyValue(NewScalarNode("x"), NewScalarNode(1))
+			_ = mapKey.AddKeyValue(NewScalarNode("y"), NewScalarNode(2))
+			if got := root.GetMapValueByKeyNode(mapKey); got == nil || got.Value != "map value" {
+				t.Errorf("GetMapValueByKeyNode({x: 1, y: 2}) = %v, want map value", got)
+			}
+
+			otherKey := NewSequenceNode()
+			otherKey.AddChild(NewScalarNode("b"))
+			otherKey.AddChild(NewScalarNode("a"))
+			if got := root.GetMapValueByKeyNode(otherKey); got != nil {
+				t.Errorf("GetMapValueByKeyNode([b, a]) = %v, want nil", got.Value)
+			}
+			if got := root.GetMapValueByKeyNode(NewScalarNode("plain")); got == nil {
+				t.Error("GetMapValueByKeyNode should also find scalar keys")
+			}
+
+			converted, ok := nodeToInterface(root).(map[string]interface{})
+			if !ok || len(converted) != 3 || converted["[a, b]"] != "seq value" || converted["{x: 1, y: 2}"] != "map value" {
+				t.Errorf("nodeToInterface() = %v, want three distinct keys", converted)
+			}
+		})
+	}
+
+	t.Run("Merge", func(t *testing.T) {
+		base, _ := UnmarshalYAML([]byte("? [a, b]\n: old\nplain: 1\n"))
+		overlay, _ := UnmarshalYAML([]byte("? [a, b]\n: new\n? [c]\n: added\n"))
+		merged := MergeTrees(base, overlay)
+		output, err := merged.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		if want := "? [a, b]\n: new\nplain: 1\n? [c]\n: added\n"; string(output) != want {
+			t.Errorf("merged = %q, want %q", output, want)
+		}
+	})
+}
+
 // TestNodePathComplete tests the Path method
 func TestNodePathComplete(t *testing.T) {
 	tests := []struct {
@@ -455,6 +1027,189 @@ func TestNodePathComplete(t *testing.T) {
 	}
 }
 
+// TestNodeGetPath tests resolving the paths written by Path
+func TestNodeGetPath(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte(`app:
+  name: demo
+  "key with spaces": 1
+  "a.b": 2
+  "x/y": 3
+  "[0]": 4
+  "": 5
+  'say "hi"': 6
+  "tab	key": 7
+  ports:
+    - 80
+    - name: "web.ui"
+      "path/to": /
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	root := tree.Documents[0].Root
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		count := 0
+		root.Walk(func(node *Node) bool {
+			if node.Parent == nil || node.Parent.Kind == DocumentNode {
+				return true
+			}
+			if node.Parent.Kind == MappingNode && node.Key == nil {
+				return true // keys share the path of their value
+			}
+			count++
+			path := node.Path()
+			got, err := root.GetPath(path)
+			if err != nil {
+				t.Errorf("GetPath(%q) error = %v", path, err)
+			} else if got != node {
+				t.Errorf("GetPath(%q) resolved %v, want %v", path, got, node.Value)
+			}
+			return true
+		})
+		if count != 14 {
+			t.Errorf("checked %d nodes, want 14", count)
+		}
+	})
+
+	app := root.Children[0].GetMapValue("app")
+	tests := []struct {
+		path string
+		want *Node
+	}{
+		{`$.app.name`, app.GetMapValue("name")},
+		{`$.app["key with spaces"]`, app.GetMapValue("key with spaces")},
+		{`$.app.["key with spaces"]`, app.GetMapValue("key with spaces")},
+		{`$.app["a.b"]`, app.GetMapValue("a.b")},
+		{`$.app["x/y"]`, app.GetMapValue("x/y")},
+		{`$.app["[0]"]`, app.GetMapValue("[0]")},
+		{`$.app[""]`, app.GetMapValue("")},
+		{`$.app["say \"hi\""]`, app.GetMapValue(`say "hi"`)},
+		{`$.app["tab\tkey"]`, app.GetMapValue("tab\tkey")},
+		{`$.app.ports[1]["path/to"]`, app.GetMapValue("ports").Children[1].GetMapValue("path/to")},
+		{`app.ports[0]`, app.GetMapValue("ports").Children[0]},
+		{`$`, root.Children[0]},
+		{`$.app.missing`, nil},
+		{`$.app.ports[5]`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := root.GetPath(tt.path)
+			if err != nil {
+				t.Fatalf("GetPath() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("PathQuoting", func(t *testing.T) {
+		want := map[string]string{
+			"name":            `$.app.name`,
+			"key with spaces": `$.app["key with spaces"]`,
+			"a.b":             `$.app["a.b"]`,
+			"":                `$.app[""]`,
+		}
+		for key, path := range want {
+			if got := app.GetMapValue(key).Path(); got != path {
+				t.Errorf("Path() of %q = %s, want %s", key, got, path)
+			}
+		}
+	})
+
+	t.Run("CommonAncestorPath", func(t *testing.T) {
+		a := app.GetMapValue("a.b")
+		b := app.GetMapValue("x/y")
+		if got := CommonAncestorPath(a, b); got != "$.app" {
+			t.Errorf("CommonAncestorPath() = %q, want $.app", got)
+		}
+	})
+
+	for _, path := range []string{`$.app["unterminated`, `$.app["key"`, `$.app.ports[1`, `$.app.ports[x]`} {
+		t.Run("Invalid"+path, func(t *testing.T) {
+			if _, err := root.GetPath(path); err == nil {
+				t.Errorf("GetPath(%q) should return an error", path)
+			}
+		})
+	}
+}
+
+// TestNodeTreeGetPath tests resolving paths that name a document of the tree
+func TestNodeTreeGetPath(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte("name: first\n---\nitems:\n  - \"a.b\": 1\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	second := tree.Documents[1].Root.Children[0]
+
+	tests := []struct {
+		path string
+		want *Node
+	}{
+		{`$.name`, tree.Documents[0].Root.Children[0].GetMapValue("name")},
+		{`$[document:1].items[0]["a.b"]`, second.GetMapValue("items").Children[0].GetMapValue("a.b")},
+		{`$[document:1]`, second},
+		{`$[document:2].name`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := tree.GetPath(tt.path)
+			if err != nil {
+				t.Fatalf("GetPath() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("DiffTreesPaths", func(t *testing.T) {
+		oldTree, _ := UnmarshalYAML([]byte("labels:\n  app.kubernetes.io/name: a\n  \"team name\": x\n"))
+		newTree, _ := UnmarshalYAML([]byte("labels:\n  app.kubernetes.io/name: b\n  \"team name\": y\n  new/key: z\n"))
+		diffs := DiffTrees(oldTree, newTree)
+		if len(diffs) != 3 {
+			t.Fatalf("DiffTrees() = %v, want 3 differences", diffs)
+		}
+		for _, diff := range diffs {
+			got, err := newTree.GetPath(diff.Path)
+			if err != nil {
+				t.Fatalf("GetPath(%q) error = %v", diff.Path, err)
+			}
+			if got != diff.NewNode {
+				t.Errorf("GetPath(%q) = %v, want %v", diff.Path, got, diff.NewNode)
+			}
+		}
+	})
+
+	t.Run("MergePlanPaths", func(t *testing.T) {
+		base, _ := UnmarshalYAML([]byte("labels:\n  app.kubernetes.io/name: a\n"))
+		overlay, _ := UnmarshalYAML([]byte("labels:\n  app.kubernetes.io/name: b\n  \"team name\": x\n"))
+		merged := MergeTrees(base, overlay)
+		changes := MergePlan(base, overlay)
+		if len(changes) != 2 {
+			t.Fatalf("MergePlan() = %v, want 2 changes", changes)
+		}
+		for _, change := range changes {
+			got, err := merged.GetPath(change.Path)
+			if err != nil {
+				t.Fatalf("GetPath(%q) error = %v", change.Path, err)
+			}
+			if got == nil || !reflect.DeepEqual(got.Value, change.NewValue) {
+				t.Errorf("GetPath(%q) = %v, want %v", change.Path, got, change.NewValue)
+			}
+		}
+	})
+
+	for _, path := range []string{`$[document:1`, `$[document:x].name`, `$[document:-1]`, `$[document:0].items[`} {
+		t.Run("Invalid"+path, func(t *testing.T) {
+			if _, err := tree.GetPath(path); err == nil {
+				t.Errorf("GetPath(%q) should return an error", path)
+			}
+		})
+	}
+}
+
 // TestNodeClone tests the Clone method
 func TestNodeClone(t *testing.T) {
 	t.Run("SimpleNode", func(t *testing.T) {
@@ -607,6 +1362,260 @@ func TestNodeIsNull(t *testing.T) {
 	}
 }
 
+// TestNodeKeyName tests reading the key a value is stored under
+func TestNodeKeyName(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte("name: demo\n8080: http\nports:\n  - 80\n? [a, b]\n: complex\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	root := tree.Documents[0].Root
+	content := root.Children[0]
+
+	tests := []struct {
+		name     string
+		node     *Node
+		wantName string
+		wantOK   bool
+	}{
+		{"MappingValue", content.GetMapValue("name"), "name", true},
+		{"IntegerKey", content.GetMapValue("8080"), "8080", true},
+		{"SequenceValue", content.GetMapValue("ports"), "ports", true},
+		{"SequenceItem", content.GetMapValue("ports").Children[0], "", false},
+		{"ComplexKey", content.Children[7], "", false},
+		{"DocumentContent", content, "", false},
+		{"Detached", NewScalarNode("x"), "", false},
+		{"Nil", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, ok := tt.node.KeyName()
+			if name != tt.wantName || ok != tt.wantOK {
+				t.Errorf("KeyName() = %q, %v, want %q, %v", name, ok, tt.wantName, tt.wantOK)
+			}
+		})
+	}
+}
+
+// TestNodeIsEmpty tests the IsEmpty method
+func TestNodeIsEmpty(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte("tilde: ~\nblank:\nquoted: \"\"\nspaces: \"  \\t\"\nmap: {}\nlist: []\nzero: 0\nno: false\nname: x\nempty: &e []\nref: *e\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	root := tree.Documents[0].Root.Children[0]
+
+	tests := []struct {
+		name string
+		node *Node
+		want bool
+	}{
+		{"NilNode", nil, true},
+		{"NullKindNode", NewNode(NullNode), true},
+		{"ScalarNilValue", &Node{Kind: ScalarNode, Value: nil}, true},
+		{"ParsedTilde", root.GetMapValue("tilde"), true},
+		{"ParsedBlank", root.GetMapValue("blank"), true},
+		{"EmptyString", root.GetMapValue("quoted"), true},
+		{"WhitespaceString", root.GetMapValue("spaces"), true},
+		{"EmptyMapping", root.GetMapValue("map"), true},
+		{"EmptySequence", root.GetMapValue("list"), true},
+		{"AliasToEmpty", root.GetMapValue("ref"), true},
+		{"EmptyDocument", NewNode(DocumentNode), true},
+		{"Zero", root.GetMapValue("zero"), false},
+		{"False", root.GetMapValue("no"), false},
+		{"String", root.GetMapValue("name"), false},
+		{"Mapping", root, false},
+		{"Document", tree.Documents[0].Root, false},
+		{"SequenceWithEmptyItem", &Node{Kind: SequenceNode, Children: []*Node{NewScalarNode("")}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.node.IsEmpty(); got != tt.want {
+				t.Errorf("IsEmpty() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNodeValueTypeHistogram tests counting scalar values by type
+func TestNodeValueTypeHistogram(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte(`name: demo
+version: v1.2
+replicas: 3
+ratio: 0.5
+enabled: true
+debug: false
+owner: null
+empty:
+ports: [80, 443]
+servers:
+  - host: a.example.com
+    weight: 1.5
+  - host: b.example.com
+base: &base
+  timeout: 30
+copy: *base
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		node *Node
+		want map[string]int
+	}{
+		{
+			name: "Document",
+			node: tree.Documents[0].Root,
+			want: map[string]int{"string": 4, "integer": 4, "number": 2, "boolean": 2, "null": 2},
+		},
+		{
+			name: "Subtree",
+			node: tree.Documents[0].Root.Children[0].GetMapValue("servers"),
+			want: map[string]int{"string": 2, "number": 1},
+		},
+		{
+			name: "Scalar",
+			node: NewScalarNode("x"),
+			want: map[string]int{"string": 1},
+		},
+		{
+			name: "Nil",
+			want: map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.node.ValueTypeHistogram()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValueTypeHistogram() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNodeTypedAccessors tests the AsString, AsInt, AsFloat and AsBool methods
+func TestNodeTypedAccessors(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte("name: app\nport: 8080\nratio: 0.5\nenabled: true\nbase: &b 42\nref: *b\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	root := tree.Documents[0].Root.Children[0]
+
+	t.Run("AsString", func(t *testing.T) {
+		if got, ok := root.GetMapValue("name").AsString(); !ok || got != "app" {
+			t.Errorf("AsString() = %q, %v, want app, true", got, ok)
+		}
+		if got, ok := root.GetMapValue("port").AsString(); ok || got != "" {
+			t.Errorf("AsString() on int = %q, %v, want \"\", false", got, ok)
+		}
+	})
+
+	t.Run("AsInt", func(t *testing.T) {
+		if got, ok := root.GetMapValue("port").AsInt(); !ok || got != 8080 {
+			t.Errorf("AsInt() = %v, %v, want 8080, true", got, ok)
+		}
+		if got, ok := NewScalarNode(7).AsInt(); !ok || got != 7 {
+			t.Errorf("AsInt() on int = %v, %v, want 7, true", got, ok)
+		}
+		if got, ok := root.GetMapValue("ratio").AsInt(); ok || got != 0 {
+			t.Errorf("AsInt() on float = %v, %v, want 0, false", got, ok)
+		}
+	})
+
+	t.Run("AsFloat", func(t *testing.T) {
+		if got, ok := root.GetMapValue("ratio").AsFloat(); !ok || got != 0.5 {
+			t.Errorf("AsFloat() = %v, %v, want 0.5, true", got, ok)
+		}
+		if got, ok := root.GetMapValue("port").AsFloat(); !ok || got != 8080 {
+			t.Errorf("AsFloat() on int = %v, %v, want 8080, true", got, ok)
+		}
+		if got, ok := root.GetMapValue("name").AsFloat(); ok || got != 0 {
+			t.Errorf("AsFloat() on string = %v, %v, want 0, false", got, ok)
+		}
+	})
+
+	t.Run("AsBool", func(t *testing.T) {
+		if got, ok := root.GetMapValue("enabled").AsBool(); !ok || !got {
+			t.Errorf("AsBool() = %v, %v, want true, true", got, ok)
+		}
+		if got, ok := root.GetMapValue("name").AsBool(); ok || got {
+			t.Errorf("AsBool() on string = %v, %v, want false, false", got, ok)
+		}
+	})
+
+	t.Run("FollowsAliases", func(t *testing.T) {
+		if got, ok := root.GetMapValue("ref").AsInt(); !ok || got != 42 {
+			t.Errorf("AsInt() on alias = %v, %v, want 42, true", got, ok)
+		}
+	})
+
+	t.Run("NonScalar", func(t *testing.T) {
+		var nilNode *Node
+		for name, node := range map[string]*Node{"Mapping": root, "Sequence": NewSequenceNode(), "Nil": nilNode} {
+			if _, ok := node.AsString(); ok {
+				t.Errorf("AsString() on %s should fail", name)
+			}
+			if _, ok := node.AsInt(); ok {
+				t.Errorf("AsInt() on %s should fail", name)
+			}
+			if _, ok := node.AsFloat(); ok {
+				t.Errorf("AsFloat() on %s should fail", name)
+			}
+			if _, ok := node.AsBool(); ok {
+				t.Errorf("AsBool() on %s should fail", name)
+			}
+		}
+	})
+}
+
+// TestNodeAsOrderedMap tests the AsOrderedMap method
+func TestNodeAsOrderedMap(t *testing.T) {
+	t.Run("CleanMapping", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("zeta: 1\nalpha: 2\nmid: 3\n"))
+		entries, err := tree.Documents[0].Root.Children[0].AsOrderedMap()
+		if err != nil {
+			t.Fatalf("AsOrderedMap() error = %v", err)
+		}
+
+		wantKeys := []string{"zeta", "alpha", "mid"}
+		if len(entries) != len(wantKeys) {
+			t.Fatalf("AsOrderedMap() returned %d entries, want %d", len(entries), len(wantKeys))
+		}
+		for i, want := range wantKeys {
+			if entries[i].Key != want {
+				t.Errorf("AsOrderedMap()[%d].Key = %v, want %v", i, entries[i].Key, want)
+			}
+			if entries[i].Value.Value != int64(i+1) {
+				t.Errorf("AsOrderedMap()[%d].Value = %v, want %d", i, entries[i].Value.Value, i+1)
+			}
+		}
+	})
+
+	t.Run("DuplicateKeys", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte("name: first\nport: 80\nname: second\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		_, err = tree.Documents[0].Root.Children[0].AsOrderedMap()
+		if err == nil {
+			t.Fatal("AsOrderedMap() should reject duplicate keys")
+		}
+		if !strings.Contains(err.Error(), `"name"`) || !strings.Contains(err.Error(), "line 3") {
+			t.Errorf("AsOrderedMap() error = %v, want key name and line", err)
+		}
+	})
+
+	t.Run("NotAMapping", func(t *testing.T) {
+		if _, err := NewSequenceNode().AsOrderedMap(); err == nil {
+			t.Error("AsOrderedMap() should fail on a sequence")
+		}
+	})
+}
+
 // TestNodeRemoveComplete tests the Remove method
 func TestNodeRemoveComplete(t *testing.T) {
 	t.Run("RemoveFromMapping", func(t *testing.T) {
@@ -1812,6 +2821,52 @@ func TestMarshalIndent(t *testing.T) {
 	}
 }
 
+// TestMarshalDocuments tests the MarshalDocuments function
+func TestMarshalDocuments(t *testing.T) {
+	type Service struct {
+		Name string `yaml:"name"`
+		Port int    `yaml:"port"`
+	}
+
+	values := []interface{}{
+		Service{Name: "web", Port: 80},
+		Service{Name: "api", Port: 8080},
+		Service{Name: "db", Port: 5432},
+	}
+
+	result, err := MarshalDocuments(values)
+	if err != nil {
+		t.Fatalf("MarshalDocuments() error = %v", err)
+	}
+	if strings.Count(string(result), "---\n") != 2 {
+		t.Errorf("MarshalDocuments() = %q, want 2 separators", result)
+	}
+
+	tree, err := UnmarshalYAML(result)
+	if err != nil {
+		t.Fatalf("Failed to parse MarshalDocuments() output: %v", err)
+	}
+	if len(tree.Documents) != 3 {
+		t.Fatalf("MarshalDocuments() produced %d documents, want 3", len(tree.Documents))
+	}
+	for i, want := range values {
+		root := tree.Documents[i].Root.Children[0]
+		if got := root.GetMapValue("name").Value; got != want.(Service).Name {
+			t.Errorf("document %d name = %v, want %v", i, got, want.(Service).Name)
+		}
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		result, err := MarshalDocuments(nil)
+		if err != nil {
+			t.Errorf("MarshalDocuments(nil) error = %v", err)
+		}
+		if len(result) != 0 {
+			t.Errorf("MarshalDocuments(nil) = %q, want empty", result)
+		}
+	})
+}
+
 // TestAddEmptyLinesBeforeSchemaComments tests the addEmptyLinesBeforeSchemaComments function
 func TestAddEmptyLinesBeforeSchemaComments(t *testing.T) {
 	tests := []struct {
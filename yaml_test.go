@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 
@@ -45,6 +46,13 @@ development:
 	emptyYAML = `# Just comments
 # No actual content`
 
+	headersOnlyYAML = `# yaml-language-server: $schema=values.schema.json
+# Default values for base-chart.
+# This is a YAML-formatted file.
+
+# Declare variables to be passed into your templates.
+`
+
 	invalidYAML = `
 invalid: [
   unclosed array
@@ -1038,6 +1046,2907 @@ parent:
 	}
 }
 
+func TestRawValuePreservation(t *testing.T) {
+	input := `zip: "007"
+ratio: 1.50
+mask: 0x1F
+count: 42
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	root := tree.Documents[0].Root.Children[0]
+	zip := root.GetMapValue("zip")
+	if zip.RawValue != "007" {
+		t.Errorf("RawValue = %q, want %q", zip.RawValue, "007")
+	}
+	if mask := root.GetMapValue("mask"); mask.RawValue != "0x1F" {
+		t.Errorf("RawValue = %q, want %q", mask.RawValue, "0x1F")
+	}
+
+	t.Run("default options drop raw text", func(t *testing.T) {
+		output, err := tree.ToYAML()
+		if err != nil {
+			t.Fatalf("Failed to serialize: %v", err)
+		}
+		if !strings.Contains(string(output), "ratio: 1.5\n") {
+			t.Errorf("Default encoding should emit the parsed value, got:\n%s", output)
+		}
+		if !strings.Contains(string(output), `zip: "007"`) {
+			t.Errorf("Quoted strings should stay strings, got:\n%s", output)
+		}
+	})
+
+	t.Run("raw values survive round-trip", func(t *testing.T) {
+		tree.EncodeOptions = RawEncodeOptions()
+		output, err := tree.ToYAML()
+		if err != nil {
+			t.Fatalf("Failed to serialize: %v", err)
+		}
+		if !strings.Contains(string(output), `zip: "007"`) {
+			t.Errorf("Expected quoted zip code to survive, got:\n%s", output)
+		}
+		if !strings.Contains(string(output), "mask: 0x1F") {
+			t.Errorf("Expected hex literal to survive, got:\n%s", output)
+		}
+		if !strings.Contains(string(output), "count: 42") {
+			t.Errorf("Expected plain integer to survive, got:\n%s", output)
+		}
+	})
+
+	t.Run("modified values ignore stale raw text", func(t *testing.T) {
+		modified, _ := UnmarshalYAML([]byte(input))
+		modified.Documents[0].Root.Children[0].GetMapValue("zip").Value = "008"
+		modified.EncodeOptions = RawEncodeOptions()
+		output, err := modified.ToYAML()
+		if err != nil {
+			t.Fatalf("Failed to serialize: %v", err)
+		}
+		if !strings.Contains(string(output), `zip: "008"`) {
+			t.Errorf("Expected modified value to be emitted, got:\n%s", output)
+		}
+	})
+}
+
+func TestMergeAll(t *testing.T) {
+	base, _ := UnmarshalYAML([]byte(`replicas: 1
+region: none
+image: app:1.0
+`))
+	region, _ := UnmarshalYAML([]byte(`replicas: 2
+region: eu-west-1
+`))
+	env, _ := UnmarshalYAML([]byte(`replicas: 3
+`))
+
+	result := MergeAll(base, nil, region, env)
+	if result == nil {
+		t.Fatal("MergeAll should return a tree")
+	}
+
+	root := result.Documents[0].Root.Children[0]
+	if v := root.GetMapValue("replicas").Value; v != int64(3) {
+		t.Errorf("replicas = %v, want 3 from the last tree", v)
+	}
+	if v := root.GetMapValue("region").Value; v != "eu-west-1" {
+		t.Errorf("region = %v, want eu-west-1 from the region tree", v)
+	}
+	if v := root.GetMapValue("image").Value; v != "app:1.0" {
+		t.Errorf("image = %v, want app:1.0 from the base tree", v)
+	}
+
+	if MergeAll() != nil {
+		t.Error("MergeAll with no trees should return nil")
+	}
+	if MergeAll(nil, nil) != nil {
+		t.Error("MergeAll with only nil trees should return nil")
+	}
+	if MergeAll(base) != base {
+		t.Error("MergeAll with a single tree should return that tree")
+	}
+}
+
+func TestMergeNodesWithResolver(t *testing.T) {
+	baseTree, _ := UnmarshalYAML([]byte(`app:
+  replicas: 1
+  image: app:1.0
+  debug: false
+`))
+	overlayTree, _ := UnmarshalYAML([]byte(`app:
+  replicas: 3
+  image: app:2.0
+  region: eu
+`))
+	base := baseTree.Documents[0].Root.Children[0]
+	overlay := overlayTree.Documents[0].Root.Children[0]
+
+	value := func(merged *Node, key string) interface{} {
+		return merged.GetMapValue("app").GetMapValue(key).Value
+	}
+
+	t.Run("always pick base", func(t *testing.T) {
+		var paths []string
+		merged := MergeNodesWithResolver(base, overlay, func(path string, b, o *Node) *Node {
+			paths = append(paths, path)
+			return b
+		})
+		if value(merged, "replicas") != int64(1) || value(merged, "image") != "app:1.0" {
+			t.Errorf("Base values should win, got replicas=%v image=%v", value(merged, "replicas"), value(merged, "image"))
+		}
+		if value(merged, "region") != "eu" {
+			t.Error("Non-conflicting overlay keys should still be added")
+		}
+		if !equalStringSlices(paths, []string{"$.app.replicas", "$.app.image"}) {
+			t.Errorf("Resolver called for %v, want only the conflicting leaves", paths)
+		}
+	})
+
+	t.Run("always pick overlay", func(t *testing.T) {
+		merged := MergeNodesWithResolver(base, overlay, func(path string, b, o *Node) *Node {
+			return o
+		})
+		if value(merged, "replicas") != int64(3) || value(merged, "image") != "app:2.0" {
+			t.Error("Overlay values should win")
+		}
+		if value(merged, "debug") != false {
+			t.Error("Base-only keys should be kept")
+		}
+	})
+
+	t.Run("pick by path", func(t *testing.T) {
+		merged := MergeNodesWithResolver(base, overlay, func(path string, b, o *Node) *Node {
+			if path == "$.app.image" {
+				return b
+			}
+			return o
+		})
+		if value(merged, "replicas") != int64(3) {
+			t.Errorf("replicas = %v, want overlay value", value(merged, "replicas"))
+		}
+		if value(merged, "image") != "app:1.0" {
+			t.Errorf("image = %v, want base value", value(merged, "image"))
+		}
+	})
+
+	t.Run("nil resolver matches MergeNodes", func(t *testing.T) {
+		merged := MergeNodesWithResolver(base, overlay, nil)
+		expected := MergeNodes(base, overlay)
+		if diffs := DiffNodes(expected, merged, "$"); len(diffs) != 0 {
+			t.Errorf("nil resolver should behave like MergeNodes, got diffs: %v", diffs)
+		}
+	})
+
+	t.Run("inputs are not modified", func(t *testing.T) {
+		MergeNodesWithResolver(base, overlay, func(path string, b, o *Node) *Node { return o })
+		if base.GetMapValue("app").GetMapValue("replicas").Value != int64(1) {
+			t.Error("Base node should not be modified")
+		}
+	})
+}
+
+// TestFlowStyleRoundTrip tests that flow collections stay inline after parse and serialize
+func TestFlowStyleRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		want   []string
+		reject []string
+	}{
+		{
+			name:   "FlowSequence",
+			input:  "flow_sequence: [item1, item2]\n",
+			want:   []string{"flow_sequence: [item1, item2]"},
+			reject: []string{"- item1"},
+		},
+		{
+			name:   "FlowMapping",
+			input:  "flow_mapping: {key1: value1}\n",
+			want:   []string{"flow_mapping: {key1: value1}"},
+			reject: []string{"  key1: value1"},
+		},
+		{
+			name:   "NestedFlowInBlock",
+			input:  "outer:\n  inner: [1, 2, 3]\n",
+			want:   []string{"inner: [1, 2, 3]"},
+			reject: []string{"- 1"},
+		},
+		{
+			name:   "TaggedFlowSequence",
+			input:  "tagged: !custom [x, y]\n",
+			want:   []string{"tagged: !custom [x, y]"},
+			reject: []string{"- x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+
+			// Serialize twice to make sure the style survives a full round trip
+			output, err := tree.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			reparsed, err := UnmarshalYAML(output)
+			if err != nil {
+				t.Fatalf("Failed to re-parse output: %v", err)
+			}
+			output, err = reparsed.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+
+			result := string(output)
+			for _, want := range tt.want {
+				if !strings.Contains(result, want) {
+					t.Errorf("ToYAML() = %q, want it to contain %q", result, want)
+				}
+			}
+			for _, reject := range tt.reject {
+				if strings.Contains(result, reject) {
+					t.Errorf("ToYAML() = %q, flow collection was expanded to block style", result)
+				}
+			}
+		})
+	}
+
+	t.Run("StyleRecorded", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("seq: !custom [a]\nmap: {k: v}\n"))
+		root := tree.Documents[0].Root.Children[0]
+		if style := root.GetMapValue("seq").Style; style != FlowStyle {
+			t.Errorf("Tagged sequence Style = %v, want FlowStyle", style)
+		}
+		if style := root.GetMapValue("map").Style; style != FlowStyle {
+			t.Errorf("Mapping Style = %v, want FlowStyle", style)
+		}
+	})
+}
+
+// TestStripComments tests removing all comments from a tree
+func TestStripComments(t *testing.T) {
+	t.Run("ComplexDocument", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte(complexYAML))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+
+		tree.StripComments()
+
+		output, err := tree.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		if strings.Contains(string(output), "#") {
+			t.Errorf("StripComments() output still contains comments:\n%s", output)
+		}
+
+		reparsed, err := UnmarshalYAML(output)
+		if err != nil {
+			t.Fatalf("Failed to re-parse output: %v", err)
+		}
+		port := reparsed.Documents[0].Root.Children[0].GetMapValue("app").GetMapValue("settings").GetMapValue("port")
+		if port == nil || port.Value != int64(8080) {
+			t.Errorf("StripComments() should keep values, got port = %v", port)
+		}
+	})
+
+	t.Run("DropsCommentOnlyDocuments", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte("doc: 1 # one\n---\n" + emptyYAML + "\n---\ndoc: 2\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if len(tree.Documents) != 3 {
+			t.Fatalf("expected 3 documents before stripping, got %d", len(tree.Documents))
+		}
+
+		tree.StripComments()
+
+		if len(tree.Documents) != 2 {
+			t.Fatalf("StripComments() left %d documents, want 2", len(tree.Documents))
+		}
+		if tree.Current != tree.Documents[1] {
+			t.Error("StripComments() should keep Current pointing at a remaining document")
+		}
+		if tree.Documents[0].Root.Children[0].Children[1].LineComment != "" {
+			t.Error("StripComments() should clear line comments")
+		}
+	})
+
+	t.Run("NodeLevel", func(t *testing.T) {
+		node := NewScalarNode("value")
+		node.HeadComment = []string{"# head"}
+		node.LineComment = "# line"
+		node.FootComment = []string{"# foot"}
+
+		node.StripComments()
+
+		if node.HeadComment != nil || node.LineComment != "" || node.FootComment != nil {
+			t.Errorf("Node.StripComments() left comments: %q %q %q", node.HeadComment, node.LineComment, node.FootComment)
+		}
+	})
+}
+
+// TestSummarizeDiff tests counting differences by type
+func TestSummarizeDiff(t *testing.T) {
+	oldTree, _ := UnmarshalYAML([]byte(`name: test
+value: 123
+removed: x
+list: [a]
+`))
+	newTree, _ := UnmarshalYAML([]byte(`name: test
+value: 456 # changed
+list:
+  - a
+  - b
+added: y
+`))
+
+	diffs := DiffTrees(oldTree, newTree)
+	summary := SummarizeDiff(diffs)
+
+	want := map[DiffType]int{
+		DiffModified:       1,
+		DiffRemoved:        1,
+		DiffAdded:          2,
+		DiffCommentChanged: 1,
+		DiffStyleChanged:   1,
+	}
+	if len(summary) != len(want) {
+		t.Errorf("SummarizeDiff() = %v, want %v", summary, want)
+	}
+	for diffType, count := range want {
+		if summary[diffType] != count {
+			t.Errorf("SummarizeDiff()[%v] = %d, want %d", diffType, summary[diffType], count)
+		}
+	}
+
+	if len(SummarizeDiff(nil)) != 0 {
+		t.Error("SummarizeDiff(nil) should be empty")
+	}
+}
+
+// TestDiffResultIsMeaningful tests filtering out comment and style only changes
+func TestDiffResultIsMeaningful(t *testing.T) {
+	tests := []struct {
+		diffType DiffType
+		want     bool
+	}{
+		{DiffNone, false},
+		{DiffAdded, true},
+		{DiffRemoved, true},
+		{DiffModified, true},
+		{DiffCommentChanged, false},
+		{DiffStyleChanged, false},
+		{DiffReordered, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.diffType.String(), func(t *testing.T) {
+			if got := (DiffResult{Type: tt.diffType}).IsMeaningful(); got != tt.want {
+				t.Errorf("IsMeaningful() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("CommentOnlyEdit", func(t *testing.T) {
+		oldTree, _ := UnmarshalYAML([]byte("key: value\n"))
+		newTree, _ := UnmarshalYAML([]byte("# documented\nkey: 'value' # note\n"))
+
+		diffs := DiffTrees(oldTree, newTree)
+		if len(diffs) == 0 {
+			t.Fatal("DiffTrees() should report the comment and style changes")
+		}
+		for _, diff := range diffs {
+			if diff.IsMeaningful() {
+				t.Errorf("Diff %v at %s should not be meaningful", diff.Type, diff.Path)
+			}
+		}
+	})
+}
+
+// TestDiffStyleSignificance tests classifying style changes that can alter parsed content
+func TestDiffStyleSignificance(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldYAML string
+		newYAML string
+		want    bool
+	}{
+		{"DoubleQuotesAdded", "key: value\n", "key: \"value\"\n", false},
+		{"SingleToDoubleQuotes", "key: 'value'\n", "key: \"value\"\n", false},
+		{"LiteralToFolded", "key: |\n  line one\n  line two\n", "key: >\n  line one\n  line two\n", true},
+		{"FoldedToLiteral", "key: >-\n  text\n", "key: |-\n  text\n", true},
+		{"PlainToLiteral", "key: text\n", "key: |-\n  text\n", true},
+		{"QuotesAroundBooleanWord", "key: 'yes'\n", "key: yes\n", true},
+		{"QuotesAroundNumber", "key: \"8080\"\n", "key: 8080\n", true},
+		{"FlowToBlockSequence", "key: [a, b]\n", "key:\n  - a\n  - b\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldTree, err := UnmarshalYAML([]byte(tt.oldYAML))
+			if err != nil {
+				t.Fatalf("Failed to parse old: %v", err)
+			}
+			newTree, err := UnmarshalYAML([]byte(tt.newYAML))
+			if err != nil {
+				t.Fatalf("Failed to parse new: %v", err)
+			}
+
+			var styleDiffs []DiffResult
+			for _, diff := range DiffTrees(oldTree, newTree) {
+				if diff.Type == DiffStyleChanged {
+					styleDiffs = append(styleDiffs, diff)
+				}
+			}
+			if len(styleDiffs) != 1 {
+				t.Fatalf("DiffTrees() reported %d style changes, want 1", len(styleDiffs))
+			}
+			if styleDiffs[0].Significant != tt.want {
+				t.Errorf("Significant = %v, want %v", styleDiffs[0].Significant, tt.want)
+			}
+			if styleDiffs[0].IsMeaningful() != tt.want {
+				t.Errorf("IsMeaningful() = %v, want %v", styleDiffs[0].IsMeaningful(), tt.want)
+			}
+		})
+	}
+}
+
+// TestYAMLVersionBooleans tests boolean interpretation and round-trips under YAML 1.1 and 1.2
+func TestYAMLVersionBooleans(t *testing.T) {
+	input := `a: yes
+b: no
+c: on
+d: off
+e: true
+f: false
+g: 'yes'
+on: key
+h: !!bool "yes"
+`
+
+	tests := []struct {
+		name    string
+		version YAMLVersion
+		want    map[string]interface{}
+	}{
+		{
+			name:    "YAML12",
+			version: YAML12,
+			want: map[string]interface{}{
+				"a": "yes", "b": "no", "c": "on", "d": "off",
+				"e": true, "f": false, "g": "yes", "h": true,
+			},
+		},
+		{
+			name:    "YAML11",
+			version: YAML11,
+			want: map[string]interface{}{
+				"a": true, "b": false, "c": true, "d": false,
+				"e": true, "f": false, "g": "yes", "h": true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAMLWithOptions([]byte(input), ParseOptions{YAMLVersion: tt.version})
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+
+			root := tree.Documents[0].Root.Children[0]
+			for key, want := range tt.want {
+				if got := root.GetMapValue(key).Value; got != want {
+					t.Errorf("%s = %v (%T), want %v (%T)", key, got, got, want, want)
+				}
+			}
+			if root.GetMapValue("on") == nil {
+				t.Error("Mapping keys should keep their literal text")
+			}
+
+			output, err := tree.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			for _, line := range strings.Split(strings.TrimSpace(input), "\n") {
+				if !strings.Contains(string(output), line) {
+					t.Errorf("ToYAML() = %q, want it to keep %q", output, line)
+				}
+			}
+		})
+	}
+
+	t.Run("DefaultIsYAML12", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("a: yes\n"))
+		if v := tree.Documents[0].Root.Children[0].GetMapValue("a").Value; v != "yes" {
+			t.Errorf("UnmarshalYAML() a = %v, want the string yes", v)
+		}
+	})
+
+	t.Run("ModifiedValueUsesCanonicalToken", func(t *testing.T) {
+		tree, _ := UnmarshalYAMLWithOptions([]byte("a: yes\n"), ParseOptions{YAMLVersion: YAML11})
+		tree.Documents[0].Root.Children[0].GetMapValue("a").Value = false
+
+		output, _ := tree.ToYAML()
+		if strings.TrimSpace(string(output)) != "a: false" {
+			t.Errorf("ToYAML() = %q, want a: false", output)
+		}
+	})
+}
+
+// TestMergeTreesWithOptions tests tree-level merging with merge options
+func TestMergeTreesWithOptions(t *testing.T) {
+	baseValues := `replicaCount: 1
+image:
+  tag: v1.0
+containers:
+  - name: app
+    image: app:1.0
+    env:
+      - name: LOG_LEVEL
+        value: info
+  - name: sidecar
+    image: proxy:1.0
+debug: true
+`
+	overlayValues := `replicaCount: 3
+containers:
+  - name: app
+    image: app:2.0
+    env:
+      - name: LOG_LEVEL
+        value: debug
+      - name: EXTRA
+        value: "1"
+  - name: metrics
+    image: exporter:1.0
+debug: null
+`
+	base, _ := UnmarshalYAML([]byte(baseValues))
+	overlay, _ := UnmarshalYAML([]byte(overlayValues))
+
+	t.Run("SequenceMergeByKey", func(t *testing.T) {
+		merged := MergeTreesWithOptions(base, overlay, MergeOptions{SequenceStrategy: SequenceMergeByKey})
+		root := merged.Documents[0].Root.Children[0]
+
+		containers := root.GetMapValue("containers")
+		if containers == nil || len(containers.Children) != 3 {
+			t.Fatalf("containers should merge by name into 3 items, got %v", containers)
+		}
+
+		wantNames := []string{"app", "sidecar", "metrics"}
+		for i, want := range wantNames {
+			if got := containers.Children[i].GetMapValue("name").Value; got != want {
+				t.Errorf("containers[%d].name = %v, want %v", i, got, want)
+			}
+		}
+
+		app := containers.Children[0]
+		if got := app.GetMapValue("image").Value; got != "app:2.0" {
+			t.Errorf("containers[0].image = %v, want app:2.0", got)
+		}
+		env := app.GetMapValue("env")
+		if env == nil || len(env.Children) != 2 {
+			t.Fatalf("containers[0].env should merge by name into 2 items, got %v", env)
+		}
+		if got := env.Children[0].GetMapValue("value").Value; got != "debug" {
+			t.Errorf("LOG_LEVEL = %v, want debug", got)
+		}
+
+		if got := root.GetMapValue("replicaCount").Value; got != int64(3) {
+			t.Errorf("replicaCount = %v, want 3", got)
+		}
+		if got := root.GetMapValue("image").GetMapValue("tag").Value; got != "v1.0" {
+			t.Errorf("image.tag = %v, want base value v1.0", got)
+		}
+	})
+
+	t.Run("DefaultsMatchMergeTrees", func(t *testing.T) {
+		merged := MergeTreesWithOptions(base, overlay, DefaultMergeOptions())
+		expected := MergeTrees(base, overlay)
+
+		mergedYAML, _ := merged.ToYAML()
+		expectedYAML, _ := expected.ToYAML()
+		if string(mergedYAML) != string(expectedYAML) {
+			t.Errorf("Default options differ from MergeTrees:\n%s\nvs\n%s", mergedYAML, expectedYAML)
+		}
+
+		// Nested sequences are replaced by default
+		containers := merged.Documents[0].Root.Children[0].GetMapValue("containers")
+		if len(containers.Children) != 2 || containers.Children[1].GetMapValue("name").Value != "metrics" {
+			t.Errorf("Default merge should replace nested sequences, got %d items", len(containers.Children))
+		}
+	})
+
+	t.Run("SequenceMergeAppend", func(t *testing.T) {
+		merged := MergeTreesWithOptions(base, overlay, MergeOptions{SequenceStrategy: SequenceMergeAppend})
+		containers := merged.Documents[0].Root.Children[0].GetMapValue("containers")
+		if len(containers.Children) != 4 {
+			t.Errorf("Append should keep all 4 containers, got %d", len(containers.Children))
+		}
+	})
+
+	t.Run("SequenceMergeUnion", func(t *testing.T) {
+		baseList, _ := UnmarshalYAML([]byte("roles: [a, b]\nfeatures:\n  - x\n  - 1\n"))
+		overlayList, _ := UnmarshalYAML([]byte("roles: [b, c, c]\nfeatures:\n  - \"x\"\n  - \"1\"\n"))
+		merged := MergeTreesWithOptions(baseList, overlayList, MergeOptions{SequenceStrategy: SequenceMergeUnion})
+		root := merged.Documents[0].Root.Children[0]
+
+		var roles []interface{}
+		for _, item := range root.GetMapValue("roles").Children {
+			roles = append(roles, item.Value)
+		}
+		if want := []interface{}{"a", "b", "c"}; !reflect.DeepEqual(roles, want) {
+			t.Errorf("roles = %v, want %v", roles, want)
+		}
+		if features := root.GetMapValue("features").Children; len(features) != 3 {
+			t.Errorf("features has %d items, want 3: quoted x matches x but the string \"1\" differs from 1", len(features))
+		}
+
+		topBase, _ := UnmarshalYAML([]byte("- a\n- b\n"))
+		topOverlay, _ := UnmarshalYAML([]byte("- b\n- c\n"))
+		merged = MergeTreesWithOptions(topBase, topOverlay, MergeOptions{SequenceStrategy: SequenceMergeUnion})
+		if items := merged.Documents[0].Root.Children[0].Children; len(items) != 3 || items[2].Value != "c" {
+			t.Errorf("top-level union should give [a b c], got %d items", len(items))
+		}
+	})
+
+	t.Run("SequenceMergeReplaceTopLevel", func(t *testing.T) {
+		baseSeq, _ := UnmarshalYAML([]byte("- a\n- b\n"))
+		overlaySeq, _ := UnmarshalYAML([]byte("- c\n"))
+		merged := MergeTreesWithOptions(baseSeq, overlaySeq, MergeOptions{SequenceStrategy: SequenceMergeReplace})
+		items := merged.Documents[0].Root.Children[0].Children
+		if len(items) != 1 || items[0].Value != "c" {
+			t.Errorf("Replace should keep only the overlay items, got %d items", len(items))
+		}
+	})
+
+	t.Run("PreferBase", func(t *testing.T) {
+		merged := MergeTreesWithOptions(base, overlay, MergeOptions{PreferBase: true})
+		root := merged.Documents[0].Root.Children[0]
+		if got := root.GetMapValue("replicaCount").Value; got != int64(1) {
+			t.Errorf("replicaCount = %v, want base value 1", got)
+		}
+		if got := root.GetMapValue("debug").Value; got != true {
+			t.Errorf("debug = %v, want base value true", got)
+		}
+	})
+
+	t.Run("DeleteOnNull", func(t *testing.T) {
+		merged := MergeTreesWithOptions(base, overlay, MergeOptions{DeleteOnNull: true})
+		root := merged.Documents[0].Root.Children[0]
+		if root.GetMapValue("debug") != nil {
+			t.Error("DeleteOnNull should remove keys set to null by the overlay")
+		}
+		if root.GetMapValue("replicaCount") == nil || root.GetMapValue("image") == nil {
+			t.Error("DeleteOnNull should keep the other keys")
+		}
+
+		addOnly, _ := UnmarshalYAML([]byte("extra: ~\n"))
+		merged = MergeTreesWithOptions(base, addOnly, MergeOptions{DeleteOnNull: true})
+		if merged.Documents[0].Root.Children[0].GetMapValue("extra") != nil {
+			t.Error("DeleteOnNull should not add overlay-only null keys")
+		}
+	})
+
+	t.Run("CustomSequenceKey", func(t *testing.T) {
+		baseList, _ := UnmarshalYAML([]byte("ports:\n  - port: 80\n    protocol: TCP\n"))
+		overlayList, _ := UnmarshalYAML([]byte("ports:\n  - port: 80\n    protocol: UDP\n"))
+		merged := MergeTreesWithOptions(baseList, overlayList, MergeOptions{SequenceStrategy: SequenceMergeByKey, SequenceKey: "port"})
+		ports := merged.Documents[0].Root.Children[0].GetMapValue("ports")
+		if len(ports.Children) != 1 || ports.Children[0].GetMapValue("protocol").Value != "UDP" {
+			t.Errorf("Items should be matched by the port field, got %d items", len(ports.Children))
+		}
+	})
+}
+
+// TestMergeCommentModes tests combining comments of keys present in both trees
+func TestMergeCommentModes(t *testing.T) {
+	base, _ := UnmarshalYAML([]byte(`# -- Number of replicas
+replicaCount: 1 # base
+image:
+  # -- Image tag
+  tag: v1
+`))
+	overlay, _ := UnmarshalYAML([]byte(`# -- Scaled for production
+replicaCount: 3 # prod
+image:
+  # -- Pinned release tag
+  tag: v2
+`))
+
+	tests := []struct {
+		mode        CommentMergeMode
+		wantHead    []string
+		wantLine    string
+		wantTagHead []string
+	}{
+		{
+			mode:        CommentMergePreferBase,
+			wantHead:    []string{"# -- Number of replicas"},
+			wantLine:    "# base",
+			wantTagHead: []string{"# -- Image tag"},
+		},
+		{
+			mode:        CommentMergePreferOverlay,
+			wantHead:    []string{"# -- Scaled for production"},
+			wantLine:    "# prod",
+			wantTagHead: []string{"# -- Pinned release tag"},
+		},
+		{
+			mode:        CommentMergeConcatenate,
+			wantHead:    []string{"# -- Number of replicas", "# -- Scaled for production"},
+			wantLine:    "# base # prod",
+			wantTagHead: []string{"# -- Image tag", "# -- Pinned release tag"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			merged := MergeTreesWithOptions(base, overlay, MergeOptions{CommentMode: tt.mode})
+			root := merged.Documents[0].Root.Children[0]
+
+			replicasKey := root.Children[0]
+			if !equalStringSlices(replicasKey.HeadComment, tt.wantHead) {
+				t.Errorf("replicaCount head comment = %q, want %q", replicasKey.HeadComment, tt.wantHead)
+			}
+			replicas := root.GetMapValue("replicaCount")
+			if replicas.Value != int64(3) {
+				t.Errorf("replicaCount = %v, want overlay value 3", replicas.Value)
+			}
+			if replicas.LineComment != tt.wantLine {
+				t.Errorf("replicaCount line comment = %q, want %q", replicas.LineComment, tt.wantLine)
+			}
+
+			tagKey := root.GetMapValue("image").Children[0]
+			if !equalStringSlices(tagKey.HeadComment, tt.wantTagHead) {
+				t.Errorf("image.tag head comment = %q, want %q", tagKey.HeadComment, tt.wantTagHead)
+			}
+		})
+	}
+
+	t.Run("ConcatenateSerializes", func(t *testing.T) {
+		merged := MergeTreesWithOptions(base, overlay, MergeOptions{CommentMode: CommentMergeConcatenate})
+		output, err := merged.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		for _, want := range []string{"# -- Number of replicas\n# -- Scaled for production\nreplicaCount: 3", "# -- Image tag\n  # -- Pinned release tag\n  tag: v2"} {
+			if !strings.Contains(string(output), want) {
+				t.Errorf("ToYAML() = %q, want it to contain %q", output, want)
+			}
+		}
+	})
+
+	t.Run("IdenticalCommentsNotDuplicated", func(t *testing.T) {
+		merged := MergeTreesWithOptions(base, base, MergeOptions{CommentMode: CommentMergeConcatenate})
+		key := merged.Documents[0].Root.Children[0].Children[0]
+		if !equalStringSlices(key.HeadComment, []string{"# -- Number of replicas"}) {
+			t.Errorf("head comment = %q, want a single copy", key.HeadComment)
+		}
+	})
+}
+
+// TestKeepEmptyDocuments tests preserving empty documents between separators
+func TestKeepEmptyDocuments(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantDocs  int
+		emptyDocs []int
+	}{
+		{"LeadingEmpty", "---\n---\nkey: v\n", 2, []int{0}},
+		{"MiddleEmpty", "a: 1\n---\n---\nb: 2\n", 3, []int{1}},
+		{"TrailingEmpty", "a: 1\n---\n", 2, []int{1}},
+		{"EndMarker", "---\n...\n---\nb: 2\n", 2, []int{0}},
+		{"NoEmpty", "---\na: 1\n---\nb: 2\n", 2, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAMLWithOptions([]byte(tt.input), ParseOptions{KeepEmptyDocuments: true})
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if len(tree.Documents) != tt.wantDocs {
+				t.Fatalf("got %d documents, want %d", len(tree.Documents), tt.wantDocs)
+			}
+			for _, i := range tt.emptyDocs {
+				if tree.Documents[i].Root != nil {
+					t.Errorf("document %d root = %v, want nil", i, tree.Documents[i].Root)
+				}
+			}
+
+			// Serializing and parsing again keeps the document positions
+			output, err := tree.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			reparsed, err := UnmarshalYAMLWithOptions(output, ParseOptions{KeepEmptyDocuments: true})
+			if err != nil {
+				t.Fatalf("Failed to re-parse %q: %v", output, err)
+			}
+			if !tree.Equal(reparsed, EqualOptions{}) {
+				t.Errorf("Round trip through %q changed the documents", output)
+			}
+		})
+	}
+
+	t.Run("DefaultDropsEmpty", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte("---\n---\nkey: v\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if len(tree.Documents) != 1 {
+			t.Errorf("got %d documents, want 1 without KeepEmptyDocuments", len(tree.Documents))
+		}
+	})
+}
+
+// TestUnmarshalYAMLRange tests parsing a range of documents
+func TestUnmarshalYAMLRange(t *testing.T) {
+	input := []byte("---\nname: first\n---\nname: second\n---\nname: third\n")
+
+	t.Run("MiddleDocument", func(t *testing.T) {
+		tree, err := UnmarshalYAMLRange(input, 1, 1)
+		if err != nil {
+			t.Fatalf("UnmarshalYAMLRange() error = %v", err)
+		}
+		if len(tree.Documents) != 1 {
+			t.Fatalf("got %d documents, want 1", len(tree.Documents))
+		}
+		if got := tree.Documents[0].Root.Children[0].GetMapValue("name").Value; got != "second" {
+			t.Errorf("name = %v, want second", got)
+		}
+	})
+
+	t.Run("RemainingDocuments", func(t *testing.T) {
+		tree, err := UnmarshalYAMLRange(input, 1, -1)
+		if err != nil {
+			t.Fatalf("UnmarshalYAMLRange() error = %v", err)
+		}
+		if len(tree.Documents) != 2 {
+			t.Fatalf("got %d documents, want 2", len(tree.Documents))
+		}
+		if got := tree.Documents[1].Root.Children[0].GetMapValue("name").Value; got != "third" {
+			t.Errorf("name = %v, want third", got)
+		}
+	})
+
+	t.Run("CountPastEnd", func(t *testing.T) {
+		tree, _ := UnmarshalYAMLRange(input, 2, 10)
+		if len(tree.Documents) != 1 {
+			t.Errorf("got %d documents, want 1", len(tree.Documents))
+		}
+	})
+
+	t.Run("StartOutOfRange", func(t *testing.T) {
+		tree, err := UnmarshalYAMLRange(input, 5, 1)
+		if err != nil {
+			t.Fatalf("UnmarshalYAMLRange() error = %v", err)
+		}
+		if len(tree.Documents) != 0 {
+			t.Errorf("got %d documents, want an empty tree", len(tree.Documents))
+		}
+	})
+
+	t.Run("SkippedDocumentsAreNotParsed", func(t *testing.T) {
+		broken := []byte("---\ninvalid: [\n---\nname: ok\n")
+		tree, err := UnmarshalYAMLRange(broken, 1, 1)
+		if err != nil {
+			t.Fatalf("UnmarshalYAMLRange() should not parse skipped documents: %v", err)
+		}
+		if len(tree.Documents) != 1 {
+			t.Errorf("got %d documents, want 1", len(tree.Documents))
+		}
+	})
+
+	t.Run("NegativeStart", func(t *testing.T) {
+		if _, err := UnmarshalYAMLRange(input, -1, 1); err == nil {
+			t.Error("UnmarshalYAMLRange() should reject a negative start")
+		}
+	})
+}
+
+// TestDiffDetectKeyReorder tests reporting mappings whose keys changed order
+func TestDiffDetectKeyReorder(t *testing.T) {
+	opts := DiffOptions{DetectKeyReorder: true}
+
+	tests := []struct {
+		name      string
+		old, new  string
+		opts      DiffOptions
+		wantPaths []string
+	}{
+		{"Reordered", "steps:\n  build: 1\n  test: 2\n  deploy: 3\n", "steps:\n  test: 2\n  build: 1\n  deploy: 3\n", opts, []string{"$[document:0].steps"}},
+		{"SameOrder", "a: 1\nb: 2\n", "a: 1\nb: 2\n", opts, nil},
+		{"DisabledByDefault", "a: 1\nb: 2\n", "b: 2\na: 1\n", DefaultDiffOptions(), nil},
+		{"KeySetChanged", "a: 1\nb: 2\n", "b: 2\nc: 3\n", opts, nil},
+		{"NestedAndRoot", "x:\n  p: 1\n  q: 2\ny: 3\n", "y: 3\nx:\n  q: 2\n  p: 1\n", opts, []string{"$[document:0]", "$[document:0].x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldTree, _ := UnmarshalYAML([]byte(tt.old))
+			newTree, _ := UnmarshalYAML([]byte(tt.new))
+
+			var paths []string
+			for _, diff := range DiffTreesWithOptions(oldTree, newTree, tt.opts) {
+				if diff.Type == DiffReordered {
+					paths = append(paths, diff.Path)
+				}
+			}
+			sort.Strings(paths)
+			if !equalStringSlices(paths, tt.wantPaths) {
+				t.Errorf("reordered paths = %v, want %v", paths, tt.wantPaths)
+			}
+		})
+	}
+
+	t.Run("KeyOrderValues", func(t *testing.T) {
+		oldTree, _ := UnmarshalYAML([]byte("a: 1\nb: 2\n"))
+		newTree, _ := UnmarshalYAML([]byte("b: 2\na: 1\n"))
+		oldNode, newNode := oldTree.Documents[0].Root, newTree.Documents[0].Root
+		diffs := DiffNodesWithOptions(oldNode, newNode, "$", opts)
+		if len(diffs) != 1 {
+			t.Fatalf("DiffNodesWithOptions() = %v, want a single reorder", diffs)
+		}
+		if !reflect.DeepEqual(diffs[0].OldValue, []string{"a", "b"}) || !reflect.DeepEqual(diffs[0].NewValue, []string{"b", "a"}) {
+			t.Errorf("key orders = %v -> %v, want [a b] -> [b a]", diffs[0].OldValue, diffs[0].NewValue)
+		}
+	})
+}
+
+// TestDocumentFootComments tests that trailing comments at the end of a document survive
+func TestDocumentFootComments(t *testing.T) {
+	trailing := []string{"# trailing one", "# trailing two"}
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"AfterBlankLine", "app:\n  name: demo\n  port: 80\n\n# trailing one\n# trailing two\n"},
+		{"DirectlyAfterContent", "app:\n  name: demo\n# trailing one\n# trailing two\n"},
+		{"AfterSequence", "- a\n- b\n\n# trailing one\n# trailing two\n"},
+		{"BeforeNextDocument", "a: 1\n\n# trailing one\n# trailing two\n---\nb: 2\n"},
+		{"CommentOnlyDocument", "a: 1\n---\n# trailing one\n# trailing two\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			output, err := tree.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if !strings.Contains(string(output), strings.Join(trailing, "\n")+"\n") {
+				t.Errorf("trailing comments lost in output:\n%s", output)
+			}
+		})
+	}
+
+	t.Run("ExactRoundTrip", func(t *testing.T) {
+		input := "app:\n  name: demo\n\n# trailing one\n# trailing two\n"
+		tree, _ := UnmarshalYAML([]byte(input))
+		if root := tree.Documents[0].Root; !equalStringSlices(root.FootComment, trailing) {
+			t.Errorf("document FootComment = %q, want %q", root.FootComment, trailing)
+		}
+		output, _ := tree.ToYAML()
+		if string(output) != input {
+			t.Errorf("ToYAML() = %q, want %q", output, input)
+		}
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		base, _ := UnmarshalYAML([]byte("app:\n  name: demo\n\n# trailing one\n# trailing two\n"))
+		overlay, _ := UnmarshalYAML([]byte("app:\n  port: 80\n"))
+
+		for name, merged := range map[string]*NodeTree{
+			"FromBase":    MergeTrees(base, overlay),
+			"FromOverlay": MergeTrees(overlay, base),
+		} {
+			if root := merged.Documents[0].Root; !equalStringSlices(root.FootComment, trailing) {
+				t.Errorf("%s: merged FootComment = %q, want %q", name, root.FootComment, trailing)
+			}
+		}
+	})
+
+	t.Run("CommentOnlyFoot", func(t *testing.T) {
+		root := NewNode(DocumentNode)
+		root.FootComment = trailing
+		tree := NewNodeTree()
+		tree.AddDocument().SetRoot(root)
+		output, _ := tree.ToYAML()
+		if want := "# trailing one\n# trailing two\n"; string(output) != want {
+			t.Errorf("ToYAML() = %q, want %q", output, want)
+		}
+	})
+}
+
+// TestNodeTreeClone tests deep copying a whole tree
+func TestNodeTreeClone(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte(anchorsYAML + "\n---\nsecond: doc\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	tree.Documents[0].Directives = []Directive{{Name: "YAML", Value: "1.2"}}
+	tree.Documents[0].Version = "1.2"
+	tree.Current = tree.Documents[1]
+	original, _ := tree.ToYAML()
+
+	clone := tree.Clone()
+	if !tree.Equal(clone, EqualOptions{}) {
+		t.Fatal("Clone() should be equal to the original")
+	}
+	if clone.Current != clone.Documents[1] {
+		t.Error("Clone() should point Current at the cloned document")
+	}
+
+	t.Run("MutationsStayInClone", func(t *testing.T) {
+		clone := tree.Clone()
+		content := clone.Documents[0].Root.Children[0]
+		content.GetMapValue("development").GetMapValue("host").Value = "example.com"
+		content.AddKeyValue(NewScalarNode("added"), NewScalarNode(true))
+		clone.Documents[1].Root.Children[0].HeadComment = []string{"# changed"}
+		clone.Documents[0].Directives = append(clone.Documents[0].Directives, Directive{Name: "TAG"})
+
+		after, _ := tree.ToYAML()
+		if string(after) != string(original) {
+			t.Errorf("original changed after mutating the clone:\n%s", after)
+		}
+		if len(tree.Documents[0].Directives) != len(clone.Documents[0].Directives)-1 {
+			t.Error("Directives should be copied")
+		}
+	})
+
+	t.Run("AnchorsIndependent", func(t *testing.T) {
+		clone := tree.Clone()
+		origDoc, cloneDoc := tree.Documents[0], clone.Documents[0]
+
+		anchor := cloneDoc.GetAnchor("defaults")
+		if anchor == nil || anchor == origDoc.GetAnchor("defaults") {
+			t.Fatalf("cloned anchor = %p, want a node distinct from the original %p", anchor, origDoc.GetAnchor("defaults"))
+		}
+		if anchor != cloneDoc.Root.Children[0].GetMapValue("defaults") {
+			t.Error("cloned anchor should be the cloned defaults node")
+		}
+
+		alias := cloneDoc.Root.Children[0].GetMapValue("development").Children[1]
+		if alias.Kind != AliasNode || alias.Alias != anchor {
+			t.Errorf("cloned alias should resolve to the cloned anchor, got %p", alias.Alias)
+		}
+
+		anchor.GetMapValue("timeout").Value = 60
+		if origDoc.GetAnchor("defaults").GetMapValue("timeout").Value == 60 {
+			t.Error("changing the cloned anchor should not affect the original")
+		}
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		var nilTree *NodeTree
+		if nilTree.Clone() != nil {
+			t.Error("Clone() of a nil tree should be nil")
+		}
+	})
+}
+
+// TestDocumentReindexAnchors tests relinking anchors and aliases to a cloned root
+func TestDocumentReindexAnchors(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte("base: &base\n  size: 1\nlist:\n  - &item x\n  - *item\ncopy: *base\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	original := tree.Documents[0]
+
+	doc := &Document{Anchors: original.Anchors}
+	doc.SetRoot(original.Root.Clone())
+	if doc.GetAnchor("base") != original.GetAnchor("base") {
+		t.Fatal("setup: a shared Anchors map should still point at the original nodes")
+	}
+
+	doc.ReindexAnchors()
+
+	content := doc.Root.Children[0]
+	tests := []struct {
+		anchor string
+		node   *Node
+		alias  *Node
+	}{
+		{"base", content.GetMapValue("base"), content.GetMapValue("copy")},
+		{"item", content.GetMapValue("list").Children[0], content.GetMapValue("list").Children[1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.anchor, func(t *testing.T) {
+			anchor := doc.GetAnchor(tt.anchor)
+			if anchor != tt.node {
+				t.Errorf("GetAnchor(%q) should be the cloned node", tt.anchor)
+			}
+			if anchor == original.GetAnchor(tt.anchor) {
+				t.Errorf("GetAnchor(%q) still points at the original node", tt.anchor)
+			}
+			if tt.alias.Alias != anchor {
+				t.Errorf("alias to %q should resolve to the cloned anchor", tt.anchor)
+			}
+		})
+	}
+
+	if original.GetAnchor("base") != tree.Documents[0].Root.Children[0].GetMapValue("base") {
+		t.Error("ReindexAnchors() should not modify the original document's anchors")
+	}
+
+	t.Run("RemovedAnchor", func(t *testing.T) {
+		content.GetMapValue("base").Anchor = ""
+		doc.ReindexAnchors()
+		if doc.GetAnchor("base") != nil {
+			t.Error("anchors no longer present in the tree should be dropped")
+		}
+	})
+
+	t.Run("AliasBeforeAnchor", func(t *testing.T) {
+		mapping := NewMappingNode()
+		alias := NewAliasNode("shared")
+		anchor := NewMappingNode()
+		anchor.Anchor = "shared"
+		anchor.AddKeyValue(NewScalarNode("size"), NewScalarNode(1))
+		mapping.AddKeyValue(NewScalarNode("copy"), alias)
+		mapping.AddKeyValue(NewScalarNode("base"), anchor)
+
+		forward := &Document{}
+		root := NewNode(DocumentNode)
+		root.AddChild(mapping)
+		forward.SetRoot(root)
+		forward.ReindexAnchors()
+
+		if alias.Alias != anchor {
+			t.Error("an alias before its anchor should link to the anchor that follows it")
+		}
+		if forward.GetAnchor("shared") != anchor {
+			t.Error("GetAnchor() should return the anchor defined after the alias")
+		}
+	})
+
+	t.Run("RedefinedAnchor", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte("a: &x 1\nb: *x\nc: &x 2\nd: *x\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		doc := tree.Documents[0]
+		doc.ReindexAnchors()
+
+		content := doc.Root.Children[0]
+		if content.GetMapValue("b").Alias != content.GetMapValue("a") {
+			t.Error("alias b should link to the anchor defined before it")
+		}
+		if content.GetMapValue("d").Alias != content.GetMapValue("c") {
+			t.Error("alias d should link to the redefined anchor")
+		}
+	})
+}
+
+// TestNodeResolve tests resolving paths relative to a node
+func TestNodeResolve(t *testing.T) {
+	input := `defaults: &defaults
+  timeout: 30
+server:
+  host: localhost
+  port: 8080
+  routes:
+    - path: /
+    - path: /health
+  limits: *defaults
+`
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	content := tree.Documents[0].Root.Children[0]
+	server := content.GetMapValue("server")
+	host := server.GetMapValue("host")
+	health := server.GetMapValue("routes").Children[1].GetMapValue("path")
+
+	tests := []struct {
+		name     string
+		from     *Node
+		relative string
+		want     *Node
+	}{
+		{"Self", host, ".", host},
+		{"Empty", host, "", host},
+		{"Sibling", host, "../port", server.GetMapValue("port")},
+		{"Parent", host, "..", server},
+		{"Ancestor", health, "../../..", server.GetMapValue("routes").Parent},
+		{"AncestorSibling", health, "../../../host", host},
+		{"IndexFromSibling", health, "../../[0]/path", server.GetMapValue("routes").Children[0].GetMapValue("path")},
+		{"PlainIndex", server, "routes/1/path", health},
+		{"ThroughAlias", host, "../limits/timeout", content.GetMapValue("defaults").GetMapValue("timeout")},
+		{"AboveRoot", content, "..", nil},
+		{"FarAboveRoot", host, "../../../..", nil},
+		{"MissingKey", host, "../missing", nil},
+		{"IndexOutOfRange", server, "routes/[5]", nil},
+		{"ChildOfScalar", host, "child", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.from.Resolve(tt.relative); got != tt.want {
+				t.Errorf("Resolve(%q) = %v, want %v", tt.relative, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNodeResolvedTag tests explicit and inferred YAML tags
+func TestNodeResolvedTag(t *testing.T) {
+	anchor := NewScalarNode(int64(1))
+	alias := NewAliasNode("one")
+	alias.Alias = anchor
+
+	quoted := NewScalarNode("42")
+	quoted.Style = DoubleQuotedStyle
+
+	tests := []struct {
+		name string
+		node *Node
+		want string
+	}{
+		{"Int", NewScalarNode(42), "!!int"},
+		{"Int64", NewScalarNode(int64(42)), "!!int"},
+		{"Float", NewScalarNode(1.5), "!!float"},
+		{"Bool", NewScalarNode(true), "!!bool"},
+		{"NilValue", NewScalarNode(nil), "!!null"},
+		{"NullNode", NewNode(NullNode), "!!null"},
+		{"String", NewScalarNode("hello"), "!!str"},
+		{"PlainNumericString", NewScalarNode("42"), "!!int"},
+		{"PlainFloatString", NewScalarNode("4.2"), "!!float"},
+		{"PlainBoolString", NewScalarNode("true"), "!!bool"},
+		{"PlainNullString", NewScalarNode("~"), "!!null"},
+		{"QuotedNumericString", quoted, "!!str"},
+		{"Mapping", NewMappingNode(), "!!map"},
+		{"Sequence", NewSequenceNode(), "!!seq"},
+		{"Alias", alias, "!!int"},
+		{"UnresolvedAlias", NewAliasNode("missing"), ""},
+		{"Document", NewNode(DocumentNode), ""},
+		{"Nil", nil, ""},
+		{"Explicit", &Node{Kind: ScalarNode, Tag: "!custom", Value: "x"}, "!custom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.node.ResolvedTag(); got != tt.want {
+				t.Errorf("ResolvedTag() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("MatchesParsedTags", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte("a: 1\nb: 1.5\nc: true\nd: ~\ne: text\nf: [x]\ng: {k: v}\n"))
+		content := tree.Documents[0].Root.Children[0]
+		for i := 1; i < len(content.Children); i += 2 {
+			parsed := content.Children[i]
+			built := parsed.Clone()
+			built.Tag = ""
+			if got := built.ResolvedTag(); got != parsed.Tag {
+				t.Errorf("%v: inferred tag %q, parsed tag %q", content.Children[i-1].Value, got, parsed.Tag)
+			}
+		}
+	})
+}
+
+// TestHeaderCommentBlankLines tests that blank lines inside the top-of-file comment survive
+func TestHeaderCommentBlankLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"HeadersOnly", headersOnlyYAML},
+		{"HeadersWithContent", headersOnlyYAML + "\n# @schema\n# additionalProperties: false\n# @schema\nfullnameOverride: \"test\"\n"},
+		{"SeveralBlankLines", "# yaml-language-server: $schema=values.schema.json\n\n\n# Paragraph one\n# continues\n\n\n\n# Paragraph two\n\nkey: value\n"},
+		{"AfterSeparator", "---\n# Header\n\n\n# More\n\nkey: value\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			output, err := tree.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			want := strings.TrimPrefix(tt.input, "---\n")
+			if string(output) != want {
+				t.Errorf("ToYAML() =\n%q\nwant\n%q", output, want)
+			}
+		})
+	}
+}
+
+// TestNodeTreeSplitToBytes tests serializing each document separately
+func TestNodeTreeSplitToBytes(t *testing.T) {
+	input := "# first\nname: one\n---\nitems:\n  - a\n  - b\n---\nname: three\n"
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	parts, err := tree.SplitToBytes()
+	if err != nil {
+		t.Fatalf("SplitToBytes() error = %v", err)
+	}
+	want := []string{"# first\nname: one\n", "items:\n  - a\n  - b\n", "name: three\n"}
+	if len(parts) != len(want) {
+		t.Fatalf("SplitToBytes() returned %d documents, want %d", len(parts), len(want))
+	}
+
+	for i, part := range parts {
+		if string(part) != want[i] {
+			t.Errorf("document %d = %q, want %q", i, part, want[i])
+		}
+		reparsed, err := UnmarshalYAML(part)
+		if err != nil {
+			t.Fatalf("document %d does not parse: %v", i, err)
+		}
+		if len(reparsed.Documents) != 1 {
+			t.Errorf("document %d parsed into %d documents, want 1", i, len(reparsed.Documents))
+		}
+		if !reparsed.Documents[0].Root.Equal(tree.Documents[i].Root, EqualOptions{}) {
+			t.Errorf("document %d changed after splitting", i)
+		}
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		parts, err := NewNodeTree().SplitToBytes()
+		if err != nil || len(parts) != 0 {
+			t.Errorf("SplitToBytes() = %v, %v, want no documents", parts, err)
+		}
+	})
+}
+
+// TestQuoteAmbiguousScalars tests quoting strings that would re-parse as another type
+func TestQuoteAmbiguousScalars(t *testing.T) {
+	values := []string{"yes", "null", "~", "12:30", "@handle", "off", "1e3", "", "42", "007"}
+
+	build := func() *NodeTree {
+		mapping := NewMappingNode()
+		for i, value := range values {
+			mapping.AddKeyValue(NewScalarNode(fmt.Sprintf("k%d", i)), NewScalarNode(value))
+		}
+		mapping.AddKeyValue(NewScalarNode("plain"), NewScalarNode("hello"))
+		root := NewNode(DocumentNode)
+		root.AddChild(mapping)
+		tree := NewNodeTree()
+		tree.AddDocument().SetRoot(root)
+		return tree
+	}
+
+	t.Run("Enabled", func(t *testing.T) {
+		tree := build()
+		tree.EncodeOptions.QuoteAmbiguousScalars = true
+		output, err := tree.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		if !strings.Contains(string(output), "plain: hello\n") {
+			t.Errorf("unambiguous strings should stay plain, got:\n%s", output)
+		}
+
+		var decoded map[string]interface{}
+		if err := Unmarshal(output, &decoded); err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+		for i, want := range values {
+			if got, ok := decoded[fmt.Sprintf("k%d", i)].(string); !ok || got != want {
+				t.Errorf("k%d decoded as %#v, want string %q", i, decoded[fmt.Sprintf("k%d", i)], want)
+			}
+		}
+
+		for _, version := range []YAMLVersion{YAML12, YAML11} {
+			reparsed, err := UnmarshalYAMLWithOptions(output, ParseOptions{YAMLVersion: version})
+			if err != nil {
+				t.Fatalf("Failed to re-parse: %v", err)
+			}
+			mapping := reparsed.Documents[0].Root.Children[0]
+			for i, want := range values {
+				node := mapping.GetMapValue(fmt.Sprintf("k%d", i))
+				if node.Tag != "!!str" {
+					t.Errorf("YAML %s: k%d re-parsed with tag %s, want !!str", version, i, node.Tag)
+				}
+				if got, ok := node.Value.(string); !ok || got != want {
+					t.Errorf("YAML %s: k%d re-parsed as %#v, want string %q", version, i, node.Value, want)
+				}
+			}
+
+			again, err := reparsed.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if string(again) != string(output) {
+				t.Errorf("YAML %s: second pass changed the output\ngot:\n%s\nwant:\n%s", version, again, output)
+			}
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		output, err := build().ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		if !strings.Contains(string(output), "k1: null\n") {
+			t.Errorf("without the option strings should be emitted plain, got:\n%s", output)
+		}
+	})
+}
+
+// TestMergeCoerceScalarToSequence tests merging scalars and sequences under the same key
+func TestMergeCoerceScalarToSequence(t *testing.T) {
+	parse := func(input string) *Node {
+		tree, err := UnmarshalYAML([]byte(input))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		return tree.Documents[0].Root.Children[0]
+	}
+
+	tests := []struct {
+		name    string
+		base    string
+		overlay string
+		coerce  bool
+		want    string
+	}{
+		{"ScalarBaseSequenceOverlay", "args: value\n", "args: [extra]\n", true, "args: [value, extra]\n"},
+		{"SequenceBaseScalarOverlay", "args:\n  - value\n", "args: extra\n", true, "args: [value, extra]\n"},
+		{"NullBaseIsReplaced", "args: null\n", "args: [extra]\n", true, "args: [extra]\n"},
+		{"DefaultReplacesScalar", "args: value\n", "args: [extra]\n", false, "args: [extra]\n"},
+		{"DefaultReplacesSequence", "args: [value]\n", "args: extra\n", false, "args: extra\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultMergeOptions()
+			opts.CoerceScalarToSequence = tt.coerce
+			merged := MergeNodesWithOptions(parse(tt.base), parse(tt.overlay), opts)
+
+			got, want := nodeToInterface(merged), nodeToInterface(parse(tt.want))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("merged = %v, want %v", got, want)
+			}
+		})
+	}
+
+	t.Run("TopLevel", func(t *testing.T) {
+		opts := MergeOptions{CoerceScalarToSequence: true}
+		merged := MergeNodesWithOptions(NewScalarNode("a"), parse("[b, c]\n"), opts)
+		if merged.Kind != SequenceNode || len(merged.Children) != 3 || merged.Children[0].Value != "a" {
+			t.Errorf("merged = %v, want the sequence [a, b, c]", nodeToInterface(merged))
+		}
+		if merged.Children[0].Parent != merged {
+			t.Error("prepended item should point to the merged sequence")
+		}
+	})
+}
+
+// TestNodeAtLine tests locating the node at a source line
+func TestNodeAtLine(t *testing.T) {
+	tree, err := UnmarshalYAML([]byte(complexYAML))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	root := tree.Documents[0].Root.Children[0]
+	app := root.GetMapValue("app")
+
+	tests := []struct {
+		name string
+		line int
+		want *Node
+	}{
+		{"ValueOnLine", 3, app.GetMapValue("name")},
+		{"NestedValue", 8, app.GetMapValue("settings").GetMapValue("port")},
+		{"KeyOfCollection", 6, app.Children[4]},
+		{"CommentInsideMapping", 5, app},
+		{"HeaderComment", 1, nil},
+		{"PastEnd", 20, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tree.NodeAtLine(tt.line); got != tt.want {
+				t.Errorf("NodeAtLine(%d) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+
+	if got := tree.NodeAtLine(3); got.Value != "MyApp" {
+		t.Errorf("NodeAtLine(3) = %v, want the MyApp scalar", got.Value)
+	}
+
+	t.Run("BlockScalar", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte("script: |\n  one\n  two\nnext: 1\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		script := tree.Documents[0].Root.Children[0].GetMapValue("script")
+		if got := tree.NodeAtLine(3); got != script {
+			t.Errorf("NodeAtLine(3) = %v, want the block scalar", got)
+		}
+	})
+
+	t.Run("MultipleDocuments", func(t *testing.T) {
+		input := "a: 1\n---\nb: 2\nc: 3\n---\n\n# note\nd: 4\n"
+		parsers := map[string]func() (*NodeTree, error){
+			"UnmarshalYAML":       func() (*NodeTree, error) { return UnmarshalYAML([]byte(input)) },
+			"UnmarshalYAMLReader": func() (*NodeTree, error) { return UnmarshalYAMLReader(strings.NewReader(input)) },
+		}
+		for name, parse := range parsers {
+			tree, err := parse()
+			if err != nil {
+				t.Fatalf("%s: failed to parse: %v", name, err)
+			}
+			content := func(i int) *Node { return tree.Documents[i].Root.Children[0] }
+
+			tests := []struct {
+				line int
+				want *Node
+			}{
+				{1, content(0).GetMapValue("a")},
+				{2, nil},
+				{3, content(1).GetMapValue("b")},
+				{4, content(1).GetMapValue("c")},
+				{8, content(2).GetMapValue("d")},
+			}
+			for _, tt := range tests {
+				if got := tree.NodeAtLine(tt.line); got != tt.want {
+					t.Errorf("%s: NodeAtLine(%d) = %v, want %v", name, tt.line, got, tt.want)
+				}
+			}
+		}
+	})
+}
+
+// TestNodeMetadata tests that node metadata survives cloning and merging
+func TestNodeMetadata(t *testing.T) {
+	t.Run("SetAndGet", func(t *testing.T) {
+		node := &Node{Kind: ScalarNode}
+		if _, ok := node.GetMeta("source"); ok {
+			t.Error("GetMeta() should report unset keys")
+		}
+		node.SetMeta("source", "values.yaml")
+		if value, ok := node.GetMeta("source"); !ok || value != "values.yaml" {
+			t.Errorf("GetMeta() = %v, %v, want values.yaml, true", value, ok)
+		}
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		node := NewScalarNode("x")
+		node.SetMeta("source", "values.yaml")
+		clone := node.Clone()
+		clone.SetMeta("source", "changed")
+		if value, _ := clone.GetMeta("source"); value != "changed" {
+			t.Errorf("clone metadata = %v, want changed", value)
+		}
+		if value, _ := node.GetMeta("source"); value != "values.yaml" {
+			t.Errorf("changing the clone should not affect the original, got %v", value)
+		}
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		parse := func(input string) *Node {
+			tree, err := UnmarshalYAML([]byte(input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			return tree.Documents[0].Root.Children[0]
+		}
+		base := parse("app:\n  name: base\n  port: 80\n")
+		overlay := parse("app:\n  name: overlay\n")
+
+		base.SetMeta("file", "base.yaml")
+		base.SetMeta("owner", "platform")
+		overlay.SetMeta("file", "overlay.yaml")
+		base.GetMapValue("app").GetMapValue("name").SetMeta("line", 2)
+		overlay.GetMapValue("app").GetMapValue("name").SetMeta("reviewed", true)
+		base.GetMapValue("app").GetMapValue("port").SetMeta("line", 3)
+
+		merged := MergeNodes(base, overlay)
+		want := map[string]interface{}{"file": "overlay.yaml", "owner": "platform"}
+		if !reflect.DeepEqual(merged.Metadata, want) {
+			t.Errorf("merged metadata = %v, want %v", merged.Metadata, want)
+		}
+
+		app := merged.GetMapValue("app")
+		name := app.GetMapValue("name")
+		if name.Value != "overlay" {
+			t.Errorf("name = %v, want overlay", name.Value)
+		}
+		if !reflect.DeepEqual(name.Metadata, map[string]interface{}{"line": 2, "reviewed": true}) {
+			t.Errorf("replaced leaf metadata = %v, want both inputs", name.Metadata)
+		}
+		if line, _ := app.GetMapValue("port").GetMeta("line"); line != 3 {
+			t.Errorf("base-only leaf metadata = %v, want 3", line)
+		}
+		if _, ok := overlay.GetMeta("owner"); ok {
+			t.Error("merging should not modify the overlay")
+		}
+	})
+}
+
+// TestMergeTreesWithProvenance tests recording which input each merged node came from
+func TestMergeTreesWithProvenance(t *testing.T) {
+	base, err := UnmarshalYAML([]byte("replicaCount: 1\nimage:\n  repository: nginx\n  tag: \"1.0\"\nports: [80]\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse base: %v", err)
+	}
+	overlay, err := UnmarshalYAML([]byte("replicaCount: 3\nimage:\n  tag: \"2.0\"\ningress: true\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse overlay: %v", err)
+	}
+
+	merged := MergeTreesWithProvenance(base, overlay, "values.yaml", "prod.yaml")
+	root := merged.Documents[0].Root.Children[0]
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"replicaCount", "prod.yaml"},
+		{"image.tag", "prod.yaml"},
+		{"ingress", "prod.yaml"},
+		{"image.repository", "values.yaml"},
+		{"ports", "values.yaml"},
+		{"image", "values.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			node := root.Resolve(strings.ReplaceAll(tt.path, ".", "/"))
+			if node == nil {
+				t.Fatalf("path %s not found", tt.path)
+			}
+			if source, _ := node.GetMeta(DefaultProvenanceKey); source != tt.want {
+				t.Errorf("%s source = %v, want %s", tt.path, source, tt.want)
+			}
+		})
+	}
+
+	if replicas, _ := root.GetMapValue("replicaCount").AsInt(); replicas != 3 {
+		t.Errorf("replicaCount = %d, want 3", replicas)
+	}
+	if _, ok := base.Documents[0].Root.Children[0].GetMapValue("ports").GetMeta(DefaultProvenanceKey); ok {
+		t.Error("MergeTreesWithProvenance() should not modify its inputs")
+	}
+
+	t.Run("PreferBaseKeepsBaseLabel", func(t *testing.T) {
+		opts := MergeOptions{PreferBase: true, ProvenanceKey: "layer", BaseLabel: "base", OverlayLabel: "overlay"}
+		merged := MergeNodesWithOptions(base.Documents[0].Root.Children[0], overlay.Documents[0].Root.Children[0], opts)
+		if layer, _ := merged.GetMapValue("replicaCount").GetMeta("layer"); layer != "base" {
+			t.Errorf("kept base value layer = %v, want base", layer)
+		}
+		if layer, _ := merged.GetMapValue("ingress").GetMeta("layer"); layer != "overlay" {
+			t.Errorf("added value layer = %v, want overlay", layer)
+		}
+	})
+}
+
+// TestMergeTreesWithProvenanceLayers tests that labels survive merging several layers
+func TestMergeTreesWithProvenanceLayers(t *testing.T) {
+	parse := func(input string) *NodeTree {
+		tree, err := UnmarshalYAML([]byte(input))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		return tree
+	}
+	base := parse("replicaCount: 1\nimage:\n  repository: nginx\n  tag: \"1.0\"\n")
+	prod := parse("replicaCount: 3\nimage:\n  tag: \"2.0\"\n")
+	local := parse("image:\n  tag: dev\ndebug: true\n---\nkind: Secret\n")
+
+	layered := MergeTreesWithProvenance(MergeTreesWithProvenance(base, prod, "base.yaml", "prod.yaml"), local, "merged", "local.yaml")
+	root := layered.Documents[0].Root.Children[0]
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"replicaCount", "prod.yaml"},
+		{"image/repository", "base.yaml"},
+		{"image/tag", "local.yaml"},
+		{"debug", "local.yaml"},
+		{"image", "base.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if source, _ := root.Resolve(tt.path).GetMeta(DefaultProvenanceKey); source != tt.want {
+				t.Errorf("%s source = %v, want %s", tt.path, source, tt.want)
+			}
+		})
+	}
+
+	t.Run("ExtraDocuments", func(t *testing.T) {
+		kind := layered.Documents[1].Root.Children[0].GetMapValue("kind")
+		if source, _ := kind.GetMeta(DefaultProvenanceKey); source != "local.yaml" {
+			t.Errorf("kind source = %v, want local.yaml", source)
+		}
+		if _, ok := local.Documents[1].Root.Children[0].GetMapValue("kind").GetMeta(DefaultProvenanceKey); ok {
+			t.Error("merging should not label the input documents")
+		}
+	})
+
+	t.Run("EmptyBaseLabel", func(t *testing.T) {
+		opts := MergeOptions{ProvenanceKey: DefaultProvenanceKey, OverlayLabel: "prod.yaml"}
+		merged := MergeTreesWithOptions(base, prod, opts).Documents[0].Root.Children[0]
+		if _, ok := merged.Resolve("image/repository").GetMeta(DefaultProvenanceKey); ok {
+			t.Error("an empty BaseLabel should leave base nodes unlabelled")
+		}
+		if source, _ := merged.GetMapValue("replicaCount").GetMeta(DefaultProvenanceKey); source != "prod.yaml" {
+			t.Errorf("replicaCount source = %v, want prod.yaml", source)
+		}
+	})
+}
+
+// TestMergePath tests merging only the subtree at a path
+func TestMergePath(t *testing.T) {
+	parse := func(input string) *NodeTree {
+		tree, err := UnmarshalYAML([]byte(input))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		return tree
+	}
+
+	base := parse(`replicas: 1
+spec:
+  template:
+    image: app:1.0
+    port: 80
+  strategy: rolling
+containers:
+  - name: app
+`)
+	overlay := parse(`replicas: 5
+spec:
+  template:
+    image: app:2.0
+    debug: true
+  strategy: recreate
+containers:
+  - name: app
+    env:
+      mode: prod
+`)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{
+			name: "NestedPath",
+			path: "spec.template",
+			want: "replicas: 1\nspec:\n  template:\n    image: app:2.0\n    port: 80\n    debug: true\n  strategy: rolling\ncontainers:\n  - name: app\n",
+		},
+		{
+			name: "MissingInBase",
+			path: "$.containers[0].env",
+			want: "replicas: 1\nspec:\n  template:\n    image: app:1.0\n    port: 80\n  strategy: rolling\ncontainers:\n  - name: app\n    env:\n      mode: prod\n",
+		},
+		{
+			name: "MissingInOverlay",
+			path: "spec.selector",
+			want: "replicas: 1\nspec:\n  template:\n    image: app:1.0\n    port: 80\n  strategy: rolling\ncontainers:\n  - name: app\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := MergePath(base, overlay, tt.path)
+			if err != nil {
+				t.Fatalf("MergePath() error = %v", err)
+			}
+			output, err := merged.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if string(output) != tt.want {
+				t.Errorf("MergePath() =\n%s\nwant\n%s", output, tt.want)
+			}
+		})
+	}
+
+	t.Run("CreatesMissingPath", func(t *testing.T) {
+		overlay := parse("metadata:\n  labels:\n    team: core\n")
+		merged, err := MergePath(base, overlay, "metadata.labels")
+		if err != nil {
+			t.Fatalf("MergePath() error = %v", err)
+		}
+		labels := merged.Documents[0].Root.Children[0].Resolve("metadata/labels")
+		if labels == nil || labels.GetMapValue("team").Value != "core" {
+			t.Errorf("metadata.labels = %v, want the overlay labels", labels)
+		}
+		if labels.Parent.Key.Value != "metadata" {
+			t.Error("created mapping should be attached under metadata")
+		}
+	})
+
+	t.Run("BaseUnchanged", func(t *testing.T) {
+		if _, err := MergePath(base, overlay, "spec"); err != nil {
+			t.Fatalf("MergePath() error = %v", err)
+		}
+		if image := base.Documents[0].Root.Children[0].Resolve("spec/template/image"); image.Value != "app:1.0" {
+			t.Errorf("base image = %v, want app:1.0", image.Value)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := MergePath(base, overlay, "spec[0"); err == nil {
+			t.Error("MergePath() should reject an invalid path")
+		}
+		if _, err := MergePath(NewNodeTree(), overlay, "spec"); err == nil {
+			t.Error("MergePath() should reject an empty base")
+		}
+		if _, err := MergePath(base, parse("replicas:\n  min: 1\n"), "replicas.min"); err == nil {
+			t.Error("MergePath() should not create keys under a scalar")
+		}
+	})
+}
+
+// TestEncodeYAMLVersion tests emitting version-appropriate boolean tokens
+func TestEncodeYAMLVersion(t *testing.T) {
+	build := func() *NodeTree {
+		tree, err := UnmarshalYAML([]byte("enabled: true\ndisabled: true\nanswer: \"yes\"\nmode: on\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		root := tree.Documents[0].Root.Children[0]
+		root.AddKeyValue(NewScalarNode("created"), NewScalarNode(true))
+		root.GetMapValue("disabled").Value = false
+		return tree
+	}
+
+	tests := []struct {
+		name    string
+		version YAMLVersion
+		want    string
+	}{
+		{"YAML12", YAML12, "enabled: true\ndisabled: false\nanswer: \"yes\"\nmode: on\ncreated: true\n"},
+		{"YAML11", YAML11, "enabled: true\ndisabled: no\nanswer: \"yes\"\nmode: \"on\"\ncreated: yes\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := build()
+			tree.EncodeOptions.YAMLVersion = tt.version
+			output, err := tree.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if string(output) != tt.want {
+				t.Errorf("ToYAML() = %q, want %q", output, tt.want)
+			}
+
+			reparsed, err := UnmarshalYAMLWithOptions(output, ParseOptions{YAMLVersion: tt.version})
+			if err != nil {
+				t.Fatalf("Failed to re-parse: %v", err)
+			}
+			root := reparsed.Documents[0].Root.Children[0]
+			want := map[string]interface{}{"enabled": true, "disabled": false, "answer": "yes", "mode": "on", "created": true}
+			for key, value := range want {
+				if got := root.GetMapValue(key).Value; got != value {
+					t.Errorf("%s re-parsed as %v (%T), want %v", key, got, got, value)
+				}
+			}
+		})
+	}
+
+	t.Run("KeepsSourceSpelling", func(t *testing.T) {
+		tree, _ := UnmarshalYAMLWithOptions([]byte("a: on\n"), ParseOptions{YAMLVersion: YAML11})
+		tree.EncodeOptions.YAMLVersion = YAML11
+		output, _ := tree.ToYAML()
+		if string(output) != "a: on\n" {
+			t.Errorf("ToYAML() = %q, want the source token on", output)
+		}
+	})
+}
+
+// TestFixCommentAttachment tests moving comments back to the sequence item they precede
+func TestFixCommentAttachment(t *testing.T) {
+	input := `# Deeply nested structure with comments at every level
+level1:
+  # Level 2 comment
+  level2:
+    # Level 3 comment
+    level3:
+      # Deep value with metadata
+      value: "deep"
+    # Array at level 3
+    array3:
+      - name: first
+        settings:
+          enabled: true
+          # Second item comment
+      - name: second
+      - item3 # Third item
+  # Back at level 2
+  level2b:
+    key: value
+`
+
+	headComments := func(tree *NodeTree) map[string][]string {
+		comments := make(map[string][]string)
+		tree.Documents[0].Root.Walk(func(n *Node) bool {
+			if len(n.HeadComment) > 0 {
+				comments[n.Path()] = n.HeadComment
+			}
+			if len(n.FootComment) > 0 {
+				comments["foot:"+n.Path()] = n.FootComment
+			}
+			return true
+		})
+		return comments
+	}
+
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	array := tree.Documents[0].Root.Children[0].GetMapValue("level1").GetMapValue("level2").GetMapValue("array3")
+	enabled := array.Children[0].GetMapValue("settings").Children[0]
+	if got := enabled.FootComment; len(got) != 1 || got[0] != "# Second item comment" {
+		t.Fatalf("FootComment = %v, want the parser to attach the comment to the previous entry", got)
+	}
+
+	tree.FixCommentAttachment()
+	if len(enabled.FootComment) != 0 {
+		t.Errorf("FootComment = %v, want it moved", enabled.FootComment)
+	}
+	if got := array.Children[1].HeadComment; len(got) != 1 || got[0] != "# Second item comment" {
+		t.Errorf("second item HeadComment = %v, want the moved comment", got)
+	}
+	if got := tree.Documents[0].Root.Children[0].GetMapValue("level1").Children[2].HeadComment; len(got) != 1 || got[0] != "# Back at level 2" {
+		t.Errorf("level2b HeadComment = %v, want it unchanged", got)
+	}
+
+	first, err := tree.ToYAML()
+	if err != nil {
+		t.Fatalf("ToYAML() error = %v", err)
+	}
+	if !strings.Contains(string(first), "\n      # Second item comment\n      - name: second\n") {
+		t.Errorf("comment should be emitted above the second item:\n%s", first)
+	}
+
+	reparsed, err := UnmarshalYAML(first)
+	if err != nil {
+		t.Fatalf("Failed to re-parse: %v", err)
+	}
+	reparsed.FixCommentAttachment()
+	if !reflect.DeepEqual(headComments(reparsed), headComments(tree)) {
+		t.Errorf("comments moved on round trip:\n%v\nwant\n%v", headComments(reparsed), headComments(tree))
+	}
+	second, err := reparsed.ToYAML()
+	if err != nil {
+		t.Fatalf("ToYAML() error = %v", err)
+	}
+	if string(second) != string(first) {
+		t.Errorf("second round trip =\n%s\nwant\n%s", second, first)
+	}
+
+	t.Run("BlankLineKeepsFootComment", func(t *testing.T) {
+		tree, err := UnmarshalYAML([]byte("items:\n  - a: 1\n    # end of a\n\n  - b: 2\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		tree.FixCommentAttachment()
+		items := tree.Documents[0].Root.Children[0].GetMapValue("items")
+		if len(items.Children[1].HeadComment) != 0 {
+			t.Errorf("HeadComment = %v, want the foot comment left in place", items.Children[1].HeadComment)
+		}
+	})
+}
+
+// TestExtractDocComments tests collecting documentation comments by key path
+func TestExtractDocComments(t *testing.T) {
+	values := `# Default values for the chart.
+
+# -- Number of replicas
+replicaCount: 1
+image:
+  # -- Image repository
+  repository: nginx
+  # Not documented
+  pullPolicy: IfNotPresent
+  # -- Image tag, defaults to
+  # the chart appVersion
+  tag: ""
+servers:
+  - name: api
+    # -- Port of the first server
+    port: 80
+`
+
+	tests := []struct {
+		name   string
+		input  string
+		prefix string
+		want   map[string]string
+	}{
+		{
+			name:   "HelmValues",
+			input:  values,
+			prefix: "# --",
+			want: map[string]string{
+				"$.replicaCount":     "Number of replicas",
+				"$.image.repository": "Image repository",
+				"$.image.tag":        "Image tag, defaults to the chart appVersion",
+				"$.servers[0].port":  "Port of the first server",
+			},
+		},
+		{
+			name:   "SimpleFixture",
+			input:  simpleYAML,
+			prefix: "# --",
+			want:   map[string]string{},
+		},
+		{
+			name:   "ComplexFixture",
+			input:  complexYAML,
+			prefix: "# Settings",
+			want:   map[string]string{"$.app.settings": "section"},
+		},
+		{
+			name:   "AnyComment",
+			input:  complexYAML,
+			prefix: "#",
+			want: map[string]string{
+				"$.app":          "Document header",
+				"$.app.settings": "Settings section",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if got := tree.ExtractDocComments(tt.prefix); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExtractDocComments(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMergeAnnotateOverrides tests recording replaced base values as comments
+func TestMergeAnnotateOverrides(t *testing.T) {
+	base, err := UnmarshalYAML([]byte("# Number of replicas\nreplicaCount: 1\nimage:\n  repository: nginx\n  tag: \"1.0\"\nports: [80]\nregion: eu\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse base: %v", err)
+	}
+	overlay, err := UnmarshalYAML([]byte("replicaCount: 3\nimage:\n  tag: \"2.0\"\nports: [80, 443]\nregion: 'eu'\ningress: true\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse overlay: %v", err)
+	}
+
+	merged := MergeNodesWithOptions(base.Documents[0].Root.Children[0], overlay.Documents[0].Root.Children[0], MergeOptions{AnnotateOverrides: true})
+	keyComments := func(mapping *Node, key string) []string {
+		return mapping.Children[findMapEntry(mapping, key)].HeadComment
+	}
+
+	tests := []struct {
+		name    string
+		mapping *Node
+		key     string
+		want    []string
+	}{
+		{"ScalarOverride", merged, "replicaCount", []string{"# overridden from 1", "# Number of replicas"}},
+		{"NestedOverride", merged.GetMapValue("image"), "tag", []string{"# overridden from 1.0"}},
+		{"SequenceOverride", merged, "ports", []string{"# overridden from [80]"}},
+		{"NestedMappingNotAnnotated", merged, "image", nil},
+		{"UnchangedValue", merged, "region", nil},
+		{"UntouchedKey", merged.GetMapValue("image"), "repository", nil},
+		{"AddedKey", merged, "ingress", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keyComments(tt.mapping, tt.key); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s HeadComment = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+
+	if got := keyComments(base.Documents[0].Root.Children[0], "replicaCount"); len(got) != 1 {
+		t.Errorf("base HeadComment = %q, the inputs should not change", got)
+	}
+
+	t.Run("Encoded", func(t *testing.T) {
+		output, err := MergeTreesWithOptions(base, overlay, MergeOptions{AnnotateOverrides: true}).ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		if !strings.Contains(string(output), "# overridden from 1\n# Number of replicas\nreplicaCount: 3\n") {
+			t.Errorf("output missing the annotation:\n%s", output)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		merged := MergeNodes(base.Documents[0].Root.Children[0], overlay.Documents[0].Root.Children[0])
+		if got := keyComments(merged, "replicaCount"); !reflect.DeepEqual(got, []string{"# Number of replicas"}) {
+			t.Errorf("HeadComment = %q, want no annotation", got)
+		}
+	})
+}
+
+// TestNodeTreeValidate tests checking the structural invariants of a tree
+func TestNodeTreeValidate(t *testing.T) {
+	parse := func(input string) *NodeTree {
+		tree, err := UnmarshalYAML([]byte(input))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		return tree
+	}
+	content := func(tree *NodeTree) *Node {
+		return tree.Documents[0].Root.Children[0]
+	}
+
+	tests := []struct {
+		name    string
+		tree    func() *NodeTree
+		wantErr string
+	}{
+		{
+			name: "ParsedTree",
+			tree: func() *NodeTree { return parse(anchorsYAML) },
+		},
+		{
+			name: "MultiDocument",
+			tree: func() *NodeTree { return parse(multiDocYAML) },
+		},
+		{
+			name: "OddChildMapping",
+			tree: func() *NodeTree {
+				tree := parse("app:\n  name: demo\n")
+				app := content(tree).GetMapValue("app")
+				app.AddChild(NewScalarNode("dangling"))
+				return tree
+			},
+			wantErr: "mapping at $.app has an odd number of children (3)",
+		},
+		{
+			name: "ComplexKey",
+			tree: func() *NodeTree { return parse("? [a, b]\n: 1\n") },
+		},
+		{
+			name: "NonScalarKey",
+			tree: func() *NodeTree {
+				tree := parse("a: 1\n")
+				content(tree).Children[0] = NewSequenceNode()
+				return tree
+			},
+		},
+		{
+			name: "DocumentKey",
+			tree: func() *NodeTree {
+				tree := parse("a: 1\n")
+				content(tree).Children[0] = NewNode(DocumentNode)
+				return tree
+			},
+			wantErr: "mapping key at $ is a DocumentNode, not a scalar or a collection",
+		},
+		{
+			name: "NilKey",
+			tree: func() *NodeTree {
+				tree := parse("a: 1\n")
+				content(tree).Children[0] = nil
+				return tree
+			},
+			wantErr: "nil mapping key at $",
+		},
+		{
+			name: "CyclicReference",
+			tree: func() *NodeTree {
+				tree := parse("items:\n  - a\n")
+				items := content(tree).GetMapValue("items")
+				items.AddChild(content(tree))
+				return tree
+			},
+			wantErr: "cycle at $.items[1]",
+		},
+		{
+			name: "UnresolvedAlias",
+			tree: func() *NodeTree {
+				tree := parse("a: 1\n")
+				content(tree).Children[1] = NewAliasNode("missing")
+				return tree
+			},
+			wantErr: "alias *missing at $.a does not refer to an earlier anchor",
+		},
+		{
+			name: "AliasBeforeAnchor",
+			tree: func() *NodeTree {
+				tree := parse("a: 1\nb: 2\n")
+				content(tree).Children[1] = NewAliasNode("later")
+				content(tree).Children[3].SetAnchor("later")
+				return tree
+			},
+			wantErr: "alias *later at $.a",
+		},
+		{
+			name: "NilChild",
+			tree: func() *NodeTree {
+				tree := parse("- a\n")
+				content(tree).Children = append(content(tree).Children, nil)
+				return tree
+			},
+			wantErr: "nil node at $[1]",
+		},
+		{
+			name: "ScalarWithChildren",
+			tree: func() *NodeTree {
+				tree := parse("a: 1\n")
+				content(tree).Children[1].Children = []*Node{NewScalarNode("x")}
+				return tree
+			},
+			wantErr: "ScalarNode at $.a has 1 children",
+		},
+		{
+			name: "NestedDocument",
+			tree: func() *NodeTree {
+				tree := parse("- a\n")
+				content(tree).AddChild(NewNode(DocumentNode))
+				return tree
+			},
+			wantErr: "document node at $[1] below the document root",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tree().Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestMergeKeyOrder tests the order of keys in merged mappings
+func TestMergeKeyOrder(t *testing.T) {
+	base, err := UnmarshalYAML([]byte("# Service settings\n\nname: api\nport: 80\nimage:\n  tag: v1\n  repository: nginx\ndebug: false\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse base: %v", err)
+	}
+	overlay, err := UnmarshalYAML([]byte("replicas: 3\nimage:\n  pullPolicy: Always\n  tag: v2\nport: 8080\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse overlay: %v", err)
+	}
+
+	keys := func(mapping *Node) []string {
+		var names []string
+		for i := 0; i < len(mapping.Children)-1; i += 2 {
+			names = append(names, fmt.Sprintf("%v", mapping.Children[i].Value))
+		}
+		return names
+	}
+
+	tests := []struct {
+		order     MergeKeyOrder
+		wantRoot  []string
+		wantImage []string
+	}{
+		{KeyOrderBaseFirst, []string{"name", "port", "image", "debug", "replicas"}, []string{"tag", "repository", "pullPolicy"}},
+		{KeyOrderOverlayFirst, []string{"replicas", "image", "port", "name", "debug"}, []string{"pullPolicy", "tag", "repository"}},
+		{KeyOrderAlphabetical, []string{"debug", "image", "name", "port", "replicas"}, []string{"pullPolicy", "repository", "tag"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order.String(), func(t *testing.T) {
+			merged := MergeTreesWithOptions(base, overlay, MergeOptions{KeyOrder: tt.order})
+			root := merged.Documents[0].Root.Children[0]
+			if got := keys(root); !reflect.DeepEqual(got, tt.wantRoot) {
+				t.Errorf("root keys = %v, want %v", got, tt.wantRoot)
+			}
+			if got := keys(root.GetMapValue("image")); !reflect.DeepEqual(got, tt.wantImage) {
+				t.Errorf("image keys = %v, want %v", got, tt.wantImage)
+			}
+			if port, _ := root.GetMapValue("port").AsInt(); port != 8080 {
+				t.Errorf("port = %d, want 8080", port)
+			}
+
+			output, err := merged.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if !strings.HasPrefix(string(output), "# Service settings\n") {
+				t.Errorf("section comment should stay at the top:\n%s", output)
+			}
+		})
+	}
+}
+
+// TestMergeBlankLineBeforeAdded tests spacing keys the overlay adds to a mapping
+func TestMergeBlankLineBeforeAdded(t *testing.T) {
+	base, err := UnmarshalYAML([]byte("app:\n  name: demo\n  port: 80\nlogging: info\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse base: %v", err)
+	}
+	overlay, err := UnmarshalYAML([]byte("app:\n  port: 8080\n  # Region of the deployment\n  region: eu-west-1\n  zone: a\nowner: team-a\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse overlay: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts MergeOptions
+		want string
+	}{
+		{
+			name: "Default",
+			opts: MergeOptions{},
+			want: "app:\n  name: demo\n  port: 8080\n\n  # Region of the deployment\n  region: eu-west-1\n  zone: a\nlogging: info\nowner: team-a\n",
+		},
+		{
+			name: "BlankLineBeforeAdded",
+			opts: MergeOptions{BlankLineBeforeAdded: true},
+			want: "app:\n  name: demo\n  port: 8080\n\n  # Region of the deployment\n  region: eu-west-1\n\n  zone: a\nlogging: info\n\nowner: team-a\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := MergeTreesWithOptions(base, overlay, tt.opts).ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if string(output) != tt.want {
+				t.Errorf("merged =\n%q\nwant\n%q", output, tt.want)
+			}
+		})
+	}
+
+	t.Run("KeepsOverlaySpacing", func(t *testing.T) {
+		spaced, err := UnmarshalYAMLWithEmptyLines([]byte("app:\n  port: 8080\n\n\n  limits:\n    cpu: 1\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse overlay: %v", err)
+		}
+		output, err := MergeTrees(base, spaced).ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		want := "app:\n  name: demo\n  port: 8080\n\n\n  limits:\n    cpu: 1\nlogging: info\n"
+		if string(output) != want {
+			t.Errorf("merged =\n%q\nwant\n%q", output, want)
+		}
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		inputs := []string{
+			"a: 1\n\nb: 2\n",
+			"a:\n  x: 1\n\n  y: 2\n\nb: [1]\n\nc: {d: 1}\n",
+			"# Header\n\nkey: value\n",
+		}
+		for _, input := range inputs {
+			tree, err := UnmarshalYAMLWithEmptyLines([]byte(input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			output, err := tree.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if string(output) != input {
+				t.Errorf("ToYAML() =\n%q\nwant\n%q", output, input)
+			}
+		}
+	})
+
+	t.Run("FirstKeyOfNewMapping", func(t *testing.T) {
+		empty := &NodeTree{Documents: []*Document{{Root: &Node{Kind: DocumentNode, Children: []*Node{NewMappingNode()}}}}}
+		output, err := MergeTreesWithOptions(empty, overlay, MergeOptions{BlankLineBeforeAdded: true}).ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML() error = %v", err)
+		}
+		if strings.HasPrefix(string(output), "\n") {
+			t.Errorf("the first key of a mapping should not be preceded by an empty line:\n%s", output)
+		}
+	})
+}
+
+// TestMultilineLineComment tests writing line comments that span several lines
+func TestMultilineLineComment(t *testing.T) {
+	input := "script: |\n  echo one\n  echo two\nports:\n  - 80\n  - 443\nserver:\n  host: localhost\nname: demo\n"
+
+	tests := []struct {
+		name    string
+		node    func(content *Node) *Node
+		comment string
+		want    []string
+	}{
+		{"BlockScalar", func(c *Node) *Node { return c.GetMapValue("script") }, "# first\n# second", []string{"# first", "# second"}},
+		{"SequenceItem", func(c *Node) *Node { return c.GetMapValue("ports").Children[0] }, "# http\n# plain text", []string{"# http", "# plain text"}},
+		{"MappingKey", func(c *Node) *Node { return c.Children[4] }, "# server\n# settings", []string{"# server", "# settings"}},
+		{"MissingHashAndBlankLines", func(c *Node) *Node { return c.GetMapValue("name") }, "# app\r\n\n  name of the app\n", []string{"# app", "# name of the app"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			original := tree.Clone()
+			tt.node(tree.Documents[0].Root.Children[0]).LineComment = tt.comment
+
+			output, err := tree.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(string(output), line) {
+					t.Errorf("output should contain %q:\n%s", line, output)
+				}
+			}
+
+			reparsed, err := UnmarshalYAML(output)
+			if err != nil {
+				t.Fatalf("output is not valid YAML: %v\n%s", err, output)
+			}
+			if !reparsed.Equal(original, EqualOptions{IgnoreComments: true}) {
+				t.Errorf("round trip changed the data:\n%s", output)
+			}
+			if got := tt.node(reparsed.Documents[0].Root.Children[0]).LineComment; got != tt.want[0] {
+				t.Errorf("LineComment after round trip = %q, want %q", got, tt.want[0])
+			}
+		})
+	}
+
+	t.Run("SingleLine", func(t *testing.T) {
+		line, rest := splitLineComment("# only")
+		if line != "# only" || rest != nil {
+			t.Errorf("splitLineComment() = %q, %v", line, rest)
+		}
+	})
+}
+
+// failingReader returns an error after its content has been read
+type failingReader struct {
+	content *strings.Reader
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.content.Len() == 0 {
+		return 0, fmt.Errorf("connection reset")
+	}
+	return r.content.Read(p)
+}
+
+// TestUnmarshalYAMLReader tests parsing YAML from an io.Reader
+func TestUnmarshalYAMLReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"Simple", simpleYAML},
+		{"Complex", complexYAML},
+		{"MultiDocument", multiDocYAML},
+		{"Anchors", anchorsYAML},
+		{"CommentsOnly", emptyYAML},
+		{"HeadersOnly", headersOnlyYAML},
+		{"Empty", ""},
+		{"MarkersOnly", "---\n...\n"},
+		{"NoFinalNewline", "a: 1\n---\nb: 2"},
+		{"EmptyDocuments", "---\n---\na: 1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("UnmarshalYAML() error = %v", err)
+			}
+			got, err := UnmarshalYAMLReader(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("UnmarshalYAMLReader() error = %v", err)
+			}
+
+			if len(got.Documents) != len(want.Documents) {
+				t.Fatalf("UnmarshalYAMLReader() returned %d documents, want %d", len(got.Documents), len(want.Documents))
+			}
+			if !got.Equal(want, EqualOptions{}) {
+				t.Error("UnmarshalYAMLReader() tree differs from UnmarshalYAML()")
+			}
+
+			gotYAML, _ := got.ToYAML()
+			wantYAML, _ := want.ToYAML()
+			if string(gotYAML) != string(wantYAML) {
+				t.Errorf("ToYAML() = %q, want %q", gotYAML, wantYAML)
+			}
+		})
+	}
+
+	t.Run("ReadError", func(t *testing.T) {
+		_, err := UnmarshalYAMLReader(&failingReader{content: strings.NewReader("a: 1\n")})
+		if err == nil || !strings.Contains(err.Error(), "connection reset") {
+			t.Errorf("UnmarshalYAMLReader() error = %v, want the read error", err)
+		}
+	})
+
+	t.Run("ParseError", func(t *testing.T) {
+		if _, err := UnmarshalYAMLReader(strings.NewReader(invalidYAML)); err == nil {
+			t.Error("UnmarshalYAMLReader() should return a parse error")
+		}
+	})
+}
+
+// failingWriter accepts limit bytes and then returns an error
+type failingWriter struct {
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, fmt.Errorf("disk full")
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+// TestWriteYAML tests streaming serialized output to an io.Writer
+func TestWriteYAML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"Simple", simpleYAML},
+		{"Complex", complexYAML},
+		{"MultiDocument", multiDocYAML},
+		{"HeadersOnly", headersOnlyYAML},
+		{"Empty", ""},
+		{"EmptyFirstDocument", "---\n---\na: 1\n"},
+		{"CommentBlocks", "a: 1\n# section\nb: 2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAMLWithOptions([]byte(tt.input), ParseOptions{KeepEmptyDocuments: true})
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+
+			want, err := tree.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			var buf bytes.Buffer
+			if err := tree.WriteYAML(&buf); err != nil {
+				t.Fatalf("WriteYAML() error = %v", err)
+			}
+			if buf.String() != string(want) {
+				t.Errorf("WriteYAML() = %q, want %q", buf.String(), want)
+			}
+		})
+	}
+
+	t.Run("WriteError", func(t *testing.T) {
+		tree, _ := UnmarshalYAML([]byte(multiDocYAML))
+		err := tree.WriteYAML(&failingWriter{limit: 4})
+		if err == nil || !strings.Contains(err.Error(), "disk full") {
+			t.Errorf("WriteYAML() error = %v, want the write error", err)
+		}
+	})
+}
+
+// TestDocumentEndMarker tests preserving explicit ... document end markers
+func TestDocumentEndMarker(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantEnded []bool
+		want      string
+	}{
+		{
+			name:      "SingleDocument",
+			input:     "---\nkey: v\n...",
+			wantEnded: []bool{true},
+			want:      "key: v\n...\n",
+		},
+		{
+			name:      "MixedDocuments",
+			input:     "a: 1\n...\n---\nb: 2\n---\nc: 3\n...\n",
+			wantEnded: []bool{true, false, true},
+			want:      "a: 1\n...\n---\nb: 2\n---\nc: 3\n...\n",
+		},
+		{
+			name:      "NoMarkers",
+			input:     "a: 1\n---\nb: 2\n",
+			wantEnded: []bool{false, false},
+			want:      "a: 1\n---\nb: 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if len(tree.Documents) != len(tt.wantEnded) {
+				t.Fatalf("parsed %d documents, want %d", len(tree.Documents), len(tt.wantEnded))
+			}
+			for i, doc := range tree.Documents {
+				if doc.ExplicitEnd != tt.wantEnded[i] {
+					t.Errorf("document %d ExplicitEnd = %v, want %v", i, doc.ExplicitEnd, tt.wantEnded[i])
+				}
+			}
+
+			output, err := tree.ToYAML()
+			if err != nil {
+				t.Fatalf("ToYAML() error = %v", err)
+			}
+			if string(output) != tt.want {
+				t.Errorf("ToYAML() = %q, want %q", output, tt.want)
+			}
+
+			streamed, err := UnmarshalYAMLReader(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("UnmarshalYAMLReader() error = %v", err)
+			}
+			if streamedOutput, _ := streamed.ToYAML(); string(streamedOutput) != tt.want {
+				t.Errorf("UnmarshalYAMLReader() round trip = %q, want %q", streamedOutput, tt.want)
+			}
+			if clone, _ := tree.Clone().ToYAML(); string(clone) != tt.want {
+				t.Errorf("Clone() round trip = %q, want %q", clone, tt.want)
+			}
+		})
+	}
+
+	t.Run("StreamParser", func(t *testing.T) {
+		var ended []bool
+		parser := NewStreamParser(strings.NewReader("a: 1\n...\n---\nb: 2\n"))
+		parser.SetDocumentCallback(func(tree *NodeTree) error {
+			ended = append(ended, tree.Documents[0].ExplicitEnd)
+			return nil
+		})
+		if err := parser.Parse(); err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		if !reflect.DeepEqual(ended, []bool{true, false}) {
+			t.Errorf("ExplicitEnd = %v, want [true false]", ended)
+		}
+	})
+}
+
+// TestNodeTreeCursor tests walking a tree with Enter, Exit and Value
+func TestNodeTreeCursor(t *testing.T) {
+	input := "app:\n  name: demo\n  ports:\n    - 80\n    - 443\n  env:\n    debug: true\n"
+	tree, err := UnmarshalYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	if root := tree.Value(); root == nil || root.Kind != MappingNode {
+		t.Fatalf("Value() = %v, want the root mapping", root)
+	}
+
+	for _, key := range []string{"app", "env", "debug"} {
+		if err := tree.Enter(key); err != nil {
+			t.Fatalf("Enter(%q) error = %v", key, err)
+		}
+	}
+	if value, _ := tree.Value().AsBool(); !value {
+		t.Errorf("Value() = %v, want true", tree.Value().Value)
+	}
+
+	if err := tree.Exit(); err != nil {
+		t.Fatalf("Exit() error = %v", err)
+	}
+	if err := tree.Exit(); err != nil {
+		t.Fatalf("Exit() error = %v", err)
+	}
+	if path := tree.Value().Path(); path != "$.app" {
+		t.Errorf("Value() after Exit is at %s, want $.app", path)
+	}
+
+	if err := tree.Enter("ports"); err != nil {
+		t.Fatalf("Enter(ports) error = %v", err)
+	}
+	if err := tree.Enter("1"); err != nil {
+		t.Fatalf("Enter(1) error = %v", err)
+	}
+	if port, _ := tree.Value().AsInt(); port != 443 {
+		t.Errorf("Value() = %v, want 443", tree.Value().Value)
+	}
+
+	t.Run("IntoScalar", func(t *testing.T) {
+		if err := tree.Enter("x"); err == nil {
+			t.Error("Enter() on a scalar should fail")
+		}
+	})
+
+	t.Run("MissingKeyKeepsPosition", func(t *testing.T) {
+		tree.Exit()
+		tree.Exit()
+		if err := tree.Enter("missing"); err == nil {
+			t.Error("Enter(missing) should fail")
+		}
+		if path := tree.Value().Path(); path != "$.app" {
+			t.Errorf("cursor moved to %s after a failed Enter, want $.app", path)
+		}
+	})
+
+	t.Run("SequenceNeedsIndex", func(t *testing.T) {
+		tree.Enter("ports")
+		for _, key := range []string{"first", "2", "-1"} {
+			if err := tree.Enter(key); err == nil {
+				t.Errorf("Enter(%q) on a sequence should fail", key)
+			}
+		}
+	})
+
+	t.Run("ExitAtRoot", func(t *testing.T) {
+		tree.Exit()
+		if err := tree.Exit(); err != nil {
+			t.Fatalf("Exit() error = %v", err)
+		}
+		if tree.Value().Kind != MappingNode || tree.Value().GetMapValue("app") == nil {
+			t.Error("cursor should be back at the root mapping")
+		}
+		if err := tree.Exit(); err == nil {
+			t.Error("Exit() at the root should fail")
+		}
+	})
+
+	t.Run("EmptyTree", func(t *testing.T) {
+		empty := NewNodeTree()
+		if empty.Value() != nil {
+			t.Error("Value() of an empty tree should be nil")
+		}
+		if err := empty.Enter("a"); err == nil {
+			t.Error("Enter() on an empty tree should fail")
+		}
+	})
+}
+
+// TestMergeAndDiff tests merging trees and reporting what the overlay changed
+func TestMergeAndDiff(t *testing.T) {
+	base, err := UnmarshalYAML([]byte("# app settings\napp:\n  name: demo # the name\n  replicas: 1\n  tags: [a, b]\nlegacy: true\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse base: %v", err)
+	}
+	overlay, err := UnmarshalYAML([]byte("app:\n  replicas: 3\n  image: demo:2\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse overlay: %v", err)
+	}
+	baseYAML, _ := base.ToYAML()
+
+	merged, diffs := MergeAndDiff(base, overlay)
+
+	output, err := merged.ToYAML()
+	if err != nil {
+		t.Fatalf("ToYAML() error = %v", err)
+	}
+	want := "# app settings\napp:\n  name: demo # the name\n  replicas: 3\n  tags: [a, b]\n  image: demo:2\nlegacy: true\n"
+	if string(output) != want {
+		t.Errorf("merged =\n%s\nwant\n%s", output, want)
+	}
+
+	got := make(map[string]DiffType)
+	for _, diff := range diffs {
+		got[diff.Path] = diff.Type
+	}
+	wantDiffs := map[string]DiffType{
+		"$[document:0].app.replicas": DiffModified,
+		"$[document:0].app.image":    DiffAdded,
+	}
+	if !reflect.DeepEqual(got, wantDiffs) {
+		t.Errorf("MergeAndDiff() diffs = %v, want %v", got, wantDiffs)
+	}
+
+	inMerged := make(map[*Node]bool)
+	merged.Documents[0].Root.Walk(func(node *Node) bool {
+		inMerged[node] = true
+		return true
+	})
+	for _, diff := range diffs {
+		if !inMerged[diff.NewNode] {
+			t.Errorf("diff at %s has a NewNode outside the merged tree", diff.Path)
+		}
+	}
+
+	if after, _ := base.ToYAML(); string(after) != string(baseYAML) {
+		t.Error("MergeAndDiff() modified the base tree")
+	}
+
+	t.Run("EmptyOverlay", func(t *testing.T) {
+		merged, diffs := MergeAndDiff(base, NewNodeTree())
+		if len(diffs) != 0 {
+			t.Errorf("MergeAndDiff() with an empty overlay returned diffs %v", diffs)
+		}
+		if !merged.Equal(base, EqualOptions{}) {
+			t.Error("merging an empty overlay should keep the base content")
+		}
+	})
+}
+
+// TestUnmarshalYAMLStrict tests rejecting duplicate mapping keys
+func TestUnmarshalYAMLStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name:  "Clean",
+			input: "app:\n  name: demo\n  port: 80\nitems:\n  - name: a\n  - name: b\n",
+		},
+		{
+			name:  "Empty",
+			input: "",
+		},
+		{
+			name:    "TopLevel",
+			input:   "name: a\nport: 80\nname: b\n",
+			wantErr: `document 0: duplicate key "name" at line 3, first defined at line 1`,
+		},
+		{
+			name:    "Nested",
+			input:   "app:\n  port: 80\n  debug: true\n  port: 81\n",
+			wantErr: `document 0: duplicate key "port" at line 4, first defined at line 2`,
+		},
+		{
+			name:    "InSequenceItem",
+			input:   "items:\n  - id: 1\n    id: 2\n",
+			wantErr: `duplicate key "id" at line 3, first defined at line 2`,
+		},
+		{
+			name:    "LaterDocument",
+			input:   "a: 1\n---\nb: 1\nb: 2\n",
+			wantErr: `document 1: duplicate key "b"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := UnmarshalYAMLStrict([]byte(tt.input))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("UnmarshalYAMLStrict() error = %v", err)
+				}
+				want, _ := UnmarshalYAML([]byte(tt.input))
+				if !tree.Equal(want, EqualOptions{}) {
+					t.Error("UnmarshalYAMLStrict() tree differs from UnmarshalYAML()")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("UnmarshalYAMLStrict() error = %v, want %q", err, tt.wantErr)
+			}
+			if _, err := UnmarshalYAML([]byte(tt.input)); err != nil {
+				t.Errorf("UnmarshalYAML() should accept duplicate keys, got %v", err)
+			}
+		})
+	}
+}
+
 // Benchmark tests
 func BenchmarkUnmarshalYAML(b *testing.B) {
 	data := []byte(complexYAML)